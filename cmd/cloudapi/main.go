@@ -14,11 +14,25 @@ import (
 
 func main() {
 	cfg := cloudapp.LoadConfig()
-	app := cloudapp.Wire(cfg, nil)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	db, err := cloudapp.OpenDatabase(ctx, cfg)
+	if err != nil {
+		log.Fatalf("failed to open database: %v", err)
+	}
+	if db != nil {
+		defer db.Close()
+	}
+
+	blobStore, err := cloudapp.OpenBlobStore(cfg)
+	if err != nil {
+		log.Fatalf("failed to open blob store: %v", err)
+	}
+
+	app := cloudapp.Wire(cfg, &cloudapp.WireOptions{DB: db, BlobStore: blobStore})
+
 	if err := app.SubscribeEventualConsistencyCheck(ctx); err != nil {
 		log.Fatalf("failed to subscribe to syncconsistencycheck: %v", err)
 	}
@@ -35,8 +49,16 @@ func main() {
 		}
 	}()
 
-	go runQueueProcessor(ctx, app, cfg.QueueTickInterval)
+	queueDone := make(chan struct{})
+	go func() {
+		app.Queue.Run(ctx, cfg.QueueTickInterval)
+		close(queueDone)
+	}()
+	if app.OutboxRelay != nil {
+		go runOutboxRelay(ctx, app, cfg.OutboxRelayInterval)
+	}
 	go runPeriodicScanner(ctx, app, cfg.ScanInterval)
+	go runObjectGC(ctx, app, cfg.GCInterval)
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
@@ -51,10 +73,21 @@ func main() {
 	if err := server.Shutdown(shutdownCtx); err != nil {
 		log.Printf("server shutdown error: %v", err)
 	}
+	waitForQueue(shutdownCtx, queueDone)
 	log.Println("shutdown complete")
 }
 
-func runQueueProcessor(ctx context.Context, app *cloudapp.App, interval time.Duration) {
+// waitForQueue waits for the queue to finish its handlers in flight, or
+// gives up when ctx is done.
+func waitForQueue(ctx context.Context, done <-chan struct{}) {
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Println("gave up waiting for queue handlers in flight")
+	}
+}
+
+func runOutboxRelay(ctx context.Context, app *cloudapp.App, interval time.Duration) {
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
@@ -63,7 +96,9 @@ func runQueueProcessor(ctx context.Context, app *cloudapp.App, interval time.Dur
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			app.Queue.Tick(ctx)
+			if _, err := app.OutboxRelay.Relay(ctx); err != nil {
+				log.Printf("outbox relay error: %v", err)
+			}
 		}
 	}
 }
@@ -83,3 +118,36 @@ func runPeriodicScanner(ctx context.Context, app *cloudapp.App, interval time.Du
 		}
 	}
 }
+
+func runObjectGC(ctx context.Context, app *cloudapp.App, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := app.ObjectGarbageCollector.Collect(ctx)
+			if err != nil {
+				log.Printf("object gc error: %v", err)
+			}
+			if purged > 0 {
+				log.Printf("object gc purged %d superseded blobs", purged)
+			}
+			expired, err := app.UploadSessionService.ExpireStale(ctx)
+			if err != nil {
+				log.Printf("upload session expiry error: %v", err)
+			}
+			if expired > 0 {
+				log.Printf("expired %d stale upload sessions", expired)
+			}
+			if _, err := app.IdempotencyService.ExpireStale(ctx); err != nil {
+				log.Printf("idempotency key expiry error: %v", err)
+			}
+			if _, err := app.MessageDeduplicator.ExpireStale(ctx); err != nil {
+				log.Printf("processed message expiry error: %v", err)
+			}
+		}
+	}
+}
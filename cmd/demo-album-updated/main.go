@@ -129,7 +129,6 @@ func main() {
 		CloudClient:        cloudClient,
 		StagingStorage:     stagingStorage,
 		MediaVaultRegistry: mediaVaultRegistryProxy,
-		MaxRetries:         1,
 	}
 	onpremApp := onpremapp.Wire(onpremCfg, onpremOpts)
 
@@ -254,7 +253,7 @@ func main() {
 	printCodeRef("eventual_consistency.go")
 	fmt.Println()
 
-	eventualConsistencyWorker := services.NewEventualConsistencyWorker(cloud.AlbumRepo, queue, clock)
+	eventualConsistencyWorker := services.NewEventualConsistencyWorker(cloud.AlbumRepo, cloud.AlbumVideoRepo, cloud.ObjectRepo, cloud.DeadLetterRepo, queue, clock, time.Hour)
 
 	fmt.Println("Running worker.Scan()...")
 	eventualConsistencyWorker.Scan(ctx)
@@ -275,10 +274,8 @@ func main() {
 	fmt.Printf("  %sexpected: videoupload + syncconsistencycheck (scheduled retry)%s\n", colorDim, colorReset)
 	fmt.Println()
 
-	fmt.Println("Processing videoupload (CMove sends all 4 again)...")
+	fmt.Println("Processing videoupload (CMove sends only the 2 added videos)...")
 	fmt.Printf("%sExpected behavior:%s\n", colorDim, colorReset)
-	fmt.Printf("  %s•%s vid-001: already exists → %supserted%s\n", colorGreen, colorReset, colorGreen, colorReset)
-	fmt.Printf("  %s•%s vid-002: already exists → %supserted%s\n", colorGreen, colorReset, colorGreen, colorReset)
 	fmt.Printf("  %s•%s vid-003: now in manifest → %saccepted%s\n", colorGreen, colorReset, colorGreen, colorReset)
 	fmt.Printf("  %s•%s vid-004: now in manifest → %saccepted%s\n", colorGreen, colorReset, colorGreen, colorReset)
 	fmt.Println()
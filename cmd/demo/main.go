@@ -155,7 +155,6 @@ func main() {
 		CloudClient:        cloudClient,
 		StagingStorage:     stagingStorage,
 		MediaVaultRegistry: mediaVaultRegistryProxy,
-		MaxRetries:         1,
 	}
 	onpremApp := onpremapp.Wire(onpremCfg, onpremOpts)
 
@@ -19,11 +19,19 @@ func main() {
 		log.Fatal("PROVIDER_ID environment variable is required")
 	}
 
-	app := onpremapp.Wire(cfg, nil)
-
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	db, err := onpremapp.OpenDatabase(ctx, cfg)
+	if err != nil {
+		log.Fatalf("failed to open database: %v", err)
+	}
+	if db != nil {
+		defer db.Close()
+	}
+
+	app := onpremapp.Wire(cfg, &onpremapp.WireOptions{DB: db})
+
 	if err := app.SubscribeAll(ctx); err != nil {
 		log.Fatalf("failed to subscribe to topics: %v", err)
 	}
@@ -40,7 +48,12 @@ func main() {
 		}
 	}()
 
-	go runQueueProcessor(ctx, app, cfg.QueueTickInterval)
+	queueDone := make(chan struct{})
+	go func() {
+		app.Queue.Run(ctx, cfg.QueueTickInterval)
+		close(queueDone)
+	}()
+	go runProcessedMessageExpiry(ctx, app, time.Hour)
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
@@ -52,13 +65,25 @@ func main() {
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer shutdownCancel()
 
+	// handlers in flight may still send videos to the receiver, so it stops last
+	waitForQueue(shutdownCtx, queueDone)
 	if err := server.Shutdown(shutdownCtx); err != nil {
 		log.Printf("server shutdown error: %v", err)
 	}
 	log.Println("shutdown complete")
 }
 
-func runQueueProcessor(ctx context.Context, app *onpremapp.App, interval time.Duration) {
+// waitForQueue waits for the queue to finish its handlers in flight, or
+// gives up when ctx is done.
+func waitForQueue(ctx context.Context, done <-chan struct{}) {
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Println("gave up waiting for queue handlers in flight")
+	}
+}
+
+func runProcessedMessageExpiry(ctx context.Context, app *onpremapp.App, interval time.Duration) {
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
@@ -67,7 +92,9 @@ func runQueueProcessor(ctx context.Context, app *onpremapp.App, interval time.Du
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			app.Queue.Tick(ctx)
+			if _, err := app.MessageDeduplicator.ExpireStale(ctx); err != nil {
+				log.Printf("processed message expiry error: %v", err)
+			}
 		}
 	}
 }
@@ -0,0 +1,199 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+type DeadLetterHandler struct {
+	service *services.DeadLetterService
+}
+
+func NewDeadLetterHandler(service *services.DeadLetterService) *DeadLetterHandler {
+	return &DeadLetterHandler{service: service}
+}
+
+type deadLetterResponse struct {
+	ID         string            `json:"id"`
+	MessageID  string            `json:"messageID"`
+	Topic      string            `json:"topic"`
+	ProviderID string            `json:"providerID"`
+	Payload    json.RawMessage   `json:"payload"`
+	Metadata   map[string]string `json:"metadata"`
+	Attempts   int               `json:"attempts"`
+	LastError  string            `json:"lastError"`
+	CreatedAt  time.Time         `json:"createdAt"`
+}
+
+type purgeResponse struct {
+	Purged int `json:"purged"`
+}
+
+func toDeadLetterResponse(dl *services.DeadLetter) deadLetterResponse {
+	payload := json.RawMessage(dl.Message.Payload)
+	if !json.Valid(payload) {
+		payload, _ = json.Marshal(dl.Message.Payload)
+	}
+	return deadLetterResponse{
+		ID:         dl.ID,
+		MessageID:  dl.Message.MessageID,
+		Topic:      dl.Topic,
+		ProviderID: dl.ProviderID,
+		Payload:    payload,
+		Metadata:   dl.Message.Metadata,
+		Attempts:   dl.Attempts,
+		LastError:  dl.LastError,
+		CreatedAt:  dl.CreatedAt,
+	}
+}
+
+// ServeHTTP routes:
+//
+//	GET    /v1/deadletters             list (topic, providerID, before, limit)
+//	DELETE /v1/deadletters             purge (topic, providerID, before)
+//	GET    /v1/deadletters/{id}        inspect
+//	DELETE /v1/deadletters/{id}        delete
+//	POST   /v1/deadletters/{id}/replay republish and delete
+func (h *DeadLetterHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	prefix := "/v1/deadletters"
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/")
+
+	if rest == "" {
+		switch r.Method {
+		case http.MethodGet:
+			h.handleList(w, r)
+		case http.MethodDelete:
+			h.handlePurge(w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	id, action, _ := strings.Cut(rest, "/")
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		h.handleGet(w, r, id)
+	case action == "" && r.Method == http.MethodDelete:
+		h.handleDelete(w, r, id)
+	case action == "replay" && r.Method == http.MethodPost:
+		h.handleReplay(w, r, id)
+	case action == "" || action == "replay":
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.Error(w, "not found", http.StatusNotFound)
+	}
+}
+
+func (h *DeadLetterHandler) parseFilter(r *http.Request) (services.DeadLetterFilter, error) {
+	query := r.URL.Query()
+	filter := services.DeadLetterFilter{
+		Topic:      query.Get("topic"),
+		ProviderID: query.Get("providerID"),
+	}
+
+	if before := query.Get("before"); before != "" {
+		t, err := time.Parse(time.RFC3339, before)
+		if err != nil {
+			return filter, errors.New("invalid before, expected RFC3339")
+		}
+		filter.CreatedBefore = t
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			return filter, errors.New("invalid limit")
+		}
+		filter.Limit = n
+	}
+
+	return filter, nil
+}
+
+func (h *DeadLetterHandler) handleList(w http.ResponseWriter, r *http.Request) {
+	filter, err := h.parseFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	deadLetters, err := h.service.List(r.Context(), filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]deadLetterResponse, len(deadLetters))
+	for i, dl := range deadLetters {
+		resp[i] = toDeadLetterResponse(dl)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *DeadLetterHandler) handlePurge(w http.ResponseWriter, r *http.Request) {
+	filter, err := h.parseFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter.Limit = 0
+
+	purged, err := h.service.Purge(r.Context(), filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, purgeResponse{Purged: purged})
+}
+
+func (h *DeadLetterHandler) handleGet(w http.ResponseWriter, r *http.Request, id string) {
+	dl, err := h.service.Get(r.Context(), id)
+	if errors.Is(err, services.ErrDeadLetterNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, toDeadLetterResponse(dl))
+}
+
+func (h *DeadLetterHandler) handleDelete(w http.ResponseWriter, r *http.Request, id string) {
+	err := h.service.Delete(r.Context(), id)
+	if errors.Is(err, services.ErrDeadLetterNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *DeadLetterHandler) handleReplay(w http.ResponseWriter, r *http.Request, id string) {
+	err := h.service.Replay(r.Context(), id)
+	if errors.Is(err, services.ErrDeadLetterNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
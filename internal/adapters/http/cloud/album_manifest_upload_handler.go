@@ -18,22 +18,22 @@ func NewAlbumManifestUploadHandler(service *services.AlbumManifestUploadService)
 
 func (h *AlbumManifestUploadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		writeErrorMessage(w, http.StatusMethodNotAllowed, "method not allowed")
 		return
 	}
 
 	var req services.AlbumManifestUploadRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+		writeErrorMessage(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
 
 	if err := h.service.ProcessAlbumManifestUpload(r.Context(), req); err != nil {
 		if errors.Is(err, services.ErrUserIDMismatch) {
-			http.Error(w, err.Error(), http.StatusConflict)
+			writeError(w, http.StatusConflict, err)
 			return
 		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, err)
 		return
 	}
 
@@ -0,0 +1,137 @@
+package cloud
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/media-vault-sync/internal/core/domain"
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+type AlbumStatusHandler struct {
+	service *services.AlbumStatusService
+}
+
+func NewAlbumStatusHandler(service *services.AlbumStatusService) *AlbumStatusHandler {
+	return &AlbumStatusHandler{service: service}
+}
+
+type albumStatusResponse struct {
+	ProviderID       string                     `json:"providerID"`
+	DatabaseID       string                     `json:"databaseID"`
+	AlbumUID         string                     `json:"albumUID"`
+	UserID           string                     `json:"userID"`
+	Synced           bool                       `json:"synced"`
+	CreatedAt        time.Time                  `json:"createdAt"`
+	UpdatedAt        time.Time                  `json:"updatedAt"`
+	ManifestSize     int                        `json:"manifestSize"`
+	UploadedCount    int                        `json:"uploadedCount"`
+	MissingVideoUIDs []string                   `json:"missingVideoUIDs"`
+	Videos           []albumVideoStatusResponse `json:"videos"`
+}
+
+type albumVideoStatusResponse struct {
+	VideoUID string          `json:"videoUID"`
+	Object   *objectResponse `json:"object"`
+}
+
+type objectResponse struct {
+	UID          string     `json:"uid"`
+	VideoUID     string     `json:"videoUID"`
+	Version      int        `json:"version"`
+	StorageKey   string     `json:"storageKey"`
+	SizeBytes    int64      `json:"sizeBytes"`
+	Checksum     string     `json:"checksum"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	SupersededAt *time.Time `json:"supersededAt,omitempty"`
+	PurgedAt     *time.Time `json:"purgedAt,omitempty"`
+}
+
+func toObjectResponse(object *domain.Object) *objectResponse {
+	return &objectResponse{
+		UID:          object.UID,
+		VideoUID:     object.VideoUID,
+		Version:      object.Version,
+		StorageKey:   object.StorageKey,
+		SizeBytes:    object.SizeBytes,
+		Checksum:     object.Checksum,
+		CreatedAt:    object.CreatedAt,
+		SupersededAt: object.SupersededAt,
+		PurgedAt:     object.PurgedAt,
+	}
+}
+
+func toAlbumStatusResponse(status *services.AlbumStatus) albumStatusResponse {
+	resp := albumStatusResponse{
+		ProviderID:       status.Album.ProviderID,
+		DatabaseID:       status.Album.DatabaseID,
+		AlbumUID:         status.Album.AlbumUID,
+		UserID:           status.Album.UserID,
+		Synced:           status.Album.Synced,
+		CreatedAt:        status.Album.CreatedAt,
+		UpdatedAt:        status.Album.UpdatedAt,
+		ManifestSize:     status.ManifestSize,
+		UploadedCount:    status.UploadedCount,
+		MissingVideoUIDs: status.MissingVideoUIDs,
+		Videos:           make([]albumVideoStatusResponse, len(status.Videos)),
+	}
+	for i, video := range status.Videos {
+		resp.Videos[i].VideoUID = video.VideoUID
+		if video.Object != nil {
+			resp.Videos[i].Object = toObjectResponse(video.Object)
+		}
+	}
+	return resp
+}
+
+// parseProviderPath splits /v1/providers/{providerID}/databases/{databaseID}/{rest}.
+func parseProviderPath(path string) (providerID, databaseID, rest string, ok bool) {
+	rest, ok = strings.CutPrefix(path, "/v1/providers/")
+	if !ok {
+		return "", "", "", false
+	}
+	providerID, rest, ok = strings.Cut(rest, "/databases/")
+	if !ok || providerID == "" || strings.Contains(providerID, "/") {
+		return "", "", "", false
+	}
+	databaseID, rest, _ = strings.Cut(rest, "/")
+	if databaseID == "" {
+		return "", "", "", false
+	}
+	return providerID, databaseID, strings.Trim(rest, "/"), true
+}
+
+// ServeHTTP routes:
+//
+//	GET /v1/providers/{providerID}/databases/{databaseID}/albums/{albumUID} sync status and progress
+func (h *AlbumStatusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeErrorMessage(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	providerID, databaseID, rest, ok := parseProviderPath(r.URL.Path)
+	if !ok {
+		writeErrorMessage(w, http.StatusBadRequest, "invalid path")
+		return
+	}
+	albumUID, ok := strings.CutPrefix(rest, "albums/")
+	if !ok || albumUID == "" || strings.Contains(albumUID, "/") {
+		writeErrorMessage(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	status, err := h.service.GetStatus(r.Context(), providerID, databaseID, albumUID)
+	if errors.Is(err, services.ErrAlbumNotFound) {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, toAlbumStatusResponse(status))
+}
@@ -0,0 +1,39 @@
+package cloud
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+// writeError answers with a services.APIError body. The code is the one of
+// the sentinel err wraps, or else follows from status. A server error is
+// logged and answered with the status text only, since its message may
+// carry internals such as SQL or storage paths.
+func writeError(w http.ResponseWriter, status int, err error) {
+	apiErr := services.NewAPIError(err, errorCodeFor(status))
+	if status >= http.StatusInternalServerError {
+		log.Printf("answering %d: %v", status, err)
+		apiErr.Message = http.StatusText(status)
+	}
+	writeJSON(w, status, apiErr)
+}
+
+func writeErrorMessage(w http.ResponseWriter, status int, message string) {
+	writeError(w, status, errors.New(message))
+}
+
+func errorCodeFor(status int) string {
+	switch {
+	case status == http.StatusNotFound:
+		return services.ErrorCodeNotFound
+	case status == http.StatusMethodNotAllowed:
+		return services.ErrorCodeMethodNotAllowed
+	case status >= http.StatusInternalServerError:
+		return services.ErrorCodeInternal
+	default:
+		return services.ErrorCodeInvalidRequest
+	}
+}
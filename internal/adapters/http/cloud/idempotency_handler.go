@@ -0,0 +1,87 @@
+package cloud
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// set on responses that replay an earlier request instead of running it
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+)
+
+// IdempotencyHandler runs a write endpoint at most once per Idempotency-Key:
+// a request repeating a key that already succeeded gets the stored status
+// back without reaching next. Requests without the header pass through.
+type IdempotencyHandler struct {
+	service *services.IdempotencyService
+	next    http.Handler
+}
+
+func NewIdempotencyHandler(service *services.IdempotencyService, next http.Handler) *IdempotencyHandler {
+	return &IdempotencyHandler{service: service, next: next}
+}
+
+func (h *IdempotencyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get(IdempotencyKeyHeader)
+	if key == "" || r.Method != http.MethodPost {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		writeErrorMessage(w, http.StatusBadRequest, "idempotency key too long")
+		return
+	}
+
+	// the same key may be used against different endpoints
+	scope := r.Method + " " + r.URL.Path
+	status, err := h.service.Begin(r.Context(), scope, key)
+	if errors.Is(err, services.ErrIdempotencyKeyInUse) {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if status != 0 {
+		w.Header().Set(IdempotentReplayedHeader, "true")
+		w.WriteHeader(status)
+		return
+	}
+
+	recorder := &statusRecorder{ResponseWriter: w}
+	h.next.ServeHTTP(recorder, r)
+	if recorder.status == 0 {
+		recorder.status = http.StatusOK
+	}
+
+	// the client may have given up waiting, which is when its retry needs the
+	// outcome most; if it cannot be stored the retry runs the request again
+	h.service.Finish(context.WithoutCancel(r.Context()), scope, key, recorder.status)
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,234 @@
+package cloud
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+type ListingHandler struct {
+	service *services.ListingService
+}
+
+func NewListingHandler(service *services.ListingService) *ListingHandler {
+	return &ListingHandler{service: service}
+}
+
+type albumResponse struct {
+	ProviderID string    `json:"providerID"`
+	DatabaseID string    `json:"databaseID"`
+	AlbumUID   string    `json:"albumUID"`
+	UserID     string    `json:"userID"`
+	Synced     bool      `json:"synced"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+type videoResponse struct {
+	ProviderID string    `json:"providerID"`
+	DatabaseID string    `json:"databaseID"`
+	VideoUID   string    `json:"videoUID"`
+	UserID     string    `json:"userID"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+type albumPageResponse struct {
+	Albums     []albumResponse `json:"albums"`
+	NextCursor string          `json:"nextCursor,omitempty"`
+}
+
+type videoPageResponse struct {
+	Videos     []videoResponse `json:"videos"`
+	NextCursor string          `json:"nextCursor,omitempty"`
+}
+
+type objectPageResponse struct {
+	Objects    []*objectResponse `json:"objects"`
+	NextCursor string            `json:"nextCursor,omitempty"`
+}
+
+// ServeHTTP routes:
+//
+//	GET /v1/providers/{providerID}/databases/{databaseID}/albums  (userID, synced, updatedSince, updatedBefore)
+//	GET /v1/providers/{providerID}/databases/{databaseID}/videos  (userID, updatedSince, updatedBefore)
+//	GET /v1/providers/{providerID}/databases/{databaseID}/objects (videoUID, includeSuperseded, createdSince, createdBefore)
+//
+// Every list accepts cursor and limit; times are RFC3339.
+func (h *ListingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeErrorMessage(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	providerID, databaseID, rest, ok := parseProviderPath(r.URL.Path)
+	if !ok {
+		writeErrorMessage(w, http.StatusBadRequest, "invalid path")
+		return
+	}
+
+	switch rest {
+	case "albums":
+		h.handleAlbums(w, r, providerID, databaseID)
+	case "videos":
+		h.handleVideos(w, r, providerID, databaseID)
+	case "objects":
+		h.handleObjects(w, r, providerID, databaseID)
+	default:
+		writeErrorMessage(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (h *ListingHandler) handleAlbums(w http.ResponseWriter, r *http.Request, providerID, databaseID string) {
+	query := r.URL.Query()
+	filter := services.AlbumFilter{ProviderID: providerID, DatabaseID: databaseID, UserID: query.Get("userID")}
+
+	var err error
+	if synced := query.Get("synced"); synced != "" {
+		value, parseErr := strconv.ParseBool(synced)
+		if parseErr != nil {
+			writeErrorMessage(w, http.StatusBadRequest, "invalid synced, expected true or false")
+			return
+		}
+		filter.Synced = &value
+	}
+	if filter.UpdatedSince, err = parseTimeParam(query, "updatedSince"); err == nil {
+		filter.UpdatedBefore, err = parseTimeParam(query, "updatedBefore")
+	}
+	if err == nil {
+		filter.Limit, err = parseLimitParam(query)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	page, err := h.service.ListAlbums(r.Context(), filter, query.Get("cursor"))
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+
+	resp := albumPageResponse{Albums: make([]albumResponse, len(page.Albums)), NextCursor: page.NextCursor}
+	for i, album := range page.Albums {
+		resp.Albums[i] = albumResponse{
+			ProviderID: album.ProviderID,
+			DatabaseID: album.DatabaseID,
+			AlbumUID:   album.AlbumUID,
+			UserID:     album.UserID,
+			Synced:     album.Synced,
+			CreatedAt:  album.CreatedAt,
+			UpdatedAt:  album.UpdatedAt,
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *ListingHandler) handleVideos(w http.ResponseWriter, r *http.Request, providerID, databaseID string) {
+	query := r.URL.Query()
+	filter := services.VideoFilter{ProviderID: providerID, DatabaseID: databaseID, UserID: query.Get("userID")}
+
+	var err error
+	if filter.UpdatedSince, err = parseTimeParam(query, "updatedSince"); err == nil {
+		filter.UpdatedBefore, err = parseTimeParam(query, "updatedBefore")
+	}
+	if err == nil {
+		filter.Limit, err = parseLimitParam(query)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	page, err := h.service.ListVideos(r.Context(), filter, query.Get("cursor"))
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+
+	resp := videoPageResponse{Videos: make([]videoResponse, len(page.Videos)), NextCursor: page.NextCursor}
+	for i, video := range page.Videos {
+		resp.Videos[i] = videoResponse{
+			ProviderID: video.ProviderID,
+			DatabaseID: video.DatabaseID,
+			VideoUID:   video.VideoUID,
+			UserID:     video.UserID,
+			CreatedAt:  video.CreatedAt,
+			UpdatedAt:  video.UpdatedAt,
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *ListingHandler) handleObjects(w http.ResponseWriter, r *http.Request, providerID, databaseID string) {
+	query := r.URL.Query()
+	filter := services.ObjectFilter{ProviderID: providerID, DatabaseID: databaseID, VideoUID: query.Get("videoUID")}
+
+	var err error
+	if includeSuperseded := query.Get("includeSuperseded"); includeSuperseded != "" {
+		filter.IncludeSuperseded, err = strconv.ParseBool(includeSuperseded)
+		if err != nil {
+			writeErrorMessage(w, http.StatusBadRequest, "invalid includeSuperseded, expected true or false")
+			return
+		}
+	}
+	if filter.CreatedSince, err = parseTimeParam(query, "createdSince"); err == nil {
+		filter.CreatedBefore, err = parseTimeParam(query, "createdBefore")
+	}
+	if err == nil {
+		filter.Limit, err = parseLimitParam(query)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	page, err := h.service.ListObjects(r.Context(), filter, query.Get("cursor"))
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+
+	resp := objectPageResponse{Objects: make([]*objectResponse, len(page.Objects)), NextCursor: page.NextCursor}
+	for i, object := range page.Objects {
+		resp.Objects[i] = toObjectResponse(object)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func parseTimeParam(query url.Values, name string) (time.Time, error) {
+	value := query.Get(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s, expected RFC3339", name)
+	}
+	return t, nil
+}
+
+func parseLimitParam(query url.Values) (int, error) {
+	limit := query.Get("limit")
+	if limit == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(limit)
+	if err != nil || n < 0 {
+		return 0, errors.New("invalid limit")
+	}
+	return n, nil
+}
+
+func writeListError(w http.ResponseWriter, err error) {
+	if errors.Is(err, services.ErrInvalidCursor) {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeError(w, http.StatusInternalServerError, err)
+}
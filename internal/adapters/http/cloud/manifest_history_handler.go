@@ -0,0 +1,146 @@
+package cloud
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/media-vault-sync/internal/core/domain"
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+type ManifestHistoryHandler struct {
+	service *services.ManifestHistoryService
+}
+
+func NewManifestHistoryHandler(service *services.ManifestHistoryService) *ManifestHistoryHandler {
+	return &ManifestHistoryHandler{service: service}
+}
+
+type manifestRevisionResponse struct {
+	Revision  int       `json:"revision"`
+	Source    string    `json:"source"`
+	Added     []string  `json:"added"`
+	Removed   []string  `json:"removed"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type manifestRevisionPageResponse struct {
+	Revisions  []manifestRevisionResponse `json:"revisions"`
+	NextCursor string                     `json:"nextCursor,omitempty"`
+}
+
+type manifestSnapshotResponse struct {
+	manifestRevisionResponse
+	VideoUIDs []string `json:"videoUIDs"`
+}
+
+func toManifestRevisionResponse(revision *domain.ManifestRevision) manifestRevisionResponse {
+	resp := manifestRevisionResponse{
+		Revision:  revision.Revision,
+		Source:    revision.Source,
+		Added:     revision.Added,
+		Removed:   revision.Removed,
+		CreatedAt: revision.CreatedAt,
+	}
+	if resp.Added == nil {
+		resp.Added = []string{}
+	}
+	if resp.Removed == nil {
+		resp.Removed = []string{}
+	}
+	return resp
+}
+
+// ServeHTTP routes:
+//
+//	GET /v1/providers/{providerID}/databases/{databaseID}/albums/{albumUID}/revisions            (createdSince, createdBefore, cursor, limit)
+//	GET /v1/providers/{providerID}/databases/{databaseID}/albums/{albumUID}/revisions/{revision} the revision and the manifest as of it
+func (h *ManifestHistoryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeErrorMessage(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	providerID, databaseID, rest, ok := parseProviderPath(r.URL.Path)
+	if !ok {
+		writeErrorMessage(w, http.StatusBadRequest, "invalid path")
+		return
+	}
+	rest, ok = strings.CutPrefix(rest, "albums/")
+	if !ok {
+		writeErrorMessage(w, http.StatusNotFound, "not found")
+		return
+	}
+	albumUID, rest, ok := strings.Cut(rest, "/revisions")
+	if !ok || albumUID == "" || strings.Contains(albumUID, "/") {
+		writeErrorMessage(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	switch {
+	case rest == "":
+		h.handleList(w, r, providerID, databaseID, albumUID)
+	case strings.HasPrefix(rest, "/"):
+		revision, err := strconv.Atoi(rest[1:])
+		if err != nil || revision < 1 {
+			writeErrorMessage(w, http.StatusBadRequest, "invalid revision")
+			return
+		}
+		h.handleGet(w, r, providerID, databaseID, albumUID, revision)
+	default:
+		writeErrorMessage(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (h *ManifestHistoryHandler) handleList(w http.ResponseWriter, r *http.Request, providerID, databaseID, albumUID string) {
+	query := r.URL.Query()
+	filter := services.ManifestRevisionFilter{ProviderID: providerID, DatabaseID: databaseID, AlbumUID: albumUID}
+
+	var err error
+	if filter.CreatedSince, err = parseTimeParam(query, "createdSince"); err == nil {
+		filter.CreatedBefore, err = parseTimeParam(query, "createdBefore")
+	}
+	if err == nil {
+		filter.Limit, err = parseLimitParam(query)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	page, err := h.service.ListRevisions(r.Context(), filter, query.Get("cursor"))
+	if errors.Is(err, services.ErrAlbumNotFound) {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		writeListError(w, err)
+		return
+	}
+
+	resp := manifestRevisionPageResponse{Revisions: make([]manifestRevisionResponse, len(page.Revisions)), NextCursor: page.NextCursor}
+	for i, revision := range page.Revisions {
+		resp.Revisions[i] = toManifestRevisionResponse(revision)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *ManifestHistoryHandler) handleGet(w http.ResponseWriter, r *http.Request, providerID, databaseID, albumUID string, revision int) {
+	snapshot, err := h.service.GetSnapshot(r.Context(), providerID, databaseID, albumUID, revision)
+	if errors.Is(err, services.ErrAlbumNotFound) || errors.Is(err, services.ErrRevisionNotFound) {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, manifestSnapshotResponse{
+		manifestRevisionResponse: toManifestRevisionResponse(snapshot.Revision),
+		VideoUIDs:                snapshot.VideoUIDs,
+	})
+}
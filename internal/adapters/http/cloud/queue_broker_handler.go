@@ -0,0 +1,134 @@
+package cloud
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+type QueueBrokerHandler struct {
+	broker *services.QueueBroker
+}
+
+func NewQueueBrokerHandler(broker *services.QueueBroker) *QueueBrokerHandler {
+	return &QueueBrokerHandler{broker: broker}
+}
+
+// ServeHTTP routes:
+//
+//	POST /v1/queue/publish publish a message
+//	POST /v1/queue/poll    next message of a subscription; 204 when none came in time
+//	POST /v1/queue/ack     outcome of a delivery's handler
+//	POST /v1/queue/extend  heartbeat of a delivery's handler that is still running
+func (h *QueueBrokerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeErrorMessage(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	switch r.URL.Path {
+	case "/v1/queue/publish":
+		h.handlePublish(w, r)
+	case "/v1/queue/poll":
+		h.handlePoll(w, r)
+	case "/v1/queue/ack":
+		h.handleAck(w, r)
+	case "/v1/queue/extend":
+		h.handleExtend(w, r)
+	default:
+		writeErrorMessage(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (h *QueueBrokerHandler) handlePublish(w http.ResponseWriter, r *http.Request) {
+	var msg services.QueueMessage
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		writeErrorMessage(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if msg.Topic == "" {
+		writeErrorMessage(w, http.StatusBadRequest, "missing required fields")
+		return
+	}
+
+	if err := h.broker.Publish(r.Context(), msg); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *QueueBrokerHandler) handlePoll(w http.ResponseWriter, r *http.Request) {
+	var req services.QueuePollRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorMessage(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.SubscriptionID == "" || req.Topic == "" || req.WaitMillis < 0 {
+		writeErrorMessage(w, http.StatusBadRequest, "missing required fields")
+		return
+	}
+
+	delivery, err := h.broker.Poll(r.Context(), req)
+	if errors.Is(err, services.ErrQueueBrokerElsewhere) {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if delivery == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, http.StatusOK, delivery)
+}
+
+func (h *QueueBrokerHandler) handleAck(w http.ResponseWriter, r *http.Request) {
+	var ack services.QueueAck
+	if err := json.NewDecoder(r.Body).Decode(&ack); err != nil {
+		writeErrorMessage(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if ack.DeliveryID == "" {
+		writeErrorMessage(w, http.StatusBadRequest, "missing required fields")
+		return
+	}
+
+	err := h.broker.Ack(r.Context(), ack)
+	if errors.Is(err, services.ErrDeliveryNotFound) {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *QueueBrokerHandler) handleExtend(w http.ResponseWriter, r *http.Request) {
+	var beat services.QueueHeartbeat
+	if err := json.NewDecoder(r.Body).Decode(&beat); err != nil {
+		writeErrorMessage(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if beat.DeliveryID == "" {
+		writeErrorMessage(w, http.StatusBadRequest, "missing required fields")
+		return
+	}
+
+	err := h.broker.Heartbeat(r.Context(), beat)
+	if errors.Is(err, services.ErrDeliveryNotFound) {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
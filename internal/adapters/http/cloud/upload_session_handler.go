@@ -0,0 +1,182 @@
+package cloud
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/media-vault-sync/internal/core/domain"
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+type UploadSessionHandler struct {
+	service *services.UploadSessionService
+}
+
+func NewUploadSessionHandler(service *services.UploadSessionService) *UploadSessionHandler {
+	return &UploadSessionHandler{service: service}
+}
+
+type uploadSessionResponse struct {
+	SessionID string `json:"sessionID"`
+	Offset    int64  `json:"offset"`
+	SizeBytes int64  `json:"sizeBytes"`
+}
+
+type finalizeUploadRequest struct {
+	Checksum string `json:"checksum"`
+}
+
+func toUploadSessionResponse(session *domain.UploadSession) uploadSessionResponse {
+	return uploadSessionResponse{
+		SessionID: session.ID,
+		Offset:    session.Offset,
+		SizeBytes: session.SizeBytes,
+	}
+}
+
+// ServeHTTP routes:
+//
+//	POST /v1/album/{albumUID}/videoupload/sessions               create
+//	GET  /v1/album/{albumUID}/videoupload/sessions/{id}          status
+//	PUT  /v1/album/{albumUID}/videoupload/sessions/{id}          chunk at X-Upload-Offset
+//	POST /v1/album/{albumUID}/videoupload/sessions/{id}/finalize verify checksum and ingest
+func (h *UploadSessionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rest, ok := strings.CutPrefix(r.URL.Path, "/v1/album/")
+	if !ok {
+		writeErrorMessage(w, http.StatusBadRequest, "invalid path")
+		return
+	}
+	albumUID, rest, ok := strings.Cut(rest, "/videoupload/sessions")
+	if !ok || albumUID == "" {
+		writeErrorMessage(w, http.StatusBadRequest, "invalid path")
+		return
+	}
+
+	rest = strings.Trim(rest, "/")
+	if rest == "" {
+		if r.Method != http.MethodPost {
+			writeErrorMessage(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		h.handleCreate(w, r, albumUID)
+		return
+	}
+
+	id, action, _ := strings.Cut(rest, "/")
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		h.handleStatus(w, r, albumUID, id)
+	case action == "" && r.Method == http.MethodPut:
+		h.handleChunk(w, r, albumUID, id)
+	case action == "finalize" && r.Method == http.MethodPost:
+		h.handleFinalize(w, r, albumUID, id)
+	case action == "" || action == "finalize":
+		writeErrorMessage(w, http.StatusMethodNotAllowed, "method not allowed")
+	default:
+		writeErrorMessage(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (h *UploadSessionHandler) handleCreate(w http.ResponseWriter, r *http.Request, albumUID string) {
+	var req services.CreateUploadSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorMessage(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.ProviderID == "" || req.DatabaseID == "" || req.UserID == "" || req.VideoUID == "" || req.SizeBytes < 0 {
+		writeErrorMessage(w, http.StatusBadRequest, "missing required fields")
+		return
+	}
+	req.AlbumUID = albumUID
+
+	session, err := h.service.Create(r.Context(), req)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, toUploadSessionResponse(session))
+}
+
+// session lookup scoped to the album in the path
+func (h *UploadSessionHandler) session(w http.ResponseWriter, r *http.Request, albumUID, id string) *domain.UploadSession {
+	session, err := h.service.Status(r.Context(), id)
+	if errors.Is(err, services.ErrUploadSessionNotFound) || (err == nil && session.AlbumUID != albumUID) {
+		writeError(w, http.StatusNotFound, services.ErrUploadSessionNotFound)
+		return nil
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return nil
+	}
+	return session
+}
+
+func (h *UploadSessionHandler) handleStatus(w http.ResponseWriter, r *http.Request, albumUID, id string) {
+	session := h.session(w, r, albumUID, id)
+	if session == nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, toUploadSessionResponse(session))
+}
+
+func (h *UploadSessionHandler) handleChunk(w http.ResponseWriter, r *http.Request, albumUID, id string) {
+	offset, err := strconv.ParseInt(r.Header.Get("X-Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		writeErrorMessage(w, http.StatusBadRequest, "missing or invalid X-Upload-Offset")
+		return
+	}
+	if h.session(w, r, albumUID, id) == nil {
+		return
+	}
+
+	session, err := h.service.PutChunk(r.Context(), id, offset, r.Body)
+	switch {
+	case errors.Is(err, services.ErrUploadOffsetMismatch):
+		// the body tells the client where to resume
+		writeJSON(w, http.StatusConflict, toUploadSessionResponse(session))
+	case errors.Is(err, services.ErrUploadSizeExceeded):
+		writeError(w, http.StatusRequestEntityTooLarge, err)
+	case errors.Is(err, services.ErrUploadSessionNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err)
+	default:
+		writeJSON(w, http.StatusOK, toUploadSessionResponse(session))
+	}
+}
+
+func (h *UploadSessionHandler) handleFinalize(w http.ResponseWriter, r *http.Request, albumUID, id string) {
+	var req finalizeUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Checksum == "" {
+		writeErrorMessage(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if h.session(w, r, albumUID, id) == nil {
+		return
+	}
+
+	err := h.service.Finalize(r.Context(), id, req.Checksum)
+	switch {
+	case errors.Is(err, services.ErrVideoNotInManifest):
+		writeError(w, http.StatusConflict, err)
+	case errors.Is(err, services.ErrChecksumMismatch):
+		writeError(w, http.StatusUnprocessableEntity, err)
+	case errors.Is(err, services.ErrUploadIncomplete):
+		writeError(w, http.StatusBadRequest, err)
+	case errors.Is(err, services.ErrUploadSessionNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err)
+	default:
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -17,18 +17,18 @@ func NewUserAlbumsHandler(service *services.UserAlbumsService) *UserAlbumsHandle
 
 func (h *UserAlbumsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		writeErrorMessage(w, http.StatusMethodNotAllowed, "method not allowed")
 		return
 	}
 
 	var req services.UserAlbumsRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+		writeErrorMessage(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
 
 	if err := h.service.ProcessUserAlbums(r.Context(), req); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, err)
 		return
 	}
 
@@ -27,23 +27,34 @@ type videoUploadHTTPRequest struct {
 
 func (h *VideoUploadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		writeErrorMessage(w, http.StatusMethodNotAllowed, "method not allowed")
 		return
 	}
 
 	path := r.URL.Path
 	prefix := "/v1/album/"
 	suffix := "/videoupload"
+	referenceSuffix := "/videoupload/reference"
+
+	if strings.HasPrefix(path, prefix) && strings.HasSuffix(path, referenceSuffix) {
+		albumUID := strings.TrimSuffix(strings.TrimPrefix(path, prefix), referenceSuffix)
+		if albumUID == "" {
+			writeErrorMessage(w, http.StatusBadRequest, "missing albumUID")
+			return
+		}
+		h.handleReference(w, r, albumUID)
+		return
+	}
 
 	if !strings.HasPrefix(path, prefix) || !strings.HasSuffix(path, suffix) {
-		http.Error(w, "invalid path", http.StatusBadRequest)
+		writeErrorMessage(w, http.StatusBadRequest, "invalid path")
 		return
 	}
 
 	albumUID := strings.TrimPrefix(path, prefix)
 	albumUID = strings.TrimSuffix(albumUID, suffix)
 	if albumUID == "" {
-		http.Error(w, "missing albumUID", http.StatusBadRequest)
+		writeErrorMessage(w, http.StatusBadRequest, "missing albumUID")
 		return
 	}
 
@@ -67,32 +78,22 @@ func (h *VideoUploadHandler) handleBinary(w http.ResponseWriter, r *http.Request
 	videoUID := r.Header.Get("X-Video-UID")
 
 	if providerID == "" || databaseID == "" || userID == "" || videoUID == "" {
-		http.Error(w, "missing required headers", http.StatusBadRequest)
+		writeErrorMessage(w, http.StatusBadRequest, "missing required headers")
 		return
 	}
 
-	// storing the whole file in memory can crash the service
-	data, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "failed to read body", http.StatusBadRequest)
-		return
-	}
-
-	err = h.service.ProcessVideoUpload(r.Context(), services.VideoUploadRequest{
-		ProviderID: providerID,
-		DatabaseID: databaseID,
-		UserID:     userID,
-		AlbumUID:   albumUID,
-		VideoUID:   videoUID,
-		Data:       data,
+	err := h.service.ProcessVideoUpload(r.Context(), services.VideoUploadRequest{
+		ProviderID:       providerID,
+		DatabaseID:       databaseID,
+		UserID:           userID,
+		AlbumUID:         albumUID,
+		VideoUID:         videoUID,
+		Body:             r.Body,
+		ExpectedChecksum: r.Header.Get("X-Content-SHA256"),
 	})
 
-	if errors.Is(err, services.ErrVideoNotInManifest) {
-		http.Error(w, "video not in manifest", http.StatusConflict)
-		return
-	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeVideoUploadError(w, err)
 		return
 	}
 
@@ -102,70 +103,116 @@ func (h *VideoUploadHandler) handleBinary(w http.ResponseWriter, r *http.Request
 func (h *VideoUploadHandler) handleJSON(w http.ResponseWriter, r *http.Request, albumUID string) {
 	var req videoUploadHTTPRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid request body", http.StatusBadRequest)
+		writeErrorMessage(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
 
-	data := r.Header.Get("X-Video-Data")
-	var dataBytes []byte
-	if data != "" {
-		dataBytes = []byte(data)
-	}
-
 	err := h.service.ProcessVideoUpload(r.Context(), services.VideoUploadRequest{
-		ProviderID: req.ProviderID,
-		DatabaseID: req.DatabaseID,
-		UserID:     req.UserID,
-		AlbumUID:   albumUID,
-		VideoUID:   req.VideoUID,
-		Data:       dataBytes,
+		ProviderID:       req.ProviderID,
+		DatabaseID:       req.DatabaseID,
+		UserID:           req.UserID,
+		AlbumUID:         albumUID,
+		VideoUID:         req.VideoUID,
+		Body:             strings.NewReader(r.Header.Get("X-Video-Data")),
+		ExpectedChecksum: r.Header.Get("X-Content-SHA256"),
 	})
 
-	if errors.Is(err, services.ErrVideoNotInManifest) {
-		http.Error(w, "video not in manifest", http.StatusConflict)
-		return
-	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeVideoUploadError(w, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 }
 
+// handleMultipart streams the "data" part straight into the service, so the
+// metadata fields have to come before it in the form.
 func (h *VideoUploadHandler) handleMultipart(w http.ResponseWriter, r *http.Request, albumUID string) {
-	if err := r.ParseMultipartForm(32 << 20); err != nil {
-		http.Error(w, "failed to parse multipart form", http.StatusBadRequest)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		writeErrorMessage(w, http.StatusBadRequest, "failed to parse multipart form")
 		return
 	}
 
-	providerID := r.FormValue("providerID")
-	databaseID := r.FormValue("databaseID")
-	userID := r.FormValue("userID")
-	videoUID := r.FormValue("videoUID")
-
-	var data []byte
-	file, _, err := r.FormFile("data")
-	if err == nil {
-		defer file.Close()
-		data, _ = io.ReadAll(file)
+	fields := make(map[string]string)
+	var body io.Reader = strings.NewReader("")
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			writeErrorMessage(w, http.StatusBadRequest, "failed to parse multipart form")
+			return
+		}
+		if part.FormName() == "data" {
+			body = part
+			break
+		}
+		value, err := io.ReadAll(io.LimitReader(part, 4096))
+		if err != nil {
+			writeErrorMessage(w, http.StatusBadRequest, "failed to parse multipart form")
+			return
+		}
+		fields[part.FormName()] = string(value)
 	}
 
 	err = h.service.ProcessVideoUpload(r.Context(), services.VideoUploadRequest{
-		ProviderID: providerID,
-		DatabaseID: databaseID,
-		UserID:     userID,
-		AlbumUID:   albumUID,
-		VideoUID:   videoUID,
-		Data:       data,
+		ProviderID:       fields["providerID"],
+		DatabaseID:       fields["databaseID"],
+		UserID:           fields["userID"],
+		AlbumUID:         albumUID,
+		VideoUID:         fields["videoUID"],
+		Body:             body,
+		ExpectedChecksum: r.Header.Get("X-Content-SHA256"),
 	})
 
+	if err != nil {
+		writeVideoUploadError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// writeVideoUploadError maps upload failures to their status codes; 422 tells
+// the client the bytes were damaged on the way and are worth sending again.
+func writeVideoUploadError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrVideoNotInManifest):
+		writeError(w, http.StatusConflict, err)
+	case errors.Is(err, services.ErrChecksumMismatch):
+		writeError(w, http.StatusUnprocessableEntity, err)
+	default:
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+// handleReference links a video to content the cloud already stores. A 404
+// tells the client to upload the bytes instead.
+func (h *VideoUploadHandler) handleReference(w http.ResponseWriter, r *http.Request, albumUID string) {
+	var req services.VideoReferenceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorMessage(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.ProviderID == "" || req.DatabaseID == "" || req.UserID == "" || req.VideoUID == "" || req.Checksum == "" {
+		writeErrorMessage(w, http.StatusBadRequest, "missing required fields")
+		return
+	}
+	req.AlbumUID = albumUID
+
+	err := h.service.ProcessVideoReference(r.Context(), req)
 	if errors.Is(err, services.ErrVideoNotInManifest) {
-		http.Error(w, "video not in manifest", http.StatusConflict)
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	if errors.Is(err, services.ErrBlobNotFound) {
+		writeErrorMessage(w, http.StatusNotFound, "content not found")
 		return
 	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, err)
 		return
 	}
 
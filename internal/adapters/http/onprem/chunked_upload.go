@@ -0,0 +1,236 @@
+package onprem
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+var errUploadSessionGone = errors.New("upload session not found")
+
+type uploadSessionStatus struct {
+	SessionID string `json:"sessionID"`
+	Offset    int64  `json:"offset"`
+	SizeBytes int64  `json:"sizeBytes"`
+}
+
+func uploadKey(req services.VideoUploadRequest) string {
+	return req.ProviderID + "|" + req.DatabaseID + "|" + req.AlbumUID + "|" + req.VideoUID
+}
+
+func (c *HTTPCloudClient) sessionsURL(albumUID string) string {
+	return fmt.Sprintf("%s/v1/album/%s/videoupload/sessions", c.baseURL, albumUID)
+}
+
+func (c *HTTPCloudClient) postVideoUploadChunked(ctx context.Context, req services.VideoUploadRequest, body io.ReadSeeker) (err error) {
+	defer func() {
+		// nobody resumes an upload that failed for good
+		if err != nil && !services.IsRetryable(err) {
+			c.forgetUpload(req)
+		}
+	}()
+
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, body)
+	if err != nil {
+		return fmt.Errorf("hashing video: %w", err)
+	}
+	checksum := hex.EncodeToString(hasher.Sum(nil))
+	if req.ExpectedChecksum != "" && req.ExpectedChecksum != checksum {
+		// the local copy no longer matches the source, the cloud would reject it
+		return fmt.Errorf("%w: read %s, expected %s", services.ErrChecksumMismatch, checksum, req.ExpectedChecksum)
+	}
+
+	upload, offset, err := c.resumeOrCreate(ctx, req, checksum, size)
+	if err != nil {
+		return err
+	}
+
+	attempts := 0
+	for offset < size {
+		n := min(c.chunkSize, size-offset)
+		status, err := c.putChunk(ctx, req.AlbumUID, upload.sessionID, offset, body, n)
+		if errors.Is(err, errUploadSessionGone) {
+			c.forgetUpload(req)
+			return err
+		}
+		if err != nil {
+			attempts++
+			if attempts > c.maxChunkRetries {
+				// the session is kept, the next PostVideoUpload resumes it
+				return fmt.Errorf("uploading chunk at offset %d: %w", offset, err)
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(chunkRetryDelay):
+			}
+			if status, statusErr := c.getSession(ctx, req.AlbumUID, upload.sessionID); statusErr == nil {
+				offset = status.Offset
+			}
+			continue
+		}
+		attempts = 0
+		offset = status.Offset
+	}
+
+	ended, err := c.finalize(ctx, req.AlbumUID, upload.sessionID, checksum)
+	if ended {
+		c.forgetUpload(req)
+	}
+	return err
+}
+
+func (c *HTTPCloudClient) resumeOrCreate(ctx context.Context, req services.VideoUploadRequest, checksum string, size int64) (pendingUpload, int64, error) {
+	c.mu.Lock()
+	upload, ok := c.uploads[uploadKey(req)]
+	c.mu.Unlock()
+
+	if ok && upload.checksum == checksum && upload.sizeBytes == size {
+		status, err := c.getSession(ctx, req.AlbumUID, upload.sessionID)
+		if err == nil {
+			return upload, status.Offset, nil
+		}
+		if !errors.Is(err, errUploadSessionGone) {
+			return upload, 0, err
+		}
+	}
+
+	status, err := c.createSession(ctx, req, size)
+	if err != nil {
+		return pendingUpload{}, 0, err
+	}
+	upload = pendingUpload{sessionID: status.SessionID, checksum: checksum, sizeBytes: size}
+
+	c.mu.Lock()
+	c.uploads[uploadKey(req)] = upload
+	c.mu.Unlock()
+
+	return upload, status.Offset, nil
+}
+
+func (c *HTTPCloudClient) forgetUpload(req services.VideoUploadRequest) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.uploads, uploadKey(req))
+}
+
+func (c *HTTPCloudClient) createSession(ctx context.Context, req services.VideoUploadRequest, size int64) (*uploadSessionStatus, error) {
+	body, err := json.Marshal(services.CreateUploadSessionRequest{
+		ProviderID: req.ProviderID,
+		DatabaseID: req.DatabaseID,
+		UserID:     req.UserID,
+		AlbumUID:   req.AlbumUID,
+		VideoUID:   req.VideoUID,
+		SizeBytes:  size,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshaling request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.sessionsURL(req.AlbumUID), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	return c.doSessionRequest(httpReq, http.StatusCreated)
+}
+
+func (c *HTTPCloudClient) getSession(ctx context.Context, albumUID, sessionID string) (*uploadSessionStatus, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, c.sessionsURL(albumUID)+"/"+sessionID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	return c.doSessionRequest(httpReq, http.StatusOK)
+}
+
+// putChunk sends n bytes of body starting at offset. An offset conflict is
+// not an error: the returned status carries the offset to continue from.
+func (c *HTTPCloudClient) putChunk(ctx context.Context, albumUID, sessionID string, offset int64, body io.ReadSeeker, n int64) (*uploadSessionStatus, error) {
+	if _, err := body.Seek(offset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("seeking to offset %d: %w", offset, err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPut, c.sessionsURL(albumUID)+"/"+sessionID, io.LimitReader(body, n))
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	httpReq.ContentLength = n
+	httpReq.Header.Set("Content-Type", "application/octet-stream")
+	httpReq.Header.Set("X-Upload-Offset", strconv.FormatInt(offset, 10))
+
+	return c.doSessionRequest(httpReq, http.StatusOK, http.StatusConflict)
+}
+
+// finalize reports whether the session ended on the cloud side, which every
+// answer but a server error does.
+func (c *HTTPCloudClient) finalize(ctx context.Context, albumUID, sessionID, checksum string) (bool, error) {
+	body, err := json.Marshal(map[string]string{"checksum": checksum})
+	if err != nil {
+		return false, fmt.Errorf("marshaling request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.sessionsURL(albumUID)+"/"+sessionID+"/finalize", bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("creating request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return false, fmt.Errorf("making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return true, nil
+	case resp.StatusCode == http.StatusNotFound:
+		return true, errUploadSessionGone
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return false, responseError(resp)
+	default:
+		return true, fmt.Errorf("finalizing upload: %w", responseError(resp))
+	}
+}
+
+func (c *HTTPCloudClient) doSessionRequest(httpReq *http.Request, okStatuses ...int) (*uploadSessionStatus, error) {
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errUploadSessionGone
+	}
+	for _, ok := range okStatuses {
+		if resp.StatusCode == ok {
+			var status uploadSessionStatus
+			if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+				return nil, fmt.Errorf("decoding upload session: %w", err)
+			}
+			return &status, nil
+		}
+	}
+	return nil, responseError(resp)
+}
+
+type unexpectedStatusError struct {
+	code int
+}
+
+func (e *unexpectedStatusError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d", e.code)
+}
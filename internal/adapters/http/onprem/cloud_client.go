@@ -3,26 +3,74 @@ package onprem
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/media-vault-sync/internal/core/services"
 )
 
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+
+	chunkRetryDelay = 500 * time.Millisecond
+	// how often a video is sent again after the cloud reports it arrived damaged
+	checksumMismatchRetries = 2
+)
+
 type HTTPCloudClient struct {
-	baseURL    string
-	httpClient *http.Client
+	baseURL         string
+	httpClient      *http.Client
+	chunkSize       int64
+	maxChunkRetries int
+	mu              sync.Mutex
+	// upload sessions that are not finalized yet, so a retried upload resumes
+	uploads map[string]pendingUpload
+	// Idempotency-Keys of operations that have not succeeded or failed for
+	// good yet, so a retry of one whose response got lost is recognized by
+	// the cloud
+	operationKeys map[string]string
+}
+
+type pendingUpload struct {
+	sessionID string
+	checksum  string
+	sizeBytes int64
+}
+
+type ClientOption func(*HTTPCloudClient)
+
+// WithChunkedUpload sends seekable video bodies in chunks of chunkSize
+// through an upload session. A failed chunk is retried up to maxChunkRetries
+// times from the offset the cloud acknowledged, and a later PostVideoUpload
+// for the same video resumes the session instead of starting over.
+func WithChunkedUpload(chunkSize int64, maxChunkRetries int) ClientOption {
+	return func(c *HTTPCloudClient) {
+		c.chunkSize = chunkSize
+		c.maxChunkRetries = maxChunkRetries
+	}
 }
 
-func NewHTTPCloudClient(baseURL string, client *http.Client) *HTTPCloudClient {
+func NewHTTPCloudClient(baseURL string, client *http.Client, opts ...ClientOption) *HTTPCloudClient {
 	if client == nil {
 		client = http.DefaultClient
 	}
-	return &HTTPCloudClient{
-		baseURL:    baseURL,
-		httpClient: client,
+	c := &HTTPCloudClient{
+		baseURL:       baseURL,
+		httpClient:    client,
+		uploads:       make(map[string]pendingUpload),
+		operationKeys: make(map[string]string),
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 func (c *HTTPCloudClient) PostUserAlbums(ctx context.Context, req services.UserAlbumsRequest) error {
@@ -31,23 +79,7 @@ func (c *HTTPCloudClient) PostUserAlbums(ctx context.Context, req services.UserA
 		return fmt.Errorf("marshaling request: %w", err)
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/v1/useralbums", bytes.NewReader(body))
-	if err != nil {
-		return fmt.Errorf("creating request: %w", err)
-	}
-	httpReq.Header.Set("Content-Type", "application/json")
-
-	resp, err := c.httpClient.Do(httpReq)
-	if err != nil {
-		return fmt.Errorf("making request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-	}
-
-	return nil
+	return c.postJSON(ctx, "/v1/useralbums", body)
 }
 
 func (c *HTTPCloudClient) PostAlbumManifestUpload(ctx context.Context, req services.AlbumManifestUploadRequest) error {
@@ -56,11 +88,22 @@ func (c *HTTPCloudClient) PostAlbumManifestUpload(ctx context.Context, req servi
 		return fmt.Errorf("marshaling request: %w", err)
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/v1/albummanifestupload", bytes.NewReader(body))
+	return c.postJSON(ctx, "/v1/albummanifestupload", body)
+}
+
+// postJSON sends body with the Idempotency-Key of the operation it makes up
+// with path, so a retry of the same request carries the same key.
+func (c *HTTPCloudClient) postJSON(ctx context.Context, path string, body []byte) (err error) {
+	operation := jsonOperation(path, body)
+	idempotencyKey := c.operationKey(operation)
+	defer func() { c.finishOperation(operation, err) }()
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, bytes.NewReader(body))
 	if err != nil {
 		return fmt.Errorf("creating request: %w", err)
 	}
 	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set(idempotencyKeyHeader, idempotencyKey)
 
 	resp, err := c.httpClient.Do(httpReq)
 	if err != nil {
@@ -69,15 +112,68 @@ func (c *HTTPCloudClient) PostAlbumManifestUpload(ctx context.Context, req servi
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return responseError(resp)
 	}
 
 	return nil
 }
 
+// responseError returns the services.APIError the cloud answered with, so
+// errors.Is matches the sentinel of its code and services.IsRetryable its
+// retryable flag. A body of another shape, as from a proxy in between,
+// leaves only the status code.
+func responseError(resp *http.Response) error {
+	var apiErr services.APIError
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&apiErr); err == nil && apiErr.Code != "" {
+		return &apiErr
+	}
+	return &unexpectedStatusError{code: resp.StatusCode}
+}
+
 func (c *HTTPCloudClient) PostVideoUpload(ctx context.Context, req services.VideoUploadRequest) error {
+	operation := "videoupload|" + uploadKey(req) + "|" + req.ExpectedChecksum
+	err := c.postVideoUpload(ctx, req, c.operationKey(operation))
+	c.finishOperation(operation, err)
+	return err
+}
+
+func (c *HTTPCloudClient) postVideoUpload(ctx context.Context, req services.VideoUploadRequest, idempotencyKey string) error {
+	// with the checksum known up front, the cloud may already have the content
+	if req.ExpectedChecksum != "" {
+		linked, err := c.postVideoReference(ctx, req, idempotencyKey)
+		if err != nil {
+			return err
+		}
+		if linked {
+			return nil
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := c.sendVideo(ctx, req, idempotencyKey)
+		if !errors.Is(err, services.ErrChecksumMismatch) || attempt >= checksumMismatchRetries {
+			return err
+		}
+		// the bytes were damaged on the way, send them again from the start
+		seeker, ok := req.Body.(io.Seeker)
+		if !ok {
+			return err
+		}
+		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("rewinding video: %w", err)
+		}
+	}
+}
+
+func (c *HTTPCloudClient) sendVideo(ctx context.Context, req services.VideoUploadRequest, idempotencyKey string) error {
+	if c.chunkSize > 0 {
+		if body, ok := req.Body.(io.ReadSeeker); ok {
+			return c.postVideoUploadChunked(ctx, req, body)
+		}
+	}
+
 	url := fmt.Sprintf("%s/v1/album/%s/videoupload", c.baseURL, req.AlbumUID)
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(req.Data))
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, req.Body)
 	if err != nil {
 		return fmt.Errorf("creating request: %w", err)
 	}
@@ -86,6 +182,10 @@ func (c *HTTPCloudClient) PostVideoUpload(ctx context.Context, req services.Vide
 	httpReq.Header.Set("X-Database-ID", req.DatabaseID)
 	httpReq.Header.Set("X-User-ID", req.UserID)
 	httpReq.Header.Set("X-Video-UID", req.VideoUID)
+	httpReq.Header.Set(idempotencyKeyHeader, idempotencyKey)
+	if req.ExpectedChecksum != "" {
+		httpReq.Header.Set("X-Content-SHA256", req.ExpectedChecksum)
+	}
 
 	resp, err := c.httpClient.Do(httpReq)
 	if err != nil {
@@ -93,12 +193,81 @@ func (c *HTTPCloudClient) PostVideoUpload(ctx context.Context, req services.Vide
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusConflict {
-		return fmt.Errorf("video not in manifest")
-	}
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return responseError(resp)
 	}
 
 	return nil
 }
+
+// postVideoReference asks the cloud to record the video from content it
+// already stores. It reports false when the cloud does not have the content.
+func (c *HTTPCloudClient) postVideoReference(ctx context.Context, req services.VideoUploadRequest, idempotencyKey string) (bool, error) {
+	body, err := json.Marshal(services.VideoReferenceRequest{
+		ProviderID: req.ProviderID,
+		DatabaseID: req.DatabaseID,
+		UserID:     req.UserID,
+		AlbumUID:   req.AlbumUID,
+		VideoUID:   req.VideoUID,
+		Checksum:   req.ExpectedChecksum,
+	})
+	if err != nil {
+		return false, fmt.Errorf("marshaling request: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/v1/album/%s/videoupload/reference", c.baseURL, req.AlbumUID)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("creating request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set(idempotencyKeyHeader, idempotencyKey)
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return false, fmt.Errorf("making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, responseError(resp)
+	}
+}
+
+// operationKey returns the Idempotency-Key of operation: the same one for
+// every attempt until the operation succeeds, so the cloud replays an attempt
+// it already ran instead of running it again.
+func (c *HTTPCloudClient) operationKey(operation string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key, ok := c.operationKeys[operation]
+	if !ok {
+		key = services.NewID()
+		c.operationKeys[operation] = key
+	}
+	return key
+}
+
+// finishOperation forgets the key of an operation that succeeded, so that
+// running it again later is a new operation, or that failed for good, since
+// nobody retries it.
+func (c *HTTPCloudClient) finishOperation(operation string, err error) {
+	if err != nil && services.IsRetryable(err) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.operationKeys, operation)
+}
+
+// jsonOperation identifies a JSON request by its endpoint and body.
+func jsonOperation(path string, body []byte) string {
+	sum := sha256.Sum256(body)
+	return path + "|" + hex.EncodeToString(sum[:])
+}
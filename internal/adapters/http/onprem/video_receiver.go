@@ -1,30 +1,31 @@
 package onprem
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"time"
 
 	"github.com/media-vault-sync/internal/core/services"
 )
 
+var errStagedFileCorrupt = errors.New("staged video does not match its checksum")
+
 type VideoReceiver struct {
 	staging            services.StagingStorage
 	cloudClient        services.CloudClient
 	mediaVaultRegistry services.MediaVaultRegistry
-	maxRetries         int
 }
 
-func NewVideoReceiver(staging services.StagingStorage, cloudClient services.CloudClient, mediaVaultRegistry services.MediaVaultRegistry, maxRetries int) *VideoReceiver {
-	if maxRetries <= 0 {
-		maxRetries = 3
-	}
+func NewVideoReceiver(staging services.StagingStorage, cloudClient services.CloudClient, mediaVaultRegistry services.MediaVaultRegistry) *VideoReceiver {
 	return &VideoReceiver{
 		staging:            staging,
 		cloudClient:        cloudClient,
 		mediaVaultRegistry: mediaVaultRegistry,
-		maxRetries:         maxRetries,
 	}
 }
 
@@ -44,21 +45,28 @@ func (h *VideoReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "failed to read body", http.StatusBadRequest)
-		return
-	}
-
 	ctx := r.Context()
 
 	stagingKey := fmt.Sprintf("%s/%s/%s/%s", providerID, databaseID, albumUID, videoUID)
-	// saving on disk to store and be able to retry in case of an error
-	if err := h.staging.Store(ctx, stagingKey, data); err != nil {
+	// saving on disk to store and be able to retry in case of an error; the
+	// checksum lets the cloud skip content it already has
+	hasher := sha256.New()
+	if _, err := h.staging.Store(ctx, stagingKey, io.TeeReader(r.Body, hasher)); err != nil {
 		http.Error(w, fmt.Sprintf("failed to store in staging: %v", err), http.StatusInternalServerError)
 		return
 	}
-	data = nil
+	checksum := hex.EncodeToString(hasher.Sum(nil))
+
+	// the sender's digest arrives as a header or, when it hashed while streaming, as a trailer
+	sourceChecksum := r.Header.Get("X-Content-SHA256")
+	if sourceChecksum == "" {
+		sourceChecksum = r.Trailer.Get("X-Content-SHA256")
+	}
+	if sourceChecksum != "" && sourceChecksum != checksum {
+		h.staging.Delete(ctx, stagingKey)
+		http.Error(w, fmt.Sprintf("%v: received %s, sender read %s", services.ErrChecksumMismatch, checksum, sourceChecksum), http.StatusUnprocessableEntity)
+		return
+	}
 
 	mediaVault, err := h.mediaVaultRegistry.Get(databaseID)
 	if err != nil {
@@ -72,34 +80,75 @@ func (h *VideoReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data, err = h.staging.Load(ctx, stagingKey)
+	// this sends the data as octet-stream and all metadata as headers; a
+	// failure fails the C-MOVE issued against the MediaVault, and the queue
+	// retries the videoupload that asked for it
+	err = h.uploadFromStaging(ctx, stagingKey, services.VideoUploadRequest{
+		ProviderID:       providerID,
+		DatabaseID:       databaseID,
+		UserID:           userID,
+		AlbumUID:         albumUID,
+		VideoUID:         videoUID,
+		ExpectedChecksum: checksum,
+	})
+	h.staging.Delete(ctx, stagingKey)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("failed to load from staging: %v", err), http.StatusInternalServerError)
+		status := http.StatusInternalServerError
+		if !services.IsRetryable(err) {
+			status = http.StatusConflict
+		}
+		writeUploadError(w, status, err)
 		return
 	}
 
-	// this sends the data as octet-stream and all metadata as headers
-	for attempt := 0; attempt < h.maxRetries; attempt++ {
-		err = h.cloudClient.PostVideoUpload(ctx, services.VideoUploadRequest{
-			ProviderID: providerID,
-			DatabaseID: databaseID,
-			UserID:     userID,
-			AlbumUID:   albumUID,
-			VideoUID:   videoUID,
-			Data:       data,
-		})
-		if err == nil {
-			break
-		}
-		if attempt == h.maxRetries-1 {
-			// this is effectively a memory leak (we never delete the file)
-			http.Error(w, fmt.Sprintf("failed to upload to cloud after %d attempts: %v", h.maxRetries, err), http.StatusInternalServerError)
-			return // returning the error here will cause the C-MOVE issued against the MediaVault to fail
-		}
-		time.Sleep(time.Duration(8<<attempt) * time.Second)
+	w.WriteHeader(http.StatusOK)
+}
+
+// writeUploadError answers with the services.APIError the cloud rejected the
+// upload with, or else one coded by the sentinel err wraps, so the sender
+// gets back the error the cloud named rather than one read from the status.
+func writeUploadError(w http.ResponseWriter, status int, err error) {
+	var apiErr *services.APIError
+	if !errors.As(err, &apiErr) {
+		apiErr = services.NewAPIError(fmt.Errorf("failed to upload to cloud: %w", err), services.ErrorCodeInternal)
+		apiErr.Retryable = services.IsRetryable(err)
 	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(apiErr)
+}
 
-	h.staging.Delete(ctx, stagingKey)
+// uploadFromStaging reopens the staged file for every attempt so a retry
+// streams the video from the start. The file is checked against the checksum
+// taken while staging before anything is sent.
+func (h *VideoReceiver) uploadFromStaging(ctx context.Context, stagingKey string, req services.VideoUploadRequest) error {
+	if err := h.verifyStaged(ctx, stagingKey, req.ExpectedChecksum); err != nil {
+		return err
+	}
 
-	w.WriteHeader(http.StatusOK)
+	body, err := h.staging.Load(ctx, stagingKey)
+	if err != nil {
+		return fmt.Errorf("loading from staging: %w", err)
+	}
+	defer body.Close()
+
+	req.Body = body
+	return h.cloudClient.PostVideoUpload(ctx, req)
+}
+
+func (h *VideoReceiver) verifyStaged(ctx context.Context, stagingKey, checksum string) error {
+	body, err := h.staging.Load(ctx, stagingKey)
+	if err != nil {
+		return fmt.Errorf("loading from staging: %w", err)
+	}
+	defer body.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, body); err != nil {
+		return fmt.Errorf("loading from staging: %w", err)
+	}
+	if got := hex.EncodeToString(hasher.Sum(nil)); got != checksum {
+		return fmt.Errorf("%w: read %s, staged %s", errStagedFileCorrupt, got, checksum)
+	}
+	return nil
 }
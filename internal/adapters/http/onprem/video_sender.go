@@ -1,10 +1,15 @@
 package onprem
 
 import (
-	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"hash"
+	"io"
 	"net/http"
+
+	"github.com/media-vault-sync/internal/core/services"
 )
 
 type HTTPVideoSender struct {
@@ -24,11 +29,34 @@ func NewHTTPVideoSender(receiverURL, providerID string, client *http.Client) *HT
 	}
 }
 
-func (s *HTTPVideoSender) SendVideo(ctx context.Context, databaseID, albumUID, videoUID string, data []byte) error {
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, s.receiverURL+"/receive-video", bytes.NewReader(data))
+// digestReader hashes the body as the transport reads it and fills in the
+// X-Content-SHA256 trailer once the body is exhausted.
+type digestReader struct {
+	r       io.Reader
+	hasher  hash.Hash
+	trailer http.Header
+}
+
+func (d *digestReader) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	d.hasher.Write(p[:n])
+	if err == io.EOF {
+		d.trailer.Set("X-Content-SHA256", hex.EncodeToString(d.hasher.Sum(nil)))
+	}
+	return n, err
+}
+
+// SendVideo streams the video to the receiver. Its SHA-256 is only known once
+// every byte has been read, so it travels as the X-Content-SHA256 trailer.
+func (s *HTTPVideoSender) SendVideo(ctx context.Context, databaseID, albumUID, videoUID string, body io.Reader) error {
+	trailer := http.Header{http.CanonicalHeaderKey("X-Content-SHA256"): nil}
+	digest := &digestReader{r: body, hasher: sha256.New(), trailer: trailer}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, s.receiverURL+"/receive-video", digest)
 	if err != nil {
 		return fmt.Errorf("creating request: %w", err)
 	}
+	httpReq.Trailer = trailer
 	httpReq.Header.Set("Content-Type", "application/octet-stream")
 	httpReq.Header.Set("X-Provider-ID", s.providerID)
 	httpReq.Header.Set("X-Database-ID", databaseID)
@@ -41,8 +69,12 @@ func (s *HTTPVideoSender) SendVideo(ctx context.Context, databaseID, albumUID, v
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusUnprocessableEntity {
+		return fmt.Errorf("sending video %s: %w", videoUID, services.ErrChecksumMismatch)
+	}
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		// the receiver passes on the error body of the cloud that refused it
+		return fmt.Errorf("sending video %s: %w", videoUID, responseError(resp))
 	}
 
 	return nil
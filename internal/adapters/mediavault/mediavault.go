@@ -5,11 +5,12 @@ import (
 	"crypto/rand"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 )
 
 type VideoSender interface {
-	SendVideo(ctx context.Context, databaseID, albumUID, videoUID string, data []byte) error
+	SendVideo(ctx context.Context, databaseID, albumUID, videoUID string, body io.Reader) error
 }
 
 type DatabaseScopedMediaVault struct {
@@ -129,9 +130,40 @@ func (p *DatabaseScopedMediaVault) CMove(ctx context.Context, albumUID string) e
 		return nil
 	}
 
+	return p.sendVideos(ctx, albumUID, album.Videos)
+}
+
+// CMoveVideos sends the listed videos that are still in the album; the
+// others have been removed since the request was made and are skipped.
+func (p *DatabaseScopedMediaVault) CMoveVideos(ctx context.Context, albumUID string, videoUIDs []string) error {
+	cfg, err := p.readConfig()
+	if err != nil {
+		return err
+	}
+
+	album, _ := p.findAlbum(cfg, albumUID)
+	if album == nil {
+		return nil
+	}
+
+	inAlbum := make(map[string]bool, len(album.Videos))
 	for _, videoUID := range album.Videos {
-		data := make([]byte, 2*1024*1024) // 2MB
-		rand.Read(data)
+		inAlbum[videoUID] = true
+	}
+
+	var selected []string
+	for _, videoUID := range videoUIDs {
+		if inAlbum[videoUID] {
+			selected = append(selected, videoUID)
+		}
+	}
+
+	return p.sendVideos(ctx, albumUID, selected)
+}
+
+func (p *DatabaseScopedMediaVault) sendVideos(ctx context.Context, albumUID string, videoUIDs []string) error {
+	for _, videoUID := range videoUIDs {
+		data := io.LimitReader(rand.Reader, 2*1024*1024) // 2MB
 		if err := p.videoSender.SendVideo(ctx, p.databaseID, albumUID, videoUID, data); err != nil {
 			return fmt.Errorf("sending video %s: %w", videoUID, err)
 		}
@@ -1,57 +1,247 @@
 package memory
 
 import (
+	"cmp"
 	"context"
+	"log"
+	"slices"
+	"strconv"
 	"sync"
+	"time"
 
+	"github.com/media-vault-sync/internal/adapters/queue/workerpool"
 	"github.com/media-vault-sync/internal/core/services"
 )
 
-const MaxAttempts = 3
+// DedupWindow is how long a published MessageID suppresses the same ID.
+const DedupWindow = 10 * time.Minute
 
 type subscription struct {
+	id         string
+	group      string
 	topic      string
 	providerID string
 	handler    services.MessageHandler
 }
 
+func (s *subscription) matches(msg services.Message) bool {
+	if s.topic != msg.Topic {
+		return false
+	}
+	return s.providerID == "" || s.providerID == msg.Metadata["providerID"]
+}
+
+// consumerGroup is a group registered for a topic and provider. It outlives
+// its members, so the copies published while it has none wait for the next.
+type consumerGroup struct {
+	name       string
+	topic      string
+	providerID string
+}
+
+func (g consumerGroup) matches(msg services.Message) bool {
+	if g.topic != msg.Topic {
+		return false
+	}
+	return g.providerID == "" || g.providerID == msg.Metadata["providerID"]
+}
+
+type publishedID struct {
+	messageID   string
+	publishedAt time.Time
+}
+
 type pendingMessage struct {
+	// seq is the publish order, which messages with an ordering key keep
+	seq int64
+	// group is the consumer group the copy is for; empty until a message
+	// published before any group matched it is delivered
+	group    string
 	msg      services.Message
 	attempts int
 }
 
 type InMemoryQueue struct {
-	mu            sync.RWMutex
-	clock         services.Clock
-	subscriptions map[string]*subscription
-	pending       []pendingMessage
+	mu             sync.RWMutex
+	clock          services.Clock
+	subscriptions  map[string]*subscription
+	groups         map[consumerGroup]bool
+	pending        []pendingMessage
+	deadLetterRepo services.DeadLetterRepository
+	dedupWindow    time.Duration
+	retryPolicy    services.RetryPolicy
+	topicPolicies  map[string]services.RetryPolicy
+	concurrency    int
+	topicWorkers   map[string]int
+	workers        *workerpool.Pools
+	seq            int64
+	// turns counts the deliveries of each group to take turns among its members
+	turns map[string]int
+	// IDs published within the dedup window, oldest first
+	publishedIDs []publishedID
+	publishedAt  map[string]time.Time
+}
+
+type Option func(*InMemoryQueue)
+
+// WithDeadLetterRepository stores messages that exhausted their retry
+// policy instead of dropping them.
+func WithDeadLetterRepository(repo services.DeadLetterRepository) Option {
+	return func(q *InMemoryQueue) {
+		q.deadLetterRepo = repo
+	}
+}
+
+// WithDedupWindow changes how long a published MessageID suppresses later
+// messages with the same ID; zero turns deduplication off.
+func WithDedupWindow(window time.Duration) Option {
+	return func(q *InMemoryQueue) {
+		q.dedupWindow = window
+	}
+}
+
+// WithRetryPolicy replaces services.DefaultRetryPolicy for topics without a
+// policy of their own.
+func WithRetryPolicy(policy services.RetryPolicy) Option {
+	return func(q *InMemoryQueue) {
+		q.retryPolicy = policy
+	}
+}
+
+// WithTopicRetryPolicies retries failed messages of each topic in policies
+// by its own policy.
+func WithTopicRetryPolicies(policies map[string]services.RetryPolicy) Option {
+	return func(q *InMemoryQueue) {
+		for topic, policy := range policies {
+			q.topicPolicies[topic] = policy
+		}
+	}
+}
+
+// WithConcurrency runs up to n handlers of each topic at once, for topics
+// without a count of their own; the default is one.
+func WithConcurrency(n int) Option {
+	return func(q *InMemoryQueue) {
+		q.concurrency = n
+	}
+}
+
+// WithTopicConcurrency runs up to the given number of handlers of each topic
+// in concurrency at once.
+func WithTopicConcurrency(concurrency map[string]int) Option {
+	return func(q *InMemoryQueue) {
+		for topic, n := range concurrency {
+			q.topicWorkers[topic] = n
+		}
+	}
 }
 
-func NewInMemoryQueue(clock services.Clock) *InMemoryQueue {
-	return &InMemoryQueue{
+func NewInMemoryQueue(clock services.Clock, opts ...Option) *InMemoryQueue {
+	q := &InMemoryQueue{
 		clock:         clock,
 		subscriptions: make(map[string]*subscription),
+		groups:        make(map[consumerGroup]bool),
 		pending:       make([]pendingMessage, 0),
+		dedupWindow:   DedupWindow,
+		retryPolicy:   services.DefaultRetryPolicy,
+		topicPolicies: make(map[string]services.RetryPolicy),
+		concurrency:   1,
+		topicWorkers:  make(map[string]int),
+		turns:         make(map[string]int),
+		publishedAt:   make(map[string]time.Time),
+	}
+	for _, opt := range opts {
+		opt(q)
 	}
+	q.workers = workerpool.New(q.concurrency, q.topicWorkers)
+	return q
 }
 
 func (q *InMemoryQueue) Publish(ctx context.Context, msg services.Message) error {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
+	now := q.clock.Now()
+	if msg.MessageID == "" {
+		msg.MessageID = services.NewID()
+	} else if q.isDuplicate(msg.MessageID, now) {
+		return nil
+	}
+	q.rememberID(msg.MessageID, now)
+
 	if msg.DeliverAt.IsZero() {
-		msg.DeliverAt = q.clock.Now()
+		msg.DeliverAt = now
 	}
 
-	q.pending = append(q.pending, pendingMessage{msg: msg, attempts: 0})
+	for _, group := range q.groupsFor(msg) {
+		groupMsg := msg
+		if group != "" {
+			groupMsg = msg.WithMetadata(services.MetadataConsumerGroup, group)
+		}
+		q.seq++
+		q.pending = append(q.pending, pendingMessage{seq: q.seq, group: group, msg: groupMsg, attempts: 0})
+	}
 	return nil
 }
 
-func (q *InMemoryQueue) Subscribe(ctx context.Context, subscriptionID string, topic string, providerID string, handler services.MessageHandler) error {
+// groupsFor returns the consumer groups that get a copy of msg: the one it
+// names, or else every registered group matching it. A message no group
+// matches yet goes to the first one that subscribes.
+func (q *InMemoryQueue) groupsFor(msg services.Message) []string {
+	if group := msg.Metadata[services.MetadataConsumerGroup]; group != "" {
+		return []string{group}
+	}
+
+	var groups []string
+	for group := range q.groups {
+		if group.matches(msg) && !slices.Contains(groups, group.name) {
+			groups = append(groups, group.name)
+		}
+	}
+	if len(groups) == 0 {
+		return []string{""}
+	}
+	slices.Sort(groups)
+	return groups
+}
+
+func (q *InMemoryQueue) isDuplicate(messageID string, now time.Time) bool {
+	publishedAt, ok := q.publishedAt[messageID]
+	return ok && now.Sub(publishedAt) < q.dedupWindow
+}
+
+// rememberID records messageID and forgets the IDs that left the window.
+func (q *InMemoryQueue) rememberID(messageID string, now time.Time) {
+	if q.dedupWindow <= 0 {
+		return
+	}
+
+	expired := 0
+	for _, published := range q.publishedIDs {
+		if now.Sub(published.publishedAt) < q.dedupWindow {
+			break
+		}
+		if q.publishedAt[published.messageID].Equal(published.publishedAt) {
+			delete(q.publishedAt, published.messageID)
+		}
+		expired++
+	}
+	q.publishedIDs = append(q.publishedIDs[expired:], publishedID{messageID: messageID, publishedAt: now})
+	q.publishedAt[messageID] = now
+}
+
+// Subscribe adds a member to the consumer group of the subscription and
+// registers the group, so messages published from then on are copied to it
+// even while it has no members. Unsubscribe leaves the group in place.
+func (q *InMemoryQueue) Subscribe(ctx context.Context, subscriptionID string, topic string, providerID string, handler services.MessageHandler, opts ...services.SubscribeOption) error {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
+	group := services.NewSubscribeOptions(subscriptionID, opts...).Group
+	q.groups[consumerGroup{name: group, topic: topic, providerID: providerID}] = true
 	q.subscriptions[subscriptionID] = &subscription{
+		id:         subscriptionID,
+		group:      group,
 		topic:      topic,
 		providerID: providerID,
 		handler:    handler,
@@ -67,68 +257,213 @@ func (q *InMemoryQueue) Unsubscribe(subscriptionID string) error {
 	return nil
 }
 
+// Tick hands the ready messages to the workers of their topics and waits for
+// their handlers. A topic takes no more messages than it has free workers.
 func (q *InMemoryQueue) Tick(ctx context.Context) (delivered int, requeued int) {
+	var mu sync.Mutex
+	var batch sync.WaitGroup
+
+	for _, pm := range q.takeReady() {
+		batch.Add(1)
+		q.workers.Go(pm.msg.Topic, pm.group, pm.msg.Metadata[services.MetadataOrderingKey], func() {
+			defer batch.Done()
+			ok, retried := q.deliver(ctx, pm)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if ok {
+				delivered++
+			} else if retried {
+				requeued++
+			}
+		})
+	}
+	batch.Wait()
+
+	return delivered, requeued
+}
+
+// Run keeps the workers busy until ctx is cancelled, looking for ready
+// messages every interval and whenever a worker frees up. It then waits for
+// the handlers in flight, which get a context that ctx does not cancel so
+// shutting down does not cut them off halfway.
+func (q *InMemoryQueue) Run(ctx context.Context, interval time.Duration) {
+	handlerCtx := context.WithoutCancel(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for _, pm := range q.takeReady() {
+			q.workers.Go(pm.msg.Topic, pm.group, pm.msg.Metadata[services.MetadataOrderingKey], func() {
+				q.deliver(handlerCtx, pm)
+			})
+		}
+
+		select {
+		case <-ctx.Done():
+			q.workers.Wait()
+			return
+		case <-ticker.C:
+		case <-q.workers.Freed():
+		}
+	}
+}
+
+// takeReady removes the ready messages that got a worker from pending. A
+// message waits behind an earlier one of its group with the same ordering key
+// that is ready, in flight or waiting for its retry, and a message whose
+// group has no members waits for one to subscribe.
+func (q *InMemoryQueue) takeReady() []pendingMessage {
 	q.mu.Lock()
+	defer q.mu.Unlock()
+
 	now := q.clock.Now()
+	slices.SortFunc(q.pending, func(a, b pendingMessage) int {
+		return cmp.Compare(a.seq, b.seq)
+	})
 
 	var ready []pendingMessage
 	var stillPending []pendingMessage
+	blocked := make(map[string]bool)
 
 	for _, pm := range q.pending {
-		if !pm.msg.DeliverAt.After(now) {
-			ready = append(ready, pm)
-		} else {
+		topic := pm.msg.Topic
+		key := pm.msg.Metadata[services.MetadataOrderingKey]
+		orderKey := topic + "\x00" + pm.group + "\x00" + key
+
+		switch {
+		case key != "" && blocked[orderKey]:
+			stillPending = append(stillPending, pm)
+		case !q.hasMember(pm.msg, pm.group):
+			stillPending = append(stillPending, pm)
+		case pm.msg.DeliverAt.After(now):
+			if key != "" && pm.attempts > 0 {
+				blocked[orderKey] = true
+			}
+			stillPending = append(stillPending, pm)
+		case !q.workers.TryAcquire(topic, pm.group, key):
+			if key != "" {
+				blocked[orderKey] = true
+			}
 			stillPending = append(stillPending, pm)
+		default:
+			if key != "" {
+				blocked[orderKey] = true
+			}
+			ready = append(ready, pm)
 		}
 	}
 	q.pending = stillPending
-	q.mu.Unlock()
 
-	var toRequeue []pendingMessage
+	return ready
+}
 
-	for _, pm := range ready {
-		q.mu.RLock()
-		var matchedHandler services.MessageHandler
-		for _, sub := range q.subscriptions {
-			if sub.topic != pm.msg.Topic {
-				continue
-			}
-			msgProviderID := pm.msg.Metadata["providerID"]
-			if sub.providerID != "" && sub.providerID != msgProviderID {
-				continue
-			}
-			matchedHandler = sub.handler
-			break
-		}
-		q.mu.RUnlock()
+// deliver runs the handler of pm's subscription and reports whether it
+// succeeded, or else whether the message was put back for a retry.
+func (q *InMemoryQueue) deliver(ctx context.Context, pm pendingMessage) (ok bool, retried bool) {
+	sub := q.member(pm.msg, pm.group)
+	if sub == nil {
+		// the last member unsubscribed since takeReady
+		q.requeue(pm)
+		return false, false
+	}
+	if pm.group == "" {
+		pm.group = sub.group
+		pm.msg = pm.msg.WithMetadata(services.MetadataConsumerGroup, sub.group)
+	}
 
-		if matchedHandler == nil {
-			pm.attempts++
-			if pm.attempts < MaxAttempts {
-				toRequeue = append(toRequeue, pm)
-			}
-			continue
+	err := sub.handler(ctx, pm.msg.WithMetadata(services.MetadataAttempt, strconv.Itoa(pm.attempts+1)))
+	if err == nil {
+		return true, false
+	}
+	if q.retry(ctx, &pm, err) {
+		q.requeue(pm)
+		return false, true
+	}
+	return false, false
+}
+
+func (q *InMemoryQueue) hasMember(msg services.Message, group string) bool {
+	for _, sub := range q.subscriptions {
+		if sub.matches(msg) && (group == "" || sub.group == group) {
+			return true
 		}
+	}
+	return false
+}
 
-		err := matchedHandler(ctx, pm.msg)
-		if err != nil {
-			pm.attempts++
-			if pm.attempts < MaxAttempts {
-				toRequeue = append(toRequeue, pm)
-				requeued++
-			}
-		} else {
-			delivered++
+// member picks the subscription of group that handles msg, taking turns
+// among the group's members. A message of no group yet goes to the group of
+// the first subscription matching it.
+func (q *InMemoryQueue) member(msg services.Message, group string) *subscription {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var members []*subscription
+	for _, sub := range q.subscriptions {
+		if sub.matches(msg) && (group == "" || sub.group == group) {
+			members = append(members, sub)
 		}
 	}
+	if len(members) == 0 {
+		return nil
+	}
+	slices.SortFunc(members, func(a, b *subscription) int {
+		return cmp.Compare(a.id, b.id)
+	})
+	if group == "" {
+		group = members[0].group
+		members = slices.DeleteFunc(members, func(sub *subscription) bool {
+			return sub.group != group
+		})
+	}
 
-	if len(toRequeue) > 0 {
-		q.mu.Lock()
-		q.pending = append(q.pending, toRequeue...)
-		q.mu.Unlock()
+	turn := q.turns[group]
+	q.turns[group]++
+	return members[turn%len(members)]
+}
+
+func (q *InMemoryQueue) requeue(pm pendingMessage) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pending = append(q.pending, pm)
+}
+
+// retry counts the failed attempt and schedules the next one by the topic's
+// retry policy; it reports false once the message was dead-lettered instead,
+// which a non-retryable error does right away.
+func (q *InMemoryQueue) retry(ctx context.Context, pm *pendingMessage, lastErr error) bool {
+	pm.attempts++
+	policy := q.retryPolicyFor(pm.msg.Topic)
+	retryable := services.IsRetryable(lastErr)
+	if !retryable {
+		log.Printf("message %s on topic %s failed permanently: %v", pm.msg.MessageID, pm.msg.Topic, lastErr)
+	}
+	if !retryable || policy.Exhausted(pm.attempts) {
+		q.deadLetter(ctx, *pm, lastErr)
+		return false
 	}
 
-	return delivered, requeued
+	pm.msg = pm.msg.WithMetadata(services.MetadataLastError, lastErr.Error())
+	pm.msg.DeliverAt = q.clock.Now().Add(policy.Delay(pm.attempts))
+	return true
+}
+
+func (q *InMemoryQueue) retryPolicyFor(topic string) services.RetryPolicy {
+	if policy, ok := q.topicPolicies[topic]; ok {
+		return policy
+	}
+	return q.retryPolicy
+}
+
+func (q *InMemoryQueue) deadLetter(ctx context.Context, pm pendingMessage, lastErr error) {
+	if q.deadLetterRepo == nil {
+		return
+	}
+	dl := services.NewDeadLetter(pm.msg, pm.attempts, lastErr, q.clock.Now())
+	if err := q.deadLetterRepo.Add(ctx, dl); err != nil {
+		log.Printf("failed to dead-letter message %s on topic %s: %v", pm.msg.MessageID, pm.msg.Topic, err)
+	}
 }
 
 func (q *InMemoryQueue) Process(ctx context.Context) (totalDelivered int) {
@@ -0,0 +1,183 @@
+package memory_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/media-vault-sync/internal/adapters/queue/memory"
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+func TestQueue_TopicsRunOnTheirOwnWorkers(t *testing.T) {
+	ctx := context.Background()
+	metadata := func(key string) map[string]string {
+		return map[string]string{"providerID": "p1", services.MetadataOrderingKey: key}
+	}
+
+	t.Run("a slow topic does not hold up the others", func(t *testing.T) {
+		q := memory.NewInMemoryQueue(services.NewFakeClock(time.Now()))
+
+		synced := make(chan struct{})
+		q.Subscribe(ctx, "videoupload", "videoupload", "p1", func(ctx context.Context, msg services.Message) error {
+			select {
+			case <-synced:
+				return nil
+			case <-time.After(time.Second):
+				return errors.New("usersync waited behind the video upload")
+			}
+		})
+		q.Subscribe(ctx, "usersync", "usersync", "p1", func(ctx context.Context, msg services.Message) error {
+			close(synced)
+			return nil
+		})
+		q.Publish(ctx, services.Message{Topic: "videoupload", Metadata: metadata("")})
+		q.Publish(ctx, services.Message{Topic: "usersync", Metadata: metadata("")})
+
+		if delivered, _ := q.Tick(ctx); delivered != 2 {
+			t.Errorf("expected both topics handled side by side, got %d delivered", delivered)
+		}
+	})
+
+	t.Run("a topic runs at most its number of workers", func(t *testing.T) {
+		q := memory.NewInMemoryQueue(services.NewFakeClock(time.Now()),
+			memory.WithTopicConcurrency(map[string]int{"videoupload": 2}))
+
+		var active, peak atomic.Int32
+		q.Subscribe(ctx, "videoupload", "videoupload", "p1", func(ctx context.Context, msg services.Message) error {
+			n := active.Add(1)
+			defer active.Add(-1)
+			for {
+				current := peak.Load()
+				if n <= current || peak.CompareAndSwap(current, n) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			return nil
+		})
+		for range 5 {
+			q.Publish(ctx, services.Message{Topic: "videoupload", Metadata: metadata("")})
+		}
+
+		if delivered := q.Process(ctx); delivered != 5 {
+			t.Fatalf("expected all messages delivered, got %d", delivered)
+		}
+		if peak.Load() != 2 {
+			t.Errorf("expected two handlers at a time, got %d", peak.Load())
+		}
+	})
+
+	t.Run("messages with one key are handled one at a time in publish order", func(t *testing.T) {
+		q := memory.NewInMemoryQueue(services.NewFakeClock(time.Now()), memory.WithConcurrency(4))
+
+		var mu sync.Mutex
+		received := map[string][]string{}
+		active := map[string]bool{}
+		q.Subscribe(ctx, "videoupload", "videoupload", "p1", func(ctx context.Context, msg services.Message) error {
+			key := msg.Metadata[services.MetadataOrderingKey]
+			mu.Lock()
+			if active[key] {
+				t.Errorf("two handlers of %s at once", key)
+			}
+			active[key] = true
+			received[key] = append(received[key], string(msg.Payload))
+			mu.Unlock()
+
+			time.Sleep(5 * time.Millisecond)
+
+			mu.Lock()
+			active[key] = false
+			mu.Unlock()
+			return nil
+		})
+		for _, m := range []struct{ key, payload string }{
+			{"album1", "1"}, {"album2", "1"}, {"album1", "2"}, {"album1", "3"}, {"album2", "2"},
+		} {
+			q.Publish(ctx, services.Message{Topic: "videoupload", Payload: []byte(m.payload), Metadata: metadata(m.key)})
+		}
+
+		q.Process(ctx)
+		if got := received["album1"]; len(got) != 3 || got[0] != "1" || got[1] != "2" || got[2] != "3" {
+			t.Errorf("expected album1 in publish order, got %v", got)
+		}
+		if got := received["album2"]; len(got) != 2 || got[0] != "1" || got[1] != "2" {
+			t.Errorf("expected album2 in publish order, got %v", got)
+		}
+	})
+
+	t.Run("a message waiting for its retry holds back its key", func(t *testing.T) {
+		clock := services.NewFakeClock(time.Now())
+		q := memory.NewInMemoryQueue(clock, memory.WithConcurrency(4))
+
+		var received []string
+		failures := 1
+		q.Subscribe(ctx, "videoupload", "videoupload", "p1", func(ctx context.Context, msg services.Message) error {
+			received = append(received, string(msg.Payload))
+			if failures > 0 {
+				failures--
+				return errors.New("cloud unavailable")
+			}
+			return nil
+		})
+		q.Publish(ctx, services.Message{Topic: "videoupload", Payload: []byte("1"), Metadata: metadata("album1")})
+		q.Publish(ctx, services.Message{Topic: "videoupload", Payload: []byte("2"), Metadata: metadata("album1")})
+
+		q.Process(ctx)
+		if len(received) != 1 || q.PendingCount() != 2 {
+			t.Fatalf("expected the second message to wait for the retry, got %v with %d pending", received, q.PendingCount())
+		}
+
+		clock.Advance(time.Second)
+		q.Process(ctx)
+		if len(received) != 3 || received[1] != "1" || received[2] != "2" {
+			t.Errorf("expected the retry before the next message, got %v", received)
+		}
+	})
+
+	t.Run("cancelling Run waits for the handlers in flight", func(t *testing.T) {
+		q := memory.NewInMemoryQueue(services.NewFakeClock(time.Now()))
+
+		started := make(chan struct{})
+		release := make(chan struct{})
+		var handlerErr error
+		q.Subscribe(ctx, "videoupload", "videoupload", "p1", func(ctx context.Context, msg services.Message) error {
+			close(started)
+			<-release
+			handlerErr = ctx.Err()
+			return nil
+		})
+		q.Publish(ctx, services.Message{Topic: "videoupload", Metadata: metadata("")})
+
+		runCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			q.Run(runCtx, 10*time.Millisecond)
+			close(done)
+		}()
+
+		<-started
+		cancel()
+		select {
+		case <-done:
+			t.Fatal("Run returned before its handler finished")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		close(release)
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Run did not return after its handler finished")
+		}
+		if handlerErr != nil {
+			t.Errorf("the handler must finish on a live context, got %v", handlerErr)
+		}
+		if q.PendingCount() != 0 {
+			t.Errorf("expected the message delivered, got %d pending", q.PendingCount())
+		}
+	})
+}
@@ -0,0 +1,160 @@
+package memory_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/media-vault-sync/internal/adapters/queue/memory"
+	memoryrepo "github.com/media-vault-sync/internal/adapters/repo/memory"
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+func TestQueue_ConsumerGroupsEachGetEveryMessage(t *testing.T) {
+	ctx := context.Background()
+	p1 := map[string]string{"providerID": "p1"}
+
+	t.Run("every group gets each message", func(t *testing.T) {
+		q := memory.NewInMemoryQueue(services.NewFakeClock(time.Now()))
+
+		var mu sync.Mutex
+		received := map[string][]services.Message{}
+		for _, sub := range []struct{ id, providerID string }{{"onprem:p1:albummanifestupload", "p1"}, {"audit", ""}} {
+			q.Subscribe(ctx, sub.id, "albummanifestupload", sub.providerID, func(ctx context.Context, msg services.Message) error {
+				mu.Lock()
+				defer mu.Unlock()
+				received[sub.id] = append(received[sub.id], msg)
+				return nil
+			})
+		}
+		q.Publish(ctx, services.Message{Topic: "albummanifestupload", Metadata: p1})
+		q.Publish(ctx, services.Message{Topic: "albummanifestupload", Metadata: p1})
+
+		if delivered := q.Process(ctx); delivered != 4 {
+			t.Fatalf("expected a copy of each message per group, got %d delivered", delivered)
+		}
+		for id, msgs := range received {
+			if len(msgs) != 2 {
+				t.Errorf("expected %s to get both messages, got %d", id, len(msgs))
+			}
+			if msgs[0].Metadata[services.MetadataConsumerGroup] != id {
+				t.Errorf("expected the copy of %s to name its group, got %v", id, msgs[0].Metadata)
+			}
+		}
+		if received["audit"][0].MessageID != received["onprem:p1:albummanifestupload"][0].MessageID {
+			t.Error("the copies must keep the MessageID")
+		}
+	})
+
+	t.Run("members of a group share its messages", func(t *testing.T) {
+		q := memory.NewInMemoryQueue(services.NewFakeClock(time.Now()))
+
+		received := map[string]int{}
+		for _, id := range []string{"worker-a", "worker-b"} {
+			q.Subscribe(ctx, id, "videoupload", "p1", func(ctx context.Context, msg services.Message) error {
+				received[id]++
+				return nil
+			}, services.InGroup("onprem:p1:videoupload"))
+		}
+		for range 4 {
+			q.Publish(ctx, services.Message{Topic: "videoupload", Metadata: p1})
+		}
+
+		if delivered := q.Process(ctx); delivered != 4 {
+			t.Fatalf("expected each message delivered once, got %d", delivered)
+		}
+		if received["worker-a"] != 2 || received["worker-b"] != 2 {
+			t.Errorf("expected the members to take turns, got %v", received)
+		}
+	})
+
+	t.Run("a failed copy is retried and replayed for its group only", func(t *testing.T) {
+		clock := services.NewFakeClock(time.Now())
+		deadLetterRepo := memoryrepo.NewDeadLetterRepository()
+		q := memory.NewInMemoryQueue(clock, memory.WithDeadLetterRepository(deadLetterRepo))
+
+		var mu sync.Mutex
+		received := map[string]int{}
+		failures := map[string]error{
+			"onprem:p1:albummanifestupload": errors.New("cloud unavailable"),
+			"audit":                         services.NonRetryable(errors.New("audit log full")),
+		}
+		for _, id := range []string{"onprem:p1:albummanifestupload", "audit"} {
+			q.Subscribe(ctx, id, "albummanifestupload", "p1", func(ctx context.Context, msg services.Message) error {
+				mu.Lock()
+				defer mu.Unlock()
+				received[id]++
+				err := failures[id]
+				failures[id] = nil
+				return err
+			})
+		}
+		q.Publish(ctx, services.Message{Topic: "albummanifestupload", Metadata: p1})
+
+		q.Process(ctx)
+		clock.Advance(time.Second)
+		q.Process(ctx)
+		if received["onprem:p1:albummanifestupload"] != 2 || received["audit"] != 1 {
+			t.Fatalf("expected only the failed copy retried, got %v", received)
+		}
+
+		deadLetters, _ := deadLetterRepo.List(ctx, services.DeadLetterFilter{})
+		if len(deadLetters) != 1 {
+			t.Fatalf("expected the audit copy dead-lettered, got %d", len(deadLetters))
+		}
+		if err := services.NewDeadLetterService(deadLetterRepo, q).Replay(ctx, deadLetters[0].ID); err != nil {
+			t.Fatalf("replay failed: %v", err)
+		}
+		q.Process(ctx)
+		if received["onprem:p1:albummanifestupload"] != 2 || received["audit"] != 2 {
+			t.Errorf("expected the replay to reach the audit group only, got %v", received)
+		}
+	})
+
+	t.Run("a group keeps its messages while it has no members", func(t *testing.T) {
+		q := memory.NewInMemoryQueue(services.NewFakeClock(time.Now()))
+
+		received := 0
+		subscribe := func() {
+			q.Subscribe(ctx, "onprem:p1:videoupload", "videoupload", "p1", func(ctx context.Context, msg services.Message) error {
+				received++
+				return nil
+			})
+		}
+		subscribe()
+		q.Unsubscribe("onprem:p1:videoupload")
+		q.Publish(ctx, services.Message{Topic: "videoupload", Metadata: p1})
+
+		q.Process(ctx)
+		if received != 0 || q.PendingCount() != 1 {
+			t.Fatalf("expected the copy to wait for its group, got %d received with %d pending", received, q.PendingCount())
+		}
+		subscribe()
+		q.Process(ctx)
+		if received != 1 || q.PendingCount() != 0 {
+			t.Errorf("expected the group to catch up, got %d received with %d pending", received, q.PendingCount())
+		}
+	})
+
+	t.Run("a message published before any group subscribed goes to one", func(t *testing.T) {
+		q := memory.NewInMemoryQueue(services.NewFakeClock(time.Now()))
+		q.Publish(ctx, services.Message{Topic: "usersync", Metadata: p1})
+
+		var received []services.Message
+		for _, id := range []string{"onprem:p1:usersync", "audit"} {
+			q.Subscribe(ctx, id, "usersync", "p1", func(ctx context.Context, msg services.Message) error {
+				received = append(received, msg)
+				return nil
+			})
+		}
+
+		if delivered := q.Process(ctx); delivered != 1 {
+			t.Fatalf("expected the message delivered once, got %d", delivered)
+		}
+		if received[0].Metadata[services.MetadataConsumerGroup] != "audit" {
+			t.Errorf("expected the first group by subscription ID, got %v", received[0].Metadata)
+		}
+	})
+}
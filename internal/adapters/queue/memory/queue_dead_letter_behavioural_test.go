@@ -0,0 +1,124 @@
+package memory_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/media-vault-sync/internal/adapters/queue/memory"
+	memoryrepo "github.com/media-vault-sync/internal/adapters/repo/memory"
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+func TestQueue_ExhaustedMessageIsDeadLettered(t *testing.T) {
+	clock := services.NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	deadLetterRepo := memoryrepo.NewDeadLetterRepository()
+	q := memory.NewInMemoryQueue(clock, memory.WithDeadLetterRepository(deadLetterRepo))
+	ctx := context.Background()
+
+	calls := 0
+	err := q.Subscribe(ctx, "sub1", "usersync", "p1", func(ctx context.Context, msg services.Message) error {
+		calls++
+		return errors.New("cloud unavailable")
+	})
+	if err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+
+	err = q.Publish(ctx, services.Message{
+		MessageID: "failing-msg",
+		Topic:     "usersync",
+		Payload:   []byte(`{"databaseID":"db1","userID":"user1"}`),
+		Metadata:  map[string]string{"providerID": "p1"},
+	})
+	if err != nil {
+		t.Fatalf("publish failed: %v", err)
+	}
+
+	// every retry waits for its backoff
+	for i := 0; i < services.DefaultRetryPolicy.MaxAttempts; i++ {
+		q.Process(ctx)
+		clock.Advance(time.Minute)
+	}
+
+	if calls != services.DefaultRetryPolicy.MaxAttempts {
+		t.Errorf("expected %d handler calls, got %d", services.DefaultRetryPolicy.MaxAttempts, calls)
+	}
+	if q.PendingCount() != 0 {
+		t.Errorf("expected no pending messages, got %d", q.PendingCount())
+	}
+
+	deadLetters, err := deadLetterRepo.List(ctx, services.DeadLetterFilter{})
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if len(deadLetters) != 1 {
+		t.Fatalf("expected 1 dead letter, got %d", len(deadLetters))
+	}
+
+	dl := deadLetters[0]
+	if dl.Message.MessageID != "failing-msg" {
+		t.Errorf("expected original message ID, got %s", dl.Message.MessageID)
+	}
+	if dl.Topic != "usersync" || dl.ProviderID != "p1" {
+		t.Errorf("expected usersync/p1, got %s/%s", dl.Topic, dl.ProviderID)
+	}
+	if dl.Attempts != services.DefaultRetryPolicy.MaxAttempts {
+		t.Errorf("expected %d attempts, got %d", services.DefaultRetryPolicy.MaxAttempts, dl.Attempts)
+	}
+	if dl.LastError != "cloud unavailable" {
+		t.Errorf("expected last error to be recorded, got %q", dl.LastError)
+	}
+}
+
+func TestQueue_ReplayedDeadLetterIsDeliveredAgain(t *testing.T) {
+	clock := services.NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	deadLetterRepo := memoryrepo.NewDeadLetterRepository()
+	q := memory.NewInMemoryQueue(clock, memory.WithDeadLetterRepository(deadLetterRepo))
+	deadLetterService := services.NewDeadLetterService(deadLetterRepo, q)
+	ctx := context.Background()
+
+	healthy := false
+	var delivered []string
+	q.Subscribe(ctx, "sub1", "usersync", "p1", func(ctx context.Context, msg services.Message) error {
+		if !healthy {
+			return errors.New("cloud unavailable")
+		}
+		delivered = append(delivered, msg.MessageID)
+		return nil
+	})
+
+	q.Publish(ctx, services.Message{
+		MessageID: "replay-me",
+		Topic:     "usersync",
+		Metadata:  map[string]string{"providerID": "p1"},
+	})
+	for i := 0; i < services.DefaultRetryPolicy.MaxAttempts; i++ {
+		q.Process(ctx)
+		clock.Advance(time.Minute)
+	}
+
+	deadLetters, _ := deadLetterRepo.List(ctx, services.DeadLetterFilter{ProviderID: "p1"})
+	if len(deadLetters) != 1 {
+		t.Fatalf("expected 1 dead letter, got %d", len(deadLetters))
+	}
+
+	healthy = true
+	if err := deadLetterService.Replay(ctx, deadLetters[0].ID); err != nil {
+		t.Fatalf("replay failed: %v", err)
+	}
+	q.Process(ctx)
+
+	if len(delivered) != 1 {
+		t.Fatalf("expected replayed message to be delivered, got %v", delivered)
+	}
+	if delivered[0] == "replay-me" {
+		t.Error("a replay is a new delivery and needs a new MessageID, or it is taken for a duplicate")
+	}
+
+	remaining, _ := deadLetterRepo.List(ctx, services.DeadLetterFilter{})
+	if len(remaining) != 0 {
+		t.Errorf("expected dead letter to be removed after replay, got %d", len(remaining))
+	}
+}
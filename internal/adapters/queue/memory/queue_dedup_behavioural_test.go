@@ -0,0 +1,86 @@
+package memory_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/media-vault-sync/internal/adapters/queue/memory"
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+func TestQueue_PublishAssignsMissingMessageIDs(t *testing.T) {
+	clock := services.NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	q := memory.NewInMemoryQueue(clock)
+	ctx := context.Background()
+
+	var received []services.Message
+	q.Subscribe(ctx, "sub1", "usersync", "p1", func(ctx context.Context, msg services.Message) error {
+		received = append(received, msg)
+		return nil
+	})
+
+	for i := 0; i < 2; i++ {
+		if err := q.Publish(ctx, services.Message{
+			Topic:    "usersync",
+			Payload:  []byte(`{"test":"data"}`),
+			Metadata: map[string]string{"providerID": "p1"},
+		}); err != nil {
+			t.Fatalf("publish failed: %v", err)
+		}
+	}
+	q.Process(ctx)
+
+	if len(received) != 2 {
+		t.Fatalf("messages without an ID are never duplicates, got %d", len(received))
+	}
+	if received[0].MessageID == "" || received[0].MessageID == received[1].MessageID {
+		t.Errorf("expected two distinct IDs, got %q and %q", received[0].MessageID, received[1].MessageID)
+	}
+}
+
+func TestQueue_DuplicateMessageIDsAreDroppedWithinTheWindow(t *testing.T) {
+	clock := services.NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	q := memory.NewInMemoryQueue(clock, memory.WithDedupWindow(time.Minute))
+	ctx := context.Background()
+
+	var received []services.Message
+	q.Subscribe(ctx, "sub1", "usersync", "p1", func(ctx context.Context, msg services.Message) error {
+		received = append(received, msg)
+		return nil
+	})
+
+	payload := []byte(`{"databaseID":"db1","userID":"user1"}`)
+	publish := func() {
+		t.Helper()
+		if err := q.Publish(ctx, services.Message{
+			MessageID: "sync-user1",
+			Topic:     "usersync",
+			Payload:   payload,
+			Metadata:  map[string]string{"providerID": "p1"},
+		}); err != nil {
+			t.Fatalf("publish failed: %v", err)
+		}
+	}
+
+	publish()
+	publish()
+	q.Process(ctx)
+	if len(received) != 1 {
+		t.Fatalf("expected the duplicate dropped, got %d deliveries", len(received))
+	}
+
+	clock.Advance(30 * time.Second)
+	publish()
+	q.Process(ctx)
+	if len(received) != 1 {
+		t.Fatalf("the window runs from the first publish and still holds, got %d deliveries", len(received))
+	}
+
+	clock.Advance(time.Minute)
+	publish()
+	q.Process(ctx)
+	if len(received) != 2 {
+		t.Errorf("expected the ID published again after the window, got %d deliveries", len(received))
+	}
+}
@@ -0,0 +1,127 @@
+package memory_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/media-vault-sync/internal/adapters/queue/memory"
+	memoryrepo "github.com/media-vault-sync/internal/adapters/repo/memory"
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+func TestQueue_FailedMessagesBackOffByTopicPolicy(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("retries wait an exponentially growing delay", func(t *testing.T) {
+		clock := services.NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+		deadLetterRepo := memoryrepo.NewDeadLetterRepository()
+		q := memory.NewInMemoryQueue(clock,
+			memory.WithDeadLetterRepository(deadLetterRepo),
+			memory.WithRetryPolicy(services.RetryPolicy{MaxAttempts: 4, BaseDelay: time.Second, Multiplier: 2}))
+
+		var received []services.Message
+		q.Subscribe(ctx, "sub1", "usersync", "p1", func(ctx context.Context, msg services.Message) error {
+			received = append(received, msg)
+			return fmt.Errorf("attempt %d failed", len(received))
+		})
+		q.Publish(ctx, services.Message{MessageID: "m1", Topic: "usersync", Metadata: map[string]string{"providerID": "p1"}})
+
+		steps := []struct {
+			advance time.Duration
+			calls   int
+		}{
+			{0, 1},
+			{999 * time.Millisecond, 1},
+			{time.Millisecond, 2},
+			{2*time.Second - time.Millisecond, 2},
+			{time.Millisecond, 3},
+			{4 * time.Second, 4},
+		}
+		for _, step := range steps {
+			clock.Advance(step.advance)
+			q.Process(ctx)
+			if len(received) != step.calls {
+				t.Fatalf("after %v expected %d attempts, got %d", step.advance, step.calls, len(received))
+			}
+		}
+
+		if received[0].Metadata[services.MetadataAttempt] != "1" || received[0].Metadata[services.MetadataLastError] != "" {
+			t.Errorf("first attempt should carry no error, got %v", received[0].Metadata)
+		}
+		if received[2].Metadata[services.MetadataAttempt] != "3" || received[2].Metadata[services.MetadataLastError] != "attempt 2 failed" {
+			t.Errorf("expected attempt 3 after attempt 2 failed, got %v", received[2].Metadata)
+		}
+		if deadLetters, _ := deadLetterRepo.List(ctx, services.DeadLetterFilter{}); len(deadLetters) != 1 || deadLetters[0].Attempts != 4 {
+			t.Errorf("expected the message dead-lettered after 4 attempts, got %+v", deadLetters)
+		}
+	})
+
+	t.Run("topics keep their own policy", func(t *testing.T) {
+		clock := services.NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+		deadLetterRepo := memoryrepo.NewDeadLetterRepository()
+		q := memory.NewInMemoryQueue(clock,
+			memory.WithDeadLetterRepository(deadLetterRepo),
+			memory.WithTopicRetryPolicies(map[string]services.RetryPolicy{
+				"videoupload": {MaxAttempts: 1},
+			}))
+
+		var mu sync.Mutex
+		calls := map[string]int{}
+		for _, topic := range []string{"usersync", "videoupload"} {
+			q.Subscribe(ctx, topic, topic, "p1", func(ctx context.Context, msg services.Message) error {
+				mu.Lock()
+				defer mu.Unlock()
+				calls[msg.Topic]++
+				return errors.New("cloud unavailable")
+			})
+			q.Publish(ctx, services.Message{Topic: topic, Metadata: map[string]string{"providerID": "p1"}})
+		}
+		q.Process(ctx)
+
+		if deadLetters, _ := deadLetterRepo.List(ctx, services.DeadLetterFilter{Topic: "videoupload"}); len(deadLetters) != 1 {
+			t.Errorf("expected videoupload dead-lettered after its single attempt, got %d", len(deadLetters))
+		}
+		if q.PendingCount() != 1 || calls["usersync"] != 1 {
+			t.Errorf("expected usersync waiting for its retry, got %d pending after %d calls", q.PendingCount(), calls["usersync"])
+		}
+	})
+
+	t.Run("jitter only shortens a delay", func(t *testing.T) {
+		policy := services.RetryPolicy{MaxAttempts: 5, BaseDelay: time.Second, Multiplier: 3, Jitter: 0.5}
+		for i := 0; i < 100; i++ {
+			if delay := policy.Delay(3); delay < 4500*time.Millisecond || delay > 9*time.Second {
+				t.Fatalf("expected the third delay between 4.5s and 9s, got %v", delay)
+			}
+		}
+	})
+
+	t.Run("delays stop growing at the max delay", func(t *testing.T) {
+		policy := services.RetryPolicy{MaxAttempts: 2000, BaseDelay: time.Second, Multiplier: 10, MaxDelay: time.Minute}
+		for _, attempts := range []int{3, 50, 1000} {
+			if delay := policy.Delay(attempts); delay != time.Minute {
+				t.Errorf("expected the delay after %d attempts capped at 1m, got %v", attempts, delay)
+			}
+		}
+
+		policy.MaxDelay = 0
+		if delay := policy.Delay(1000); delay != services.DefaultMaxRetryDelay {
+			t.Errorf("expected a policy without a max delay capped at the default, got %v", delay)
+		}
+
+		parsed, err := services.ParseRetryPolicy("5/2s/2/0.2/10m")
+		if err != nil || parsed.MaxDelay != 10*time.Minute {
+			t.Errorf("expected the max delay parsed, got %+v (%v)", parsed, err)
+		}
+		parsed, err = services.ParseRetryPolicy("5/2s/2/0.2")
+		if err != nil || parsed.MaxDelay != services.DefaultMaxRetryDelay {
+			t.Errorf("expected the default max delay, got %+v (%v)", parsed, err)
+		}
+		if _, err := services.ParseRetryPolicy("5/2s/2/0.2/1s"); err == nil {
+			t.Error("expected a max delay below the base delay rejected")
+		}
+	})
+}
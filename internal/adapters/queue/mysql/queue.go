@@ -0,0 +1,766 @@
+package mysql
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/media-vault-sync/internal/adapters/queue/workerpool"
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+const (
+	// LeaseDuration is how long a claim holds a message; a delivery renews
+	// it every third of the duration while its handler runs.
+	LeaseDuration = 5 * time.Minute
+	ClaimBatch    = 100
+	// DedupWindow is how long a published MessageID suppresses the same ID.
+	DedupWindow = 10 * time.Minute
+)
+
+// errLeaseLost means the lease of a claimed message expired and another
+// consumer may have claimed it since, so the outcome was not recorded.
+var errLeaseLost = errors.New("lease lost")
+
+type subscription struct {
+	id         string
+	group      string
+	topic      string
+	providerID string
+	handler    services.MessageHandler
+}
+
+func (s *subscription) matches(msg services.Message) bool {
+	if s.topic != msg.Topic {
+		return false
+	}
+	return s.providerID == "" || s.providerID == msg.Metadata["providerID"]
+}
+
+type claimedMessage struct {
+	id int64
+	// group is empty for a message published before any group matched it,
+	// until it is delivered
+	group    string
+	msg      services.Message
+	attempts int
+}
+
+// Queue persists messages in the queue_messages table, one row per consumer
+// group registered in queue_consumer_groups. Rows are claimed with a lease,
+// so several processes can tick the same table; a process only claims rows
+// of the groups of its own subscriptions.
+type Queue struct {
+	db             *sql.DB
+	clock          services.Clock
+	owner          string
+	leaseDuration  time.Duration
+	mu             sync.RWMutex
+	subscriptions  map[string]*subscription
+	deadLetterRepo services.DeadLetterRepository
+	dedupWindow    time.Duration
+	retryPolicy    services.RetryPolicy
+	topicPolicies  map[string]services.RetryPolicy
+	concurrency    int
+	topicWorkers   map[string]int
+	workers        *workerpool.Pools
+	// turns counts the deliveries of each group to take turns among its members
+	turns map[string]int
+}
+
+type Option func(*Queue)
+
+// WithDeadLetterRepository stores messages that exhausted their retry
+// policy instead of deleting them.
+func WithDeadLetterRepository(repo services.DeadLetterRepository) Option {
+	return func(q *Queue) {
+		q.deadLetterRepo = repo
+	}
+}
+
+// WithDedupWindow changes how long a published MessageID suppresses later
+// messages with the same ID; zero turns deduplication off.
+func WithDedupWindow(window time.Duration) Option {
+	return func(q *Queue) {
+		q.dedupWindow = window
+	}
+}
+
+// WithRetryPolicy replaces services.DefaultRetryPolicy for topics without a
+// policy of their own.
+func WithRetryPolicy(policy services.RetryPolicy) Option {
+	return func(q *Queue) {
+		q.retryPolicy = policy
+	}
+}
+
+// WithTopicRetryPolicies retries failed messages of each topic in policies
+// by its own policy.
+func WithTopicRetryPolicies(policies map[string]services.RetryPolicy) Option {
+	return func(q *Queue) {
+		for topic, policy := range policies {
+			q.topicPolicies[topic] = policy
+		}
+	}
+}
+
+// WithLeaseDuration changes how long a claim holds a message before another
+// consumer may claim it, unless the delivery renews it.
+func WithLeaseDuration(d time.Duration) Option {
+	return func(q *Queue) {
+		q.leaseDuration = d
+	}
+}
+
+// WithConcurrency runs up to n handlers of each topic at once, for topics
+// without a count of their own; the default is one.
+func WithConcurrency(n int) Option {
+	return func(q *Queue) {
+		q.concurrency = n
+	}
+}
+
+// WithTopicConcurrency runs up to the given number of handlers of each topic
+// in concurrency at once.
+func WithTopicConcurrency(concurrency map[string]int) Option {
+	return func(q *Queue) {
+		for topic, n := range concurrency {
+			q.topicWorkers[topic] = n
+		}
+	}
+}
+
+func NewQueue(db *sql.DB, clock services.Clock, opts ...Option) *Queue {
+	q := &Queue{
+		db:            db,
+		clock:         clock,
+		owner:         newLeaseOwner(),
+		leaseDuration: LeaseDuration,
+		subscriptions: make(map[string]*subscription),
+		dedupWindow:   DedupWindow,
+		retryPolicy:   services.DefaultRetryPolicy,
+		topicPolicies: make(map[string]services.RetryPolicy),
+		concurrency:   1,
+		topicWorkers:  make(map[string]int),
+		turns:         make(map[string]int),
+	}
+	for _, opt := range opts {
+		opt(q)
+	}
+	q.workers = workerpool.New(q.concurrency, q.topicWorkers)
+	return q
+}
+
+func newLeaseOwner() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Publish records the MessageID in queue_message_ids in the same transaction
+// as the message, so concurrent publishes of one ID insert it only once.
+func (q *Queue) Publish(ctx context.Context, msg services.Message) error {
+	now := q.clock.Now()
+	if msg.MessageID == "" {
+		msg.MessageID = services.NewID()
+	}
+	if msg.DeliverAt.IsZero() {
+		msg.DeliverAt = now
+	}
+
+	tx, err := q.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if q.dedupWindow > 0 {
+		duplicate, err := q.rememberID(ctx, tx, msg.MessageID, now)
+		if err != nil || duplicate {
+			return err
+		}
+	}
+
+	groups, err := q.groupsFor(ctx, tx, msg)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO queue_messages (message_id, topic, provider_id, consumer_group, ordering_key, payload, metadata, deliver_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	payload := msg.Payload
+	if payload == nil {
+		payload = []byte{}
+	}
+	orderingKey := msg.Metadata[services.MetadataOrderingKey]
+
+	for _, group := range groups {
+		groupMsg := msg
+		if group != "" {
+			groupMsg = msg.WithMetadata(services.MetadataConsumerGroup, group)
+		}
+		metadata, err := json.Marshal(groupMsg.Metadata)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, query,
+			msg.MessageID,
+			msg.Topic,
+			msg.Metadata["providerID"],
+			group,
+			sql.NullString{String: orderingKey, Valid: orderingKey != ""},
+			payload,
+			string(metadata),
+			msg.DeliverAt.UTC(),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// groupsFor returns the consumer groups that get a copy of msg: the one it
+// names, or else every registered group matching it. A message no group
+// matches yet goes to the first one that claims it.
+func (q *Queue) groupsFor(ctx context.Context, tx *sql.Tx, msg services.Message) ([]string, error) {
+	if group := msg.Metadata[services.MetadataConsumerGroup]; group != "" {
+		return []string{group}, nil
+	}
+
+	query := `
+		SELECT DISTINCT consumer_group
+		FROM queue_consumer_groups
+		WHERE topic = ? AND provider_id IN ('', ?)
+		ORDER BY consumer_group
+	`
+
+	rows, err := tx.QueryContext(ctx, query, msg.Topic, msg.Metadata["providerID"])
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []string
+	for rows.Next() {
+		var group string
+		if err := rows.Scan(&group); err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(groups) == 0 {
+		return []string{""}, nil
+	}
+	return groups, nil
+}
+
+// rememberID records messageID, taking over a record that left the dedup
+// window, and reports whether it was published within the window.
+func (q *Queue) rememberID(ctx context.Context, tx *sql.Tx, messageID string, now time.Time) (bool, error) {
+	query := `
+		INSERT INTO queue_message_ids (message_id, published_at)
+		VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE published_at = IF(published_at <= ?, ?, published_at)
+	`
+
+	result, err := tx.ExecContext(ctx, query, messageID, now.UTC(), now.Add(-q.dedupWindow).UTC(), now.UTC())
+	if err != nil {
+		return false, err
+	}
+
+	// 1 for a new row, 2 for a taken over one, 0 when the row was left as is
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 0, nil
+}
+
+// forgetIDs removes IDs that left the dedup window.
+func (q *Queue) forgetIDs(ctx context.Context) error {
+	query := `
+		DELETE FROM queue_message_ids
+		WHERE published_at <= ?
+		LIMIT ?
+	`
+	_, err := q.db.ExecContext(ctx, query, q.clock.Now().Add(-q.dedupWindow).UTC(), ClaimBatch)
+	return err
+}
+
+// Subscribe registers the consumer group of the subscription in
+// queue_consumer_groups, so messages published from then on are copied to it
+// even while none of its members runs. Unsubscribe leaves the group in place.
+func (q *Queue) Subscribe(ctx context.Context, subscriptionID string, topic string, providerID string, handler services.MessageHandler, opts ...services.SubscribeOption) error {
+	group := services.NewSubscribeOptions(subscriptionID, opts...).Group
+
+	query := `
+		INSERT INTO queue_consumer_groups (topic, provider_id, consumer_group, created_at)
+		VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE consumer_group = consumer_group
+	`
+	if _, err := q.db.ExecContext(ctx, query, topic, providerID, group, q.clock.Now().UTC()); err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.subscriptions[subscriptionID] = &subscription{
+		id:         subscriptionID,
+		group:      group,
+		topic:      topic,
+		providerID: providerID,
+		handler:    handler,
+	}
+	return nil
+}
+
+func (q *Queue) Unsubscribe(subscriptionID string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.subscriptions, subscriptionID)
+	return nil
+}
+
+// Tick hands the claimed messages to the workers of their topics and waits
+// for their handlers. A topic claims no more messages than it has free
+// workers.
+func (q *Queue) Tick(ctx context.Context) (delivered int, requeued int) {
+	if err := q.forgetIDs(ctx); err != nil {
+		log.Printf("failed to forget expired message IDs: %v", err)
+	}
+
+	claimed, err := q.claim(ctx)
+	if err != nil || len(claimed) == 0 {
+		return 0, 0
+	}
+
+	var mu sync.Mutex
+	var batch sync.WaitGroup
+
+	for _, cm := range claimed {
+		batch.Add(1)
+		q.workers.Go(cm.msg.Topic, cm.group, cm.msg.Metadata[services.MetadataOrderingKey], func() {
+			defer batch.Done()
+			ok, retried := q.deliver(ctx, cm)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if ok {
+				delivered++
+			} else if retried {
+				requeued++
+			}
+		})
+	}
+	batch.Wait()
+
+	return delivered, requeued
+}
+
+// Run keeps the workers busy until ctx is cancelled, claiming messages every
+// interval and whenever a worker frees up. It then waits for the handlers in
+// flight, which get a context that ctx does not cancel so shutting down does
+// not cut them off halfway.
+func (q *Queue) Run(ctx context.Context, interval time.Duration) {
+	handlerCtx := context.WithoutCancel(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := q.forgetIDs(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("failed to forget expired message IDs: %v", err)
+		}
+		claimed, err := q.claim(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("failed to claim queue messages: %v", err)
+		}
+		for _, cm := range claimed {
+			q.workers.Go(cm.msg.Topic, cm.group, cm.msg.Metadata[services.MetadataOrderingKey], func() {
+				q.deliver(handlerCtx, cm)
+			})
+		}
+
+		select {
+		case <-ctx.Done():
+			q.workers.Wait()
+			return
+		case <-ticker.C:
+		case <-q.workers.Freed():
+		}
+	}
+}
+
+// deliver runs the handler of cm's subscription, renewing the lease while it
+// runs, and reports whether it succeeded, or else whether the message was
+// rescheduled for a retry.
+func (q *Queue) deliver(ctx context.Context, cm claimedMessage) (ok bool, retried bool) {
+	sub := q.member(cm.msg, cm.group)
+	if sub == nil {
+		// the subscription went away after the claim; let another consumer have it
+		q.logSettleError("release", cm, q.release(ctx, cm))
+		return false, false
+	}
+	if cm.group == "" {
+		cm.group = sub.group
+		cm.msg = cm.msg.WithMetadata(services.MetadataConsumerGroup, sub.group)
+	}
+
+	handlerCtx, cancel := context.WithCancelCause(ctx)
+	handlerCtx = services.WithLeaseRenewal(handlerCtx, func(ctx context.Context) error {
+		err := q.renew(ctx, cm)
+		if errors.Is(err, errLeaseLost) {
+			cancel(errLeaseLost)
+		}
+		return err
+	})
+	stopRenewing := q.renewLease(handlerCtx, cancel, cm)
+	err := sub.handler(handlerCtx, cm.msg.WithMetadata(services.MetadataAttempt, strconv.Itoa(cm.attempts+1)))
+	stopRenewing()
+	cancel(nil)
+	if err == nil {
+		if err := q.remove(ctx, cm); err != nil {
+			q.logSettleError("remove", cm, err)
+			return false, false
+		}
+		return true, false
+	}
+
+	cm.attempts++
+	policy := q.retryPolicyFor(cm.msg.Topic)
+	retryable := services.IsRetryable(err)
+	if !retryable {
+		log.Printf("message %s on topic %s failed permanently: %v", cm.msg.MessageID, cm.msg.Topic, err)
+	}
+	if !retryable || policy.Exhausted(cm.attempts) {
+		q.logSettleError("dead-letter", cm, q.deadLetter(ctx, cm, err))
+		return false, false
+	}
+	cm.msg = cm.msg.WithMetadata(services.MetadataLastError, err.Error())
+	cm.msg.DeliverAt = q.clock.Now().Add(policy.Delay(cm.attempts))
+	if err := q.reschedule(ctx, cm); err != nil {
+		q.logSettleError("reschedule", cm, err)
+		return false, false
+	}
+	return false, true
+}
+
+// renewLease extends the lease of cm every third of the lease duration until
+// the returned stop is called, so a long handler keeps its message. Once the
+// lease is lost to another consumer it stops and cancels the handler with
+// errLeaseLost.
+func (q *Queue) renewLease(ctx context.Context, cancel context.CancelCauseFunc, cm claimedMessage) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(q.leaseDuration / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			err := q.renew(ctx, cm)
+			if errors.Is(err, errLeaseLost) {
+				log.Printf("lost the lease of message %s on topic %s to another consumer; cancelling its handler", cm.msg.MessageID, cm.msg.Topic)
+				cancel(errLeaseLost)
+				return
+			}
+			if err != nil {
+				log.Printf("failed to renew the lease of message %s on topic %s: %v", cm.msg.MessageID, cm.msg.Topic, err)
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+func (q *Queue) renew(ctx context.Context, cm claimedMessage) error {
+	query := `
+		UPDATE queue_messages
+		SET lease_expires_at = ?
+		WHERE id = ? AND lease_owner = ?
+	`
+	leaseExpiresAt := q.clock.Now().Add(q.leaseDuration).UTC()
+	return leased(q.db.ExecContext(ctx, query, leaseExpiresAt, cm.id, q.owner))
+}
+
+func (q *Queue) logSettleError(action string, cm claimedMessage, err error) {
+	if err == nil {
+		return
+	}
+	if errors.Is(err, errLeaseLost) {
+		log.Printf("could not %s message %s on topic %s: lease lost, another consumer may handle it again", action, cm.msg.MessageID, cm.msg.Topic)
+		return
+	}
+	log.Printf("failed to %s message %s on topic %s: %v", action, cm.msg.MessageID, cm.msg.Topic, err)
+}
+
+func (q *Queue) Process(ctx context.Context) (totalDelivered int) {
+	for {
+		delivered, requeued := q.Tick(ctx)
+		totalDelivered += delivered
+		if delivered == 0 && requeued == 0 {
+			break
+		}
+	}
+	return totalDelivered
+}
+
+func (q *Queue) PendingCount() int {
+	var count int
+	if err := q.db.QueryRow(`SELECT COUNT(*) FROM queue_messages`).Scan(&count); err != nil {
+		return 0
+	}
+	return count
+}
+
+// member picks the subscription of group that handles msg, taking turns
+// among the group's members. A message of no group yet goes to the group of
+// the first subscription matching it.
+func (q *Queue) member(msg services.Message, group string) *subscription {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var members []*subscription
+	for _, sub := range q.subscriptions {
+		if sub.matches(msg) && (group == "" || sub.group == group) {
+			members = append(members, sub)
+		}
+	}
+	if len(members) == 0 {
+		return nil
+	}
+	slices.SortFunc(members, func(a, b *subscription) int {
+		return cmp.Compare(a.id, b.id)
+	})
+	if group == "" {
+		group = members[0].group
+		members = slices.DeleteFunc(members, func(sub *subscription) bool {
+			return sub.group != group
+		})
+	}
+
+	turn := q.turns[group]
+	q.turns[group]++
+	return members[turn%len(members)]
+}
+
+func (q *Queue) retryPolicyFor(topic string) services.RetryPolicy {
+	if policy, ok := q.topicPolicies[topic]; ok {
+		return policy
+	}
+	return q.retryPolicy
+}
+
+func (q *Queue) routingFilter() (string, []any) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	var clauses []string
+	var args []any
+	for _, sub := range q.subscriptions {
+		if sub.providerID == "" {
+			clauses = append(clauses, "(topic = ? AND consumer_group IN ('', ?))")
+			args = append(args, sub.topic, sub.group)
+		} else {
+			clauses = append(clauses, "(topic = ? AND provider_id = ? AND consumer_group IN ('', ?))")
+			args = append(args, sub.topic, sub.providerID, sub.group)
+		}
+	}
+	if len(clauses) == 0 {
+		return "", nil
+	}
+	return "(" + strings.Join(clauses, " OR ") + ")", args
+}
+
+func (q *Queue) claim(ctx context.Context) ([]claimedMessage, error) {
+	filter, filterArgs := q.routingFilter()
+	if filter == "" {
+		return nil, nil
+	}
+
+	now := q.clock.Now().UTC()
+
+	tx, err := q.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// a message waits behind an earlier one of its group with the same
+	// ordering key that is ready, in flight or waiting for its retry
+	query := `
+		SELECT m.id, m.message_id, m.topic, m.consumer_group, m.payload, m.metadata, m.deliver_at, m.attempts
+		FROM queue_messages m
+		WHERE m.deliver_at <= ?
+			AND (m.lease_expires_at IS NULL OR m.lease_expires_at <= ?)
+			AND ` + filter + `
+			AND (m.ordering_key IS NULL OR NOT EXISTS (
+				SELECT 1 FROM queue_messages e
+				WHERE e.topic = m.topic
+					AND e.consumer_group = m.consumer_group
+					AND e.ordering_key = m.ordering_key
+					AND e.id < m.id
+					AND (e.deliver_at <= ? OR e.attempts > 0)
+			))
+		ORDER BY m.deliver_at, m.id
+		LIMIT ?
+		FOR UPDATE SKIP LOCKED
+	`
+
+	args := append([]any{now, now}, filterArgs...)
+	args = append(args, now, ClaimBatch)
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var claimed []claimedMessage
+	for rows.Next() {
+		var cm claimedMessage
+		var metadata string
+		err := rows.Scan(
+			&cm.id,
+			&cm.msg.MessageID,
+			&cm.msg.Topic,
+			&cm.group,
+			&cm.msg.Payload,
+			&metadata,
+			&cm.msg.DeliverAt,
+			&cm.attempts,
+		)
+		if err != nil {
+			rows.Close()
+			q.releaseWorkers(claimed)
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(metadata), &cm.msg.Metadata); err != nil {
+			rows.Close()
+			q.releaseWorkers(claimed)
+			return nil, err
+		}
+		// rows without a free worker stay unleased for a later claim
+		if q.workers.TryAcquire(cm.msg.Topic, cm.group, cm.msg.Metadata[services.MetadataOrderingKey]) {
+			claimed = append(claimed, cm)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		q.releaseWorkers(claimed)
+		return nil, err
+	}
+
+	leaseQuery := `
+		UPDATE queue_messages
+		SET lease_owner = ?, lease_expires_at = ?
+		WHERE id = ?
+	`
+	leaseExpiresAt := now.Add(q.leaseDuration)
+	for _, cm := range claimed {
+		if _, err := tx.ExecContext(ctx, leaseQuery, q.owner, leaseExpiresAt, cm.id); err != nil {
+			q.releaseWorkers(claimed)
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		q.releaseWorkers(claimed)
+		return nil, err
+	}
+	return claimed, nil
+}
+
+func (q *Queue) releaseWorkers(claimed []claimedMessage) {
+	for _, cm := range claimed {
+		q.workers.Release(cm.msg.Topic, cm.group, cm.msg.Metadata[services.MetadataOrderingKey])
+	}
+}
+
+// deadLetter only removes the row once the dead letter is stored; otherwise
+// the message stays in the queue and is retried.
+func (q *Queue) deadLetter(ctx context.Context, cm claimedMessage, lastErr error) error {
+	if q.deadLetterRepo != nil {
+		dl := services.NewDeadLetter(cm.msg, cm.attempts, lastErr, q.clock.Now())
+		if err := q.deadLetterRepo.Add(ctx, dl); err != nil {
+			q.logSettleError("release", cm, q.release(ctx, cm))
+			return fmt.Errorf("storing dead letter: %w", err)
+		}
+	}
+	return q.remove(ctx, cm)
+}
+
+func (q *Queue) release(ctx context.Context, cm claimedMessage) error {
+	query := `
+		UPDATE queue_messages
+		SET attempts = ?, lease_owner = NULL, lease_expires_at = NULL
+		WHERE id = ? AND lease_owner = ?
+	`
+	return leased(q.db.ExecContext(ctx, query, cm.attempts, cm.id, q.owner))
+}
+
+// reschedule releases a failed message for its next attempt, keeping the
+// last error in its metadata and the group it was delivered to.
+func (q *Queue) reschedule(ctx context.Context, cm claimedMessage) error {
+	metadata, err := json.Marshal(cm.msg.Metadata)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE queue_messages
+		SET consumer_group = ?, attempts = ?, metadata = ?, deliver_at = ?, lease_owner = NULL, lease_expires_at = NULL
+		WHERE id = ? AND lease_owner = ?
+	`
+	return leased(q.db.ExecContext(ctx, query, cm.group, cm.attempts, string(metadata), cm.msg.DeliverAt.UTC(), cm.id, q.owner))
+}
+
+func (q *Queue) remove(ctx context.Context, cm claimedMessage) error {
+	query := `
+		DELETE FROM queue_messages
+		WHERE id = ? AND lease_owner = ?
+	`
+	return leased(q.db.ExecContext(ctx, query, cm.id, q.owner))
+}
+
+// leased returns errLeaseLost when a statement filtered on the lease owner
+// matched no row.
+func leased(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errLeaseLost
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package mysql_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/media-vault-sync/internal/adapters/queue/mysql"
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+func TestMySQLQueue_OrderingKeysKeepPublishOrderAcrossWorkers(t *testing.T) {
+	clock := services.NewFakeClock(time.Now())
+	q := newTestQueue(t, clock, mysql.WithConcurrency(4))
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	received := map[string][]string{}
+	failures := 1
+	q.Subscribe(ctx, "sub1", "videoupload", "p1", func(ctx context.Context, msg services.Message) error {
+		key := msg.Metadata[services.MetadataOrderingKey]
+		mu.Lock()
+		defer mu.Unlock()
+		received[key] = append(received[key], string(msg.Payload))
+		if key == "album1" && failures > 0 {
+			failures--
+			return errors.New("cloud unavailable")
+		}
+		return nil
+	})
+	for _, m := range []struct{ key, payload string }{
+		{"album1", "1"}, {"album2", "1"}, {"album1", "2"}, {"album2", "2"},
+	} {
+		q.Publish(ctx, services.Message{
+			Topic:    "videoupload",
+			Payload:  []byte(m.payload),
+			Metadata: map[string]string{"providerID": "p1", services.MetadataOrderingKey: m.key},
+		})
+	}
+
+	q.Process(ctx)
+	if got := received["album2"]; len(got) != 2 || got[0] != "1" || got[1] != "2" {
+		t.Errorf("expected album2 in publish order, got %v", got)
+	}
+	if got := received["album1"]; len(got) != 1 || q.PendingCount() != 2 {
+		t.Fatalf("expected album1 held back by its retry, got %v with %d pending", got, q.PendingCount())
+	}
+
+	clock.Advance(time.Second)
+	q.Process(ctx)
+	if got := received["album1"]; len(got) != 3 || got[1] != "1" || got[2] != "2" {
+		t.Errorf("expected the retry before the next album1 message, got %v", got)
+	}
+}
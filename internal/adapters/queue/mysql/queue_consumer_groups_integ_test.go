@@ -0,0 +1,58 @@
+package mysql_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+func TestMySQLQueue_ConsumerGroupsEachGetEveryMessage(t *testing.T) {
+	clock := services.NewFakeClock(time.Now())
+	q := newTestQueue(t, clock)
+	ctx := context.Background()
+	p1 := map[string]string{"providerID": "p1"}
+
+	var mu sync.Mutex
+	received := map[string]int{}
+	subscribe := func(id string, opts ...services.SubscribeOption) {
+		t.Helper()
+		err := q.Subscribe(ctx, id, "albummanifestupload", "p1", func(ctx context.Context, msg services.Message) error {
+			mu.Lock()
+			defer mu.Unlock()
+			received[id]++
+			return nil
+		}, opts...)
+		if err != nil {
+			t.Fatalf("subscribe failed: %v", err)
+		}
+	}
+	subscribe("worker-a", services.InGroup("onprem"))
+	subscribe("worker-b", services.InGroup("onprem"))
+	subscribe("audit")
+
+	for range 2 {
+		q.Publish(ctx, services.Message{Topic: "albummanifestupload", Metadata: p1})
+	}
+	if delivered := q.Process(ctx); delivered != 4 {
+		t.Fatalf("expected a copy of each message per group, got %d delivered", delivered)
+	}
+	if received["worker-a"] != 1 || received["worker-b"] != 1 || received["audit"] != 2 {
+		t.Errorf("expected onprem members to share and audit to get both, got %v", received)
+	}
+
+	// the group stays registered, so it gets the messages published while it is away
+	q.Unsubscribe("audit")
+	q.Publish(ctx, services.Message{Topic: "albummanifestupload", Metadata: p1})
+	q.Process(ctx)
+	if q.PendingCount() != 1 {
+		t.Fatalf("expected the audit copy to wait for its group, got %d pending", q.PendingCount())
+	}
+	subscribe("audit")
+	q.Process(ctx)
+	if received["audit"] != 3 || q.PendingCount() != 0 {
+		t.Errorf("expected audit to catch up, got %v with %d pending", received, q.PendingCount())
+	}
+}
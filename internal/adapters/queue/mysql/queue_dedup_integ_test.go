@@ -0,0 +1,51 @@
+package mysql_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+func TestMySQLQueue_DuplicateMessageIDsAreDroppedWithinTheWindow(t *testing.T) {
+	clock := services.NewFakeClock(time.Now())
+	q := newTestQueue(t, clock)
+	ctx := context.Background()
+
+	var received []services.Message
+	q.Subscribe(ctx, "sub1", "usersync", "p1", func(ctx context.Context, msg services.Message) error {
+		received = append(received, msg)
+		return nil
+	})
+
+	publish := func(messageID string) {
+		t.Helper()
+		if err := q.Publish(ctx, services.Message{
+			MessageID: messageID,
+			Topic:     "usersync",
+			Payload:   []byte(`{"databaseID":"db1","userID":"user1"}`),
+			Metadata:  map[string]string{"providerID": "p1"},
+		}); err != nil {
+			t.Fatalf("publish failed: %v", err)
+		}
+	}
+
+	publish("dup-1")
+	publish("dup-1")
+	publish("")
+	q.Process(ctx)
+	if len(received) != 2 {
+		t.Fatalf("expected the duplicate dropped, got %d deliveries", len(received))
+	}
+	if received[1].MessageID == "" {
+		t.Error("a message published without an ID should get one")
+	}
+
+	clock.Advance(11 * time.Minute)
+	publish("dup-1")
+	q.Process(ctx)
+	if len(received) != 3 {
+		t.Errorf("expected the ID published again after the window, got %d deliveries", len(received))
+	}
+}
@@ -0,0 +1,90 @@
+package mysql_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/media-vault-sync/internal/adapters/queue/mysql"
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+func TestMySQLQueue_LongHandlersKeepTheirLease(t *testing.T) {
+	clock := services.RealClock{}
+	lease := mysql.WithLeaseDuration(300 * time.Millisecond)
+	first := newTestQueue(t, clock, lease)
+	second := newTestQueue(t, clock, lease)
+	ctx := context.Background()
+
+	var handled atomic.Int32
+	handler := func(ctx context.Context, msg services.Message) error {
+		handled.Add(1)
+		time.Sleep(time.Second)
+		return nil
+	}
+	first.Subscribe(ctx, "onprem:p1:videoupload", "videoupload", "p1", handler)
+	second.Subscribe(ctx, "onprem:p1:videoupload", "videoupload", "p1", handler)
+	first.Publish(ctx, services.Message{Topic: "videoupload", Metadata: map[string]string{"providerID": "p1"}})
+
+	done := make(chan int)
+	go func() {
+		delivered, _ := first.Tick(ctx)
+		done <- delivered
+	}()
+
+	// well past the lease the first process would hold without renewing it
+	time.Sleep(600 * time.Millisecond)
+	if delivered, _ := second.Tick(ctx); delivered != 0 {
+		t.Errorf("expected the message still leased to the first process, got %d delivered", delivered)
+	}
+
+	if delivered := <-done; delivered != 1 {
+		t.Errorf("expected the first process to settle the message, got %d delivered", delivered)
+	}
+	if handled.Load() != 1 || first.PendingCount() != 0 {
+		t.Errorf("expected one handler run and no pending rows, got %d with %d pending", handled.Load(), first.PendingCount())
+	}
+}
+
+func TestMySQLQueue_LosingTheLeaseCancelsTheHandler(t *testing.T) {
+	// the first process's clock lags, so its lease has expired for the second
+	lagging := services.NewFakeClock(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC))
+	lease := mysql.WithLeaseDuration(300 * time.Millisecond)
+	first := newTestQueue(t, lagging, lease)
+	second := newTestQueue(t, services.RealClock{}, lease)
+	ctx := context.Background()
+
+	cause := make(chan error, 1)
+	first.Subscribe(ctx, "onprem:p1:videoupload", "videoupload", "p1", func(ctx context.Context, msg services.Message) error {
+		select {
+		case <-ctx.Done():
+			cause <- context.Cause(ctx)
+		case <-time.After(2 * time.Second):
+			cause <- nil
+		}
+		return nil
+	})
+	second.Subscribe(ctx, "onprem:p1:videoupload", "videoupload", "p1", func(ctx context.Context, msg services.Message) error {
+		return nil
+	})
+	first.Publish(ctx, services.Message{Topic: "videoupload", Metadata: map[string]string{"providerID": "p1"}})
+
+	done := make(chan int)
+	go func() {
+		delivered, _ := first.Tick(ctx)
+		done <- delivered
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	if delivered, _ := second.Tick(ctx); delivered != 1 {
+		t.Fatalf("expected the second process to claim the expired lease, got %d delivered", delivered)
+	}
+
+	if err := <-cause; err == nil || err.Error() != "lease lost" {
+		t.Errorf("expected the first handler cancelled for the lost lease, got %v", err)
+	}
+	if delivered := <-done; delivered != 0 {
+		t.Errorf("expected the first process not to settle the message, got %d delivered", delivered)
+	}
+}
@@ -0,0 +1,52 @@
+package mysql_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/media-vault-sync/internal/adapters/queue/mysql"
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+func TestMySQLQueue_FailedMessagesAreRescheduledWithTheirLastError(t *testing.T) {
+	clock := services.NewFakeClock(time.Now())
+	q := newTestQueue(t, clock, mysql.WithRetryPolicy(services.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, Multiplier: 2}))
+	ctx := context.Background()
+
+	var received []services.Message
+	q.Subscribe(ctx, "sub1", "usersync", "p1", func(ctx context.Context, msg services.Message) error {
+		received = append(received, msg)
+		return fmt.Errorf("attempt %d failed", len(received))
+	})
+	q.Publish(ctx, services.Message{MessageID: "m1", Topic: "usersync", Metadata: map[string]string{"providerID": "p1"}})
+
+	q.Process(ctx)
+	if len(received) != 1 {
+		t.Fatalf("expected the retry to wait for its delay, got %d attempts", len(received))
+	}
+
+	clock.Advance(time.Second)
+	q.Process(ctx)
+	if len(received) != 2 {
+		t.Fatalf("expected the second attempt after a second, got %d attempts", len(received))
+	}
+	if received[1].Metadata[services.MetadataAttempt] != "2" || received[1].Metadata[services.MetadataLastError] != "attempt 1 failed" {
+		t.Errorf("expected attempt 2 after attempt 1 failed, got %v", received[1].Metadata)
+	}
+	if received[1].Metadata["providerID"] != "p1" {
+		t.Error("rescheduling must keep the routing metadata")
+	}
+
+	clock.Advance(time.Second)
+	q.Process(ctx)
+	if len(received) != 2 {
+		t.Errorf("the third attempt waits two seconds, got %d attempts", len(received))
+	}
+	clock.Advance(time.Second)
+	q.Process(ctx)
+	if len(received) != 3 || q.PendingCount() != 0 {
+		t.Errorf("expected the message removed after its last attempt, got %d attempts and %d pending", len(received), q.PendingCount())
+	}
+}
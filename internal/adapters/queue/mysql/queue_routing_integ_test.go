@@ -0,0 +1,172 @@
+package mysql_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/media-vault-sync/internal/adapters/queue/mysql"
+	mysqlrepo "github.com/media-vault-sync/internal/adapters/repo/mysql"
+	"github.com/media-vault-sync/internal/core/services"
+	"github.com/media-vault-sync/migrations"
+)
+
+func TestMySQLQueue_RoutingByProviderID(t *testing.T) {
+	clock := services.NewFakeClock(time.Now())
+	q := newTestQueue(t, clock)
+	ctx := context.Background()
+
+	var receivedP1 []services.Message
+
+	err := q.Subscribe(ctx, "onprem:p1", "usersync", "p1", func(ctx context.Context, msg services.Message) error {
+		receivedP1 = append(receivedP1, msg)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+
+	err = q.Publish(ctx, services.Message{
+		MessageID: "msg-1",
+		Topic:     "usersync",
+		Payload:   []byte(`{"databaseID":"db1","userID":"user1"}`),
+		Metadata:  map[string]string{"providerID": "p1"},
+	})
+	if err != nil {
+		t.Fatalf("publish failed: %v", err)
+	}
+
+	delivered := q.Process(ctx)
+
+	if delivered != 1 {
+		t.Errorf("expected 1 message delivered, got %d", delivered)
+	}
+	if len(receivedP1) != 1 {
+		t.Fatalf("expected p1 subscriber to receive 1 message, got %d", len(receivedP1))
+	}
+	if receivedP1[0].MessageID != "msg-1" {
+		t.Errorf("expected message ID 'msg-1', got %s", receivedP1[0].MessageID)
+	}
+}
+
+func TestMySQLQueue_RoutingDoesNotDeliverToWrongProvider(t *testing.T) {
+	clock := services.NewFakeClock(time.Now())
+	q := newTestQueue(t, clock)
+	ctx := context.Background()
+
+	var receivedP1 []services.Message
+
+	err := q.Subscribe(ctx, "onprem:p1", "usersync", "p1", func(ctx context.Context, msg services.Message) error {
+		receivedP1 = append(receivedP1, msg)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+
+	err = q.Publish(ctx, services.Message{
+		MessageID: "msg-2",
+		Topic:     "usersync",
+		Payload:   []byte(`{"databaseID":"db1","userID":"user2"}`),
+		Metadata:  map[string]string{"providerID": "p2"},
+	})
+	if err != nil {
+		t.Fatalf("publish failed: %v", err)
+	}
+
+	q.Process(ctx)
+
+	if len(receivedP1) != 0 {
+		t.Errorf("expected p1 subscriber to receive 0 messages (message was for p2), got %d", len(receivedP1))
+	}
+}
+
+func TestMySQLQueue_MultipleSubscribersRouteCorrectly(t *testing.T) {
+	clock := services.NewFakeClock(time.Now())
+	q := newTestQueue(t, clock)
+	ctx := context.Background()
+
+	var receivedP1, receivedP2 []services.Message
+
+	err := q.Subscribe(ctx, "onprem:p1", "usersync", "p1", func(ctx context.Context, msg services.Message) error {
+		receivedP1 = append(receivedP1, msg)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("subscribe p1 failed: %v", err)
+	}
+
+	err = q.Subscribe(ctx, "onprem:p2", "usersync", "p2", func(ctx context.Context, msg services.Message) error {
+		receivedP2 = append(receivedP2, msg)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("subscribe p2 failed: %v", err)
+	}
+
+	err = q.Publish(ctx, services.Message{
+		MessageID: "msg-for-p1",
+		Topic:     "usersync",
+		Payload:   []byte(`{"databaseID":"db1","userID":"user1"}`),
+		Metadata:  map[string]string{"providerID": "p1"},
+	})
+	if err != nil {
+		t.Fatalf("publish failed: %v", err)
+	}
+
+	err = q.Publish(ctx, services.Message{
+		MessageID: "msg-for-p2",
+		Topic:     "usersync",
+		Payload:   []byte(`{"databaseID":"db1","userID":"user2"}`),
+		Metadata:  map[string]string{"providerID": "p2"},
+	})
+	if err != nil {
+		t.Fatalf("publish failed: %v", err)
+	}
+
+	delivered := q.Process(ctx)
+
+	if delivered != 2 {
+		t.Errorf("expected 2 messages delivered, got %d", delivered)
+	}
+
+	if len(receivedP1) != 1 {
+		t.Errorf("expected p1 subscriber to receive 1 message, got %d", len(receivedP1))
+	} else if receivedP1[0].MessageID != "msg-for-p1" {
+		t.Errorf("p1 received wrong message: %s", receivedP1[0].MessageID)
+	}
+
+	if len(receivedP2) != 1 {
+		t.Errorf("expected p2 subscriber to receive 1 message, got %d", len(receivedP2))
+	} else if receivedP2[0].MessageID != "msg-for-p2" {
+		t.Errorf("p2 received wrong message: %s", receivedP2[0].MessageID)
+	}
+}
+
+func newTestQueue(t *testing.T, clock services.Clock, opts ...mysql.Option) *mysql.Queue {
+	t.Helper()
+
+	dsn := os.Getenv("MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("MYSQL_DSN not set, skipping integration test")
+	}
+
+	ctx := context.Background()
+	db, err := mysqlrepo.Open(ctx, dsn, mysqlrepo.PoolConfig{MaxOpenConns: 5, MaxIdleConns: 5})
+	if err != nil {
+		t.Fatalf("failed to connect to MySQL: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := mysqlrepo.Migrate(ctx, db, migrations.Files); err != nil {
+		t.Fatalf("failed to run migrations: %v", err)
+	}
+	for _, table := range []string{"queue_messages", "queue_message_ids", "queue_consumer_groups"} {
+		if _, err := db.Exec("DELETE FROM " + table); err != nil {
+			t.Fatalf("failed to clean %s: %v", table, err)
+		}
+	}
+
+	return mysql.NewQueue(db, clock, opts...)
+}
@@ -0,0 +1,342 @@
+// Package remote implements services.Queue against the queue broker of the
+// cloud API, for an on-prem process that runs apart from the cloud.
+package remote
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+// PollWait is how long a poll waits for a message by default; the broker
+// may cut it shorter.
+const PollWait = 30 * time.Second
+
+type subscription struct {
+	id         string
+	group      string
+	topic      string
+	providerID string
+	handler    services.MessageHandler
+}
+
+// Queue publishes to the broker and long-polls it for the messages of its
+// subscriptions, acknowledging each with the outcome of its handler. The
+// messages wait in the broker's queue, which retries, orders and
+// dead-letters them, so PendingCount is always zero here.
+type Queue struct {
+	baseURL      string
+	httpClient   *http.Client
+	pollWait     time.Duration
+	concurrency  int
+	topicWorkers map[string]int
+
+	mu            sync.RWMutex
+	subscriptions map[string]*subscription
+}
+
+type Option func(*Queue)
+
+// WithPollWait changes how long a poll waits for a message before it is
+// sent again.
+func WithPollWait(wait time.Duration) Option {
+	return func(q *Queue) {
+		q.pollWait = wait
+	}
+}
+
+// WithConcurrency has Run poll each subscription with up to n handlers at
+// once, for topics without a count of their own; the default is one.
+func WithConcurrency(n int) Option {
+	return func(q *Queue) {
+		q.concurrency = n
+	}
+}
+
+// WithTopicConcurrency polls the subscriptions of each topic in concurrency
+// with the given number of handlers at once.
+func WithTopicConcurrency(concurrency map[string]int) Option {
+	return func(q *Queue) {
+		for topic, n := range concurrency {
+			q.topicWorkers[topic] = n
+		}
+	}
+}
+
+func NewQueue(baseURL string, client *http.Client, opts ...Option) *Queue {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	q := &Queue{
+		baseURL:       baseURL,
+		httpClient:    client,
+		pollWait:      PollWait,
+		concurrency:   1,
+		topicWorkers:  make(map[string]int),
+		subscriptions: make(map[string]*subscription),
+	}
+	for _, opt := range opts {
+		opt(q)
+	}
+	return q
+}
+
+func (q *Queue) Publish(ctx context.Context, msg services.Message) error {
+	_, err := q.post(ctx, "/v1/queue/publish", services.NewQueueMessage(msg), nil)
+	return err
+}
+
+// Subscribe only records the subscription; the broker learns of it from its
+// first poll.
+func (q *Queue) Subscribe(ctx context.Context, subscriptionID string, topic string, providerID string, handler services.MessageHandler, opts ...services.SubscribeOption) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.subscriptions[subscriptionID] = &subscription{
+		id:         subscriptionID,
+		group:      services.NewSubscribeOptions(subscriptionID, opts...).Group,
+		topic:      topic,
+		providerID: providerID,
+		handler:    handler,
+	}
+	return nil
+}
+
+func (q *Queue) Unsubscribe(subscriptionID string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.subscriptions, subscriptionID)
+	return nil
+}
+
+// Tick polls every subscription once, all at the same time, and handles the
+// messages that came within the poll wait.
+func (q *Queue) Tick(ctx context.Context) (delivered int, requeued int) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, sub := range q.snapshot() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			delivery, err := q.poll(ctx, sub)
+			if err != nil {
+				log.Printf("polling %s failed: %v", sub.id, err)
+				return
+			}
+			if delivery == nil {
+				return
+			}
+			err = q.handle(ctx, sub, delivery)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil {
+				delivered++
+			} else if services.IsRetryable(err) {
+				requeued++
+			}
+		}()
+	}
+	wg.Wait()
+
+	return delivered, requeued
+}
+
+// Run keeps polling each subscription with as many handlers as its topic has
+// workers until ctx is cancelled, waiting interval after a failed poll. It
+// then waits for the handlers in flight, which get a context that ctx does
+// not cancel, and their acks.
+func (q *Queue) Run(ctx context.Context, interval time.Duration) {
+	handlerCtx := context.WithoutCancel(ctx)
+	var wg sync.WaitGroup
+
+	for _, sub := range q.snapshot() {
+		for range q.concurrencyFor(sub.topic) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				q.pollLoop(ctx, handlerCtx, sub, interval)
+			}()
+		}
+	}
+	wg.Wait()
+}
+
+func (q *Queue) pollLoop(ctx, handlerCtx context.Context, sub *subscription, interval time.Duration) {
+	for ctx.Err() == nil {
+		delivery, err := q.poll(ctx, sub)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("polling %s failed: %v", sub.id, err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(interval):
+			}
+			continue
+		}
+		if delivery != nil {
+			q.handle(handlerCtx, sub, delivery)
+		}
+	}
+}
+
+func (q *Queue) Process(ctx context.Context) (totalDelivered int) {
+	for {
+		delivered, requeued := q.Tick(ctx)
+		totalDelivered += delivered
+		if delivered == 0 && requeued == 0 {
+			break
+		}
+	}
+	return totalDelivered
+}
+
+func (q *Queue) PendingCount() int {
+	return 0
+}
+
+func (q *Queue) snapshot() []*subscription {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	subs := make([]*subscription, 0, len(q.subscriptions))
+	for _, sub := range q.subscriptions {
+		subs = append(subs, sub)
+	}
+	slices.SortFunc(subs, func(a, b *subscription) int {
+		return cmp.Compare(a.id, b.id)
+	})
+	return subs
+}
+
+func (q *Queue) concurrencyFor(topic string) int {
+	if n, ok := q.topicWorkers[topic]; ok {
+		return max(n, 1)
+	}
+	return max(q.concurrency, 1)
+}
+
+// poll returns the next message of sub, or nil when none came in time.
+func (q *Queue) poll(ctx context.Context, sub *subscription) (*services.QueueDelivery, error) {
+	req := services.QueuePollRequest{
+		SubscriptionID: sub.id,
+		Topic:          sub.topic,
+		ProviderID:     sub.providerID,
+		Group:          sub.group,
+		WaitMillis:     q.pollWait.Milliseconds(),
+	}
+	var delivery services.QueueDelivery
+	status, err := q.post(ctx, "/v1/queue/poll", req, &delivery)
+	if err != nil || status == http.StatusNoContent {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// handle runs the handler of sub and reports its outcome to the broker, which
+// retries the message when the handler failed or the ack got lost.
+func (q *Queue) handle(ctx context.Context, sub *subscription, delivery *services.QueueDelivery) error {
+	stopBeating := q.heartbeat(ctx, sub, delivery)
+	err := sub.handler(ctx, delivery.Message.Message())
+	stopBeating()
+
+	ack := services.QueueAck{DeliveryID: delivery.DeliveryID}
+	if err != nil {
+		ack.Error = err.Error()
+		ack.Retryable = services.IsRetryable(err)
+	}
+	if _, ackErr := q.post(ctx, "/v1/queue/ack", ack, nil); ackErr != nil {
+		log.Printf("acknowledging message %s of %s failed: %v", delivery.Message.MessageID, sub.id, ackErr)
+	}
+	return err
+}
+
+// heartbeat tells the broker every third of the delivery's ack timeout that
+// its handler is still running, until the returned stop is called or the
+// broker no longer knows the delivery.
+func (q *Queue) heartbeat(ctx context.Context, sub *subscription, delivery *services.QueueDelivery) (stop func()) {
+	if delivery.AckTimeoutMillis <= 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(time.Duration(delivery.AckTimeoutMillis) * time.Millisecond / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			beat := services.QueueHeartbeat{DeliveryID: delivery.DeliveryID}
+			_, err := q.post(ctx, "/v1/queue/extend", beat, nil)
+			if errors.Is(err, services.ErrDeliveryNotFound) {
+				log.Printf("message %s of %s is no longer awaited by the broker and may be delivered again", delivery.Message.MessageID, sub.id)
+				return
+			}
+			if err != nil {
+				log.Printf("sending the heartbeat of message %s of %s failed: %v", delivery.Message.MessageID, sub.id, err)
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// post sends body as JSON and decodes a 200 response into out. A failed
+// request returns the services.APIError the cloud answered with.
+func (q *Queue) post(ctx context.Context, path string, body any, out any) (int, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return 0, fmt.Errorf("marshaling request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, q.baseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return 0, fmt.Errorf("creating request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := q.httpClient.Do(httpReq)
+	if err != nil {
+		return 0, fmt.Errorf("making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if out != nil {
+			if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+				return resp.StatusCode, fmt.Errorf("decoding response: %w", err)
+			}
+		}
+		return resp.StatusCode, nil
+	case http.StatusNoContent:
+		return resp.StatusCode, nil
+	}
+
+	var apiErr services.APIError
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&apiErr); err == nil && apiErr.Code != "" {
+		return resp.StatusCode, &apiErr
+	}
+	return resp.StatusCode, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+}
@@ -0,0 +1,101 @@
+// Package workerpool bounds how many handlers each consumer group of a topic
+// runs at once and keeps messages that share an ordering key to one handler
+// at a time.
+package workerpool
+
+import "sync"
+
+type Pools struct {
+	mu          sync.Mutex
+	concurrency int
+	topics      map[string]int
+	busy        map[string]int
+	keys        map[string]bool
+	wg          sync.WaitGroup
+	freed       chan struct{}
+}
+
+// New gives every consumer group of a topic concurrency workers, or the
+// topic's entry in topicConcurrency; counts below 1 mean a single worker.
+func New(concurrency int, topicConcurrency map[string]int) *Pools {
+	p := &Pools{
+		concurrency: max(concurrency, 1),
+		topics:      make(map[string]int),
+		busy:        make(map[string]int),
+		keys:        make(map[string]bool),
+		freed:       make(chan struct{}, 1),
+	}
+	for topic, n := range topicConcurrency {
+		p.topics[topic] = max(n, 1)
+	}
+	return p
+}
+
+// Concurrency returns the number of workers each group of topic has.
+func (p *Pools) Concurrency(topic string) int {
+	if n, ok := p.topics[topic]; ok {
+		return n
+	}
+	return p.concurrency
+}
+
+// TryAcquire reserves a worker of group on topic for a message with key. It
+// reports false while every worker of the group is busy or the group is
+// handling a message of the topic with the same key; an empty key orders
+// nothing.
+func (p *Pools) TryAcquire(topic, group, key string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pool := topic + "\x00" + group
+	if p.busy[pool] >= p.Concurrency(topic) {
+		return false
+	}
+	if key != "" {
+		if p.keys[pool+"\x00"+key] {
+			return false
+		}
+		p.keys[pool+"\x00"+key] = true
+	}
+	p.busy[pool]++
+	return true
+}
+
+// Release frees a worker reserved by TryAcquire.
+func (p *Pools) Release(topic, group, key string) {
+	pool := topic + "\x00" + group
+
+	p.mu.Lock()
+	p.busy[pool]--
+	if key != "" {
+		delete(p.keys, pool+"\x00"+key)
+	}
+	p.mu.Unlock()
+
+	select {
+	case p.freed <- struct{}{}:
+	default:
+	}
+}
+
+// Go runs fn on a worker reserved by TryAcquire and releases the worker when
+// fn returns.
+func (p *Pools) Go(topic, group, key string, fn func()) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer p.Release(topic, group, key)
+		fn()
+	}()
+}
+
+// Freed receives after a worker was released, so a dispatcher need not wait
+// for its next poll to hand out more work.
+func (p *Pools) Freed() <-chan struct{} {
+	return p.freed
+}
+
+// Wait blocks until every fn started by Go has returned.
+func (p *Pools) Wait() {
+	p.wg.Wait()
+}
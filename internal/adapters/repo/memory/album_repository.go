@@ -2,19 +2,24 @@ package memory
 
 import (
 	"context"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/media-vault-sync/internal/core/domain"
+	"github.com/media-vault-sync/internal/core/services"
 )
 
 type AlbumRepository struct {
-	mu     sync.RWMutex
-	albums map[string]*domain.Album
+	mu         sync.RWMutex
+	albums     map[string]*domain.Album
+	redrivenAt map[string]time.Time
 }
 
 func NewAlbumRepository() *AlbumRepository {
 	return &AlbumRepository{
-		albums: make(map[string]*domain.Album),
+		albums:     make(map[string]*domain.Album),
+		redrivenAt: make(map[string]time.Time),
 	}
 }
 
@@ -40,6 +45,10 @@ func (r *AlbumRepository) Create(ctx context.Context, album *domain.Album) error
 	defer r.mu.Unlock()
 
 	key := r.makeKey(album.ProviderID, album.DatabaseID, album.AlbumUID)
+	if _, exists := r.albums[key]; exists {
+		return services.NewAlbumConflictError(album)
+	}
+	album.Version = 1
 	copy := *album
 	r.albums[key] = &copy
 	return nil
@@ -50,6 +59,11 @@ func (r *AlbumRepository) Update(ctx context.Context, album *domain.Album) error
 	defer r.mu.Unlock()
 
 	key := r.makeKey(album.ProviderID, album.DatabaseID, album.AlbumUID)
+	stored, exists := r.albums[key]
+	if !exists || stored.Version != album.Version {
+		return services.NewAlbumConflictError(album)
+	}
+	album.Version++
 	copy := *album
 	r.albums[key] = &copy
 	return nil
@@ -68,3 +82,67 @@ func (r *AlbumRepository) FindNeedingRepair(ctx context.Context) ([]*domain.Albu
 	}
 	return result, nil
 }
+
+func (r *AlbumRepository) FindRedriveCandidates(ctx context.Context, before time.Time) ([]*domain.Album, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var result []*domain.Album
+	for key, album := range r.albums {
+		if !album.Synced || !album.UpdatedAt.Before(before) {
+			continue
+		}
+		if redrivenAt, ok := r.redrivenAt[key]; ok && !redrivenAt.Before(before) {
+			continue
+		}
+		copy := *album
+		result = append(result, &copy)
+	}
+	return result, nil
+}
+
+func (r *AlbumRepository) MarkRedriven(ctx context.Context, providerID, databaseID, albumUID string, redrivenAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.redrivenAt[r.makeKey(providerID, databaseID, albumUID)] = redrivenAt
+	return nil
+}
+
+func (r *AlbumRepository) matches(album *domain.Album, filter services.AlbumFilter) bool {
+	if album.ProviderID != filter.ProviderID || album.DatabaseID != filter.DatabaseID {
+		return false
+	}
+	if filter.UserID != "" && album.UserID != filter.UserID {
+		return false
+	}
+	if filter.Synced != nil && album.Synced != *filter.Synced {
+		return false
+	}
+	if !filter.UpdatedSince.IsZero() && album.UpdatedAt.Before(filter.UpdatedSince) {
+		return false
+	}
+	if !filter.UpdatedBefore.IsZero() && !album.UpdatedAt.Before(filter.UpdatedBefore) {
+		return false
+	}
+	return album.AlbumUID > filter.AfterAlbumUID
+}
+
+func (r *AlbumRepository) List(ctx context.Context, filter services.AlbumFilter) ([]*domain.Album, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var result []*domain.Album
+	for _, album := range r.albums {
+		if r.matches(album, filter) {
+			copy := *album
+			result = append(result, &copy)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].AlbumUID < result[j].AlbumUID })
+	if filter.Limit > 0 && len(result) > filter.Limit {
+		result = result[:filter.Limit]
+	}
+	return result, nil
+}
@@ -65,3 +65,19 @@ func (r *AlbumVideoRepository) Exists(ctx context.Context, providerID, databaseI
 	}
 	return false, nil
 }
+
+func (r *AlbumVideoRepository) CountByVideoUID(ctx context.Context, providerID, databaseID, videoUID string) (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	count := 0
+	for _, videos := range r.videos {
+		for _, vid := range videos {
+			if vid.ProviderID == providerID && vid.DatabaseID == databaseID && vid.VideoUID == videoUID {
+				count++
+				break
+			}
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,102 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+type DeadLetterRepository struct {
+	mu          sync.RWMutex
+	deadLetters map[string]*services.DeadLetter
+}
+
+func NewDeadLetterRepository() *DeadLetterRepository {
+	return &DeadLetterRepository{
+		deadLetters: make(map[string]*services.DeadLetter),
+	}
+}
+
+func (r *DeadLetterRepository) matches(dl *services.DeadLetter, filter services.DeadLetterFilter) bool {
+	if filter.Topic != "" && dl.Topic != filter.Topic {
+		return false
+	}
+	if filter.ProviderID != "" && dl.ProviderID != filter.ProviderID {
+		return false
+	}
+	if !filter.CreatedBefore.IsZero() && !dl.CreatedAt.Before(filter.CreatedBefore) {
+		return false
+	}
+	return true
+}
+
+func (r *DeadLetterRepository) Add(ctx context.Context, deadLetter *services.DeadLetter) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	copied := *deadLetter
+	r.deadLetters[deadLetter.ID] = &copied
+	return nil
+}
+
+func (r *DeadLetterRepository) FindByID(ctx context.Context, id string) (*services.DeadLetter, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	dl, exists := r.deadLetters[id]
+	if !exists {
+		return nil, nil
+	}
+
+	copied := *dl
+	return &copied, nil
+}
+
+func (r *DeadLetterRepository) List(ctx context.Context, filter services.DeadLetterFilter) ([]*services.DeadLetter, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var result []*services.DeadLetter
+	for _, dl := range r.deadLetters {
+		if r.matches(dl, filter) {
+			copied := *dl
+			result = append(result, &copied)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].CreatedAt.Equal(result[j].CreatedAt) {
+			return result[i].ID < result[j].ID
+		}
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+
+	if filter.Limit > 0 && len(result) > filter.Limit {
+		result = result[:filter.Limit]
+	}
+	return result, nil
+}
+
+func (r *DeadLetterRepository) Delete(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.deadLetters, id)
+	return nil
+}
+
+func (r *DeadLetterRepository) Purge(ctx context.Context, filter services.DeadLetterFilter) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	purged := 0
+	for id, dl := range r.deadLetters {
+		if r.matches(dl, filter) {
+			delete(r.deadLetters, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
@@ -0,0 +1,67 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/media-vault-sync/internal/core/domain"
+)
+
+type IdempotencyRepository struct {
+	mu      sync.Mutex
+	records map[string]*domain.IdempotencyRecord
+}
+
+func NewIdempotencyRepository() *IdempotencyRepository {
+	return &IdempotencyRepository{
+		records: make(map[string]*domain.IdempotencyRecord),
+	}
+}
+
+func (r *IdempotencyRepository) Reserve(ctx context.Context, record *domain.IdempotencyRecord) (*domain.IdempotencyRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if existing, exists := r.records[record.Key]; exists && existing.ExpiresAt.After(record.CreatedAt) {
+		copied := *existing
+		return &copied, nil
+	}
+
+	copied := *record
+	r.records[record.Key] = &copied
+	return nil, nil
+}
+
+func (r *IdempotencyRepository) Complete(ctx context.Context, key string, statusCode int, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if record, exists := r.records[key]; exists {
+		record.StatusCode = statusCode
+		record.ExpiresAt = expiresAt
+	}
+	return nil
+}
+
+func (r *IdempotencyRepository) Delete(ctx context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.records, key)
+	return nil
+}
+
+func (r *IdempotencyRepository) DeleteExpired(ctx context.Context, before time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	deleted := 0
+	for key, record := range r.records {
+		if !record.ExpiresAt.After(before) {
+			delete(r.records, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,69 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/media-vault-sync/internal/core/domain"
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+type ManifestRevisionRepository struct {
+	mu sync.RWMutex
+	// revisions of each album, oldest first
+	revisions map[string][]*domain.ManifestRevision
+}
+
+func NewManifestRevisionRepository() *ManifestRevisionRepository {
+	return &ManifestRevisionRepository{
+		revisions: make(map[string][]*domain.ManifestRevision),
+	}
+}
+
+func (r *ManifestRevisionRepository) makeAlbumKey(providerID, databaseID, albumUID string) string {
+	return providerID + "|" + databaseID + "|" + albumUID
+}
+
+func copyManifestRevision(revision *domain.ManifestRevision) *domain.ManifestRevision {
+	copied := *revision
+	copied.Added = append([]string(nil), revision.Added...)
+	copied.Removed = append([]string(nil), revision.Removed...)
+	return &copied
+}
+
+func (r *ManifestRevisionRepository) Add(ctx context.Context, revision *domain.ManifestRevision) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := r.makeAlbumKey(revision.ProviderID, revision.DatabaseID, revision.AlbumUID)
+	revision.Revision = len(r.revisions[key]) + 1
+	r.revisions[key] = append(r.revisions[key], copyManifestRevision(revision))
+	return nil
+}
+
+func (r *ManifestRevisionRepository) matches(revision *domain.ManifestRevision, filter services.ManifestRevisionFilter) bool {
+	if !filter.CreatedSince.IsZero() && revision.CreatedAt.Before(filter.CreatedSince) {
+		return false
+	}
+	if !filter.CreatedBefore.IsZero() && !revision.CreatedAt.Before(filter.CreatedBefore) {
+		return false
+	}
+	return revision.Revision > filter.AfterRevision
+}
+
+func (r *ManifestRevisionRepository) List(ctx context.Context, filter services.ManifestRevisionFilter) ([]*domain.ManifestRevision, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var result []*domain.ManifestRevision
+	for _, revision := range r.revisions[r.makeAlbumKey(filter.ProviderID, filter.DatabaseID, filter.AlbumUID)] {
+		if !r.matches(revision, filter) {
+			continue
+		}
+		result = append(result, copyManifestRevision(revision))
+		if filter.Limit > 0 && len(result) == filter.Limit {
+			break
+		}
+	}
+	return result, nil
+}
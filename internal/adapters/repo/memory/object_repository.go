@@ -2,20 +2,24 @@ package memory
 
 import (
 	"context"
+	"fmt"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/media-vault-sync/internal/core/domain"
 	"github.com/media-vault-sync/internal/core/services"
 )
 
 type ObjectRepository struct {
-	mu      sync.RWMutex
-	objects map[string]*domain.Object
+	mu sync.RWMutex
+	// versions of each video, oldest first
+	objects map[string][]*domain.Object
 }
 
 func NewObjectRepository() *ObjectRepository {
 	return &ObjectRepository{
-		objects: make(map[string]*domain.Object),
+		objects: make(map[string][]*domain.Object),
 	}
 }
 
@@ -23,13 +27,72 @@ func (r *ObjectRepository) makeKey(providerID, databaseID, videoUID string) stri
 	return providerID + "|" + databaseID + "|" + videoUID
 }
 
+func copyObject(object *domain.Object) *domain.Object {
+	copied := *object
+	if object.SupersededAt != nil {
+		t := *object.SupersededAt
+		copied.SupersededAt = &t
+	}
+	if object.PurgedAt != nil {
+		t := *object.PurgedAt
+		copied.PurgedAt = &t
+	}
+	if object.UnreferencedAt != nil {
+		t := *object.UnreferencedAt
+		copied.UnreferencedAt = &t
+	}
+	return &copied
+}
+
 func (r *ObjectRepository) Upsert(ctx context.Context, object *domain.Object) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	key := r.makeKey(object.ProviderID, object.DatabaseID, object.VideoUID)
-	copied := *object
-	r.objects[key] = &copied
+	versions := r.objects[key]
+	for i, existing := range versions {
+		if existing.UID == object.UID {
+			updated := copyObject(existing)
+			updated.StorageKey = object.StorageKey
+			updated.SizeBytes = object.SizeBytes
+			updated.Checksum = object.Checksum
+			versions[i] = updated
+			return nil
+		}
+	}
+
+	versions = append(versions, copyObject(object))
+	sort.SliceStable(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+	r.objects[key] = versions
+	return nil
+}
+
+func (r *ObjectRepository) AddVersion(ctx context.Context, object *domain.Object) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, versions := range r.objects {
+		for _, existing := range versions {
+			if existing.UID == object.UID {
+				return fmt.Errorf("%w: object %s already stored", services.ErrObjectVersionConflict, object.UID)
+			}
+		}
+	}
+
+	key := r.makeKey(object.ProviderID, object.DatabaseID, object.VideoUID)
+	latest := 0
+	for _, existing := range r.objects[key] {
+		latest = max(latest, existing.Version)
+		if existing.SupersededAt == nil {
+			supersededAt := object.CreatedAt
+			existing.SupersededAt = &supersededAt
+		}
+	}
+
+	object.Version = latest + 1
+	added := copyObject(object)
+	added.SupersededAt = nil
+	r.objects[key] = append(r.objects[key], added)
 	return nil
 }
 
@@ -37,14 +100,162 @@ func (r *ObjectRepository) FindByVideoUID(ctx context.Context, providerID, datab
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	key := r.makeKey(providerID, databaseID, videoUID)
-	object, exists := r.objects[key]
-	if !exists {
+	current := r.current(r.makeKey(providerID, databaseID, videoUID))
+	if current == nil {
 		return nil, nil
 	}
+	return copyObject(current), nil
+}
 
-	copied := *object
-	return &copied, nil
+func (r *ObjectRepository) current(key string) *domain.Object {
+	for _, object := range r.objects[key] {
+		if object.SupersededAt == nil {
+			return object
+		}
+	}
+	return nil
+}
+
+func (r *ObjectRepository) ListVersions(ctx context.Context, providerID, databaseID, videoUID string) ([]*domain.Object, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var versions []*domain.Object
+	for _, object := range r.objects[r.makeKey(providerID, databaseID, videoUID)] {
+		versions = append(versions, copyObject(object))
+	}
+	return versions, nil
+}
+
+func (r *ObjectRepository) FindSuperseded(ctx context.Context, supersededBefore time.Time, limit int) ([]*domain.Object, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var superseded []*domain.Object
+	for _, versions := range r.objects {
+		for _, object := range versions {
+			if object.SupersededAt != nil && object.PurgedAt == nil && object.SupersededAt.Before(supersededBefore) {
+				superseded = append(superseded, copyObject(object))
+			}
+		}
+	}
+
+	sort.Slice(superseded, func(i, j int) bool { return superseded[i].SupersededAt.Before(*superseded[j].SupersededAt) })
+	if limit > 0 && len(superseded) > limit {
+		superseded = superseded[:limit]
+	}
+	return superseded, nil
+}
+
+func (r *ObjectRepository) MarkPurged(ctx context.Context, uid string, purgedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, versions := range r.objects {
+		for _, object := range versions {
+			if object.UID == uid {
+				object.PurgedAt = &purgedAt
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// Purge holds the lock while release runs, so AddVersion waits for it.
+func (r *ObjectRepository) Purge(ctx context.Context, uid string, purgedAt time.Time, release func(references int) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var purged *domain.Object
+	for _, versions := range r.objects {
+		for _, object := range versions {
+			if object.UID == uid {
+				purged = object
+			}
+		}
+	}
+	if purged == nil {
+		return nil
+	}
+
+	previous := purged.PurgedAt
+	purged.PurgedAt = &purgedAt
+	references := 0
+	for _, versions := range r.objects {
+		for _, object := range versions {
+			if object.StorageKey == purged.StorageKey && object.PurgedAt == nil {
+				references++
+			}
+		}
+	}
+	if err := release(references); err != nil {
+		purged.PurgedAt = previous
+		return err
+	}
+	return nil
+}
+
+func (r *ObjectRepository) MarkUnreferenced(ctx context.Context, providerID, databaseID string, videoUIDs []string, unreferencedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, videoUID := range videoUIDs {
+		for _, object := range r.objects[r.makeKey(providerID, databaseID, videoUID)] {
+			if object.PurgedAt == nil && object.UnreferencedAt == nil {
+				at := unreferencedAt
+				object.UnreferencedAt = &at
+			}
+		}
+	}
+	return nil
+}
+
+func (r *ObjectRepository) ClearUnreferenced(ctx context.Context, providerID, databaseID string, videoUIDs []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, videoUID := range videoUIDs {
+		for _, object := range r.objects[r.makeKey(providerID, databaseID, videoUID)] {
+			object.UnreferencedAt = nil
+		}
+	}
+	return nil
+}
+
+func (r *ObjectRepository) FindUnreferenced(ctx context.Context, unreferencedBefore time.Time, limit int) ([]*domain.Object, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var unreferenced []*domain.Object
+	for _, versions := range r.objects {
+		for _, object := range versions {
+			if object.UnreferencedAt != nil && object.PurgedAt == nil && object.UnreferencedAt.Before(unreferencedBefore) {
+				unreferenced = append(unreferenced, copyObject(object))
+			}
+		}
+	}
+
+	sort.Slice(unreferenced, func(i, j int) bool { return unreferenced[i].UnreferencedAt.Before(*unreferenced[j].UnreferencedAt) })
+	if limit > 0 && len(unreferenced) > limit {
+		unreferenced = unreferenced[:limit]
+	}
+	return unreferenced, nil
+}
+
+func (r *ObjectRepository) CountByStorageKey(ctx context.Context, storageKey string) (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	count := 0
+	for _, versions := range r.objects {
+		for _, object := range versions {
+			if object.StorageKey == storageKey && object.PurgedAt == nil {
+				count++
+			}
+		}
+	}
+	return count, nil
 }
 
 func (r *ObjectRepository) CountByAlbumUID(ctx context.Context, providerID, databaseID, albumUID string, albumVideoRepo services.AlbumVideoRepository) (int, error) {
@@ -59,9 +270,56 @@ func (r *ObjectRepository) CountByAlbumUID(ctx context.Context, providerID, data
 	count := 0
 	for _, vid := range videos {
 		key := r.makeKey(providerID, databaseID, vid.VideoUID)
-		if _, exists := r.objects[key]; exists {
+		if current := r.current(key); current != nil && current.PurgedAt == nil {
 			count++
 		}
 	}
 	return count, nil
 }
+
+func (r *ObjectRepository) matches(object *domain.Object, filter services.ObjectFilter) bool {
+	if object.ProviderID != filter.ProviderID || object.DatabaseID != filter.DatabaseID {
+		return false
+	}
+	if filter.VideoUID != "" && object.VideoUID != filter.VideoUID {
+		return false
+	}
+	if !filter.IncludeSuperseded && object.SupersededAt != nil {
+		return false
+	}
+	if !filter.CreatedSince.IsZero() && object.CreatedAt.Before(filter.CreatedSince) {
+		return false
+	}
+	if !filter.CreatedBefore.IsZero() && !object.CreatedAt.Before(filter.CreatedBefore) {
+		return false
+	}
+	if object.VideoUID != filter.AfterVideoUID {
+		return object.VideoUID > filter.AfterVideoUID
+	}
+	return object.Version > filter.AfterVersion
+}
+
+func (r *ObjectRepository) List(ctx context.Context, filter services.ObjectFilter) ([]*domain.Object, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var result []*domain.Object
+	for _, versions := range r.objects {
+		for _, object := range versions {
+			if r.matches(object, filter) {
+				result = append(result, copyObject(object))
+			}
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].VideoUID != result[j].VideoUID {
+			return result[i].VideoUID < result[j].VideoUID
+		}
+		return result[i].Version < result[j].Version
+	})
+	if filter.Limit > 0 && len(result) > filter.Limit {
+		result = result[:filter.Limit]
+	}
+	return result, nil
+}
@@ -0,0 +1,54 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+type OutboxRepository struct {
+	mu       sync.RWMutex
+	messages []*services.OutboxMessage
+}
+
+func NewOutboxRepository() *OutboxRepository {
+	return &OutboxRepository{}
+}
+
+func (r *OutboxRepository) Add(ctx context.Context, msg *services.OutboxMessage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	copied := *msg
+	r.messages = append(r.messages, &copied)
+	return nil
+}
+
+func (r *OutboxRepository) ListPending(ctx context.Context, limit int) ([]*services.OutboxMessage, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var result []*services.OutboxMessage
+	for _, msg := range r.messages {
+		if limit > 0 && len(result) == limit {
+			break
+		}
+		copied := *msg
+		result = append(result, &copied)
+	}
+	return result, nil
+}
+
+func (r *OutboxRepository) Delete(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, msg := range r.messages {
+		if msg.ID == id {
+			r.messages = append(r.messages[:i], r.messages[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
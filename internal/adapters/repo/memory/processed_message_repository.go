@@ -0,0 +1,64 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type ProcessedMessageRepository struct {
+	mu        sync.Mutex
+	processed map[string]time.Time
+}
+
+func NewProcessedMessageRepository() *ProcessedMessageRepository {
+	return &ProcessedMessageRepository{
+		processed: make(map[string]time.Time),
+	}
+}
+
+func (r *ProcessedMessageRepository) makeKey(consumer, messageID string) string {
+	return consumer + "|" + messageID
+}
+
+func (r *ProcessedMessageRepository) MarkProcessed(ctx context.Context, consumer, messageID string, processedAt time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := r.makeKey(consumer, messageID)
+	if _, exists := r.processed[key]; exists {
+		return false, nil
+	}
+	r.processed[key] = processedAt
+	return true, nil
+}
+
+func (r *ProcessedMessageRepository) IsProcessed(ctx context.Context, consumer, messageID string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, exists := r.processed[r.makeKey(consumer, messageID)]
+	return exists, nil
+}
+
+func (r *ProcessedMessageRepository) Unmark(ctx context.Context, consumer, messageID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.processed, r.makeKey(consumer, messageID))
+	return nil
+}
+
+func (r *ProcessedMessageRepository) DeleteProcessedBefore(ctx context.Context, before time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	deleted := 0
+	for key, processedAt := range r.processed {
+		if processedAt.Before(before) {
+			delete(r.processed, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,15 @@
+package memory
+
+import "context"
+
+// Transactor runs units of work directly: the memory repositories apply every
+// write immediately and roll nothing back.
+type Transactor struct{}
+
+func NewTransactor() *Transactor {
+	return &Transactor{}
+}
+
+func (t *Transactor) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
@@ -0,0 +1,81 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/media-vault-sync/internal/core/domain"
+)
+
+type UploadSessionRepository struct {
+	mu       sync.RWMutex
+	sessions map[string]*domain.UploadSession
+}
+
+func NewUploadSessionRepository() *UploadSessionRepository {
+	return &UploadSessionRepository{
+		sessions: make(map[string]*domain.UploadSession),
+	}
+}
+
+func (r *UploadSessionRepository) Create(ctx context.Context, session *domain.UploadSession) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	copied := *session
+	r.sessions[session.ID] = &copied
+	return nil
+}
+
+func (r *UploadSessionRepository) FindByID(ctx context.Context, id string) (*domain.UploadSession, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	session, exists := r.sessions[id]
+	if !exists {
+		return nil, nil
+	}
+
+	copied := *session
+	return &copied, nil
+}
+
+func (r *UploadSessionRepository) UpdateOffset(ctx context.Context, id string, expectedOffset, newOffset int64, updatedAt time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	session, exists := r.sessions[id]
+	if !exists || session.Offset != expectedOffset {
+		return false, nil
+	}
+
+	session.Offset = newOffset
+	session.UpdatedAt = updatedAt
+	return true, nil
+}
+
+func (r *UploadSessionRepository) Delete(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.sessions, id)
+	return nil
+}
+
+func (r *UploadSessionRepository) FindStale(ctx context.Context, updatedBefore time.Time) ([]*domain.UploadSession, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var stale []*domain.UploadSession
+	for _, session := range r.sessions {
+		if session.UpdatedAt.Before(updatedBefore) {
+			copied := *session
+			stale = append(stale, &copied)
+		}
+	}
+
+	sort.Slice(stale, func(i, j int) bool { return stale[i].UpdatedAt.Before(stale[j].UpdatedAt) })
+	return stale, nil
+}
@@ -2,9 +2,11 @@ package memory
 
 import (
 	"context"
+	"sort"
 	"sync"
 
 	"github.com/media-vault-sync/internal/core/domain"
+	"github.com/media-vault-sync/internal/core/services"
 )
 
 type VideoRepository struct {
@@ -51,3 +53,38 @@ func (r *VideoRepository) FindByVideoUID(ctx context.Context, providerID, databa
 	copied := *video
 	return &copied, nil
 }
+
+func (r *VideoRepository) matches(video *domain.Video, filter services.VideoFilter) bool {
+	if video.ProviderID != filter.ProviderID || video.DatabaseID != filter.DatabaseID {
+		return false
+	}
+	if filter.UserID != "" && video.UserID != filter.UserID {
+		return false
+	}
+	if !filter.UpdatedSince.IsZero() && video.UpdatedAt.Before(filter.UpdatedSince) {
+		return false
+	}
+	if !filter.UpdatedBefore.IsZero() && !video.UpdatedAt.Before(filter.UpdatedBefore) {
+		return false
+	}
+	return video.VideoUID > filter.AfterVideoUID
+}
+
+func (r *VideoRepository) List(ctx context.Context, filter services.VideoFilter) ([]*domain.Video, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var result []*domain.Video
+	for _, video := range r.videos {
+		if r.matches(video, filter) {
+			copied := *video
+			result = append(result, &copied)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].VideoUID < result[j].VideoUID })
+	if filter.Limit > 0 && len(result) > filter.Limit {
+		result = result[:filter.Limit]
+	}
+	return result, nil
+}
@@ -3,8 +3,13 @@ package mysql
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"strings"
+	"time"
 
+	driver "github.com/go-sql-driver/mysql"
 	"github.com/media-vault-sync/internal/core/domain"
+	"github.com/media-vault-sync/internal/core/services"
 )
 
 type AlbumRepository struct {
@@ -15,25 +20,19 @@ func NewAlbumRepository(db *sql.DB) *AlbumRepository {
 	return &AlbumRepository{db: db}
 }
 
+const albumColumns = `uid, provider_id, database_id, user_id, album_uid, synced, version, created_at, updated_at`
+
+// mysqlErrDuplicateEntry is ER_DUP_ENTRY, raised by unique key violations.
+const mysqlErrDuplicateEntry = 1062
+
 func (r *AlbumRepository) FindByAlbumUID(ctx context.Context, providerID, databaseID, albumUID string) (*domain.Album, error) {
 	query := `
-		SELECT uid, provider_id, database_id, user_id, album_uid, synced, created_at, updated_at
+		SELECT ` + albumColumns + `
 		FROM albums
 		WHERE provider_id = ? AND database_id = ? AND album_uid = ?
 	`
 
-	var album domain.Album
-	err := r.db.QueryRowContext(ctx, query, providerID, databaseID, albumUID).Scan(
-		&album.UID,
-		&album.ProviderID,
-		&album.DatabaseID,
-		&album.UserID,
-		&album.AlbumUID,
-		&album.Synced,
-		&album.CreatedAt,
-		&album.UpdatedAt,
-	)
-
+	album, err := scanAlbum(conn(ctx, r.db).QueryRowContext(ctx, query, providerID, databaseID, albumUID))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -41,16 +40,16 @@ func (r *AlbumRepository) FindByAlbumUID(ctx context.Context, providerID, databa
 		return nil, err
 	}
 
-	return &album, nil
+	return album, nil
 }
 
 func (r *AlbumRepository) Create(ctx context.Context, album *domain.Album) error {
 	query := `
-		INSERT INTO albums (uid, provider_id, database_id, user_id, album_uid, synced, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO albums (` + albumColumns + `)
+		VALUES (?, ?, ?, ?, ?, ?, 1, ?, ?)
 	`
 
-	_, err := r.db.ExecContext(ctx, query,
+	_, err := conn(ctx, r.db).ExecContext(ctx, query,
 		album.UID,
 		album.ProviderID,
 		album.DatabaseID,
@@ -61,36 +60,92 @@ func (r *AlbumRepository) Create(ctx context.Context, album *domain.Album) error
 		album.UpdatedAt,
 	)
 
-	return err
+	var mysqlErr *driver.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlErrDuplicateEntry {
+		return services.NewAlbumConflictError(album)
+	}
+	if err != nil {
+		return err
+	}
+
+	album.Version = 1
+	return nil
 }
 
 func (r *AlbumRepository) Update(ctx context.Context, album *domain.Album) error {
 	query := `
 		UPDATE albums
-		SET user_id = ?, synced = ?, updated_at = ?
-		WHERE provider_id = ? AND database_id = ? AND album_uid = ?
+		SET user_id = ?, synced = ?, updated_at = ?, version = version + 1
+		WHERE provider_id = ? AND database_id = ? AND album_uid = ? AND version = ?
 	`
 
-	_, err := r.db.ExecContext(ctx, query,
+	result, err := conn(ctx, r.db).ExecContext(ctx, query,
 		album.UserID,
 		album.Synced,
 		album.UpdatedAt,
 		album.ProviderID,
 		album.DatabaseID,
 		album.AlbumUID,
+		album.Version,
 	)
+	if err != nil {
+		return err
+	}
 
-	return err
+	// version always changes, so a matched row is always an affected row
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return services.NewAlbumConflictError(album)
+	}
+
+	album.Version++
+	return nil
 }
 
 func (r *AlbumRepository) FindNeedingRepair(ctx context.Context) ([]*domain.Album, error) {
 	query := `
-		SELECT uid, provider_id, database_id, user_id, album_uid, synced, created_at, updated_at
+		SELECT ` + albumColumns + `
 		FROM albums
 		WHERE synced = FALSE
-	` // TODO: add an "or instances in the db don't match the ones in the manifest"
+	`
+
+	return r.queryAlbums(ctx, query)
+}
+
+func (r *AlbumRepository) FindRedriveCandidates(ctx context.Context, before time.Time) ([]*domain.Album, error) {
+	query := `
+		SELECT a.uid, a.provider_id, a.database_id, a.user_id, a.album_uid, a.synced, a.version, a.created_at, a.updated_at
+		FROM albums a
+		LEFT JOIN album_redrives r ON
+			r.provider_id = a.provider_id AND
+			r.database_id = a.database_id AND
+			r.album_uid = a.album_uid
+		WHERE a.synced = TRUE AND a.updated_at < ?
+			AND (r.redriven_at IS NULL OR r.redriven_at < ?)
+	`
+
+	return r.queryAlbums(ctx, query, before.UTC(), before.UTC())
+}
 
-	rows, err := r.db.QueryContext(ctx, query)
+// MarkRedriven keeps the time in album_redrives, as updating the albums row
+// would move its updated_at.
+func (r *AlbumRepository) MarkRedriven(ctx context.Context, providerID, databaseID, albumUID string, redrivenAt time.Time) error {
+	query := `
+		INSERT INTO album_redrives (provider_id, database_id, album_uid, redriven_at)
+		VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			redriven_at = VALUES(redriven_at)
+	`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, providerID, databaseID, albumUID, redrivenAt.UTC())
+	return err
+}
+
+func (r *AlbumRepository) queryAlbums(ctx context.Context, query string, args ...any) ([]*domain.Album, error) {
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -98,22 +153,65 @@ func (r *AlbumRepository) FindNeedingRepair(ctx context.Context) ([]*domain.Albu
 
 	var albums []*domain.Album
 	for rows.Next() {
-		var album domain.Album
-		err := rows.Scan(
-			&album.UID,
-			&album.ProviderID,
-			&album.DatabaseID,
-			&album.UserID,
-			&album.AlbumUID,
-			&album.Synced,
-			&album.CreatedAt,
-			&album.UpdatedAt,
-		)
+		album, err := scanAlbum(rows)
 		if err != nil {
 			return nil, err
 		}
-		albums = append(albums, &album)
+		albums = append(albums, album)
 	}
 
 	return albums, rows.Err()
 }
+
+func scanAlbum(row rowScanner) (*domain.Album, error) {
+	var album domain.Album
+	err := row.Scan(
+		&album.UID,
+		&album.ProviderID,
+		&album.DatabaseID,
+		&album.UserID,
+		&album.AlbumUID,
+		&album.Synced,
+		&album.Version,
+		&album.CreatedAt,
+		&album.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &album, nil
+}
+
+func (r *AlbumRepository) List(ctx context.Context, filter services.AlbumFilter) ([]*domain.Album, error) {
+	clauses := []string{"provider_id = ?", "database_id = ?", "album_uid > ?"}
+	args := []any{filter.ProviderID, filter.DatabaseID, filter.AfterAlbumUID}
+	if filter.UserID != "" {
+		clauses = append(clauses, "user_id = ?")
+		args = append(args, filter.UserID)
+	}
+	if filter.Synced != nil {
+		clauses = append(clauses, "synced = ?")
+		args = append(args, *filter.Synced)
+	}
+	if !filter.UpdatedSince.IsZero() {
+		clauses = append(clauses, "updated_at >= ?")
+		args = append(args, filter.UpdatedSince.UTC())
+	}
+	if !filter.UpdatedBefore.IsZero() {
+		clauses = append(clauses, "updated_at < ?")
+		args = append(args, filter.UpdatedBefore.UTC())
+	}
+
+	query := `
+		SELECT ` + albumColumns + `
+		FROM albums
+		WHERE ` + strings.Join(clauses, " AND ") + `
+		ORDER BY album_uid
+	`
+	if filter.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, filter.Limit)
+	}
+
+	return r.queryAlbums(ctx, query, args...)
+}
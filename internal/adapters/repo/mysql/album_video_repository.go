@@ -22,7 +22,7 @@ func (r *AlbumVideoRepository) FindByAlbumUID(ctx context.Context, providerID, d
 		WHERE provider_id = ? AND database_id = ? AND album_uid = ?
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, providerID, databaseID, albumUID)
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, providerID, databaseID, albumUID)
 	if err != nil {
 		return nil, err
 	}
@@ -42,13 +42,24 @@ func (r *AlbumVideoRepository) FindByAlbumUID(ctx context.Context, providerID, d
 }
 
 func (r *AlbumVideoRepository) ReplaceForAlbum(ctx context.Context, providerID, databaseID, albumUID string, videos []domain.AlbumVideo) error {
-	// TODO: add lock album that with SELECT FOR UPDATE
+	return inTx(ctx, r.db, func(tx dbtx) error {
+		return r.replaceForAlbum(ctx, tx, providerID, databaseID, albumUID, videos)
+	})
+}
 
-	tx, err := r.db.BeginTx(ctx, nil)
-	if err != nil {
+func (r *AlbumVideoRepository) replaceForAlbum(ctx context.Context, tx dbtx, providerID, databaseID, albumUID string, videos []domain.AlbumVideo) error {
+	// locks the album row so concurrent replacements of one manifest apply
+	// one after the other instead of interleaving their inserts
+	lockQuery := `
+		SELECT 1 FROM albums
+		WHERE provider_id = ? AND database_id = ? AND album_uid = ?
+		FOR UPDATE
+	`
+	var locked int
+	err := tx.QueryRowContext(ctx, lockQuery, providerID, databaseID, albumUID).Scan(&locked)
+	if err != nil && err != sql.ErrNoRows {
 		return err
 	}
-	defer tx.Rollback()
 
 	deleteQuery := `
 		DELETE FROM album_videos
@@ -76,7 +87,7 @@ func (r *AlbumVideoRepository) ReplaceForAlbum(ctx context.Context, providerID,
 		}
 	}
 
-	return tx.Commit()
+	return nil
 }
 
 func (r *AlbumVideoRepository) Exists(ctx context.Context, providerID, databaseID, albumUID, videoUID string) (bool, error) {
@@ -87,7 +98,7 @@ func (r *AlbumVideoRepository) Exists(ctx context.Context, providerID, databaseI
 	`
 
 	var exists int
-	err := r.db.QueryRowContext(ctx, query, providerID, databaseID, albumUID, videoUID).Scan(&exists)
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, providerID, databaseID, albumUID, videoUID).Scan(&exists)
 	if err == sql.ErrNoRows {
 		return false, nil
 	}
@@ -97,3 +108,17 @@ func (r *AlbumVideoRepository) Exists(ctx context.Context, providerID, databaseI
 
 	return true, nil
 }
+
+func (r *AlbumVideoRepository) CountByVideoUID(ctx context.Context, providerID, databaseID, videoUID string) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM album_videos
+		WHERE provider_id = ? AND database_id = ? AND video_uid = ?
+	`
+
+	var count int
+	if err := conn(ctx, r.db).QueryRowContext(ctx, query, providerID, databaseID, videoUID).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
@@ -0,0 +1,170 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+type DeadLetterRepository struct {
+	db *sql.DB
+}
+
+func NewDeadLetterRepository(db *sql.DB) *DeadLetterRepository {
+	return &DeadLetterRepository{db: db}
+}
+
+const deadLetterColumns = `id, message_id, topic, provider_id, payload, metadata, attempts, last_error, created_at`
+
+func (r *DeadLetterRepository) Add(ctx context.Context, deadLetter *services.DeadLetter) error {
+	metadata, err := json.Marshal(deadLetter.Message.Metadata)
+	if err != nil {
+		return err
+	}
+
+	payload := deadLetter.Message.Payload
+	if payload == nil {
+		payload = []byte{}
+	}
+
+	query := `
+		INSERT INTO dead_letters (` + deadLetterColumns + `)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err = conn(ctx, r.db).ExecContext(ctx, query,
+		deadLetter.ID,
+		deadLetter.Message.MessageID,
+		deadLetter.Topic,
+		deadLetter.ProviderID,
+		payload,
+		string(metadata),
+		deadLetter.Attempts,
+		deadLetter.LastError,
+		deadLetter.CreatedAt.UTC(),
+	)
+
+	return err
+}
+
+func (r *DeadLetterRepository) FindByID(ctx context.Context, id string) (*services.DeadLetter, error) {
+	query := `
+		SELECT ` + deadLetterColumns + `
+		FROM dead_letters
+		WHERE id = ?
+	`
+
+	dl, err := scanDeadLetter(conn(ctx, r.db).QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return dl, nil
+}
+
+func (r *DeadLetterRepository) List(ctx context.Context, filter services.DeadLetterFilter) ([]*services.DeadLetter, error) {
+	where, args := deadLetterWhere(filter)
+	query := `
+		SELECT ` + deadLetterColumns + `
+		FROM dead_letters
+		` + where + `
+		ORDER BY created_at, id
+	`
+	if filter.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deadLetters []*services.DeadLetter
+	for rows.Next() {
+		dl, err := scanDeadLetter(rows)
+		if err != nil {
+			return nil, err
+		}
+		deadLetters = append(deadLetters, dl)
+	}
+
+	return deadLetters, rows.Err()
+}
+
+func (r *DeadLetterRepository) Delete(ctx context.Context, id string) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM dead_letters WHERE id = ?`, id)
+	return err
+}
+
+func (r *DeadLetterRepository) Purge(ctx context.Context, filter services.DeadLetterFilter) (int, error) {
+	where, args := deadLetterWhere(filter)
+	result, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM dead_letters `+where, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(purged), nil
+}
+
+func deadLetterWhere(filter services.DeadLetterFilter) (string, []any) {
+	var clauses []string
+	var args []any
+	if filter.Topic != "" {
+		clauses = append(clauses, "topic = ?")
+		args = append(args, filter.Topic)
+	}
+	if filter.ProviderID != "" {
+		clauses = append(clauses, "provider_id = ?")
+		args = append(args, filter.ProviderID)
+	}
+	if !filter.CreatedBefore.IsZero() {
+		clauses = append(clauses, "created_at < ?")
+		args = append(args, filter.CreatedBefore.UTC())
+	}
+	if len(clauses) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(clauses, " AND "), args
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanDeadLetter(row rowScanner) (*services.DeadLetter, error) {
+	var dl services.DeadLetter
+	var metadata string
+	err := row.Scan(
+		&dl.ID,
+		&dl.Message.MessageID,
+		&dl.Topic,
+		&dl.ProviderID,
+		&dl.Message.Payload,
+		&metadata,
+		&dl.Attempts,
+		&dl.LastError,
+		&dl.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(metadata), &dl.Message.Metadata); err != nil {
+		return nil, err
+	}
+	dl.Message.Topic = dl.Topic
+
+	return &dl, nil
+}
@@ -0,0 +1,110 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	driver "github.com/go-sql-driver/mysql"
+	"github.com/media-vault-sync/internal/core/domain"
+)
+
+type IdempotencyRepository struct {
+	db *sql.DB
+}
+
+func NewIdempotencyRepository(db *sql.DB) *IdempotencyRepository {
+	return &IdempotencyRepository{db: db}
+}
+
+const idempotencyColumns = `idempotency_key, status_code, created_at, expires_at`
+
+func (r *IdempotencyRepository) Reserve(ctx context.Context, record *domain.IdempotencyRecord) (*domain.IdempotencyRecord, error) {
+	insert := `
+		INSERT INTO idempotency_keys (` + idempotencyColumns + `)
+		VALUES (?, ?, ?, ?)
+	`
+	// an expired record is taken over only if nobody else took it first
+	takeOver := `
+		UPDATE idempotency_keys
+		SET status_code = ?, created_at = ?, expires_at = ?
+		WHERE idempotency_key = ? AND expires_at <= ?
+	`
+	find := `
+		SELECT ` + idempotencyColumns + `
+		FROM idempotency_keys
+		WHERE idempotency_key = ?
+	`
+
+	db := conn(ctx, r.db)
+	for {
+		_, err := db.ExecContext(ctx, insert, record.Key, record.StatusCode, record.CreatedAt.UTC(), record.ExpiresAt.UTC())
+		var mysqlErr *driver.MySQLError
+		if !errors.As(err, &mysqlErr) || mysqlErr.Number != mysqlErrDuplicateEntry {
+			return nil, err
+		}
+
+		result, err := db.ExecContext(ctx, takeOver, record.StatusCode, record.CreatedAt.UTC(), record.ExpiresAt.UTC(), record.Key, record.CreatedAt.UTC())
+		if err != nil {
+			return nil, err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		if affected == 1 {
+			return nil, nil
+		}
+
+		existing, err := scanIdempotencyRecord(db.QueryRowContext(ctx, find, record.Key))
+		if err == sql.ErrNoRows {
+			// deleted in between, claim it again
+			continue
+		}
+		return existing, err
+	}
+}
+
+func (r *IdempotencyRepository) Complete(ctx context.Context, key string, statusCode int, expiresAt time.Time) error {
+	query := `
+		UPDATE idempotency_keys
+		SET status_code = ?, expires_at = ?
+		WHERE idempotency_key = ?
+	`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, statusCode, expiresAt.UTC(), key)
+	return err
+}
+
+func (r *IdempotencyRepository) Delete(ctx context.Context, key string) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM idempotency_keys WHERE idempotency_key = ?`, key)
+	return err
+}
+
+func (r *IdempotencyRepository) DeleteExpired(ctx context.Context, before time.Time) (int, error) {
+	result, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= ?`, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(affected), nil
+}
+
+func scanIdempotencyRecord(row rowScanner) (*domain.IdempotencyRecord, error) {
+	var record domain.IdempotencyRecord
+	err := row.Scan(
+		&record.Key,
+		&record.StatusCode,
+		&record.CreatedAt,
+		&record.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
@@ -0,0 +1,147 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+
+	"github.com/media-vault-sync/internal/core/domain"
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+type ManifestRevisionRepository struct {
+	db *sql.DB
+}
+
+func NewManifestRevisionRepository(db *sql.DB) *ManifestRevisionRepository {
+	return &ManifestRevisionRepository{db: db}
+}
+
+const manifestRevisionColumns = `uid, provider_id, database_id, album_uid, revision, source, added, removed, created_at`
+
+func (r *ManifestRevisionRepository) Add(ctx context.Context, revision *domain.ManifestRevision) error {
+	added, err := marshalVideoUIDs(revision.Added)
+	if err != nil {
+		return err
+	}
+	removed, err := marshalVideoUIDs(revision.Removed)
+	if err != nil {
+		return err
+	}
+
+	return inTx(ctx, r.db, func(tx dbtx) error {
+		// locks the album's revisions so concurrent uploads number in sequence
+		latestQuery := `
+			SELECT COALESCE(MAX(revision), 0)
+			FROM manifest_revisions
+			WHERE provider_id = ? AND database_id = ? AND album_uid = ?
+			FOR UPDATE
+		`
+		var latest int
+		err := tx.QueryRowContext(ctx, latestQuery, revision.ProviderID, revision.DatabaseID, revision.AlbumUID).Scan(&latest)
+		if err != nil {
+			return err
+		}
+
+		insertQuery := `
+			INSERT INTO manifest_revisions (` + manifestRevisionColumns + `)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`
+		_, err = tx.ExecContext(ctx, insertQuery,
+			revision.UID,
+			revision.ProviderID,
+			revision.DatabaseID,
+			revision.AlbumUID,
+			latest+1,
+			revision.Source,
+			added,
+			removed,
+			revision.CreatedAt.UTC(),
+		)
+		if err != nil {
+			return err
+		}
+
+		revision.Revision = latest + 1
+		return nil
+	})
+}
+
+func (r *ManifestRevisionRepository) List(ctx context.Context, filter services.ManifestRevisionFilter) ([]*domain.ManifestRevision, error) {
+	clauses := []string{"provider_id = ?", "database_id = ?", "album_uid = ?", "revision > ?"}
+	args := []any{filter.ProviderID, filter.DatabaseID, filter.AlbumUID, filter.AfterRevision}
+	if !filter.CreatedSince.IsZero() {
+		clauses = append(clauses, "created_at >= ?")
+		args = append(args, filter.CreatedSince.UTC())
+	}
+	if !filter.CreatedBefore.IsZero() {
+		clauses = append(clauses, "created_at < ?")
+		args = append(args, filter.CreatedBefore.UTC())
+	}
+
+	query := `
+		SELECT ` + manifestRevisionColumns + `
+		FROM manifest_revisions
+		WHERE ` + strings.Join(clauses, " AND ") + `
+		ORDER BY revision
+	`
+	if filter.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []*domain.ManifestRevision
+	for rows.Next() {
+		revision, err := scanManifestRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, rows.Err()
+}
+
+// video UID lists are stored as JSON arrays, never null
+func marshalVideoUIDs(videoUIDs []string) (string, error) {
+	if videoUIDs == nil {
+		videoUIDs = []string{}
+	}
+	data, err := json.Marshal(videoUIDs)
+	return string(data), err
+}
+
+func scanManifestRevision(row rowScanner) (*domain.ManifestRevision, error) {
+	var revision domain.ManifestRevision
+	var added, removed string
+	err := row.Scan(
+		&revision.UID,
+		&revision.ProviderID,
+		&revision.DatabaseID,
+		&revision.AlbumUID,
+		&revision.Revision,
+		&revision.Source,
+		&added,
+		&removed,
+		&revision.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(added), &revision.Added); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(removed), &revision.Removed); err != nil {
+		return nil, err
+	}
+
+	return &revision, nil
+}
@@ -0,0 +1,90 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+)
+
+const (
+	migrateUpMarker   = "-- +migrate Up"
+	migrateDownMarker = "-- +migrate Down"
+)
+
+// Migrate applies every *.sql file in fsys that is not yet recorded in
+// schema_migrations, in lexical order. Only the "+migrate Up" section runs.
+func Migrate(ctx context.Context, db *sql.DB, fsys fs.FS) error {
+	_, err := db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version VARCHAR(255) NOT NULL PRIMARY KEY,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4
+	`)
+	if err != nil {
+		return fmt.Errorf("creating schema_migrations: %w", err)
+	}
+
+	names, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return fmt.Errorf("listing migrations: %w", err)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		var exists int
+		err := db.QueryRowContext(ctx, `SELECT 1 FROM schema_migrations WHERE version = ?`, name).Scan(&exists)
+		if err == nil {
+			continue
+		}
+		if err != sql.ErrNoRows {
+			return fmt.Errorf("checking migration %s: %w", name, err)
+		}
+
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return fmt.Errorf("reading migration %s: %w", name, err)
+		}
+
+		// MySQL commits DDL implicitly, so statements are applied one by one
+		// and the version is recorded only once all of them succeeded.
+		for _, stmt := range upStatements(string(content)) {
+			if _, err := db.ExecContext(ctx, stmt); err != nil {
+				return fmt.Errorf("applying migration %s: %w", name, err)
+			}
+		}
+
+		if _, err := db.ExecContext(ctx, `INSERT INTO schema_migrations (version) VALUES (?)`, name); err != nil {
+			return fmt.Errorf("recording migration %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func upStatements(content string) []string {
+	if i := strings.Index(content, migrateUpMarker); i >= 0 {
+		content = content[i+len(migrateUpMarker):]
+	}
+	if i := strings.Index(content, migrateDownMarker); i >= 0 {
+		content = content[:i]
+	}
+
+	var lines []string
+	for _, line := range strings.Split(content, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "--") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	var statements []string
+	for _, stmt := range strings.Split(strings.Join(lines, "\n"), ";") {
+		if stmt = strings.TrimSpace(stmt); stmt != "" {
+			statements = append(statements, stmt)
+		}
+	}
+	return statements
+}
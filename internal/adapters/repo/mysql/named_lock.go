@@ -0,0 +1,78 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	sqldriver "database/sql/driver"
+	"sync"
+)
+
+// NamedLock is a MySQL GET_LOCK held on a connection of its own, so it stays
+// with this process until the connection drops.
+type NamedLock struct {
+	db   *sql.DB
+	name string
+
+	mu   sync.Mutex
+	conn *sql.Conn
+}
+
+func NewNamedLock(db *sql.DB, name string) *NamedLock {
+	return &NamedLock{db: db, name: name}
+}
+
+// Held pings the connection holding the lock, or tries to take the lock
+// without waiting when none does.
+func (l *NamedLock) Held(ctx context.Context) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conn != nil {
+		err := l.conn.PingContext(ctx)
+		if err == nil {
+			return true, nil
+		}
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		// the lock went with the connection
+		discard(l.conn)
+		l.conn = nil
+	}
+
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+	var got sql.NullInt64
+	if err := conn.QueryRowContext(ctx, `SELECT GET_LOCK(?, 0)`, l.name).Scan(&got); err != nil {
+		discard(conn)
+		return false, err
+	}
+	if got.Int64 != 1 {
+		conn.Close()
+		return false, nil
+	}
+	l.conn = conn
+	return true, nil
+}
+
+// Release gives the lock up, for another process to take.
+func (l *NamedLock) Release() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conn == nil {
+		return nil
+	}
+	err := discard(l.conn)
+	l.conn = nil
+	return err
+}
+
+// discard closes conn rather than returning it to the pool, where it would
+// keep the lock.
+func discard(conn *sql.Conn) error {
+	conn.Raw(func(any) error { return sqldriver.ErrBadConn })
+	return conn.Close()
+}
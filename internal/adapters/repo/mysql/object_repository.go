@@ -3,7 +3,12 @@ package mysql
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
 
+	driver "github.com/go-sql-driver/mysql"
 	"github.com/media-vault-sync/internal/core/domain"
 	"github.com/media-vault-sync/internal/core/services"
 )
@@ -16,21 +21,24 @@ func NewObjectRepository(db *sql.DB) *ObjectRepository {
 	return &ObjectRepository{db: db}
 }
 
+const objectColumns = `uid, provider_id, database_id, video_uid, version, storage_key, size_bytes, checksum, created_at, superseded_at, purged_at, unreferenced_at`
+
 func (r *ObjectRepository) Upsert(ctx context.Context, object *domain.Object) error {
 	query := `
-		INSERT INTO objects (uid, provider_id, database_id, video_uid, storage_key, size_bytes, checksum, created_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO objects (uid, provider_id, database_id, video_uid, version, storage_key, size_bytes, checksum, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
 		ON DUPLICATE KEY UPDATE
 			storage_key = VALUES(storage_key),
 			size_bytes = VALUES(size_bytes),
 			checksum = VALUES(checksum)
 	`
 
-	_, err := r.db.ExecContext(ctx, query,
+	_, err := conn(ctx, r.db).ExecContext(ctx, query,
 		object.UID,
 		object.ProviderID,
 		object.DatabaseID,
 		object.VideoUID,
+		objectVersion(object),
 		object.StorageKey,
 		object.SizeBytes,
 		object.Checksum,
@@ -40,25 +48,86 @@ func (r *ObjectRepository) Upsert(ctx context.Context, object *domain.Object) er
 	return err
 }
 
-func (r *ObjectRepository) FindByVideoUID(ctx context.Context, providerID, databaseID, videoUID string) (*domain.Object, error) {
-	query := `
-		SELECT uid, provider_id, database_id, video_uid, storage_key, size_bytes, checksum, created_at
+func (r *ObjectRepository) AddVersion(ctx context.Context, object *domain.Object) error {
+	return inTx(ctx, r.db, func(tx dbtx) error {
+		return r.addVersion(ctx, tx, object)
+	})
+}
+
+func (r *ObjectRepository) addVersion(ctx context.Context, tx dbtx, object *domain.Object) error {
+	// the lock makes concurrent versions of the video wait for this one
+	latestQuery := `
+		SELECT COALESCE(MAX(version), 0)
 		FROM objects
 		WHERE provider_id = ? AND database_id = ? AND video_uid = ?
+		FOR UPDATE
 	`
+	var latest int
+	err := tx.QueryRowContext(ctx, latestQuery, object.ProviderID, object.DatabaseID, object.VideoUID).Scan(&latest)
+	if err != nil {
+		return versionConflict(err)
+	}
 
-	var object domain.Object
-	err := r.db.QueryRowContext(ctx, query, providerID, databaseID, videoUID).Scan(
-		&object.UID,
-		&object.ProviderID,
-		&object.DatabaseID,
-		&object.VideoUID,
-		&object.StorageKey,
-		&object.SizeBytes,
-		&object.Checksum,
-		&object.CreatedAt,
+	supersedeQuery := `
+		UPDATE objects
+		SET superseded_at = ?
+		WHERE provider_id = ? AND database_id = ? AND video_uid = ? AND superseded_at IS NULL
+	`
+	_, err = tx.ExecContext(ctx, supersedeQuery,
+		object.CreatedAt.UTC(),
+		object.ProviderID,
+		object.DatabaseID,
+		object.VideoUID,
 	)
+	if err != nil {
+		return versionConflict(err)
+	}
+
+	insertQuery := `
+		INSERT INTO objects (uid, provider_id, database_id, video_uid, version, storage_key, size_bytes, checksum, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err = tx.ExecContext(ctx, insertQuery,
+		object.UID,
+		object.ProviderID,
+		object.DatabaseID,
+		object.VideoUID,
+		latest+1,
+		object.StorageKey,
+		object.SizeBytes,
+		object.Checksum,
+		object.CreatedAt,
+	)
+	if err != nil {
+		return versionConflict(err)
+	}
+
+	object.Version = latest + 1
+	return nil
+}
+
+// mysqlErrDeadlock is ER_LOCK_DEADLOCK, raised when two first versions of a
+// video lock the same gap of the index.
+const mysqlErrDeadlock = 1213
 
+// versionConflict reports the errors of losing a race to another version of
+// the video as services.ErrObjectVersionConflict.
+func versionConflict(err error) error {
+	var mysqlErr *driver.MySQLError
+	if errors.As(err, &mysqlErr) && (mysqlErr.Number == mysqlErrDuplicateEntry || mysqlErr.Number == mysqlErrDeadlock) {
+		return fmt.Errorf("%w: %v", services.ErrObjectVersionConflict, err)
+	}
+	return err
+}
+
+func (r *ObjectRepository) FindByVideoUID(ctx context.Context, providerID, databaseID, videoUID string) (*domain.Object, error) {
+	query := `
+		SELECT ` + objectColumns + `
+		FROM objects
+		WHERE provider_id = ? AND database_id = ? AND video_uid = ? AND superseded_at IS NULL
+	`
+
+	object, err := scanObject(conn(ctx, r.db).QueryRowContext(ctx, query, providerID, databaseID, videoUID))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -66,7 +135,141 @@ func (r *ObjectRepository) FindByVideoUID(ctx context.Context, providerID, datab
 		return nil, err
 	}
 
-	return &object, nil
+	return object, nil
+}
+
+func (r *ObjectRepository) ListVersions(ctx context.Context, providerID, databaseID, videoUID string) ([]*domain.Object, error) {
+	query := `
+		SELECT ` + objectColumns + `
+		FROM objects
+		WHERE provider_id = ? AND database_id = ? AND video_uid = ?
+		ORDER BY version
+	`
+
+	return r.queryObjects(ctx, query, providerID, databaseID, videoUID)
+}
+
+func (r *ObjectRepository) FindSuperseded(ctx context.Context, supersededBefore time.Time, limit int) ([]*domain.Object, error) {
+	query := `
+		SELECT ` + objectColumns + `
+		FROM objects
+		WHERE superseded_at IS NOT NULL AND superseded_at < ? AND purged_at IS NULL
+		ORDER BY superseded_at
+	`
+	args := []any{supersededBefore.UTC()}
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+
+	return r.queryObjects(ctx, query, args...)
+}
+
+func (r *ObjectRepository) MarkPurged(ctx context.Context, uid string, purgedAt time.Time) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, `UPDATE objects SET purged_at = ? WHERE uid = ?`, purgedAt.UTC(), uid)
+	return err
+}
+
+// Purge counts the references with a locking read, whose locks on the
+// storage key keep versions of the blob from being inserted until the
+// transaction ends after release.
+func (r *ObjectRepository) Purge(ctx context.Context, uid string, purgedAt time.Time, release func(references int) error) error {
+	return inTx(ctx, r.db, func(tx dbtx) error {
+		var storageKey string
+		err := tx.QueryRowContext(ctx, `SELECT storage_key FROM objects WHERE uid = ? FOR UPDATE`, uid).Scan(&storageKey)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE objects SET purged_at = ? WHERE uid = ?`, purgedAt.UTC(), uid); err != nil {
+			return err
+		}
+
+		query := `
+			SELECT COUNT(*)
+			FROM objects
+			WHERE storage_key = ? AND purged_at IS NULL
+			FOR UPDATE
+		`
+		var references int
+		if err := tx.QueryRowContext(ctx, query, storageKey).Scan(&references); err != nil {
+			return err
+		}
+		return release(references)
+	})
+}
+
+func (r *ObjectRepository) MarkUnreferenced(ctx context.Context, providerID, databaseID string, videoUIDs []string, unreferencedAt time.Time) error {
+	if len(videoUIDs) == 0 {
+		return nil
+	}
+
+	query := `
+		UPDATE objects
+		SET unreferenced_at = ?
+		WHERE provider_id = ? AND database_id = ? AND video_uid IN (` + placeholders(len(videoUIDs)) + `)
+			AND purged_at IS NULL AND unreferenced_at IS NULL
+	`
+	args := []any{unreferencedAt.UTC(), providerID, databaseID}
+	for _, videoUID := range videoUIDs {
+		args = append(args, videoUID)
+	}
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, args...)
+	return err
+}
+
+func (r *ObjectRepository) ClearUnreferenced(ctx context.Context, providerID, databaseID string, videoUIDs []string) error {
+	if len(videoUIDs) == 0 {
+		return nil
+	}
+
+	query := `
+		UPDATE objects
+		SET unreferenced_at = NULL
+		WHERE provider_id = ? AND database_id = ? AND video_uid IN (` + placeholders(len(videoUIDs)) + `)
+			AND unreferenced_at IS NOT NULL
+	`
+	args := []any{providerID, databaseID}
+	for _, videoUID := range videoUIDs {
+		args = append(args, videoUID)
+	}
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, args...)
+	return err
+}
+
+func (r *ObjectRepository) FindUnreferenced(ctx context.Context, unreferencedBefore time.Time, limit int) ([]*domain.Object, error) {
+	query := `
+		SELECT ` + objectColumns + `
+		FROM objects
+		WHERE unreferenced_at IS NOT NULL AND unreferenced_at < ? AND purged_at IS NULL
+		ORDER BY unreferenced_at
+	`
+	args := []any{unreferencedBefore.UTC()}
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+
+	return r.queryObjects(ctx, query, args...)
+}
+
+func (r *ObjectRepository) CountByStorageKey(ctx context.Context, storageKey string) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM objects
+		WHERE storage_key = ? AND purged_at IS NULL
+	`
+
+	var count int
+	if err := conn(ctx, r.db).QueryRowContext(ctx, query, storageKey).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
 }
 
 func (r *ObjectRepository) CountByAlbumUID(ctx context.Context, providerID, databaseID, albumUID string, albumVideoRepo services.AlbumVideoRepository) (int, error) {
@@ -78,13 +281,116 @@ func (r *ObjectRepository) CountByAlbumUID(ctx context.Context, providerID, data
 			o.database_id = av.database_id AND
 			o.video_uid = av.video_uid
 		WHERE av.provider_id = ? AND av.database_id = ? AND av.album_uid = ?
+			AND o.superseded_at IS NULL AND o.purged_at IS NULL
 	`
 
 	var count int
-	err := r.db.QueryRowContext(ctx, query, providerID, databaseID, albumUID).Scan(&count)
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, providerID, databaseID, albumUID).Scan(&count)
 	if err != nil {
 		return 0, err
 	}
 
 	return count, nil
 }
+
+func (r *ObjectRepository) List(ctx context.Context, filter services.ObjectFilter) ([]*domain.Object, error) {
+	clauses := []string{
+		"provider_id = ?",
+		"database_id = ?",
+		"(video_uid > ? OR (video_uid = ? AND version > ?))",
+	}
+	args := []any{filter.ProviderID, filter.DatabaseID, filter.AfterVideoUID, filter.AfterVideoUID, filter.AfterVersion}
+	if filter.VideoUID != "" {
+		clauses = append(clauses, "video_uid = ?")
+		args = append(args, filter.VideoUID)
+	}
+	if !filter.IncludeSuperseded {
+		clauses = append(clauses, "superseded_at IS NULL")
+	}
+	if !filter.CreatedSince.IsZero() {
+		clauses = append(clauses, "created_at >= ?")
+		args = append(args, filter.CreatedSince.UTC())
+	}
+	if !filter.CreatedBefore.IsZero() {
+		clauses = append(clauses, "created_at < ?")
+		args = append(args, filter.CreatedBefore.UTC())
+	}
+
+	query := `
+		SELECT ` + objectColumns + `
+		FROM objects
+		WHERE ` + strings.Join(clauses, " AND ") + `
+		ORDER BY video_uid, version
+	`
+	if filter.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, filter.Limit)
+	}
+
+	return r.queryObjects(ctx, query, args...)
+}
+
+func (r *ObjectRepository) queryObjects(ctx context.Context, query string, args ...any) ([]*domain.Object, error) {
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var objects []*domain.Object
+	for rows.Next() {
+		object, err := scanObject(rows)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, object)
+	}
+
+	return objects, rows.Err()
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// rows written before versioning have no explicit version
+func objectVersion(object *domain.Object) int {
+	if object.Version == 0 {
+		return 1
+	}
+	return object.Version
+}
+
+func scanObject(row rowScanner) (*domain.Object, error) {
+	var object domain.Object
+	var supersededAt, purgedAt, unreferencedAt sql.NullTime
+	err := row.Scan(
+		&object.UID,
+		&object.ProviderID,
+		&object.DatabaseID,
+		&object.VideoUID,
+		&object.Version,
+		&object.StorageKey,
+		&object.SizeBytes,
+		&object.Checksum,
+		&object.CreatedAt,
+		&supersededAt,
+		&purgedAt,
+		&unreferencedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if supersededAt.Valid {
+		object.SupersededAt = &supersededAt.Time
+	}
+	if purgedAt.Valid {
+		object.PurgedAt = &purgedAt.Time
+	}
+	if unreferencedAt.Valid {
+		object.UnreferencedAt = &unreferencedAt.Time
+	}
+
+	return &object, nil
+}
@@ -0,0 +1,114 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+type OutboxRepository struct {
+	db *sql.DB
+}
+
+func NewOutboxRepository(db *sql.DB) *OutboxRepository {
+	return &OutboxRepository{db: db}
+}
+
+const outboxColumns = `id, message_id, topic, payload, metadata, deliver_at, created_at`
+
+func (r *OutboxRepository) Add(ctx context.Context, msg *services.OutboxMessage) error {
+	metadata, err := json.Marshal(msg.Message.Metadata)
+	if err != nil {
+		return err
+	}
+
+	payload := msg.Message.Payload
+	if payload == nil {
+		payload = []byte{}
+	}
+
+	var deliverAt sql.NullTime
+	if !msg.Message.DeliverAt.IsZero() {
+		deliverAt = sql.NullTime{Time: msg.Message.DeliverAt.UTC(), Valid: true}
+	}
+
+	query := `
+		INSERT INTO outbox_messages (` + outboxColumns + `)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err = conn(ctx, r.db).ExecContext(ctx, query,
+		msg.ID,
+		msg.Message.MessageID,
+		msg.Message.Topic,
+		payload,
+		string(metadata),
+		deliverAt,
+		msg.CreatedAt.UTC(),
+	)
+
+	return err
+}
+
+// ListPending locks the rows it returns when ctx carries a transaction;
+// rows locked by another relay are skipped.
+func (r *OutboxRepository) ListPending(ctx context.Context, limit int) ([]*services.OutboxMessage, error) {
+	query := `
+		SELECT ` + outboxColumns + `
+		FROM outbox_messages
+		ORDER BY seq
+		LIMIT ?
+		FOR UPDATE SKIP LOCKED
+	`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []*services.OutboxMessage
+	for rows.Next() {
+		msg, err := scanOutboxMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, rows.Err()
+}
+
+func (r *OutboxRepository) Delete(ctx context.Context, id string) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM outbox_messages WHERE id = ?`, id)
+	return err
+}
+
+func scanOutboxMessage(row rowScanner) (*services.OutboxMessage, error) {
+	var msg services.OutboxMessage
+	var metadata string
+	var deliverAt sql.NullTime
+	err := row.Scan(
+		&msg.ID,
+		&msg.Message.MessageID,
+		&msg.Message.Topic,
+		&msg.Message.Payload,
+		&metadata,
+		&deliverAt,
+		&msg.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(metadata), &msg.Message.Metadata); err != nil {
+		return nil, err
+	}
+	if deliverAt.Valid {
+		msg.Message.DeliverAt = deliverAt.Time
+	}
+
+	return &msg, nil
+}
@@ -0,0 +1,69 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	driver "github.com/go-sql-driver/mysql"
+)
+
+type ProcessedMessageRepository struct {
+	db *sql.DB
+}
+
+func NewProcessedMessageRepository(db *sql.DB) *ProcessedMessageRepository {
+	return &ProcessedMessageRepository{db: db}
+}
+
+// MarkProcessed inserts the row, so within a unit of work a concurrent
+// delivery of the same message blocks on it until the first one ends.
+func (r *ProcessedMessageRepository) MarkProcessed(ctx context.Context, consumer, messageID string, processedAt time.Time) (bool, error) {
+	query := `
+		INSERT INTO processed_messages (consumer, message_id, processed_at)
+		VALUES (?, ?, ?)
+	`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, consumer, messageID, processedAt.UTC())
+	var mysqlErr *driver.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlErrDuplicateEntry {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *ProcessedMessageRepository) IsProcessed(ctx context.Context, consumer, messageID string) (bool, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM processed_messages
+		WHERE consumer = ? AND message_id = ?
+	`
+
+	var count int
+	if err := conn(ctx, r.db).QueryRowContext(ctx, query, consumer, messageID).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (r *ProcessedMessageRepository) Unmark(ctx context.Context, consumer, messageID string) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM processed_messages WHERE consumer = ? AND message_id = ?`, consumer, messageID)
+	return err
+}
+
+func (r *ProcessedMessageRepository) DeleteProcessedBefore(ctx context.Context, before time.Time) (int, error) {
+	result, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM processed_messages WHERE processed_at < ?`, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(affected), nil
+}
@@ -0,0 +1,60 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+)
+
+// dbtx is what the repositories run statements on: the pool, or the
+// transaction a Transactor put in the context.
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+type txKey struct{}
+
+// Transactor runs units of work in a MySQL transaction that every repository
+// of this package joins through the context. Nested units join the outer one.
+type Transactor struct {
+	db *sql.DB
+}
+
+func NewTransactor(db *sql.DB) *Transactor {
+	return &Transactor{db: db}
+}
+
+func (t *Transactor) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// conn returns the transaction carried by ctx, or db outside of one.
+func conn(ctx context.Context, db *sql.DB) dbtx {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return db
+}
+
+// inTx runs fn in the transaction carried by ctx, or in one of its own for
+// writes that must not be split.
+func inTx(ctx context.Context, db *sql.DB, fn func(tx dbtx) error) error {
+	return NewTransactor(db).WithinTx(ctx, func(ctx context.Context) error {
+		return fn(conn(ctx, db))
+	})
+}
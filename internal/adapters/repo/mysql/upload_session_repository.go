@@ -0,0 +1,129 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/media-vault-sync/internal/core/domain"
+)
+
+type UploadSessionRepository struct {
+	db *sql.DB
+}
+
+func NewUploadSessionRepository(db *sql.DB) *UploadSessionRepository {
+	return &UploadSessionRepository{db: db}
+}
+
+const uploadSessionColumns = `id, provider_id, database_id, user_id, album_uid, video_uid, size_bytes, offset_bytes, created_at, updated_at`
+
+func (r *UploadSessionRepository) Create(ctx context.Context, session *domain.UploadSession) error {
+	query := `
+		INSERT INTO upload_sessions (` + uploadSessionColumns + `)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query,
+		session.ID,
+		session.ProviderID,
+		session.DatabaseID,
+		session.UserID,
+		session.AlbumUID,
+		session.VideoUID,
+		session.SizeBytes,
+		session.Offset,
+		session.CreatedAt.UTC(),
+		session.UpdatedAt.UTC(),
+	)
+
+	return err
+}
+
+func (r *UploadSessionRepository) FindByID(ctx context.Context, id string) (*domain.UploadSession, error) {
+	query := `
+		SELECT ` + uploadSessionColumns + `
+		FROM upload_sessions
+		WHERE id = ?
+	`
+
+	session, err := scanUploadSession(conn(ctx, r.db).QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+func (r *UploadSessionRepository) UpdateOffset(ctx context.Context, id string, expectedOffset, newOffset int64, updatedAt time.Time) (bool, error) {
+	query := `
+		UPDATE upload_sessions
+		SET offset_bytes = ?, updated_at = ?
+		WHERE id = ? AND offset_bytes = ?
+	`
+
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, newOffset, updatedAt.UTC(), id, expectedOffset)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+func (r *UploadSessionRepository) Delete(ctx context.Context, id string) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM upload_sessions WHERE id = ?`, id)
+	return err
+}
+
+func (r *UploadSessionRepository) FindStale(ctx context.Context, updatedBefore time.Time) ([]*domain.UploadSession, error) {
+	query := `
+		SELECT ` + uploadSessionColumns + `
+		FROM upload_sessions
+		WHERE updated_at < ?
+		ORDER BY updated_at
+	`
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, updatedBefore.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*domain.UploadSession
+	for rows.Next() {
+		session, err := scanUploadSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+func scanUploadSession(row rowScanner) (*domain.UploadSession, error) {
+	var session domain.UploadSession
+	err := row.Scan(
+		&session.ID,
+		&session.ProviderID,
+		&session.DatabaseID,
+		&session.UserID,
+		&session.AlbumUID,
+		&session.VideoUID,
+		&session.SizeBytes,
+		&session.Offset,
+		&session.CreatedAt,
+		&session.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
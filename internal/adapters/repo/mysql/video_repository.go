@@ -3,8 +3,10 @@ package mysql
 import (
 	"context"
 	"database/sql"
+	"strings"
 
 	"github.com/media-vault-sync/internal/core/domain"
+	"github.com/media-vault-sync/internal/core/services"
 )
 
 type VideoRepository struct {
@@ -24,7 +26,7 @@ func (r *VideoRepository) Upsert(ctx context.Context, video *domain.Video) error
 			updated_at = VALUES(updated_at)
 	`
 
-	_, err := r.db.ExecContext(ctx, query,
+	_, err := conn(ctx, r.db).ExecContext(ctx, query,
 		video.UID,
 		video.ProviderID,
 		video.DatabaseID,
@@ -45,7 +47,7 @@ func (r *VideoRepository) FindByVideoUID(ctx context.Context, providerID, databa
 	`
 
 	var video domain.Video
-	err := r.db.QueryRowContext(ctx, query, providerID, databaseID, videoUID).Scan(
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, providerID, databaseID, videoUID).Scan(
 		&video.UID,
 		&video.ProviderID,
 		&video.DatabaseID,
@@ -64,3 +66,57 @@ func (r *VideoRepository) FindByVideoUID(ctx context.Context, providerID, databa
 
 	return &video, nil
 }
+
+func (r *VideoRepository) List(ctx context.Context, filter services.VideoFilter) ([]*domain.Video, error) {
+	clauses := []string{"provider_id = ?", "database_id = ?", "video_uid > ?"}
+	args := []any{filter.ProviderID, filter.DatabaseID, filter.AfterVideoUID}
+	if filter.UserID != "" {
+		clauses = append(clauses, "user_id = ?")
+		args = append(args, filter.UserID)
+	}
+	if !filter.UpdatedSince.IsZero() {
+		clauses = append(clauses, "updated_at >= ?")
+		args = append(args, filter.UpdatedSince.UTC())
+	}
+	if !filter.UpdatedBefore.IsZero() {
+		clauses = append(clauses, "updated_at < ?")
+		args = append(args, filter.UpdatedBefore.UTC())
+	}
+
+	query := `
+		SELECT uid, provider_id, database_id, user_id, video_uid, created_at, updated_at
+		FROM videos
+		WHERE ` + strings.Join(clauses, " AND ") + `
+		ORDER BY video_uid
+	`
+	if filter.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var videos []*domain.Video
+	for rows.Next() {
+		var video domain.Video
+		err := rows.Scan(
+			&video.UID,
+			&video.ProviderID,
+			&video.DatabaseID,
+			&video.UserID,
+			&video.VideoUID,
+			&video.CreatedAt,
+			&video.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		videos = append(videos, &video)
+	}
+
+	return videos, rows.Err()
+}
@@ -0,0 +1,173 @@
+package fs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+// temporary files are hidden so List never reports a blob that is still being written
+const blobTempPrefix = ".tmp-"
+
+type BlobStore struct {
+	basePath string
+}
+
+func NewBlobStore(basePath string) *BlobStore {
+	return &BlobStore{basePath: basePath}
+}
+
+func (s *BlobStore) path(key string) (string, error) {
+	if !filepath.IsLocal(filepath.FromSlash(key)) {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	return filepath.Join(s.basePath, filepath.FromSlash(key)), nil
+}
+
+func (s *BlobStore) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return 0, err
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, fmt.Errorf("creating blob directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, blobTempPrefix+"*")
+	if err != nil {
+		return 0, fmt.Errorf("creating blob file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		return 0, fmt.Errorf("writing blob file: %w", err)
+	}
+	// the content must be on disk before the rename makes it visible
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return 0, fmt.Errorf("writing blob file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, fmt.Errorf("writing blob file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return 0, fmt.Errorf("writing blob file: %w", err)
+	}
+	return n, nil
+}
+
+func (s *BlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, services.ErrBlobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading blob file: %w", err)
+	}
+	return f, nil
+}
+
+func (s *BlobStore) Head(ctx context.Context, key string) (*services.BlobInfo, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && info.IsDir()) {
+		return nil, services.ErrBlobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading blob file: %w", err)
+	}
+	return &services.BlobInfo{Key: key, SizeBytes: info.Size(), ModifiedAt: info.ModTime()}, nil
+}
+
+func (s *BlobStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("deleting blob file: %w", err)
+	}
+	return nil
+}
+
+func (s *BlobStore) Move(ctx context.Context, srcKey, dstKey string) error {
+	src, err := s.path(srcKey)
+	if err != nil {
+		return err
+	}
+	dst, err := s.path(dstKey)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("creating blob directory: %w", err)
+	}
+
+	err = os.Rename(src, dst)
+	if errors.Is(err, fs.ErrNotExist) {
+		return services.ErrBlobNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("moving blob file: %w", err)
+	}
+	return nil
+}
+
+func (s *BlobStore) List(ctx context.Context, prefix string) ([]services.BlobInfo, error) {
+	var infos []services.BlobInfo
+	err := filepath.WalkDir(s.basePath, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), blobTempPrefix) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.basePath, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			// deleted while walking
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		infos = append(infos, services.BlobInfo{Key: key, SizeBytes: info.Size(), ModifiedAt: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing blobs: %w", err)
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Key < infos[j].Key })
+	return infos, nil
+}
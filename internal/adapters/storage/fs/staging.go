@@ -3,6 +3,7 @@ package fs
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 )
@@ -15,25 +16,41 @@ func NewStagingStorage(basePath string) *StagingStorage {
 	return &StagingStorage{basePath: basePath}
 }
 
-func (s *StagingStorage) Store(ctx context.Context, key string, data []byte) error {
+func (s *StagingStorage) Store(ctx context.Context, key string, r io.Reader) (int64, error) {
 	path := filepath.Join(s.basePath, key)
 	dir := filepath.Dir(path)
 	if err := os.MkdirAll(dir, 0755); err != nil {
-		return fmt.Errorf("creating staging directory: %w", err)
+		return 0, fmt.Errorf("creating staging directory: %w", err)
 	}
-	if err := os.WriteFile(path, data, 0644); err != nil {
-		return fmt.Errorf("writing staging file: %w", err)
+
+	// write next to the target and rename so a half-written file is never loaded
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return 0, fmt.Errorf("creating staging file: %w", err)
 	}
-	return nil
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		return 0, fmt.Errorf("writing staging file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, fmt.Errorf("writing staging file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return 0, fmt.Errorf("writing staging file: %w", err)
+	}
+	return n, nil
 }
 
-func (s *StagingStorage) Load(ctx context.Context, key string) ([]byte, error) {
+func (s *StagingStorage) Load(ctx context.Context, key string) (io.ReadCloser, error) {
 	path := filepath.Join(s.basePath, key)
-	data, err := os.ReadFile(path)
+	f, err := os.Open(path)
 	if err != nil {
 		return nil, fmt.Errorf("reading staging file: %w", err)
 	}
-	return data, nil
+	return f, nil
 }
 
 func (s *StagingStorage) Delete(ctx context.Context, key string) error {
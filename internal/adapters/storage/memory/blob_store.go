@@ -0,0 +1,97 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+type blob struct {
+	data       []byte
+	modifiedAt time.Time
+}
+
+type BlobStore struct {
+	mu    sync.RWMutex
+	blobs map[string]blob
+}
+
+func NewBlobStore() *BlobStore {
+	return &BlobStore{blobs: make(map[string]blob)}
+}
+
+func (s *BlobStore) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.blobs[key] = blob{data: data, modifiedAt: time.Now()}
+	return int64(len(data)), nil
+}
+
+func (s *BlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	b, ok := s.blobs[key]
+	if !ok {
+		return nil, services.ErrBlobNotFound
+	}
+	return io.NopCloser(bytes.NewReader(b.data)), nil
+}
+
+func (s *BlobStore) Head(ctx context.Context, key string) (*services.BlobInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	b, ok := s.blobs[key]
+	if !ok {
+		return nil, services.ErrBlobNotFound
+	}
+	return &services.BlobInfo{Key: key, SizeBytes: int64(len(b.data)), ModifiedAt: b.modifiedAt}, nil
+}
+
+func (s *BlobStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.blobs, key)
+	return nil
+}
+
+func (s *BlobStore) Move(ctx context.Context, srcKey, dstKey string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.blobs[srcKey]
+	if !ok {
+		return services.ErrBlobNotFound
+	}
+	s.blobs[dstKey] = b
+	delete(s.blobs, srcKey)
+	return nil
+}
+
+func (s *BlobStore) List(ctx context.Context, prefix string) ([]services.BlobInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var infos []services.BlobInfo
+	for key, b := range s.blobs {
+		if strings.HasPrefix(key, prefix) {
+			infos = append(infos, services.BlobInfo{Key: key, SizeBytes: int64(len(b.data)), ModifiedAt: b.modifiedAt})
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Key < infos[j].Key })
+	return infos, nil
+}
@@ -0,0 +1,230 @@
+package s3
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+type Config struct {
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+// BlobStore talks to any S3-compatible server (AWS S3, MinIO, ...) over
+// path-style URLs: {endpoint}/{bucket}/{key}.
+type BlobStore struct {
+	cfg        Config
+	httpClient *http.Client
+}
+
+func NewBlobStore(cfg Config, httpClient *http.Client) *BlobStore {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Minute}
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	return &BlobStore{cfg: cfg, httpClient: httpClient}
+}
+
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+type listBucketResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+}
+
+func (s *BlobStore) newRequest(ctx context.Context, method, key string, query url.Values, body io.Reader) (*http.Request, error) {
+	u, err := url.Parse(strings.TrimSuffix(s.cfg.Endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 endpoint: %w", err)
+	}
+	u.Path = "/" + s.cfg.Bucket + "/" + key
+	u.RawPath = "/" + uriEncode(s.cfg.Bucket, true) + "/" + uriEncode(key, false)
+	if query != nil {
+		u.RawQuery = canonicalQuery(query)
+	}
+
+	return http.NewRequestWithContext(ctx, method, u.String(), body)
+}
+
+// do signs and sends the request; a 404 becomes ErrBlobNotFound and any other
+// non-2xx status an error carrying the S3 error code.
+func (s *BlobStore) do(req *http.Request, payloadHash string) (*http.Response, error) {
+	sign(req, s.cfg.AccessKeyID, s.cfg.SecretAccessKey, s.cfg.Region, payloadHash, time.Now())
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, services.ErrBlobNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		var e s3Error
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if xml.Unmarshal(body, &e) == nil && e.Code != "" {
+			return nil, fmt.Errorf("s3 %s %s: %s: %s", req.Method, req.URL.Path, e.Code, e.Message)
+		}
+		return nil, fmt.Errorf("s3 %s %s: status %d", req.Method, req.URL.Path, resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// Put spools the content to a temporary file first: S3 needs the length and
+// the payload hash up front, and the source may be a stream of unknown size.
+func (s *BlobStore) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	tmp, err := os.CreateTemp("", "s3-put-*")
+	if err != nil {
+		return 0, fmt.Errorf("creating spool file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hasher := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, hasher), r)
+	if err != nil {
+		return 0, fmt.Errorf("spooling blob: %w", err)
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("spooling blob: %w", err)
+	}
+
+	req, err := s.newRequest(ctx, http.MethodPut, key, nil, io.NopCloser(tmp))
+	if err != nil {
+		return 0, err
+	}
+	req.ContentLength = n
+	if n == 0 {
+		req.Body = http.NoBody
+	}
+
+	resp, err := s.do(req, hex.EncodeToString(hasher.Sum(nil)))
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return n, nil
+}
+
+func (s *BlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	req, err := s.newRequest(ctx, http.MethodGet, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(req, emptyPayload)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *BlobStore) Head(ctx context.Context, key string) (*services.BlobInfo, error) {
+	req, err := s.newRequest(ctx, http.MethodHead, key, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(req, emptyPayload)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	info := &services.BlobInfo{Key: key, SizeBytes: resp.ContentLength}
+	if lm := resp.Header.Get("Last-Modified"); lm != "" {
+		if t, err := http.ParseTime(lm); err == nil {
+			info.ModifiedAt = t
+		}
+	}
+	return info, nil
+}
+
+func (s *BlobStore) Delete(ctx context.Context, key string) error {
+	req, err := s.newRequest(ctx, http.MethodDelete, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req, emptyPayload)
+	if err == services.ErrBlobNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Move copies server-side and then deletes the source; S3 has no rename.
+func (s *BlobStore) Move(ctx context.Context, srcKey, dstKey string) error {
+	req, err := s.newRequest(ctx, http.MethodPut, dstKey, nil, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Amz-Copy-Source", "/"+uriEncode(s.cfg.Bucket, true)+"/"+uriEncode(srcKey, false))
+	resp, err := s.do(req, emptyPayload)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	return s.Delete(ctx, srcKey)
+}
+
+func (s *BlobStore) List(ctx context.Context, prefix string) ([]services.BlobInfo, error) {
+	var infos []services.BlobInfo
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		req, err := s.newRequest(ctx, http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := s.do(req, emptyPayload)
+		if err != nil {
+			return nil, err
+		}
+
+		var result listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("decoding list response: %w", err)
+		}
+
+		for _, c := range result.Contents {
+			infos = append(infos, services.BlobInfo{Key: c.Key, SizeBytes: c.Size, ModifiedAt: c.LastModified})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return infos, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
@@ -0,0 +1,249 @@
+package s3
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+// fakeS3 is a local stand-in for an S3-compatible server. It implements the
+// subset of the API the adapter uses and checks that requests are signed and
+// that the signed payload hash matches the body.
+type fakeS3 struct {
+	t       *testing.T
+	bucket  string
+	pageLen int
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newFakeS3(t *testing.T, bucket string) *fakeS3 {
+	return &fakeS3{t: t, bucket: bucket, pageLen: 2, objects: make(map[string][]byte)}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=test-key/") {
+		f.t.Errorf("%s %s: missing or invalid Authorization header", r.Method, r.URL.Path)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if r.Header.Get("X-Amz-Date") == "" {
+		f.t.Errorf("%s %s: missing X-Amz-Date", r.Method, r.URL.Path)
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != f.bucket {
+		writeS3Error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodGet && key == "" && r.URL.Query().Get("list-type") == "2":
+		f.list(w, r)
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		if !strings.Contains(r.Header.Get("Authorization"), "x-amz-copy-source") {
+			f.t.Errorf("copy request does not sign x-amz-copy-source")
+		}
+		src, _ := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+		_, srcKey, _ := strings.Cut(strings.TrimPrefix(src, "/"), "/")
+		data, ok := f.objects[srcKey]
+		if !ok {
+			writeS3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		f.objects[key] = data
+	case r.Method == http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		sum := sha256.Sum256(data)
+		if got := r.Header.Get("X-Amz-Content-Sha256"); got != hex.EncodeToString(sum[:]) {
+			writeS3Error(w, http.StatusBadRequest, "XAmzContentSHA256Mismatch")
+			return
+		}
+		f.objects[key] = data
+	case r.Method == http.MethodGet, r.Method == http.MethodHead:
+		data, ok := f.objects[key]
+		if !ok {
+			writeS3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		if r.Method == http.MethodGet {
+			w.Write(data)
+		}
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+	start := r.URL.Query().Get("continuation-token")
+
+	var keys []string
+	for k := range f.objects {
+		if strings.HasPrefix(k, prefix) && k > start {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var result listBucketResult
+	if len(keys) > f.pageLen {
+		keys = keys[:f.pageLen]
+		result.IsTruncated = true
+		result.NextContinuationToken = keys[len(keys)-1]
+	}
+	for _, k := range keys {
+		result.Contents = append(result.Contents, struct {
+			Key          string    `xml:"Key"`
+			Size         int64     `xml:"Size"`
+			LastModified time.Time `xml:"LastModified"`
+		}{Key: k, Size: int64(len(f.objects[k])), LastModified: time.Now().UTC()})
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"ListBucketResult"`
+		listBucketResult
+	}{listBucketResult: result})
+}
+
+func writeS3Error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		s3Error
+	}{s3Error: s3Error{Code: code, Message: code}})
+}
+
+func newTestBlobStore(t *testing.T) *BlobStore {
+	server := httptest.NewServer(newFakeS3(t, "videos"))
+	t.Cleanup(server.Close)
+
+	return NewBlobStore(Config{
+		Endpoint:        server.URL,
+		Bucket:          "videos",
+		AccessKeyID:     "test-key",
+		SecretAccessKey: "test-secret",
+	}, nil)
+}
+
+func TestS3BlobStore_PutGetHeadDelete(t *testing.T) {
+	ctx := context.Background()
+	store := newTestBlobStore(t)
+
+	key := "objects/p1/db1/video 1"
+	n, err := store.Put(ctx, key, strings.NewReader("hello video"))
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	if n != 11 {
+		t.Errorf("expected 11 bytes written, got %d", n)
+	}
+
+	body, err := store.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+	if string(data) != "hello video" {
+		t.Errorf("expected %q, got %q", "hello video", data)
+	}
+
+	info, err := store.Head(ctx, key)
+	if err != nil {
+		t.Fatalf("head failed: %v", err)
+	}
+	if info.SizeBytes != 11 {
+		t.Errorf("expected size 11, got %d", info.SizeBytes)
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if _, err := store.Get(ctx, key); !errors.Is(err, services.ErrBlobNotFound) {
+		t.Errorf("expected ErrBlobNotFound after delete, got %v", err)
+	}
+	if _, err := store.Head(ctx, key); !errors.Is(err, services.ErrBlobNotFound) {
+		t.Errorf("expected ErrBlobNotFound from head after delete, got %v", err)
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		t.Errorf("deleting a missing key should succeed, got %v", err)
+	}
+}
+
+func TestS3BlobStore_ListFollowsContinuationTokens(t *testing.T) {
+	ctx := context.Background()
+	store := newTestBlobStore(t)
+
+	for _, key := range []string{"objects/p1/a", "objects/p1/b", "objects/p1/c", "objects/p2/a", "other/x"} {
+		if _, err := store.Put(ctx, key, strings.NewReader(key)); err != nil {
+			t.Fatalf("put %s failed: %v", key, err)
+		}
+	}
+
+	infos, err := store.List(ctx, "objects/p1/")
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+
+	var keys []string
+	for _, info := range infos {
+		keys = append(keys, info.Key)
+	}
+	if got := strings.Join(keys, ","); got != "objects/p1/a,objects/p1/b,objects/p1/c" {
+		t.Errorf("unexpected keys: %s", got)
+	}
+}
+
+func TestS3BlobStore_MoveCopiesAndDeletesSource(t *testing.T) {
+	ctx := context.Background()
+	store := newTestBlobStore(t)
+
+	if _, err := store.Put(ctx, "uploads/incoming/1", strings.NewReader("content")); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	if err := store.Move(ctx, "uploads/incoming/1", "blobs/sha256/abc"); err != nil {
+		t.Fatalf("move failed: %v", err)
+	}
+
+	if _, err := store.Head(ctx, "uploads/incoming/1"); !errors.Is(err, services.ErrBlobNotFound) {
+		t.Errorf("source should be gone after move, got %v", err)
+	}
+	body, err := store.Get(ctx, "blobs/sha256/abc")
+	if err != nil {
+		t.Fatalf("destination should exist after move: %v", err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+	if string(data) != "content" {
+		t.Errorf("expected moved content, got %q", data)
+	}
+
+	if err := store.Move(ctx, "missing", "elsewhere"); !errors.Is(err, services.ErrBlobNotFound) {
+		t.Errorf("expected ErrBlobNotFound moving a missing key, got %v", err)
+	}
+}
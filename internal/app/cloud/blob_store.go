@@ -0,0 +1,33 @@
+package cloud
+
+import (
+	"fmt"
+
+	"github.com/media-vault-sync/internal/adapters/storage/fs"
+	memorystorage "github.com/media-vault-sync/internal/adapters/storage/memory"
+	"github.com/media-vault-sync/internal/adapters/storage/s3"
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+// OpenBlobStore returns the blob store selected by BLOB_BACKEND.
+func OpenBlobStore(cfg Config) (services.BlobStore, error) {
+	switch cfg.BlobBackend {
+	case "", "memory":
+		return memorystorage.NewBlobStore(), nil
+	case "fs":
+		return fs.NewBlobStore(cfg.BlobDir), nil
+	case "s3":
+		if cfg.S3Endpoint == "" || cfg.S3Bucket == "" {
+			return nil, fmt.Errorf("S3_ENDPOINT and S3_BUCKET are required for the s3 blob backend")
+		}
+		return s3.NewBlobStore(s3.Config{
+			Endpoint:        cfg.S3Endpoint,
+			Region:          cfg.S3Region,
+			Bucket:          cfg.S3Bucket,
+			AccessKeyID:     cfg.S3AccessKeyID,
+			SecretAccessKey: cfg.S3SecretAccessKey,
+		}, nil), nil
+	default:
+		return nil, fmt.Errorf("unknown blob backend %q", cfg.BlobBackend)
+	}
+}
@@ -3,24 +3,88 @@ package cloud
 import (
 	"os"
 	"strconv"
+	"strings"
 	"time"
+
+	"github.com/media-vault-sync/internal/core/services"
 )
 
 type Config struct {
-	Port             string
-	RepoBackend      string
-	MySQLDSN         string
-	ScanInterval     time.Duration
-	QueueTickInterval time.Duration
+	Port                  string
+	RepoBackend           string
+	QueueBackend          string
+	BlobBackend           string
+	BlobDir               string
+	S3Endpoint            string
+	S3Region              string
+	S3Bucket              string
+	S3AccessKeyID         string
+	S3SecretAccessKey     string
+	MySQLDSN              string
+	MySQLMaxOpenConns     int
+	MySQLMaxIdleConns     int
+	MySQLConnMaxLifetime  time.Duration
+	ScanInterval          time.Duration
+	MissingObjectGrace    time.Duration
+	QueueTickInterval     time.Duration
+	OutboxRelayInterval   time.Duration
+	ObjectRetention       time.Duration
+	UnreferencedRetention time.Duration
+	GCInterval            time.Duration
+	UploadSessionTTL      time.Duration
+	IdempotencyTTL        time.Duration
+	// QueueDedupWindow of zero turns queue deduplication off
+	QueueDedupWindow          time.Duration
+	ProcessedMessageRetention time.Duration
+	// QueueRetryPolicy applies to topics missing from QueueTopicRetryPolicies;
+	// a zero policy means services.DefaultRetryPolicy
+	QueueRetryPolicy        services.RetryPolicy
+	QueueTopicRetryPolicies map[string]services.RetryPolicy
+	// QueueConcurrency is the number of workers of topics missing from
+	// QueueTopicConcurrency; zero means one
+	QueueConcurrency      int
+	QueueTopicConcurrency map[string]int
+	// QueueBrokerPollWait caps how long a poll of the queue broker waits for
+	// a message; QueueBrokerAckTimeout is how long a delivery waits for its
+	// ack before the message is retried; with the mysql queue it must be below
+	// the queue lease. Zero means the services defaults.
+	QueueBrokerPollWait   time.Duration
+	QueueBrokerAckTimeout time.Duration
 }
 
 func LoadConfig() Config {
 	cfg := Config{
-		Port:             getEnv("CLOUD_PORT", "8080"),
-		RepoBackend:      getEnv("REPO_BACKEND", "memory"),
-		MySQLDSN:         getEnv("MYSQL_DSN", ""),
-		ScanInterval:     getDurationEnv("SCAN_INTERVAL", 30*time.Second),
-		QueueTickInterval: getDurationEnv("QUEUE_TICK_INTERVAL", 100*time.Millisecond),
+		Port:                      getEnv("CLOUD_PORT", "8080"),
+		RepoBackend:               getEnv("REPO_BACKEND", "memory"),
+		QueueBackend:              getEnv("QUEUE_BACKEND", "memory"),
+		BlobBackend:               getEnv("BLOB_BACKEND", "memory"),
+		BlobDir:                   getEnv("BLOB_DIR", "/tmp/blobs"),
+		S3Endpoint:                getEnv("S3_ENDPOINT", ""),
+		S3Region:                  getEnv("S3_REGION", "us-east-1"),
+		S3Bucket:                  getEnv("S3_BUCKET", ""),
+		S3AccessKeyID:             getEnv("S3_ACCESS_KEY_ID", ""),
+		S3SecretAccessKey:         getEnv("S3_SECRET_ACCESS_KEY", ""),
+		MySQLDSN:                  getEnv("MYSQL_DSN", ""),
+		MySQLMaxOpenConns:         getIntEnv("MYSQL_MAX_OPEN_CONNS", 25),
+		MySQLMaxIdleConns:         getIntEnv("MYSQL_MAX_IDLE_CONNS", 25),
+		MySQLConnMaxLifetime:      getDurationEnv("MYSQL_CONN_MAX_LIFETIME", 5*time.Minute),
+		ScanInterval:              getDurationEnv("SCAN_INTERVAL", 30*time.Second),
+		MissingObjectGrace:        getDurationEnv("MISSING_OBJECT_GRACE", time.Hour),
+		QueueTickInterval:         getDurationEnv("QUEUE_TICK_INTERVAL", 100*time.Millisecond),
+		OutboxRelayInterval:       getDurationEnv("OUTBOX_RELAY_INTERVAL", 100*time.Millisecond),
+		ObjectRetention:           getDurationEnv("OBJECT_RETENTION", 7*24*time.Hour),
+		UnreferencedRetention:     getDurationEnv("UNREFERENCED_RETENTION", 30*24*time.Hour),
+		GCInterval:                getDurationEnv("GC_INTERVAL", time.Hour),
+		UploadSessionTTL:          getDurationEnv("UPLOAD_SESSION_TTL", 24*time.Hour),
+		IdempotencyTTL:            getDurationEnv("IDEMPOTENCY_TTL", 24*time.Hour),
+		QueueDedupWindow:          getDurationEnv("QUEUE_DEDUP_WINDOW", 10*time.Minute),
+		ProcessedMessageRetention: getDurationEnv("PROCESSED_MESSAGE_RETENTION", 7*24*time.Hour),
+		QueueRetryPolicy:          getRetryPolicyEnv("QUEUE_RETRY_POLICY", services.DefaultRetryPolicy),
+		QueueTopicRetryPolicies:   getTopicRetryPoliciesEnv("QUEUE_TOPIC_RETRY_POLICIES"),
+		QueueConcurrency:          getIntEnv("QUEUE_CONCURRENCY", 1),
+		QueueTopicConcurrency:     getTopicConcurrencyEnv("QUEUE_TOPIC_CONCURRENCY"),
+		QueueBrokerPollWait:       getDurationEnv("QUEUE_BROKER_POLL_WAIT", services.DefaultQueueBrokerPollWait),
+		QueueBrokerAckTimeout:     getDurationEnv("QUEUE_BROKER_ACK_TIMEOUT", services.DefaultQueueBrokerAckTimeout),
 	}
 	return cfg
 }
@@ -32,6 +96,17 @@ func getEnv(key, defaultVal string) string {
 	return defaultVal
 }
 
+func getIntEnv(key string, defaultVal int) int {
+	val := os.Getenv(key)
+	if val == "" {
+		return defaultVal
+	}
+	if n, err := strconv.Atoi(val); err == nil {
+		return n
+	}
+	return defaultVal
+}
+
 func getDurationEnv(key string, defaultVal time.Duration) time.Duration {
 	val := os.Getenv(key)
 	if val == "" {
@@ -45,3 +120,46 @@ func getDurationEnv(key string, defaultVal time.Duration) time.Duration {
 	}
 	return defaultVal
 }
+
+func getRetryPolicyEnv(key string, defaultVal services.RetryPolicy) services.RetryPolicy {
+	val := os.Getenv(key)
+	if val == "" {
+		return defaultVal
+	}
+	if policy, err := services.ParseRetryPolicy(val); err == nil {
+		return policy
+	}
+	return defaultVal
+}
+
+// getTopicRetryPoliciesEnv parses "topic=policy" pairs separated by commas,
+// skipping malformed ones.
+func getTopicRetryPoliciesEnv(key string) map[string]services.RetryPolicy {
+	policies := make(map[string]services.RetryPolicy)
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		topic, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+		if policy, err := services.ParseRetryPolicy(val); err == nil {
+			policies[topic] = policy
+		}
+	}
+	return policies
+}
+
+// getTopicConcurrencyEnv parses "topic=workers" pairs separated by commas,
+// skipping malformed ones.
+func getTopicConcurrencyEnv(key string) map[string]int {
+	concurrency := make(map[string]int)
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		topic, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+		if n, err := strconv.Atoi(val); err == nil && n > 0 {
+			concurrency[topic] = n
+		}
+	}
+	return concurrency
+}
@@ -0,0 +1,51 @@
+package cloud
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/media-vault-sync/internal/adapters/repo/mysql"
+	"github.com/media-vault-sync/migrations"
+)
+
+// OpenDatabase returns a migrated MySQL pool when the repositories or the
+// queue use the mysql backend, and nil when everything runs in memory.
+func OpenDatabase(ctx context.Context, cfg Config) (*sql.DB, error) {
+	needsDB := false
+	for _, b := range []struct{ name, value string }{
+		{"repo", cfg.RepoBackend},
+		{"queue", cfg.QueueBackend},
+	} {
+		switch b.value {
+		case "", "memory":
+		case "mysql":
+			needsDB = true
+		default:
+			return nil, fmt.Errorf("unknown %s backend %q", b.name, b.value)
+		}
+	}
+	if !needsDB {
+		return nil, nil
+	}
+
+	if cfg.MySQLDSN == "" {
+		return nil, fmt.Errorf("MYSQL_DSN is required for the mysql backend")
+	}
+
+	db, err := mysql.Open(ctx, cfg.MySQLDSN, mysql.PoolConfig{
+		MaxOpenConns:    cfg.MySQLMaxOpenConns,
+		MaxIdleConns:    cfg.MySQLMaxIdleConns,
+		ConnMaxLifetime: cfg.MySQLConnMaxLifetime,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := mysql.Migrate(ctx, db, migrations.Files); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrating schema: %w", err)
+	}
+
+	return db, nil
+}
@@ -2,11 +2,17 @@ package cloud
 
 import (
 	"context"
+	"database/sql"
 	"net/http"
+	"time"
 
+	"github.com/media-vault-sync/internal/adapters/http/admin"
 	"github.com/media-vault-sync/internal/adapters/http/cloud"
 	"github.com/media-vault-sync/internal/adapters/queue/memory"
+	mysqlqueue "github.com/media-vault-sync/internal/adapters/queue/mysql"
 	memoryrepo "github.com/media-vault-sync/internal/adapters/repo/memory"
+	mysqlrepo "github.com/media-vault-sync/internal/adapters/repo/mysql"
+	memorystorage "github.com/media-vault-sync/internal/adapters/storage/memory"
 	"github.com/media-vault-sync/internal/core/services"
 )
 
@@ -14,28 +20,60 @@ type TickableQueue interface {
 	services.Queue
 	Tick(ctx context.Context) (delivered int, requeued int)
 	Process(ctx context.Context) int
+	// Run hands messages to the topics' workers until ctx is cancelled and
+	// returns once the handlers in flight are done.
+	Run(ctx context.Context, interval time.Duration)
 	PendingCount() int
 }
 
 type App struct {
-	Handler                    http.Handler
-	Queue                      TickableQueue
-	Clock                      services.Clock
-	AlbumRepo                  services.AlbumRepository
-	AlbumVideoRepo             services.AlbumVideoRepository
-	VideoRepo                  services.VideoRepository
-	ObjectRepo                 services.ObjectRepository
-	EventualConsistencyWorker      *services.EventualConsistencyWorker
+	Handler                          http.Handler
+	Queue                            TickableQueue
+	Clock                            services.Clock
+	AlbumRepo                        services.AlbumRepository
+	AlbumVideoRepo                   services.AlbumVideoRepository
+	VideoRepo                        services.VideoRepository
+	ObjectRepo                       services.ObjectRepository
+	BlobStore                        services.BlobStore
+	UploadSessionRepo                services.UploadSessionRepository
+	ManifestRevisionRepo             services.ManifestRevisionRepository
+	Transactor                       services.Transactor
+	OutboxRepo                       services.OutboxRepository
+	OutboxRelay                      *services.OutboxRelay
+	IdempotencyRepo                  services.IdempotencyRepository
+	IdempotencyService               *services.IdempotencyService
+	ProcessedMessageRepo             services.ProcessedMessageRepository
+	MessageDeduplicator              *services.MessageDeduplicator
+	UploadSessionService             *services.UploadSessionService
+	AlbumStatusService               *services.AlbumStatusService
+	ListingService                   *services.ListingService
+	ManifestHistoryService           *services.ManifestHistoryService
+	DeadLetterRepo                   services.DeadLetterRepository
+	DeadLetterService                *services.DeadLetterService
+	QueueBroker                      *services.QueueBroker
+	EventualConsistencyWorker        *services.EventualConsistencyWorker
 	EventualConsistencyCheckConsumer *services.EventualConsistencyCheckConsumer
+	ObjectGarbageCollector           *services.ObjectGarbageCollector
 }
 
 type WireOptions struct {
-	Clock          services.Clock
-	Queue          TickableQueue
-	AlbumRepo      services.AlbumRepository
-	AlbumVideoRepo services.AlbumVideoRepository
-	VideoRepo      services.VideoRepository
-	ObjectRepo     services.ObjectRepository
+	DB                   *sql.DB
+	Clock                services.Clock
+	Queue                TickableQueue
+	AlbumRepo            services.AlbumRepository
+	AlbumVideoRepo       services.AlbumVideoRepository
+	VideoRepo            services.VideoRepository
+	ObjectRepo           services.ObjectRepository
+	BlobStore            services.BlobStore
+	UploadSessionRepo    services.UploadSessionRepository
+	ManifestRevisionRepo services.ManifestRevisionRepository
+	DeadLetterRepo       services.DeadLetterRepository
+	Transactor           services.Transactor
+	// OutboxRepo routes manifest changes through the outbox; the mysql
+	// backend always uses one.
+	OutboxRepo           services.OutboxRepository
+	IdempotencyRepo      services.IdempotencyRepository
+	ProcessedMessageRepo services.ProcessedMessageRepository
 }
 
 func Wire(cfg Config, opts *WireOptions) *App {
@@ -45,6 +83,19 @@ func Wire(cfg Config, opts *WireOptions) *App {
 	var albumVideoRepo services.AlbumVideoRepository
 	var videoRepo services.VideoRepository
 	var objectRepo services.ObjectRepository
+	var blobStore services.BlobStore
+	var uploadSessionRepo services.UploadSessionRepository
+	var manifestRevisionRepo services.ManifestRevisionRepository
+	var deadLetterRepo services.DeadLetterRepository
+	var transactor services.Transactor
+	var outboxRepo services.OutboxRepository
+	var idempotencyRepo services.IdempotencyRepository
+	var processedMessageRepo services.ProcessedMessageRepository
+	var db *sql.DB
+
+	if opts != nil {
+		db = opts.DB
+	}
 
 	if opts != nil && opts.Clock != nil {
 		clock = opts.Clock
@@ -52,66 +103,233 @@ func Wire(cfg Config, opts *WireOptions) *App {
 		clock = services.RealClock{}
 	}
 
+	if opts != nil && opts.DeadLetterRepo != nil {
+		deadLetterRepo = opts.DeadLetterRepo
+	} else if db != nil && cfg.RepoBackend == "mysql" {
+		deadLetterRepo = mysqlrepo.NewDeadLetterRepository(db)
+	} else {
+		deadLetterRepo = memoryrepo.NewDeadLetterRepository()
+	}
+
+	retryPolicy := cfg.QueueRetryPolicy
+	if retryPolicy.MaxAttempts == 0 {
+		retryPolicy = services.DefaultRetryPolicy
+	}
 	if opts != nil && opts.Queue != nil {
 		queue = opts.Queue
+	} else if db != nil && cfg.QueueBackend == "mysql" {
+		queue = mysqlqueue.NewQueue(db, clock,
+			mysqlqueue.WithDeadLetterRepository(deadLetterRepo),
+			mysqlqueue.WithDedupWindow(cfg.QueueDedupWindow),
+			mysqlqueue.WithRetryPolicy(retryPolicy),
+			mysqlqueue.WithTopicRetryPolicies(cfg.QueueTopicRetryPolicies),
+			mysqlqueue.WithConcurrency(cfg.QueueConcurrency),
+			mysqlqueue.WithTopicConcurrency(cfg.QueueTopicConcurrency))
 	} else {
-		queue = memory.NewInMemoryQueue(clock)
+		queue = memory.NewInMemoryQueue(clock,
+			memory.WithDeadLetterRepository(deadLetterRepo),
+			memory.WithDedupWindow(cfg.QueueDedupWindow),
+			memory.WithRetryPolicy(retryPolicy),
+			memory.WithTopicRetryPolicies(cfg.QueueTopicRetryPolicies),
+			memory.WithConcurrency(cfg.QueueConcurrency),
+			memory.WithTopicConcurrency(cfg.QueueTopicConcurrency))
 	}
 
 	if opts != nil && opts.AlbumRepo != nil {
 		albumRepo = opts.AlbumRepo
+	} else if db != nil && cfg.RepoBackend == "mysql" {
+		albumRepo = mysqlrepo.NewAlbumRepository(db)
 	} else {
 		albumRepo = memoryrepo.NewAlbumRepository()
 	}
 
 	if opts != nil && opts.AlbumVideoRepo != nil {
 		albumVideoRepo = opts.AlbumVideoRepo
+	} else if db != nil && cfg.RepoBackend == "mysql" {
+		albumVideoRepo = mysqlrepo.NewAlbumVideoRepository(db)
 	} else {
 		albumVideoRepo = memoryrepo.NewAlbumVideoRepository()
 	}
 
 	if opts != nil && opts.VideoRepo != nil {
 		videoRepo = opts.VideoRepo
+	} else if db != nil && cfg.RepoBackend == "mysql" {
+		videoRepo = mysqlrepo.NewVideoRepository(db)
 	} else {
 		videoRepo = memoryrepo.NewVideoRepository()
 	}
 
 	if opts != nil && opts.ObjectRepo != nil {
 		objectRepo = opts.ObjectRepo
+	} else if db != nil && cfg.RepoBackend == "mysql" {
+		objectRepo = mysqlrepo.NewObjectRepository(db)
 	} else {
 		objectRepo = memoryrepo.NewObjectRepository()
 	}
 
+	if opts != nil && opts.BlobStore != nil {
+		blobStore = opts.BlobStore
+	} else {
+		blobStore = memorystorage.NewBlobStore()
+	}
+
+	if opts != nil && opts.UploadSessionRepo != nil {
+		uploadSessionRepo = opts.UploadSessionRepo
+	} else if db != nil && cfg.RepoBackend == "mysql" {
+		uploadSessionRepo = mysqlrepo.NewUploadSessionRepository(db)
+	} else {
+		uploadSessionRepo = memoryrepo.NewUploadSessionRepository()
+	}
+
+	if opts != nil && opts.ManifestRevisionRepo != nil {
+		manifestRevisionRepo = opts.ManifestRevisionRepo
+	} else if db != nil && cfg.RepoBackend == "mysql" {
+		manifestRevisionRepo = mysqlrepo.NewManifestRevisionRepository(db)
+	} else {
+		manifestRevisionRepo = memoryrepo.NewManifestRevisionRepository()
+	}
+
+	if opts != nil && opts.Transactor != nil {
+		transactor = opts.Transactor
+	} else if db != nil && cfg.RepoBackend == "mysql" {
+		transactor = mysqlrepo.NewTransactor(db)
+	} else {
+		transactor = memoryrepo.NewTransactor()
+	}
+
+	if opts != nil && opts.OutboxRepo != nil {
+		outboxRepo = opts.OutboxRepo
+	} else if db != nil && cfg.RepoBackend == "mysql" {
+		outboxRepo = mysqlrepo.NewOutboxRepository(db)
+	}
+
+	if opts != nil && opts.IdempotencyRepo != nil {
+		idempotencyRepo = opts.IdempotencyRepo
+	} else if db != nil && cfg.RepoBackend == "mysql" {
+		idempotencyRepo = mysqlrepo.NewIdempotencyRepository(db)
+	} else {
+		idempotencyRepo = memoryrepo.NewIdempotencyRepository()
+	}
+
+	if opts != nil && opts.ProcessedMessageRepo != nil {
+		processedMessageRepo = opts.ProcessedMessageRepo
+	} else if db != nil && cfg.RepoBackend == "mysql" {
+		processedMessageRepo = mysqlrepo.NewProcessedMessageRepository(db)
+	} else {
+		processedMessageRepo = memoryrepo.NewProcessedMessageRepository()
+	}
+
+	// manifest changes publish through the outbox when there is one, so their
+	// messages commit with them; memory repositories cannot roll back, so
+	// without one they publish directly
+	var manifestQueue services.Queue = queue
+	var outboxRelay *services.OutboxRelay
+	if outboxRepo != nil {
+		manifestQueue = services.NewOutboxPublisher(outboxRepo, queue, clock)
+		outboxRelay = services.NewOutboxRelay(outboxRepo, queue, transactor)
+	}
+
+	messageDeduplicator := services.NewMessageDeduplicator(processedMessageRepo, transactor, clock, cfg.ProcessedMessageRetention)
+
+	idempotencyService := services.NewIdempotencyService(idempotencyRepo, clock, cfg.IdempotencyTTL)
+
 	userAlbumsService := services.NewUserAlbumsService(albumRepo, queue)
 	userAlbumsHandler := cloud.NewUserAlbumsHandler(userAlbumsService)
 
-	albumManifestUploadService := services.NewAlbumManifestUploadService(albumRepo, albumVideoRepo, queue, clock)
+	albumManifestUploadService := services.NewAlbumManifestUploadService(albumRepo, albumVideoRepo, manifestRevisionRepo, objectRepo, transactor, manifestQueue, clock)
 	albumManifestUploadHandler := cloud.NewAlbumManifestUploadHandler(albumManifestUploadService)
 
-	videoUploadService := services.NewVideoUploadService(albumRepo, albumVideoRepo, videoRepo, objectRepo, clock)
+	videoUploadService := services.NewVideoUploadService(albumRepo, albumVideoRepo, videoRepo, objectRepo, blobStore, clock)
 	videoUploadHandler := cloud.NewVideoUploadHandler(videoUploadService)
 
-	eventualConsistencyWorker := services.NewEventualConsistencyWorker(albumRepo, queue, clock)
-	eventualConsistencyCheckConsumer := services.NewEventualConsistencyCheckConsumer(albumRepo, queue, clock)
+	uploadSessionService := services.NewUploadSessionService(uploadSessionRepo, blobStore, videoUploadService, clock, cfg.UploadSessionTTL)
+	uploadSessionHandler := cloud.NewUploadSessionHandler(uploadSessionService)
+
+	albumStatusService := services.NewAlbumStatusService(albumRepo, albumVideoRepo, objectRepo)
+	albumStatusHandler := cloud.NewAlbumStatusHandler(albumStatusService)
+
+	listingService := services.NewListingService(albumRepo, videoRepo, objectRepo)
+	listingHandler := cloud.NewListingHandler(listingService)
+
+	manifestHistoryService := services.NewManifestHistoryService(albumRepo, manifestRevisionRepo)
+	manifestHistoryHandler := cloud.NewManifestHistoryHandler(manifestHistoryService)
+
+	eventualConsistencyWorker := services.NewEventualConsistencyWorker(albumRepo, albumVideoRepo, objectRepo, deadLetterRepo, queue, clock, cfg.MissingObjectGrace)
+	eventualConsistencyCheckConsumer := services.NewEventualConsistencyCheckConsumer(albumRepo, deadLetterRepo, queue, clock)
+
+	objectGarbageCollector := services.NewObjectGarbageCollector(objectRepo, blobStore, clock, cfg.ObjectRetention, cfg.UnreferencedRetention)
+
+	deadLetterService := services.NewDeadLetterService(deadLetterRepo, queue)
+	deadLetterHandler := admin.NewDeadLetterHandler(deadLetterService)
+
+	brokerPollWait := cfg.QueueBrokerPollWait
+	if brokerPollWait == 0 {
+		brokerPollWait = services.DefaultQueueBrokerPollWait
+	}
+	brokerAckTimeout := cfg.QueueBrokerAckTimeout
+	if brokerAckTimeout == 0 {
+		brokerAckTimeout = services.DefaultQueueBrokerAckTimeout
+	}
+	var brokerLock services.QueueBrokerLock
+	if (opts == nil || opts.Queue == nil) && db != nil && cfg.QueueBackend == "mysql" {
+		// the instances share the queue but not the deliveries awaiting acks
+		brokerLock = mysqlrepo.NewNamedLock(db, "media_vault_sync.queue_broker")
+		// a delivery must be settled while its lease holds
+		if brokerAckTimeout >= mysqlqueue.LeaseDuration {
+			brokerAckTimeout = services.DefaultQueueBrokerAckTimeout
+		}
+	}
+	queueBroker := services.NewQueueBroker(queue, brokerLock, brokerPollWait, brokerAckTimeout)
+	queueBrokerHandler := cloud.NewQueueBrokerHandler(queueBroker)
 
 	mux := http.NewServeMux()
-	mux.Handle("/v1/useralbums", userAlbumsHandler)
-	mux.Handle("/v1/albummanifestupload", albumManifestUploadHandler)
-	mux.Handle("/v1/album/", videoUploadHandler)
+	mux.Handle("/v1/useralbums", cloud.NewIdempotencyHandler(idempotencyService, userAlbumsHandler))
+	mux.Handle("/v1/albummanifestupload", cloud.NewIdempotencyHandler(idempotencyService, albumManifestUploadHandler))
+	mux.Handle("/v1/album/", cloud.NewIdempotencyHandler(idempotencyService, videoUploadHandler))
+	mux.Handle("/v1/album/{albumUID}/videoupload/sessions", uploadSessionHandler)
+	mux.Handle("/v1/album/{albumUID}/videoupload/sessions/", uploadSessionHandler)
+	mux.Handle("/v1/providers/{providerID}/databases/{databaseID}/albums/{albumUID}", albumStatusHandler)
+	mux.Handle("/v1/providers/{providerID}/databases/{databaseID}/albums/{albumUID}/revisions", manifestHistoryHandler)
+	mux.Handle("/v1/providers/{providerID}/databases/{databaseID}/albums/{albumUID}/revisions/{revision}", manifestHistoryHandler)
+	mux.Handle("/v1/providers/{providerID}/databases/{databaseID}/albums", listingHandler)
+	mux.Handle("/v1/providers/{providerID}/databases/{databaseID}/videos", listingHandler)
+	mux.Handle("/v1/providers/{providerID}/databases/{databaseID}/objects", listingHandler)
+	mux.Handle("/v1/deadletters", deadLetterHandler)
+	mux.Handle("/v1/deadletters/", deadLetterHandler)
+	mux.Handle("/v1/queue/", queueBrokerHandler)
 
 	return &App{
-		Handler:                      mux,
-		Queue:                        queue,
-		Clock:                        clock,
-		AlbumRepo:                    albumRepo,
-		AlbumVideoRepo:               albumVideoRepo,
-		VideoRepo:                    videoRepo,
-		ObjectRepo:                   objectRepo,
+		Handler:                          mux,
+		Queue:                            queue,
+		Clock:                            clock,
+		AlbumRepo:                        albumRepo,
+		AlbumVideoRepo:                   albumVideoRepo,
+		VideoRepo:                        videoRepo,
+		ObjectRepo:                       objectRepo,
+		BlobStore:                        blobStore,
+		UploadSessionRepo:                uploadSessionRepo,
+		ManifestRevisionRepo:             manifestRevisionRepo,
+		Transactor:                       transactor,
+		OutboxRepo:                       outboxRepo,
+		OutboxRelay:                      outboxRelay,
+		IdempotencyRepo:                  idempotencyRepo,
+		IdempotencyService:               idempotencyService,
+		ProcessedMessageRepo:             processedMessageRepo,
+		MessageDeduplicator:              messageDeduplicator,
+		UploadSessionService:             uploadSessionService,
+		AlbumStatusService:               albumStatusService,
+		ListingService:                   listingService,
+		ManifestHistoryService:           manifestHistoryService,
+		DeadLetterRepo:                   deadLetterRepo,
+		DeadLetterService:                deadLetterService,
+		QueueBroker:                      queueBroker,
 		EventualConsistencyWorker:        eventualConsistencyWorker,
 		EventualConsistencyCheckConsumer: eventualConsistencyCheckConsumer,
+		ObjectGarbageCollector:           objectGarbageCollector,
 	}
 }
 
 func (a *App) SubscribeEventualConsistencyCheck(ctx context.Context) error {
-	return a.Queue.Subscribe(ctx, "cloud:syncconsistencycheck", "syncconsistencycheck", "", a.EventualConsistencyCheckConsumer.Handle)
+	subscriptionID := "cloud:syncconsistencycheck"
+	return a.Queue.Subscribe(ctx, subscriptionID, "syncconsistencycheck", "", a.MessageDeduplicator.HandlerInTx(subscriptionID, a.EventualConsistencyCheckConsumer.Handle))
 }
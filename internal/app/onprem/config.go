@@ -2,7 +2,11 @@ package onprem
 
 import (
 	"os"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/media-vault-sync/internal/core/services"
 )
 
 type Config struct {
@@ -10,20 +14,58 @@ type Config struct {
 	MediaVaultConfigPath string
 	StagingDir           string
 	CloudBaseURL         string
+	UploadChunkSize      int
+	UploadChunkRetries   int
 	ProviderID           string
 	QueueTickInterval    time.Duration
 	ReceiverURL          string
+	QueueBackend         string
+	MySQLDSN             string
+	MySQLMaxOpenConns    int
+	MySQLMaxIdleConns    int
+	MySQLConnMaxLifetime time.Duration
+	// QueueDedupWindow of zero turns queue deduplication off
+	QueueDedupWindow          time.Duration
+	ProcessedMessageRetention time.Duration
+	// QueueRetryPolicy applies to topics missing from QueueTopicRetryPolicies;
+	// a zero policy means services.DefaultRetryPolicy
+	QueueRetryPolicy        services.RetryPolicy
+	QueueTopicRetryPolicies map[string]services.RetryPolicy
+	// QueueConcurrency is the number of workers of topics missing from
+	// QueueTopicConcurrency; zero means one
+	QueueConcurrency      int
+	QueueTopicConcurrency map[string]int
+	// QueueBrokerURL is the cloud API serving the queue when QueueBackend is
+	// remote, CloudBaseURL when empty; QueuePollWait of zero means
+	// remote.PollWait
+	QueueBrokerURL string
+	QueuePollWait  time.Duration
 }
 
 func LoadConfig() Config {
 	cfg := Config{
-		Port:                 getEnv("ONPREM_PORT", "8081"),
-		MediaVaultConfigPath: getEnv("MEDIAVAULT_CONFIG_PATH", "mediavault_config.json"),
-		StagingDir:           getEnv("STAGING_DIR", "/tmp/staging"),
-		CloudBaseURL:         getEnv("CLOUD_BASE_URL", "http://localhost:8080"),
-		ProviderID:           getEnv("PROVIDER_ID", ""),
-		QueueTickInterval:    getDurationEnv("QUEUE_TICK_INTERVAL", 100*time.Millisecond),
-		ReceiverURL:          getEnv("RECEIVER_URL", ""),
+		Port:                      getEnv("ONPREM_PORT", "8081"),
+		MediaVaultConfigPath:      getEnv("MEDIAVAULT_CONFIG_PATH", "mediavault_config.json"),
+		StagingDir:                getEnv("STAGING_DIR", "/tmp/staging"),
+		CloudBaseURL:              getEnv("CLOUD_BASE_URL", "http://localhost:8080"),
+		UploadChunkSize:           getIntEnv("UPLOAD_CHUNK_SIZE", 1024*1024),
+		UploadChunkRetries:        getIntEnv("UPLOAD_CHUNK_RETRIES", 3),
+		ProviderID:                getEnv("PROVIDER_ID", ""),
+		QueueTickInterval:         getDurationEnv("QUEUE_TICK_INTERVAL", 100*time.Millisecond),
+		ReceiverURL:               getEnv("RECEIVER_URL", ""),
+		QueueBackend:              getEnv("QUEUE_BACKEND", "memory"),
+		MySQLDSN:                  getEnv("MYSQL_DSN", ""),
+		MySQLMaxOpenConns:         getIntEnv("MYSQL_MAX_OPEN_CONNS", 10),
+		MySQLMaxIdleConns:         getIntEnv("MYSQL_MAX_IDLE_CONNS", 10),
+		MySQLConnMaxLifetime:      getDurationEnv("MYSQL_CONN_MAX_LIFETIME", 5*time.Minute),
+		QueueDedupWindow:          getDurationEnv("QUEUE_DEDUP_WINDOW", 10*time.Minute),
+		ProcessedMessageRetention: getDurationEnv("PROCESSED_MESSAGE_RETENTION", 7*24*time.Hour),
+		QueueRetryPolicy:          getRetryPolicyEnv("QUEUE_RETRY_POLICY", services.DefaultRetryPolicy),
+		QueueTopicRetryPolicies:   getTopicRetryPoliciesEnv("QUEUE_TOPIC_RETRY_POLICIES"),
+		QueueConcurrency:          getIntEnv("QUEUE_CONCURRENCY", 1),
+		QueueTopicConcurrency:     getTopicConcurrencyEnv("QUEUE_TOPIC_CONCURRENCY"),
+		QueueBrokerURL:            getEnv("QUEUE_BROKER_URL", ""),
+		QueuePollWait:             getDurationEnv("QUEUE_POLL_WAIT", 30*time.Second),
 	}
 	return cfg
 }
@@ -35,6 +77,17 @@ func getEnv(key, defaultVal string) string {
 	return defaultVal
 }
 
+func getIntEnv(key string, defaultVal int) int {
+	val := os.Getenv(key)
+	if val == "" {
+		return defaultVal
+	}
+	if n, err := strconv.Atoi(val); err == nil {
+		return n
+	}
+	return defaultVal
+}
+
 func getDurationEnv(key string, defaultVal time.Duration) time.Duration {
 	val := os.Getenv(key)
 	if val == "" {
@@ -45,3 +98,46 @@ func getDurationEnv(key string, defaultVal time.Duration) time.Duration {
 	}
 	return defaultVal
 }
+
+func getRetryPolicyEnv(key string, defaultVal services.RetryPolicy) services.RetryPolicy {
+	val := os.Getenv(key)
+	if val == "" {
+		return defaultVal
+	}
+	if policy, err := services.ParseRetryPolicy(val); err == nil {
+		return policy
+	}
+	return defaultVal
+}
+
+// getTopicRetryPoliciesEnv parses "topic=policy" pairs separated by commas,
+// skipping malformed ones.
+func getTopicRetryPoliciesEnv(key string) map[string]services.RetryPolicy {
+	policies := make(map[string]services.RetryPolicy)
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		topic, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+		if policy, err := services.ParseRetryPolicy(val); err == nil {
+			policies[topic] = policy
+		}
+	}
+	return policies
+}
+
+// getTopicConcurrencyEnv parses "topic=workers" pairs separated by commas,
+// skipping malformed ones.
+func getTopicConcurrencyEnv(key string) map[string]int {
+	concurrency := make(map[string]int)
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		topic, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+		if n, err := strconv.Atoi(val); err == nil && n > 0 {
+			concurrency[topic] = n
+		}
+	}
+	return concurrency
+}
@@ -0,0 +1,42 @@
+package onprem
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/media-vault-sync/internal/adapters/repo/mysql"
+	"github.com/media-vault-sync/migrations"
+)
+
+// OpenDatabase returns a migrated MySQL pool when the queue uses the mysql
+// backend, and nil when it runs in memory or at the cloud's queue broker.
+func OpenDatabase(ctx context.Context, cfg Config) (*sql.DB, error) {
+	switch cfg.QueueBackend {
+	case "", "memory", "remote":
+		return nil, nil
+	case "mysql":
+	default:
+		return nil, fmt.Errorf("unknown queue backend %q", cfg.QueueBackend)
+	}
+
+	if cfg.MySQLDSN == "" {
+		return nil, fmt.Errorf("MYSQL_DSN is required for the mysql backend")
+	}
+
+	db, err := mysql.Open(ctx, cfg.MySQLDSN, mysql.PoolConfig{
+		MaxOpenConns:    cfg.MySQLMaxOpenConns,
+		MaxIdleConns:    cfg.MySQLMaxIdleConns,
+		ConnMaxLifetime: cfg.MySQLConnMaxLifetime,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := mysql.Migrate(ctx, db, migrations.Files); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrating schema: %w", err)
+	}
+
+	return db, nil
+}
@@ -2,11 +2,18 @@ package onprem
 
 import (
 	"context"
+	"database/sql"
 	"net/http"
+	"time"
 
+	"github.com/media-vault-sync/internal/adapters/http/admin"
 	"github.com/media-vault-sync/internal/adapters/http/onprem"
 	"github.com/media-vault-sync/internal/adapters/mediavault"
 	"github.com/media-vault-sync/internal/adapters/queue/memory"
+	mysqlqueue "github.com/media-vault-sync/internal/adapters/queue/mysql"
+	"github.com/media-vault-sync/internal/adapters/queue/remote"
+	memoryrepo "github.com/media-vault-sync/internal/adapters/repo/memory"
+	mysqlrepo "github.com/media-vault-sync/internal/adapters/repo/mysql"
 	"github.com/media-vault-sync/internal/adapters/storage/fs"
 	"github.com/media-vault-sync/internal/core/services"
 )
@@ -15,6 +22,9 @@ type TickableQueue interface {
 	services.Queue
 	Tick(ctx context.Context) (delivered int, requeued int)
 	Process(ctx context.Context) int
+	// Run hands messages to the topics' workers until ctx is cancelled and
+	// returns once the handlers in flight are done.
+	Run(ctx context.Context, interval time.Duration)
 	PendingCount() int
 }
 
@@ -25,21 +35,27 @@ type App struct {
 	MediaVaultRegistry          services.MediaVaultRegistry
 	CloudClient                 services.CloudClient
 	StagingStorage              services.StagingStorage
+	DeadLetterRepo              services.DeadLetterRepository
+	DeadLetterService           *services.DeadLetterService
 	SyncUserConsumer            *services.SyncUserConsumer
 	AlbumManifestUploadConsumer *services.AlbumManifestUploadConsumer
 	VideoUploadConsumer         *services.VideoUploadConsumer
+	ProcessedMessageRepo        services.ProcessedMessageRepository
+	MessageDeduplicator         *services.MessageDeduplicator
 	ProviderID                  string
 }
 
 type WireOptions struct {
-	Clock              services.Clock
-	Queue              TickableQueue
-	MediaVaultRegistry services.MediaVaultRegistry
-	CloudClient        services.CloudClient
-	StagingStorage     services.StagingStorage
-	VideoSender        mediavault.VideoSender
-	ReceiverURL        string
-	MaxRetries         int
+	DB                   *sql.DB
+	Clock                services.Clock
+	Queue                TickableQueue
+	MediaVaultRegistry   services.MediaVaultRegistry
+	CloudClient          services.CloudClient
+	StagingStorage       services.StagingStorage
+	DeadLetterRepo       services.DeadLetterRepository
+	ProcessedMessageRepo services.ProcessedMessageRepository
+	VideoSender          mediavault.VideoSender
+	ReceiverURL          string
 }
 
 func Wire(cfg Config, opts *WireOptions) *App {
@@ -49,6 +65,9 @@ func Wire(cfg Config, opts *WireOptions) *App {
 	var cloudClient services.CloudClient
 	var stagingStorage services.StagingStorage
 	var videoSender mediavault.VideoSender
+	var deadLetterRepo services.DeadLetterRepository
+	var processedMessageRepo services.ProcessedMessageRepository
+	var transactor services.Transactor
 
 	if opts != nil && opts.Clock != nil {
 		clock = opts.Clock
@@ -56,10 +75,63 @@ func Wire(cfg Config, opts *WireOptions) *App {
 		clock = services.RealClock{}
 	}
 
+	if opts != nil && opts.DeadLetterRepo != nil {
+		deadLetterRepo = opts.DeadLetterRepo
+	} else if opts != nil && opts.DB != nil {
+		deadLetterRepo = mysqlrepo.NewDeadLetterRepository(opts.DB)
+	} else {
+		deadLetterRepo = memoryrepo.NewDeadLetterRepository()
+	}
+
+	retryPolicy := cfg.QueueRetryPolicy
+	if retryPolicy.MaxAttempts == 0 {
+		retryPolicy = services.DefaultRetryPolicy
+	}
 	if opts != nil && opts.Queue != nil {
 		queue = opts.Queue
+	} else if opts != nil && opts.DB != nil && cfg.QueueBackend == "mysql" {
+		queue = mysqlqueue.NewQueue(opts.DB, clock,
+			mysqlqueue.WithDeadLetterRepository(deadLetterRepo),
+			mysqlqueue.WithDedupWindow(cfg.QueueDedupWindow),
+			mysqlqueue.WithRetryPolicy(retryPolicy),
+			mysqlqueue.WithTopicRetryPolicies(cfg.QueueTopicRetryPolicies),
+			mysqlqueue.WithConcurrency(cfg.QueueConcurrency),
+			mysqlqueue.WithTopicConcurrency(cfg.QueueTopicConcurrency))
+	} else if cfg.QueueBackend == "remote" {
+		brokerURL := cfg.QueueBrokerURL
+		if brokerURL == "" {
+			brokerURL = cfg.CloudBaseURL
+		}
+		pollWait := cfg.QueuePollWait
+		if pollWait == 0 {
+			pollWait = remote.PollWait
+		}
+		queue = remote.NewQueue(brokerURL, nil,
+			remote.WithPollWait(pollWait),
+			remote.WithConcurrency(cfg.QueueConcurrency),
+			remote.WithTopicConcurrency(cfg.QueueTopicConcurrency))
 	} else {
-		queue = memory.NewInMemoryQueue(clock)
+		queue = memory.NewInMemoryQueue(clock,
+			memory.WithDeadLetterRepository(deadLetterRepo),
+			memory.WithDedupWindow(cfg.QueueDedupWindow),
+			memory.WithRetryPolicy(retryPolicy),
+			memory.WithTopicRetryPolicies(cfg.QueueTopicRetryPolicies),
+			memory.WithConcurrency(cfg.QueueConcurrency),
+			memory.WithTopicConcurrency(cfg.QueueTopicConcurrency))
+	}
+
+	if opts != nil && opts.ProcessedMessageRepo != nil {
+		processedMessageRepo = opts.ProcessedMessageRepo
+	} else if opts != nil && opts.DB != nil {
+		processedMessageRepo = mysqlrepo.NewProcessedMessageRepository(opts.DB)
+	} else {
+		processedMessageRepo = memoryrepo.NewProcessedMessageRepository()
+	}
+
+	if opts != nil && opts.DB != nil {
+		transactor = mysqlrepo.NewTransactor(opts.DB)
+	} else {
+		transactor = memoryrepo.NewTransactor()
 	}
 
 	if opts != nil && opts.StagingStorage != nil {
@@ -71,7 +143,8 @@ func Wire(cfg Config, opts *WireOptions) *App {
 	if opts != nil && opts.CloudClient != nil {
 		cloudClient = opts.CloudClient
 	} else {
-		cloudClient = onprem.NewHTTPCloudClient(cfg.CloudBaseURL, nil)
+		cloudClient = onprem.NewHTTPCloudClient(cfg.CloudBaseURL, nil,
+			onprem.WithChunkedUpload(int64(cfg.UploadChunkSize), cfg.UploadChunkRetries))
 	}
 
 	receiverURL := cfg.ReceiverURL
@@ -94,19 +167,21 @@ func Wire(cfg Config, opts *WireOptions) *App {
 		mediaVaultRegistry = mediavault.NewFileSystemMediaVaultRegistry(cfg.MediaVaultConfigPath, videoSender)
 	}
 
-	maxRetries := 0
-	if opts != nil && opts.MaxRetries > 0 {
-		maxRetries = opts.MaxRetries
-	}
-
-	syncUserConsumer := services.NewSyncUserConsumer(cfg.ProviderID, mediaVaultRegistry, cloudClient, maxRetries)
-	albumManifestUploadConsumer := services.NewAlbumManifestUploadConsumer(cfg.ProviderID, mediaVaultRegistry, cloudClient, maxRetries)
+	syncUserConsumer := services.NewSyncUserConsumer(cfg.ProviderID, mediaVaultRegistry, cloudClient)
+	albumManifestUploadConsumer := services.NewAlbumManifestUploadConsumer(cfg.ProviderID, mediaVaultRegistry, cloudClient)
 	videoUploadConsumer := services.NewVideoUploadConsumer(mediaVaultRegistry)
 
-	videoReceiver := onprem.NewVideoReceiver(stagingStorage, cloudClient, mediaVaultRegistry, maxRetries)
+	messageDeduplicator := services.NewMessageDeduplicator(processedMessageRepo, transactor, clock, cfg.ProcessedMessageRetention)
+
+	videoReceiver := onprem.NewVideoReceiver(stagingStorage, cloudClient, mediaVaultRegistry)
+
+	deadLetterService := services.NewDeadLetterService(deadLetterRepo, queue)
+	deadLetterHandler := admin.NewDeadLetterHandler(deadLetterService)
 
 	mux := http.NewServeMux()
 	mux.Handle("/receive-video", videoReceiver)
+	mux.Handle("/v1/deadletters", deadLetterHandler)
+	mux.Handle("/v1/deadletters/", deadLetterHandler)
 
 	return &App{
 		Handler:                     mux,
@@ -115,24 +190,35 @@ func Wire(cfg Config, opts *WireOptions) *App {
 		MediaVaultRegistry:          mediaVaultRegistry,
 		CloudClient:                 cloudClient,
 		StagingStorage:              stagingStorage,
+		DeadLetterRepo:              deadLetterRepo,
+		DeadLetterService:           deadLetterService,
 		SyncUserConsumer:            syncUserConsumer,
 		AlbumManifestUploadConsumer: albumManifestUploadConsumer,
 		VideoUploadConsumer:         videoUploadConsumer,
+		ProcessedMessageRepo:        processedMessageRepo,
+		MessageDeduplicator:         messageDeduplicator,
 		ProviderID:                  cfg.ProviderID,
 	}
 }
 
+// SubscribeAll subscribes the consumers through the MessageDeduplicator, so
+// a redelivered message they already handled is not handled again.
 func (a *App) SubscribeAll(ctx context.Context) error {
 	providerID := a.ProviderID
 
-	if err := a.Queue.Subscribe(ctx, "onprem:"+providerID+":usersync", "usersync", providerID, a.SyncUserConsumer.Handle); err != nil {
-		return err
-	}
-	if err := a.Queue.Subscribe(ctx, "onprem:"+providerID+":albummanifestupload", "albummanifestupload", providerID, a.AlbumManifestUploadConsumer.Handle); err != nil {
-		return err
+	consumers := []struct {
+		topic   string
+		handler services.MessageHandler
+	}{
+		{"usersync", a.SyncUserConsumer.Handle},
+		{"albummanifestupload", a.AlbumManifestUploadConsumer.Handle},
+		{"videoupload", a.VideoUploadConsumer.Handle},
 	}
-	if err := a.Queue.Subscribe(ctx, "onprem:"+providerID+":videoupload", "videoupload", providerID, a.VideoUploadConsumer.Handle); err != nil {
-		return err
+	for _, consumer := range consumers {
+		subscriptionID := "onprem:" + providerID + ":" + consumer.topic
+		if err := a.Queue.Subscribe(ctx, subscriptionID, consumer.topic, providerID, a.MessageDeduplicator.Handler(subscriptionID, consumer.handler)); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -2,6 +2,8 @@ package domain
 
 import "time"
 
+// Album is the cloud's record of an on-prem album. Version is incremented by
+// every update so concurrent writers can detect each other.
 type Album struct {
 	UID        string
 	ProviderID string
@@ -9,6 +11,7 @@ type Album struct {
 	UserID     string
 	AlbumUID   string
 	Synced     bool
+	Version    int
 	CreatedAt  time.Time
 	UpdatedAt  time.Time
 }
@@ -0,0 +1,16 @@
+package domain
+
+import "time"
+
+// IdempotencyRecord remembers a write request by the Idempotency-Key it was
+// sent with. StatusCode stays 0 while the request is still running.
+type IdempotencyRecord struct {
+	Key        string
+	StatusCode int
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+}
+
+func (r *IdempotencyRecord) Completed() bool {
+	return r.StatusCode != 0
+}
@@ -0,0 +1,19 @@
+package domain
+
+import "time"
+
+// ManifestRevision records how one accepted manifest upload changed an
+// album's video set. Revisions are numbered from 1 per album; replaying them
+// in order rebuilds the manifest at any revision.
+type ManifestRevision struct {
+	UID        string
+	ProviderID string
+	DatabaseID string
+	AlbumUID   string
+	Revision   int
+	// Source says what triggered the upload, e.g. usersync or repair.
+	Source    string
+	Added     []string
+	Removed   []string
+	CreatedAt time.Time
+}
@@ -2,13 +2,21 @@ package domain
 
 import "time"
 
+// Object is one stored version of a video's content. The current version has
+// a nil SupersededAt; PurgedAt is set once a superseded version's blob has
+// been garbage-collected, the row itself is kept as history. UnreferencedAt
+// is set while no album lists the video, which schedules it for purging too.
 type Object struct {
-	UID        string
-	ProviderID string
-	DatabaseID string
-	VideoUID   string
-	StorageKey string
-	SizeBytes  int64
-	Checksum   string
-	CreatedAt  time.Time
+	UID            string
+	ProviderID     string
+	DatabaseID     string
+	VideoUID       string
+	Version        int
+	StorageKey     string
+	SizeBytes      int64
+	Checksum       string
+	CreatedAt      time.Time
+	SupersededAt   *time.Time
+	PurgedAt       *time.Time
+	UnreferencedAt *time.Time
 }
@@ -0,0 +1,18 @@
+package domain
+
+import "time"
+
+// UploadSession tracks a resumable chunked video upload. Offset is the number
+// of bytes acknowledged so far.
+type UploadSession struct {
+	ID         string
+	ProviderID string
+	DatabaseID string
+	UserID     string
+	AlbumUID   string
+	VideoUID   string
+	SizeBytes  int64
+	Offset     int64
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
@@ -4,57 +4,131 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"sort"
+	"time"
 
 	"github.com/media-vault-sync/internal/core/domain"
 )
 
 var ErrUserIDMismatch = errors.New("user ID mismatch for existing album")
 
+// Sources of a manifest upload, recorded on its revision. Uploads that do not
+// name one are recorded as ManifestSourceUpload.
+const (
+	ManifestSourceUpload   = "upload"
+	ManifestSourceUserSync = "usersync"
+	ManifestSourceRepair   = "repair"
+)
+
 type AlbumManifestUploadRequest struct {
 	ProviderID string   `json:"providerID"`
 	DatabaseID string   `json:"databaseID"`
 	UserID     string   `json:"userID"`
 	AlbumUID   string   `json:"albumUID"`
 	VideoUIDs  []string `json:"videoUIDs"`
+	Source     string   `json:"source,omitempty"`
 }
 
+// VideoUploadPayload asks on-prem to send the videos of an album; only the
+// listed ones when VideoUIDs is set.
 type VideoUploadPayload struct {
-	DatabaseID string `json:"databaseID"`
-	AlbumUID   string `json:"albumUID"`
+	DatabaseID string   `json:"databaseID"`
+	AlbumUID   string   `json:"albumUID"`
+	VideoUIDs  []string `json:"videoUIDs,omitempty"`
+}
+
+// ManifestDiff lists the videos a manifest upload adds and removes, in
+// manifest order.
+type ManifestDiff struct {
+	Added   []string
+	Removed []string
+}
+
+func (d ManifestDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0
+}
+
+func diffManifest(current []domain.AlbumVideo, newUIDs []string) ManifestDiff {
+	var diff ManifestDiff
+
+	known := make(map[string]bool, len(current))
+	for _, vid := range current {
+		known[vid.VideoUID] = true
+	}
+	listed := make(map[string]bool, len(newUIDs))
+	for _, videoUID := range newUIDs {
+		if !listed[videoUID] && !known[videoUID] {
+			diff.Added = append(diff.Added, videoUID)
+		}
+		listed[videoUID] = true
+	}
+	for _, vid := range current {
+		if !listed[vid.VideoUID] {
+			diff.Removed = append(diff.Removed, vid.VideoUID)
+		}
+	}
+	return diff
 }
 
 type AlbumManifestUploadService struct {
-	albumRepo      AlbumRepository
-	albumVideoRepo AlbumVideoRepository
-	queue          Queue
-	clock          Clock
+	albumRepo            AlbumRepository
+	albumVideoRepo       AlbumVideoRepository
+	manifestRevisionRepo ManifestRevisionRepository
+	objectRepo           ObjectRepository
+	transactor           Transactor
+	queue                Queue
+	clock                Clock
 }
 
 func NewAlbumManifestUploadService(
 	albumRepo AlbumRepository,
 	albumVideoRepo AlbumVideoRepository,
+	manifestRevisionRepo ManifestRevisionRepository,
+	objectRepo ObjectRepository,
+	transactor Transactor,
 	queue Queue,
 	clock Clock,
 ) *AlbumManifestUploadService {
 	return &AlbumManifestUploadService{
-		albumRepo:      albumRepo,
-		albumVideoRepo: albumVideoRepo,
-		queue:          queue,
-		clock:          clock,
+		albumRepo:            albumRepo,
+		albumVideoRepo:       albumVideoRepo,
+		manifestRevisionRepo: manifestRevisionRepo,
+		objectRepo:           objectRepo,
+		transactor:           transactor,
+		queue:                queue,
+		clock:                clock,
 	}
 }
 
+// ProcessAlbumManifestUpload stores the manifest and marks the album synced.
+// The album, manifest, revision and emitted videoupload are written in one
+// unit of work, which is re-run when it loses a race on the album. An album that a video upload
+// flags out of sync meanwhile stays out of sync: the manifest may have been
+// read before the video that flagged it, and the repair loop fetches a fresh one.
 func (s *AlbumManifestUploadService) ProcessAlbumManifestUpload(ctx context.Context, req AlbumManifestUploadRequest) error {
 	existing, err := s.albumRepo.FindByAlbumUID(ctx, req.ProviderID, req.DatabaseID, req.AlbumUID)
 	if err != nil {
 		return err
 	}
+	startedSynced := existing == nil || existing.Synced
+
+	return retryOnAlbumConflict(func() error {
+		return s.transactor.WithinTx(ctx, func(ctx context.Context) error {
+			return s.processAlbumManifestUpload(ctx, req, startedSynced)
+		})
+	})
+}
+
+func (s *AlbumManifestUploadService) processAlbumManifestUpload(ctx context.Context, req AlbumManifestUploadRequest, startedSynced bool) error {
+	existing, err := s.albumRepo.FindByAlbumUID(ctx, req.ProviderID, req.DatabaseID, req.AlbumUID)
+	if err != nil {
+		return err
+	}
 
 	now := s.clock.Now()
 
 	if existing == nil {
 		album := &domain.Album{
+			UID:        NewID(),
 			ProviderID: req.ProviderID,
 			DatabaseID: req.DatabaseID,
 			UserID:     req.UserID,
@@ -71,7 +145,12 @@ func (s *AlbumManifestUploadService) ProcessAlbumManifestUpload(ctx context.Cont
 			return err
 		}
 
-		return s.emitVideoUpload(ctx, req)
+		if err := s.applyDiff(ctx, req, diffManifest(nil, req.VideoUIDs), now); err != nil {
+			return err
+		}
+
+		// everything is new: move the whole album
+		return s.emitVideoUpload(ctx, req, nil)
 	}
 
 	if existing.UserID != req.UserID {
@@ -83,22 +162,74 @@ func (s *AlbumManifestUploadService) ProcessAlbumManifestUpload(ctx context.Cont
 		return err
 	}
 
-	existing.Synced = true // manifest sync status
+	existing.Synced = existing.Synced || !startedSynced // manifest sync status
 	existing.UpdatedAt = now
 
-	if s.manifestsEqual(currentVideos, req.VideoUIDs) {
-		return s.albumRepo.Update(ctx, existing)
+	// the album is updated first, so a concurrent upload that read the same
+	// manifest conflicts before either stores its diff
+	if err := s.albumRepo.Update(ctx, existing); err != nil {
+		return err
+	}
+
+	diff := diffManifest(currentVideos, req.VideoUIDs)
+	if diff.Empty() {
+		return nil
 	}
 
 	if err := s.storeManifest(ctx, req); err != nil {
 		return err
 	}
 
-	if err := s.albumRepo.Update(ctx, existing); err != nil {
+	if err := s.applyDiff(ctx, req, diff, now); err != nil {
+		return err
+	}
+
+	// videos already in the manifest have been sent before; the ones that
+	// never arrived are re-driven by the consistency worker
+	if len(diff.Added) == 0 {
+		return nil
+	}
+	return s.emitVideoUpload(ctx, req, diff.Added)
+}
+
+// applyDiff records the diff as a manifest revision. Removed videos that no
+// other album lists are scheduled for purging, and added videos cancel any
+// purge scheduled for them.
+func (s *AlbumManifestUploadService) applyDiff(ctx context.Context, req AlbumManifestUploadRequest, diff ManifestDiff, now time.Time) error {
+	source := req.Source
+	if source == "" {
+		source = ManifestSourceUpload
+	}
+
+	err := s.manifestRevisionRepo.Add(ctx, &domain.ManifestRevision{
+		UID:        NewID(),
+		ProviderID: req.ProviderID,
+		DatabaseID: req.DatabaseID,
+		AlbumUID:   req.AlbumUID,
+		Source:     source,
+		Added:      diff.Added,
+		Removed:    diff.Removed,
+		CreatedAt:  now,
+	})
+	if err != nil {
+		return err
+	}
+
+	var unreferenced []string
+	for _, videoUID := range diff.Removed {
+		albums, err := s.albumVideoRepo.CountByVideoUID(ctx, req.ProviderID, req.DatabaseID, videoUID)
+		if err != nil {
+			return err
+		}
+		if albums == 0 {
+			unreferenced = append(unreferenced, videoUID)
+		}
+	}
+	if err := s.objectRepo.MarkUnreferenced(ctx, req.ProviderID, req.DatabaseID, unreferenced, now); err != nil {
 		return err
 	}
 
-	return s.emitVideoUpload(ctx, req)
+	return s.objectRepo.ClearUnreferenced(ctx, req.ProviderID, req.DatabaseID, diff.Added)
 }
 
 func (s *AlbumManifestUploadService) storeManifest(ctx context.Context, req AlbumManifestUploadRequest) error {
@@ -114,33 +245,11 @@ func (s *AlbumManifestUploadService) storeManifest(ctx context.Context, req Albu
 	return s.albumVideoRepo.ReplaceForAlbum(ctx, req.ProviderID, req.DatabaseID, req.AlbumUID, videos)
 }
 
-func (s *AlbumManifestUploadService) manifestsEqual(current []domain.AlbumVideo, newUIDs []string) bool {
-	if len(current) != len(newUIDs) {
-		return false
-	}
-
-	currentUIDs := make([]string, len(current))
-	for i, vid := range current {
-		currentUIDs[i] = vid.VideoUID
-	}
-	sort.Strings(currentUIDs)
-
-	sortedNew := make([]string, len(newUIDs))
-	copy(sortedNew, newUIDs)
-	sort.Strings(sortedNew)
-
-	for i := range currentUIDs {
-		if currentUIDs[i] != sortedNew[i] {
-			return false
-		}
-	}
-	return true
-}
-
-func (s *AlbumManifestUploadService) emitVideoUpload(ctx context.Context, req AlbumManifestUploadRequest) error {
+func (s *AlbumManifestUploadService) emitVideoUpload(ctx context.Context, req AlbumManifestUploadRequest, videoUIDs []string) error {
 	payload, err := json.Marshal(VideoUploadPayload{
 		DatabaseID: req.DatabaseID,
 		AlbumUID:   req.AlbumUID,
+		VideoUIDs:  videoUIDs,
 	})
 	if err != nil {
 		return err
@@ -150,7 +259,8 @@ func (s *AlbumManifestUploadService) emitVideoUpload(ctx context.Context, req Al
 		Topic:   "videoupload",
 		Payload: payload,
 		Metadata: map[string]string{
-			"providerID": req.ProviderID,
+			"providerID":        req.ProviderID,
+			MetadataOrderingKey: AlbumOrderingKey(req.ProviderID, req.DatabaseID, req.AlbumUID),
 		},
 	})
 }
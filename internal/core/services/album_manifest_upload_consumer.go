@@ -4,25 +4,19 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"time"
 )
 
 type AlbumManifestUploadConsumer struct {
 	providerID         string
 	mediaVaultRegistry MediaVaultRegistry
 	cloudClient        CloudClient
-	maxRetries         int
 }
 
-func NewAlbumManifestUploadConsumer(providerID string, mediaVaultRegistry MediaVaultRegistry, cloudClient CloudClient, maxRetries int) *AlbumManifestUploadConsumer {
-	if maxRetries <= 0 {
-		maxRetries = 3
-	}
+func NewAlbumManifestUploadConsumer(providerID string, mediaVaultRegistry MediaVaultRegistry, cloudClient CloudClient) *AlbumManifestUploadConsumer {
 	return &AlbumManifestUploadConsumer{
 		providerID:         providerID,
 		mediaVaultRegistry: mediaVaultRegistry,
 		cloudClient:        cloudClient,
-		maxRetries:         maxRetries,
 	}
 }
 
@@ -47,21 +41,16 @@ func (c *AlbumManifestUploadConsumer) Handle(ctx context.Context, msg Message) e
 		return fmt.Errorf("getting user ID: %w", err)
 	}
 
-	for attempt := 0; attempt < c.maxRetries; attempt++ {
-		err = c.cloudClient.PostAlbumManifestUpload(ctx, AlbumManifestUploadRequest{
-			ProviderID: c.providerID,
-			DatabaseID: payload.DatabaseID,
-			UserID:     userID,
-			AlbumUID:   payload.AlbumUID,
-			VideoUIDs:  videoUIDs,
-		})
-		if err == nil {
-			break
-		}
-		if attempt == c.maxRetries-1 {
-			return fmt.Errorf("posting album manifest upload after %d attempts: %w", c.maxRetries, err)
-		}
-		time.Sleep(time.Duration(8<<attempt) * time.Second)
+	err = c.cloudClient.PostAlbumManifestUpload(ctx, AlbumManifestUploadRequest{
+		ProviderID: c.providerID,
+		DatabaseID: payload.DatabaseID,
+		UserID:     userID,
+		AlbumUID:   payload.AlbumUID,
+		VideoUIDs:  videoUIDs,
+		Source:     payload.Source,
+	})
+	if err != nil {
+		return fmt.Errorf("posting album manifest upload: %w", err)
 	}
 
 	return nil
@@ -2,13 +2,88 @@ package services
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"time"
 
 	"github.com/media-vault-sync/internal/core/domain"
 )
 
+// AlbumFilter selects albums of one provider database, ordered by AlbumUID.
+// Zero values leave a criterion out; UpdatedSince is inclusive and
+// UpdatedBefore exclusive.
+type AlbumFilter struct {
+	ProviderID    string
+	DatabaseID    string
+	UserID        string
+	Synced        *bool
+	UpdatedSince  time.Time
+	UpdatedBefore time.Time
+	// keyset cursor: only albums sorting after this one
+	AfterAlbumUID string
+	Limit         int
+}
+
+var ErrAlbumConflict = errors.New("album was modified concurrently")
+
+// AlbumConflictError is returned when an album changed after it was read:
+// Update found a version other than Version stored, or Create found the album
+// already stored. It matches ErrAlbumConflict.
+type AlbumConflictError struct {
+	ProviderID string
+	DatabaseID string
+	AlbumUID   string
+	Version    int
+}
+
+func (e *AlbumConflictError) Error() string {
+	return fmt.Sprintf("album %s/%s/%s: version %d is stale", e.ProviderID, e.DatabaseID, e.AlbumUID, e.Version)
+}
+
+func (e *AlbumConflictError) Unwrap() error {
+	return ErrAlbumConflict
+}
+
+// NewAlbumConflictError reports that the album's version is stale.
+func NewAlbumConflictError(album *domain.Album) error {
+	return &AlbumConflictError{
+		ProviderID: album.ProviderID,
+		DatabaseID: album.DatabaseID,
+		AlbumUID:   album.AlbumUID,
+		Version:    album.Version,
+	}
+}
+
+// albumConflictAttempts bounds how often an operation is re-run after losing
+// a race on an album.
+const albumConflictAttempts = 5
+
+// retryOnAlbumConflict runs fn until it no longer fails with ErrAlbumConflict.
+// fn must re-read the album on every run.
+func retryOnAlbumConflict(fn func() error) error {
+	var err error
+	for attempt := 0; attempt < albumConflictAttempts; attempt++ {
+		if err = fn(); !errors.Is(err, ErrAlbumConflict) {
+			return err
+		}
+	}
+	return err
+}
+
 type AlbumRepository interface {
 	FindByAlbumUID(ctx context.Context, providerID, databaseID, albumUID string) (*domain.Album, error)
+	// Create stores a new album at version 1.
 	Create(ctx context.Context, album *domain.Album) error
+	// Update stores the album if the stored version still equals
+	// album.Version, and increments album.Version. Both return an
+	// *AlbumConflictError when they lose a race.
 	Update(ctx context.Context, album *domain.Album) error
 	FindNeedingRepair(ctx context.Context) ([]*domain.Album, error)
+	// FindRedriveCandidates returns synced albums neither updated nor
+	// re-driven since the cutoff.
+	FindRedriveCandidates(ctx context.Context, before time.Time) ([]*domain.Album, error)
+	// MarkRedriven records when the videos of an album were last re-driven,
+	// leaving its version and UpdatedAt as they are.
+	MarkRedriven(ctx context.Context, providerID, databaseID, albumUID string, redrivenAt time.Time) error
+	List(ctx context.Context, filter AlbumFilter) ([]*domain.Album, error)
 }
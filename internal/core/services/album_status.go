@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/media-vault-sync/internal/core/domain"
+)
+
+var ErrAlbumNotFound = errors.New("album not found")
+
+// AlbumStatus reports how far an album's manifest has been uploaded.
+type AlbumStatus struct {
+	Album         *domain.Album
+	ManifestSize  int
+	UploadedCount int
+	// manifest videos without a current object, in manifest order
+	MissingVideoUIDs []string
+	Videos           []AlbumVideoStatus
+}
+
+// AlbumVideoStatus pairs a manifest video with its current object, which is
+// nil until the video has been uploaded.
+type AlbumVideoStatus struct {
+	VideoUID string
+	Object   *domain.Object
+}
+
+type AlbumStatusService struct {
+	albumRepo      AlbumRepository
+	albumVideoRepo AlbumVideoRepository
+	objectRepo     ObjectRepository
+}
+
+func NewAlbumStatusService(albumRepo AlbumRepository, albumVideoRepo AlbumVideoRepository, objectRepo ObjectRepository) *AlbumStatusService {
+	return &AlbumStatusService{
+		albumRepo:      albumRepo,
+		albumVideoRepo: albumVideoRepo,
+		objectRepo:     objectRepo,
+	}
+}
+
+func (s *AlbumStatusService) GetStatus(ctx context.Context, providerID, databaseID, albumUID string) (*AlbumStatus, error) {
+	album, err := s.albumRepo.FindByAlbumUID(ctx, providerID, databaseID, albumUID)
+	if err != nil {
+		return nil, err
+	}
+	if album == nil {
+		return nil, ErrAlbumNotFound
+	}
+
+	manifest, err := s.albumVideoRepo.FindByAlbumUID(ctx, providerID, databaseID, albumUID)
+	if err != nil {
+		return nil, err
+	}
+
+	uploaded, err := s.objectRepo.CountByAlbumUID(ctx, providerID, databaseID, albumUID, s.albumVideoRepo)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &AlbumStatus{
+		Album:            album,
+		ManifestSize:     len(manifest),
+		UploadedCount:    uploaded,
+		MissingVideoUIDs: []string{},
+		Videos:           make([]AlbumVideoStatus, 0, len(manifest)),
+	}
+	for _, video := range manifest {
+		object, err := s.objectRepo.FindByVideoUID(ctx, providerID, databaseID, video.VideoUID)
+		if err != nil {
+			return nil, err
+		}
+		if object == nil {
+			status.MissingVideoUIDs = append(status.MissingVideoUIDs, video.VideoUID)
+		}
+		status.Videos = append(status.Videos, AlbumVideoStatus{VideoUID: video.VideoUID, Object: object})
+	}
+
+	return status, nil
+}
@@ -10,4 +10,6 @@ type AlbumVideoRepository interface {
 	FindByAlbumUID(ctx context.Context, providerID, databaseID, albumUID string) ([]domain.AlbumVideo, error)
 	ReplaceForAlbum(ctx context.Context, providerID, databaseID, albumUID string, videos []domain.AlbumVideo) error
 	Exists(ctx context.Context, providerID, databaseID, albumUID, videoUID string) (bool, error)
+	// CountByVideoUID counts the albums whose manifest lists the video.
+	CountByVideoUID(ctx context.Context, providerID, databaseID, videoUID string) (int, error)
 }
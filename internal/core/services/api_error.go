@@ -0,0 +1,73 @@
+package services
+
+import "errors"
+
+// Codes of APIErrors that no sentinel error stands for.
+const (
+	ErrorCodeInvalidRequest   = "invalid_request"
+	ErrorCodeNotFound         = "not_found"
+	ErrorCodeMethodNotAllowed = "method_not_allowed"
+	ErrorCodeInternal         = "internal"
+)
+
+// APIError is the JSON body the cloud API answers a failed request with.
+// Retryable tells the client whether sending the request again may succeed.
+type APIError struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Retryable bool   `json:"retryable"`
+}
+
+type apiErrorCode struct {
+	code      string
+	err       error
+	retryable bool
+}
+
+var apiErrorCodes = []apiErrorCode{
+	{"user_id_mismatch", ErrUserIDMismatch, false},
+	{"video_not_in_manifest", ErrVideoNotInManifest, false},
+	{"checksum_mismatch", ErrChecksumMismatch, true},
+	{"album_conflict", ErrAlbumConflict, true},
+	{"object_version_conflict", ErrObjectVersionConflict, true},
+	{"album_not_found", ErrAlbumNotFound, false},
+	{"revision_not_found", ErrRevisionNotFound, false},
+	{"invalid_cursor", ErrInvalidCursor, false},
+	{"idempotency_key_in_use", ErrIdempotencyKeyInUse, true},
+	{"upload_session_not_found", ErrUploadSessionNotFound, false},
+	{"upload_size_exceeded", ErrUploadSizeExceeded, false},
+	{"upload_incomplete", ErrUploadIncomplete, false},
+	{"delivery_not_found", ErrDeliveryNotFound, false},
+	{"queue_broker_elsewhere", ErrQueueBrokerElsewhere, true},
+}
+
+// NewAPIError describes err by the code of the sentinel it wraps. Other
+// errors get fallbackCode and are retryable only when they are internal.
+func NewAPIError(err error, fallbackCode string) *APIError {
+	for _, c := range apiErrorCodes {
+		if errors.Is(err, c.err) {
+			return &APIError{Code: c.code, Message: err.Error(), Retryable: c.retryable}
+		}
+	}
+	return &APIError{Code: fallbackCode, Message: err.Error(), Retryable: fallbackCode == ErrorCodeInternal}
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// Unwrap lets errors.Is match the sentinel of the code, and ErrNonRetryable
+// when the cloud said retrying will not help.
+func (e *APIError) Unwrap() []error {
+	var errs []error
+	for _, c := range apiErrorCodes {
+		if c.code == e.Code {
+			errs = append(errs, c.err)
+			break
+		}
+	}
+	if !e.Retryable {
+		errs = append(errs, ErrNonRetryable)
+	}
+	return errs
+}
@@ -0,0 +1,30 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+var ErrBlobNotFound = errors.New("blob not found")
+
+type BlobInfo struct {
+	Key        string
+	SizeBytes  int64
+	ModifiedAt time.Time
+}
+
+// BlobStore holds the uploaded video bytes. Put replaces the blob atomically:
+// readers see either the previous content or the new one, never a partial
+// write. Move renames a blob, replacing any blob at the destination. Get, Head
+// and Move return ErrBlobNotFound for a missing key; Delete of a missing key
+// is not an error.
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader) (int64, error)
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Head(ctx context.Context, key string) (*BlobInfo, error)
+	Delete(ctx context.Context, key string) error
+	Move(ctx context.Context, srcKey, dstKey string) error
+	List(ctx context.Context, prefix string) ([]BlobInfo, error)
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+type DeadLetter struct {
+	ID         string
+	Message    Message
+	Topic      string
+	ProviderID string
+	Attempts   int
+	LastError  string
+	CreatedAt  time.Time
+}
+
+type DeadLetterFilter struct {
+	Topic         string
+	ProviderID    string
+	CreatedBefore time.Time
+	Limit         int
+}
+
+type DeadLetterRepository interface {
+	Add(ctx context.Context, deadLetter *DeadLetter) error
+	FindByID(ctx context.Context, id string) (*DeadLetter, error)
+	List(ctx context.Context, filter DeadLetterFilter) ([]*DeadLetter, error)
+	Delete(ctx context.Context, id string) error
+	Purge(ctx context.Context, filter DeadLetterFilter) (int, error)
+}
+
+func NewDeadLetter(msg Message, attempts int, lastErr error, now time.Time) *DeadLetter {
+	dl := &DeadLetter{
+		ID:         NewID(),
+		Message:    msg,
+		Topic:      msg.Topic,
+		ProviderID: msg.Metadata["providerID"],
+		Attempts:   attempts,
+		CreatedAt:  now,
+	}
+	if lastErr != nil {
+		dl.LastError = lastErr.Error()
+	}
+	return dl
+}
+
+type DeadLetterService struct {
+	deadLetterRepo DeadLetterRepository
+	queue          Queue
+}
+
+func NewDeadLetterService(deadLetterRepo DeadLetterRepository, queue Queue) *DeadLetterService {
+	return &DeadLetterService{
+		deadLetterRepo: deadLetterRepo,
+		queue:          queue,
+	}
+}
+
+func (s *DeadLetterService) List(ctx context.Context, filter DeadLetterFilter) ([]*DeadLetter, error) {
+	return s.deadLetterRepo.List(ctx, filter)
+}
+
+func (s *DeadLetterService) Get(ctx context.Context, id string) (*DeadLetter, error) {
+	dl, err := s.deadLetterRepo.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if dl == nil {
+		return nil, ErrDeadLetterNotFound
+	}
+	return dl, nil
+}
+
+// Replay publishes the original message again for immediate delivery and
+// removes the dead letter. The replay is a new delivery with a new
+// MessageID, so neither the queue nor a consumer takes it for a duplicate,
+// and it starts over with a full retry policy.
+func (s *DeadLetterService) Replay(ctx context.Context, id string) error {
+	dl, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	msg := dl.Message
+	msg.MessageID = ""
+	msg.DeliverAt = time.Time{}
+	msg.Metadata = make(map[string]string, len(dl.Message.Metadata))
+	for k, v := range dl.Message.Metadata {
+		if k != MetadataAttempt && k != MetadataLastError {
+			msg.Metadata[k] = v
+		}
+	}
+	if err := s.queue.Publish(ctx, msg); err != nil {
+		return err
+	}
+
+	return s.deadLetterRepo.Delete(ctx, id)
+}
+
+func (s *DeadLetterService) Delete(ctx context.Context, id string) error {
+	if _, err := s.Get(ctx, id); err != nil {
+		return err
+	}
+	return s.deadLetterRepo.Delete(ctx, id)
+}
+
+func (s *DeadLetterService) Purge(ctx context.Context, filter DeadLetterFilter) (int, error) {
+	return s.deadLetterRepo.Purge(ctx, filter)
+}
@@ -2,8 +2,13 @@ package services
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"time"
+
+	"github.com/media-vault-sync/internal/core/domain"
 )
 
 const (
@@ -18,17 +23,37 @@ type EventualConsistencyCheckPayload struct {
 	Attempt    int    `json:"attempt"`
 }
 
+// EventualConsistencyWorker finds albums that need attention: unsynced
+// albums get a repair loop unless an earlier one gave up on them, and synced
+// albums whose manifest still lists videos without an object after the grace
+// period get a videoupload re-drive.
 type EventualConsistencyWorker struct {
-	albumRepo AlbumRepository
-	queue     Queue
-	clock     Clock
+	albumRepo      AlbumRepository
+	albumVideoRepo AlbumVideoRepository
+	objectRepo     ObjectRepository
+	deadLetterRepo DeadLetterRepository
+	queue          Queue
+	clock          Clock
+	gracePeriod    time.Duration
 }
 
-func NewEventualConsistencyWorker(albumRepo AlbumRepository, queue Queue, clock Clock) *EventualConsistencyWorker {
+func NewEventualConsistencyWorker(
+	albumRepo AlbumRepository,
+	albumVideoRepo AlbumVideoRepository,
+	objectRepo ObjectRepository,
+	deadLetterRepo DeadLetterRepository,
+	queue Queue,
+	clock Clock,
+	gracePeriod time.Duration,
+) *EventualConsistencyWorker {
 	return &EventualConsistencyWorker{
-		albumRepo: albumRepo,
-		queue:     queue,
-		clock:     clock,
+		albumRepo:      albumRepo,
+		albumVideoRepo: albumVideoRepo,
+		objectRepo:     objectRepo,
+		deadLetterRepo: deadLetterRepo,
+		queue:          queue,
+		clock:          clock,
+		gracePeriod:    gracePeriod,
 	}
 }
 
@@ -39,6 +64,15 @@ func (w *EventualConsistencyWorker) Scan(ctx context.Context) error {
 	}
 
 	for _, album := range albums {
+		// a given-up album waits for its dead letter to be replayed
+		open, err := w.deadLetterRepo.FindByID(ctx, repairDeadLetterID(album.ProviderID, album.DatabaseID, album.AlbumUID))
+		if err != nil {
+			return err
+		}
+		if open != nil {
+			continue
+		}
+
 		payload, err := json.Marshal(EventualConsistencyCheckPayload{
 			ProviderID: album.ProviderID,
 			DatabaseID: album.DatabaseID,
@@ -50,9 +84,61 @@ func (w *EventualConsistencyWorker) Scan(ctx context.Context) error {
 		}
 
 		err = w.queue.Publish(ctx, Message{
-			Topic:    "syncconsistencycheck",
-			Payload:  payload,
-			Metadata: map[string]string{},
+			Topic:   "syncconsistencycheck",
+			Payload: payload,
+			Metadata: map[string]string{
+				MetadataOrderingKey: AlbumOrderingKey(album.ProviderID, album.DatabaseID, album.AlbumUID),
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return w.redriveIncomplete(ctx)
+}
+
+// redriveIncomplete asks on-prem to send the missing videos of albums whose
+// manifest still lists videos without a current object. The manifest itself
+// is fine, so no manifest refresh is needed. The re-drive is recorded apart
+// from the album, so the next one waits another grace period without the
+// album looking changed to listing clients or to concurrent writers.
+func (w *EventualConsistencyWorker) redriveIncomplete(ctx context.Context) error {
+	now := w.clock.Now()
+	albums, err := w.albumRepo.FindRedriveCandidates(ctx, now.Add(-w.gracePeriod))
+	if err != nil {
+		return err
+	}
+
+	for _, album := range albums {
+		missing, err := w.missingVideoUIDs(ctx, album)
+		if err != nil {
+			return err
+		}
+		if len(missing) == 0 {
+			continue
+		}
+
+		if err := w.albumRepo.MarkRedriven(ctx, album.ProviderID, album.DatabaseID, album.AlbumUID, now); err != nil {
+			return err
+		}
+
+		payload, err := json.Marshal(VideoUploadPayload{
+			DatabaseID: album.DatabaseID,
+			AlbumUID:   album.AlbumUID,
+			VideoUIDs:  missing,
+		})
+		if err != nil {
+			return err
+		}
+
+		err = w.queue.Publish(ctx, Message{
+			Topic:   "videoupload",
+			Payload: payload,
+			Metadata: map[string]string{
+				"providerID":        album.ProviderID,
+				MetadataOrderingKey: AlbumOrderingKey(album.ProviderID, album.DatabaseID, album.AlbumUID),
+			},
 		})
 		if err != nil {
 			return err
@@ -62,17 +148,38 @@ func (w *EventualConsistencyWorker) Scan(ctx context.Context) error {
 	return nil
 }
 
+func (w *EventualConsistencyWorker) missingVideoUIDs(ctx context.Context, album *domain.Album) ([]string, error) {
+	videos, err := w.albumVideoRepo.FindByAlbumUID(ctx, album.ProviderID, album.DatabaseID, album.AlbumUID)
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	for _, vid := range videos {
+		object, err := w.objectRepo.FindByVideoUID(ctx, album.ProviderID, album.DatabaseID, vid.VideoUID)
+		if err != nil {
+			return nil, err
+		}
+		if object == nil || object.PurgedAt != nil {
+			missing = append(missing, vid.VideoUID)
+		}
+	}
+	return missing, nil
+}
+
 type EventualConsistencyCheckConsumer struct {
-	albumRepo AlbumRepository
-	queue     Queue
-	clock     Clock
+	albumRepo      AlbumRepository
+	deadLetterRepo DeadLetterRepository
+	queue          Queue
+	clock          Clock
 }
 
-func NewEventualConsistencyCheckConsumer(albumRepo AlbumRepository, queue Queue, clock Clock) *EventualConsistencyCheckConsumer {
+func NewEventualConsistencyCheckConsumer(albumRepo AlbumRepository, deadLetterRepo DeadLetterRepository, queue Queue, clock Clock) *EventualConsistencyCheckConsumer {
 	return &EventualConsistencyCheckConsumer{
-		albumRepo: albumRepo,
-		queue:     queue,
-		clock:     clock,
+		albumRepo:      albumRepo,
+		deadLetterRepo: deadLetterRepo,
+		queue:          queue,
+		clock:          clock,
 	}
 }
 
@@ -92,13 +199,13 @@ func (c *EventualConsistencyCheckConsumer) Handle(ctx context.Context, msg Messa
 	}
 
 	if payload.Attempt >= MaxRepairAttempts {
-		// TODO: send it to a DLQ or a list of work that requires developer intervention
-		return nil
+		return c.giveUp(ctx, msg, payload)
 	}
 
 	albumManifestUploadPayload, err := json.Marshal(AlbumManifestUploadPayload{
 		DatabaseID: payload.DatabaseID,
 		AlbumUID:   payload.AlbumUID,
+		Source:     ManifestSourceRepair,
 	})
 	if err != nil {
 		return err
@@ -108,7 +215,8 @@ func (c *EventualConsistencyCheckConsumer) Handle(ctx context.Context, msg Messa
 		Topic:   "albummanifestupload",
 		Payload: albumManifestUploadPayload,
 		Metadata: map[string]string{
-			"providerID": payload.ProviderID,
+			"providerID":        payload.ProviderID,
+			MetadataOrderingKey: AlbumOrderingKey(payload.ProviderID, payload.DatabaseID, payload.AlbumUID),
 		},
 	})
 	if err != nil {
@@ -129,9 +237,58 @@ func (c *EventualConsistencyCheckConsumer) Handle(ctx context.Context, msg Messa
 	deliverAt := c.clock.Now().Add(backoff)
 
 	return c.queue.Publish(ctx, Message{
-		Topic:     "syncconsistencycheck",
-		Payload:   nextPayload,
-		Metadata:  map[string]string{},
+		Topic:   "syncconsistencycheck",
+		Payload: nextPayload,
+		Metadata: map[string]string{
+			MetadataOrderingKey: AlbumOrderingKey(payload.ProviderID, payload.DatabaseID, payload.AlbumUID),
+		},
 		DeliverAt: deliverAt,
 	})
 }
+
+// giveUp dead-letters an album that is still unsynced after MaxRepairAttempts.
+// The stored message restarts the repair loop from the first attempt, so
+// replaying it gives the album a fresh set of repairs. An album has at most
+// one such dead letter, under an ID of its own.
+func (c *EventualConsistencyCheckConsumer) giveUp(ctx context.Context, msg Message, payload EventualConsistencyCheckPayload) error {
+	id := repairDeadLetterID(payload.ProviderID, payload.DatabaseID, payload.AlbumUID)
+	open, err := c.deadLetterRepo.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if open != nil {
+		return nil
+	}
+
+	restartPayload, err := json.Marshal(EventualConsistencyCheckPayload{
+		ProviderID: payload.ProviderID,
+		DatabaseID: payload.DatabaseID,
+		AlbumUID:   payload.AlbumUID,
+		Attempt:    1,
+	})
+	if err != nil {
+		return err
+	}
+
+	restart := Message{
+		MessageID: msg.MessageID,
+		Topic:     msg.Topic,
+		Payload:   restartPayload,
+		Metadata: map[string]string{
+			"providerID":        payload.ProviderID,
+			MetadataOrderingKey: AlbumOrderingKey(payload.ProviderID, payload.DatabaseID, payload.AlbumUID),
+		},
+	}
+	lastErr := fmt.Errorf("album %s still unsynced after %d repair attempts", payload.AlbumUID, payload.Attempt)
+
+	deadLetter := NewDeadLetter(restart, payload.Attempt, lastErr, c.clock.Now())
+	deadLetter.ID = id
+	return c.deadLetterRepo.Add(ctx, deadLetter)
+}
+
+// repairDeadLetterID is the ID of the dead letter of an album whose repairs
+// gave up.
+func repairDeadLetterID(providerID, databaseID, albumUID string) string {
+	sum := sha256.Sum256([]byte("syncconsistencycheck\n" + AlbumOrderingKey(providerID, databaseID, albumUID)))
+	return hex.EncodeToString(sum[:])
+}
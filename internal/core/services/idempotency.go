@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/media-vault-sync/internal/core/domain"
+)
+
+var ErrIdempotencyKeyInUse = errors.New("a request with this idempotency key is still in progress")
+
+// idempotencyInProgressLease bounds how long a request that never finished,
+// because its process died, keeps its key from being used again.
+const idempotencyInProgressLease = 10 * time.Minute
+
+// IdempotencyService remembers the outcome of write requests by their
+// Idempotency-Key so that a retry replays it instead of running again. Only
+// successes are kept: a failed request changed nothing and its retry runs.
+type IdempotencyService struct {
+	repo  IdempotencyRepository
+	clock Clock
+	ttl   time.Duration
+}
+
+func NewIdempotencyService(repo IdempotencyRepository, clock Clock, ttl time.Duration) *IdempotencyService {
+	return &IdempotencyService{repo: repo, clock: clock, ttl: ttl}
+}
+
+// Begin claims key within scope, the endpoint it was sent to. It returns the
+// status of an earlier request that completed with the key, or 0 when the
+// request has to run and be finished with Finish.
+func (s *IdempotencyService) Begin(ctx context.Context, scope, key string) (int, error) {
+	now := s.clock.Now()
+	existing, err := s.repo.Reserve(ctx, &domain.IdempotencyRecord{
+		Key:       idempotencyRecordKey(scope, key),
+		CreatedAt: now,
+		ExpiresAt: now.Add(min(s.ttl, idempotencyInProgressLease)),
+	})
+	if err != nil {
+		return 0, err
+	}
+	if existing == nil {
+		return 0, nil
+	}
+	if !existing.Completed() {
+		return 0, ErrIdempotencyKeyInUse
+	}
+	return existing.StatusCode, nil
+}
+
+// Finish stores a successful status for replay and frees the key otherwise.
+func (s *IdempotencyService) Finish(ctx context.Context, scope, key string, statusCode int) error {
+	recordKey := idempotencyRecordKey(scope, key)
+	if statusCode < 200 || statusCode >= 300 {
+		return s.repo.Delete(ctx, recordKey)
+	}
+	return s.repo.Complete(ctx, recordKey, statusCode, s.clock.Now().Add(s.ttl))
+}
+
+// ExpireStale removes records whose TTL ran out.
+func (s *IdempotencyService) ExpireStale(ctx context.Context) (int, error) {
+	return s.repo.DeleteExpired(ctx, s.clock.Now())
+}
+
+func idempotencyRecordKey(scope, key string) string {
+	sum := sha256.Sum256([]byte(scope + "\n" + key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,17 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/media-vault-sync/internal/core/domain"
+)
+
+type IdempotencyRepository interface {
+	// Reserve stores record unless an unexpired record holds its key, in which
+	// case it stores nothing and returns that record.
+	Reserve(ctx context.Context, record *domain.IdempotencyRecord) (*domain.IdempotencyRecord, error)
+	Complete(ctx context.Context, key string, statusCode int, expiresAt time.Time) error
+	Delete(ctx context.Context, key string) error
+	DeleteExpired(ctx context.Context, before time.Time) (int, error)
+}
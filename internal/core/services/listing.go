@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/media-vault-sync/internal/core/domain"
+)
+
+const (
+	DefaultListLimit = 100
+	MaxListLimit     = 1000
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// NextCursor is an opaque cursor for the following page, empty on the last one.
+type AlbumPage struct {
+	Albums     []*domain.Album
+	NextCursor string
+}
+
+type VideoPage struct {
+	Videos     []*domain.Video
+	NextCursor string
+}
+
+type ObjectPage struct {
+	Objects    []*domain.Object
+	NextCursor string
+}
+
+// ListingService pages through what a provider database has synced. Cursors
+// encode the sort key of the last item returned, so pages stay stable while
+// rows are added.
+type ListingService struct {
+	albumRepo  AlbumRepository
+	videoRepo  VideoRepository
+	objectRepo ObjectRepository
+}
+
+func NewListingService(albumRepo AlbumRepository, videoRepo VideoRepository, objectRepo ObjectRepository) *ListingService {
+	return &ListingService{
+		albumRepo:  albumRepo,
+		videoRepo:  videoRepo,
+		objectRepo: objectRepo,
+	}
+}
+
+func (s *ListingService) ListAlbums(ctx context.Context, filter AlbumFilter, cursor string) (*AlbumPage, error) {
+	if cursor != "" {
+		key, err := decodeCursor(cursor, 1)
+		if err != nil {
+			return nil, err
+		}
+		filter.AfterAlbumUID = key[0]
+	}
+	limit := listLimit(filter.Limit)
+	filter.Limit = limit + 1
+
+	albums, err := s.albumRepo.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &AlbumPage{Albums: albums}
+	if len(albums) > limit {
+		page.Albums = albums[:limit]
+		page.NextCursor = encodeCursor(albums[limit-1].AlbumUID)
+	}
+	return page, nil
+}
+
+func (s *ListingService) ListVideos(ctx context.Context, filter VideoFilter, cursor string) (*VideoPage, error) {
+	if cursor != "" {
+		key, err := decodeCursor(cursor, 1)
+		if err != nil {
+			return nil, err
+		}
+		filter.AfterVideoUID = key[0]
+	}
+	limit := listLimit(filter.Limit)
+	filter.Limit = limit + 1
+
+	videos, err := s.videoRepo.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &VideoPage{Videos: videos}
+	if len(videos) > limit {
+		page.Videos = videos[:limit]
+		page.NextCursor = encodeCursor(videos[limit-1].VideoUID)
+	}
+	return page, nil
+}
+
+func (s *ListingService) ListObjects(ctx context.Context, filter ObjectFilter, cursor string) (*ObjectPage, error) {
+	if cursor != "" {
+		key, err := decodeCursor(cursor, 2)
+		if err != nil {
+			return nil, err
+		}
+		version, err := strconv.Atoi(key[1])
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		filter.AfterVideoUID = key[0]
+		filter.AfterVersion = version
+	}
+	limit := listLimit(filter.Limit)
+	filter.Limit = limit + 1
+
+	objects, err := s.objectRepo.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &ObjectPage{Objects: objects}
+	if len(objects) > limit {
+		page.Objects = objects[:limit]
+		last := objects[limit-1]
+		page.NextCursor = encodeCursor(last.VideoUID, strconv.Itoa(last.Version))
+	}
+	return page, nil
+}
+
+func listLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultListLimit
+	}
+	return min(limit, MaxListLimit)
+}
+
+// the key parts are joined with NUL, which cannot appear in a UID
+func encodeCursor(parts ...string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strings.Join(parts, "\x00")))
+}
+
+func decodeCursor(cursor string, parts int) ([]string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	key := strings.Split(string(raw), "\x00")
+	if len(key) != parts {
+		return nil, ErrInvalidCursor
+	}
+	return key, nil
+}
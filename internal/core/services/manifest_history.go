@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/media-vault-sync/internal/core/domain"
+)
+
+var ErrRevisionNotFound = errors.New("manifest revision not found")
+
+type ManifestRevisionPage struct {
+	Revisions  []*domain.ManifestRevision
+	NextCursor string
+}
+
+// ManifestSnapshot is an album's manifest as of one revision.
+type ManifestSnapshot struct {
+	Revision  *domain.ManifestRevision
+	VideoUIDs []string
+}
+
+// ManifestHistoryService browses the recorded manifest revisions of albums.
+type ManifestHistoryService struct {
+	albumRepo            AlbumRepository
+	manifestRevisionRepo ManifestRevisionRepository
+}
+
+func NewManifestHistoryService(albumRepo AlbumRepository, manifestRevisionRepo ManifestRevisionRepository) *ManifestHistoryService {
+	return &ManifestHistoryService{
+		albumRepo:            albumRepo,
+		manifestRevisionRepo: manifestRevisionRepo,
+	}
+}
+
+func (s *ManifestHistoryService) ListRevisions(ctx context.Context, filter ManifestRevisionFilter, cursor string) (*ManifestRevisionPage, error) {
+	if err := s.requireAlbum(ctx, filter.ProviderID, filter.DatabaseID, filter.AlbumUID); err != nil {
+		return nil, err
+	}
+
+	if cursor != "" {
+		key, err := decodeCursor(cursor, 1)
+		if err != nil {
+			return nil, err
+		}
+		filter.AfterRevision, err = strconv.Atoi(key[0])
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+	}
+	limit := listLimit(filter.Limit)
+	filter.Limit = limit + 1
+
+	revisions, err := s.manifestRevisionRepo.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &ManifestRevisionPage{Revisions: revisions}
+	if len(revisions) > limit {
+		page.Revisions = revisions[:limit]
+		page.NextCursor = encodeCursor(strconv.Itoa(revisions[limit-1].Revision))
+	}
+	return page, nil
+}
+
+// GetSnapshot rebuilds the manifest as of the revision by replaying every
+// revision up to it.
+func (s *ManifestHistoryService) GetSnapshot(ctx context.Context, providerID, databaseID, albumUID string, revision int) (*ManifestSnapshot, error) {
+	if err := s.requireAlbum(ctx, providerID, databaseID, albumUID); err != nil {
+		return nil, err
+	}
+
+	revisions, err := s.manifestRevisionRepo.List(ctx, ManifestRevisionFilter{
+		ProviderID: providerID,
+		DatabaseID: databaseID,
+		AlbumUID:   albumUID,
+		Limit:      revision,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if revision < 1 || len(revisions) < revision {
+		return nil, ErrRevisionNotFound
+	}
+
+	videoUIDs := []string{}
+	for _, rev := range revisions[:revision] {
+		removed := make(map[string]bool, len(rev.Removed))
+		for _, videoUID := range rev.Removed {
+			removed[videoUID] = true
+		}
+		kept := videoUIDs[:0]
+		for _, videoUID := range videoUIDs {
+			if !removed[videoUID] {
+				kept = append(kept, videoUID)
+			}
+		}
+		videoUIDs = append(kept, rev.Added...)
+	}
+
+	return &ManifestSnapshot{Revision: revisions[revision-1], VideoUIDs: videoUIDs}, nil
+}
+
+func (s *ManifestHistoryService) requireAlbum(ctx context.Context, providerID, databaseID, albumUID string) error {
+	album, err := s.albumRepo.FindByAlbumUID(ctx, providerID, databaseID, albumUID)
+	if err != nil {
+		return err
+	}
+	if album == nil {
+		return ErrAlbumNotFound
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/media-vault-sync/internal/core/domain"
+)
+
+// ManifestRevisionFilter selects revisions of one album, ordered by revision
+// number. CreatedSince is inclusive and CreatedBefore exclusive.
+type ManifestRevisionFilter struct {
+	ProviderID    string
+	DatabaseID    string
+	AlbumUID      string
+	CreatedSince  time.Time
+	CreatedBefore time.Time
+	// keyset cursor: only revisions after this number
+	AfterRevision int
+	Limit         int
+}
+
+type ManifestRevisionRepository interface {
+	// Add stores the revision under the album's next revision number and
+	// sets revision.Revision to it.
+	Add(ctx context.Context, revision *domain.ManifestRevision) error
+	List(ctx context.Context, filter ManifestRevisionFilter) ([]*domain.ManifestRevision, error)
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type ProcessedMessageRepository interface {
+	// MarkProcessed records that consumer processed messageID, joining the
+	// unit of work carried by ctx. It reports false when it already was.
+	MarkProcessed(ctx context.Context, consumer, messageID string, processedAt time.Time) (bool, error)
+	IsProcessed(ctx context.Context, consumer, messageID string) (bool, error)
+	Unmark(ctx context.Context, consumer, messageID string) error
+	DeleteProcessedBefore(ctx context.Context, before time.Time) (int, error)
+}
+
+// MessageDeduplicator makes at-least-once delivery effectively-once: a
+// wrapped handler runs once per MessageID and consumer, and redeliveries of a
+// message it handled are acknowledged without running it again.
+type MessageDeduplicator struct {
+	repo       ProcessedMessageRepository
+	transactor Transactor
+	clock      Clock
+	retention  time.Duration
+}
+
+func NewMessageDeduplicator(repo ProcessedMessageRepository, transactor Transactor, clock Clock, retention time.Duration) *MessageDeduplicator {
+	return &MessageDeduplicator{
+		repo:       repo,
+		transactor: transactor,
+		clock:      clock,
+		retention:  retention,
+	}
+}
+
+// Handler wraps handler for consumer. The message is marked processed only
+// once the handler succeeded, so a long handler such as a video upload holds
+// no transaction open, and a process that dies or loses its lease midway
+// leaves the message unmarked for its redelivery. Two deliveries of one
+// message at the same time may thus both run. Messages without a MessageID
+// always run.
+func (d *MessageDeduplicator) Handler(consumer string, handler MessageHandler) MessageHandler {
+	return func(ctx context.Context, msg Message) error {
+		if msg.MessageID == "" {
+			return handler(ctx, msg)
+		}
+
+		processed, err := d.repo.IsProcessed(ctx, consumer, msg.MessageID)
+		if err != nil {
+			return err
+		}
+		if processed {
+			return nil
+		}
+
+		if err := handler(ctx, msg); err != nil {
+			return err
+		}
+		// the handler's work is done even if ctx ended
+		if _, err := d.repo.MarkProcessed(context.WithoutCancel(ctx), consumer, msg.MessageID, d.clock.Now()); err != nil {
+			return fmt.Errorf("marking message %s processed: %w", msg.MessageID, err)
+		}
+		return nil
+	}
+}
+
+// HandlerInTx wraps a handler whose writes all go through repositories that
+// join the unit of work. The message is marked processed in the unit of work
+// the handler runs in, so the mark commits or rolls back with the handler's
+// own writes and a concurrent redelivery waits for it.
+func (d *MessageDeduplicator) HandlerInTx(consumer string, handler MessageHandler) MessageHandler {
+	return func(ctx context.Context, msg Message) error {
+		if msg.MessageID == "" {
+			return handler(ctx, msg)
+		}
+
+		return d.transactor.WithinTx(ctx, func(ctx context.Context) error {
+			first, err := d.repo.MarkProcessed(ctx, consumer, msg.MessageID, d.clock.Now())
+			if err != nil {
+				return err
+			}
+			if !first {
+				return nil
+			}
+
+			if err := handler(ctx, msg); err != nil {
+				// memory repositories keep the mark through a rollback
+				d.repo.Unmark(ctx, consumer, msg.MessageID)
+				return err
+			}
+			return nil
+		})
+	}
+}
+
+// ExpireStale forgets messages processed longer than the retention ago.
+func (d *MessageDeduplicator) ExpireStale(ctx context.Context) (int, error) {
+	return d.repo.DeleteProcessedBefore(ctx, d.clock.Now().Add(-d.retention))
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/media-vault-sync/internal/core/domain"
+)
+
+const ObjectGCBatchSize = 100
+
+// ObjectGarbageCollector purges object versions that were superseded longer
+// than the retention ago, and versions of videos no album has listed for
+// longer than the unreferenced retention. A blob is deleted once no unpurged
+// version references it anymore; the object rows stay as history.
+type ObjectGarbageCollector struct {
+	objectRepo            ObjectRepository
+	blobStore             BlobStore
+	clock                 Clock
+	retention             time.Duration
+	unreferencedRetention time.Duration
+}
+
+func NewObjectGarbageCollector(objectRepo ObjectRepository, blobStore BlobStore, clock Clock, retention, unreferencedRetention time.Duration) *ObjectGarbageCollector {
+	return &ObjectGarbageCollector{
+		objectRepo:            objectRepo,
+		blobStore:             blobStore,
+		clock:                 clock,
+		retention:             retention,
+		unreferencedRetention: unreferencedRetention,
+	}
+}
+
+func (gc *ObjectGarbageCollector) Collect(ctx context.Context) (purged int, err error) {
+	now := gc.clock.Now()
+
+	superseded, err := gc.purgeAll(ctx, now, func(limit int) ([]*domain.Object, error) {
+		return gc.objectRepo.FindSuperseded(ctx, now.Add(-gc.retention), limit)
+	})
+	if err != nil {
+		return superseded, err
+	}
+
+	unreferenced, err := gc.purgeAll(ctx, now, func(limit int) ([]*domain.Object, error) {
+		return gc.objectRepo.FindUnreferenced(ctx, now.Add(-gc.unreferencedRetention), limit)
+	})
+	return superseded + unreferenced, err
+}
+
+func (gc *ObjectGarbageCollector) purgeAll(ctx context.Context, now time.Time, find func(limit int) ([]*domain.Object, error)) (purged int, err error) {
+	for {
+		objects, err := find(ObjectGCBatchSize)
+		if err != nil {
+			return purged, err
+		}
+
+		for _, object := range objects {
+			// the blob goes while the repository keeps new versions from
+			// referencing it, so an upload cannot count on a blob being deleted
+			err := gc.objectRepo.Purge(ctx, object.UID, now, func(references int) error {
+				if references > 0 {
+					return nil
+				}
+				if err := gc.blobStore.Delete(ctx, object.StorageKey); err != nil {
+					return fmt.Errorf("deleting blob %s: %w", object.StorageKey, err)
+				}
+				return nil
+			})
+			if err != nil {
+				return purged, err
+			}
+			purged++
+		}
+
+		if len(objects) < ObjectGCBatchSize {
+			return purged, nil
+		}
+	}
+}
@@ -2,12 +2,64 @@ package services
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/media-vault-sync/internal/core/domain"
 )
 
+// ObjectFilter selects objects of one provider database, ordered by VideoUID
+// then Version. Only current versions are returned unless IncludeSuperseded
+// is set. CreatedSince is inclusive and CreatedBefore exclusive.
+type ObjectFilter struct {
+	ProviderID        string
+	DatabaseID        string
+	VideoUID          string
+	IncludeSuperseded bool
+	CreatedSince      time.Time
+	CreatedBefore     time.Time
+	// keyset cursor: only objects sorting after (AfterVideoUID, AfterVersion)
+	AfterVideoUID string
+	AfterVersion  int
+	Limit         int
+}
+
+// ErrObjectVersionConflict is returned by AddVersion when a concurrent
+// AddVersion of the same video got in the way; reading the current version
+// again and retrying resolves it.
+var ErrObjectVersionConflict = errors.New("object version was added concurrently")
+
 type ObjectRepository interface {
 	Upsert(ctx context.Context, object *domain.Object) error
+	// AddVersion supersedes the current version of the video, if any, and
+	// stores object as the new current version. The version is numbered one
+	// past the latest one of the video while they are locked, and set on
+	// object.
+	AddVersion(ctx context.Context, object *domain.Object) error
+	// FindByVideoUID returns the current version.
 	FindByVideoUID(ctx context.Context, providerID, databaseID, videoUID string) (*domain.Object, error)
+	// ListVersions returns every version of the video, oldest first.
+	ListVersions(ctx context.Context, providerID, databaseID, videoUID string) ([]*domain.Object, error)
+	// FindSuperseded returns versions superseded before the cutoff whose blob
+	// has not been purged yet.
+	FindSuperseded(ctx context.Context, supersededBefore time.Time, limit int) ([]*domain.Object, error)
+	MarkPurged(ctx context.Context, uid string, purgedAt time.Time) error
+	// Purge marks the version purged and calls release with the number of
+	// unpurged versions still referencing its blob. Versions referencing the
+	// blob cannot be added until release returns, so a release that sees no
+	// references may delete the blob. An error from release leaves the
+	// version unpurged.
+	Purge(ctx context.Context, uid string, purgedAt time.Time, release func(references int) error) error
+	// MarkUnreferenced schedules the unpurged versions of the videos for
+	// purging; versions already scheduled keep their original time.
+	MarkUnreferenced(ctx context.Context, providerID, databaseID string, videoUIDs []string, unreferencedAt time.Time) error
+	// ClearUnreferenced cancels the scheduled purge of the videos.
+	ClearUnreferenced(ctx context.Context, providerID, databaseID string, videoUIDs []string) error
+	// FindUnreferenced returns unpurged versions unreferenced before the cutoff.
+	FindUnreferenced(ctx context.Context, unreferencedBefore time.Time, limit int) ([]*domain.Object, error)
+	// CountByStorageKey counts the unpurged versions referencing a blob, which
+	// is the blob's reference count.
+	CountByStorageKey(ctx context.Context, storageKey string) (int, error)
 	CountByAlbumUID(ctx context.Context, providerID, databaseID, albumUID string, albumVideoRepo AlbumVideoRepository) (int, error)
+	List(ctx context.Context, filter ObjectFilter) ([]*domain.Object, error)
 }
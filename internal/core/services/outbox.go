@@ -0,0 +1,110 @@
+package services
+
+import (
+	"context"
+	"time"
+)
+
+// OutboxMessage is a message stored with the state change that emits it, and
+// published to the queue by OutboxRelay once that change has committed.
+type OutboxMessage struct {
+	ID        string
+	Message   Message
+	CreatedAt time.Time
+}
+
+type OutboxRepository interface {
+	// Add joins the unit of work carried by ctx.
+	Add(ctx context.Context, msg *OutboxMessage) error
+	// ListPending returns the oldest messages first. Within a unit of work,
+	// the returned messages stay claimed until it ends.
+	ListPending(ctx context.Context, limit int) ([]*OutboxMessage, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// OutboxPublisher is a Queue whose Publish stores the message in the outbox
+// instead, inside the unit of work carried by ctx. Subscriptions go to the
+// queue the relay publishes to.
+type OutboxPublisher struct {
+	outboxRepo OutboxRepository
+	queue      Queue
+	clock      Clock
+}
+
+func NewOutboxPublisher(outboxRepo OutboxRepository, queue Queue, clock Clock) *OutboxPublisher {
+	return &OutboxPublisher{
+		outboxRepo: outboxRepo,
+		queue:      queue,
+		clock:      clock,
+	}
+}
+
+func (p *OutboxPublisher) Publish(ctx context.Context, msg Message) error {
+	// assigned here so that the queue drops a message the relay publishes twice
+	if msg.MessageID == "" {
+		msg.MessageID = NewID()
+	}
+	return p.outboxRepo.Add(ctx, &OutboxMessage{
+		ID:        NewID(),
+		Message:   msg,
+		CreatedAt: p.clock.Now(),
+	})
+}
+
+func (p *OutboxPublisher) Subscribe(ctx context.Context, subscriptionID string, topic string, providerID string, handler MessageHandler, opts ...SubscribeOption) error {
+	return p.queue.Subscribe(ctx, subscriptionID, topic, providerID, handler, opts...)
+}
+
+func (p *OutboxPublisher) Unsubscribe(subscriptionID string) error {
+	return p.queue.Unsubscribe(subscriptionID)
+}
+
+// OutboxRelayBatch bounds how many messages one Relay call publishes.
+const OutboxRelayBatch = 100
+
+// OutboxRelay moves committed outbox messages to the queue.
+type OutboxRelay struct {
+	outboxRepo OutboxRepository
+	queue      Queue
+	transactor Transactor
+}
+
+func NewOutboxRelay(outboxRepo OutboxRepository, queue Queue, transactor Transactor) *OutboxRelay {
+	return &OutboxRelay{
+		outboxRepo: outboxRepo,
+		queue:      queue,
+		transactor: transactor,
+	}
+}
+
+// Relay publishes pending messages in order and removes them from the
+// outbox. The batch is claimed in one unit of work, so concurrent relays skip
+// each other's messages. A message is removed only after it was published,
+// so a crash in between publishes it again under the same MessageID, which
+// the queue drops within its dedup window. A
+// failed publish stops the batch, keeping the message and those after it for
+// the next call.
+func (r *OutboxRelay) Relay(ctx context.Context) (int, error) {
+	relayed := 0
+	var publishErr error
+	err := r.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		pending, err := r.outboxRepo.ListPending(ctx, OutboxRelayBatch)
+		if err != nil {
+			return err
+		}
+		for _, msg := range pending {
+			if publishErr = r.queue.Publish(ctx, msg.Message); publishErr != nil {
+				return nil
+			}
+			if err := r.outboxRepo.Delete(ctx, msg.ID); err != nil {
+				return err
+			}
+			relayed++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return relayed, publishErr
+}
@@ -5,6 +5,9 @@ import (
 	"time"
 )
 
+// MessageID is assigned by Publish when empty. Queues drop a message whose
+// MessageID was already published within their dedup window, so publishers
+// that may emit the same message twice can set a deterministic one.
 type Message struct {
 	MessageID string
 	Topic     string
@@ -13,10 +16,82 @@ type Message struct {
 	DeliverAt time.Time
 }
 
+// WithMetadata returns msg with key set, leaving the metadata of msg as is.
+func (m Message) WithMetadata(key, value string) Message {
+	metadata := make(map[string]string, len(m.Metadata)+1)
+	for k, v := range m.Metadata {
+		metadata[k] = v
+	}
+	metadata[key] = value
+	m.Metadata = metadata
+	return m
+}
+
+// MetadataOrderingKey orders the messages of a topic that carry the same
+// value: queues hand them to one handler at a time, in publish order, and
+// hold later ones back while an earlier one waits for its retry.
+const MetadataOrderingKey = "orderingKey"
+
+// AlbumOrderingKey is the ordering key of messages about one album.
+func AlbumOrderingKey(providerID, databaseID, albumUID string) string {
+	return providerID + "/" + databaseID + "/" + albumUID
+}
+
+// MetadataConsumerGroup names the consumer group a message is delivered to.
+// Queues set it on the copy each group gets; a message published with it
+// set goes to that group only, which is how a dead letter replay reaches
+// just the group that failed it.
+const MetadataConsumerGroup = "consumerGroup"
+
 type MessageHandler func(ctx context.Context, msg Message) error
 
+type leaseRenewalKey struct{}
+
+// WithLeaseRenewal returns ctx for a handler of a message that a lease holds,
+// with renew extending the lease.
+func WithLeaseRenewal(ctx context.Context, renew func(ctx context.Context) error) context.Context {
+	return context.WithValue(ctx, leaseRenewalKey{}, renew)
+}
+
+// RenewLease extends the lease on the message whose handler got ctx, for a
+// handler that waits on another process which reports it is still working.
+// It does nothing for queues without leases.
+func RenewLease(ctx context.Context) error {
+	if renew, ok := ctx.Value(leaseRenewalKey{}).(func(ctx context.Context) error); ok {
+		return renew(ctx)
+	}
+	return nil
+}
+
+// SubscribeOptions configures a subscription.
+type SubscribeOptions struct {
+	// Group is the consumer group of the subscription, its subscription ID
+	// by default. Every group gets each message of the topic once; the
+	// subscriptions of one group compete for it.
+	Group string
+}
+
+type SubscribeOption func(*SubscribeOptions)
+
+// InGroup makes a subscription a member of group, sharing its messages with
+// the other members instead of getting a copy of its own.
+func InGroup(group string) SubscribeOption {
+	return func(o *SubscribeOptions) {
+		o.Group = group
+	}
+}
+
+// NewSubscribeOptions applies opts to the defaults of subscriptionID.
+func NewSubscribeOptions(subscriptionID string, opts ...SubscribeOption) SubscribeOptions {
+	o := SubscribeOptions{Group: subscriptionID}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
 type Queue interface {
 	Publish(ctx context.Context, msg Message) error
-	Subscribe(ctx context.Context, subscriptionID string, topic string, providerID string, handler MessageHandler) error
+	Subscribe(ctx context.Context, subscriptionID string, topic string, providerID string, handler MessageHandler, opts ...SubscribeOption) error
 	Unsubscribe(subscriptionID string) error
 }
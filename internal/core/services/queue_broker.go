@@ -0,0 +1,330 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultQueueBrokerAckTimeout stays below the five minute lease of the
+// mysql queue, so a delivery is settled before another process may claim it.
+const (
+	DefaultQueueBrokerPollWait   = 30 * time.Second
+	DefaultQueueBrokerAckTimeout = 4 * time.Minute
+)
+
+var (
+	ErrDeliveryNotFound     = errors.New("delivery not found")
+	ErrQueueBrokerElsewhere = errors.New("queue broker runs in another instance")
+
+	errSubscriberGone = errors.New("remote subscriber stopped polling")
+	errAckTimeout     = errors.New("remote subscriber did not acknowledge in time")
+)
+
+// QueueMessage is a Message on its way between the queue broker and a
+// remote queue.
+type QueueMessage struct {
+	MessageID string            `json:"messageID"`
+	Topic     string            `json:"topic"`
+	Payload   []byte            `json:"payload"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	DeliverAt time.Time         `json:"deliverAt,omitzero"`
+}
+
+func NewQueueMessage(msg Message) QueueMessage {
+	return QueueMessage{
+		MessageID: msg.MessageID,
+		Topic:     msg.Topic,
+		Payload:   msg.Payload,
+		Metadata:  msg.Metadata,
+		DeliverAt: msg.DeliverAt,
+	}
+}
+
+func (m QueueMessage) Message() Message {
+	return Message{
+		MessageID: m.MessageID,
+		Topic:     m.Topic,
+		Payload:   m.Payload,
+		Metadata:  m.Metadata,
+		DeliverAt: m.DeliverAt,
+	}
+}
+
+// QueuePollRequest asks the broker for the next message of a remote
+// subscription. WaitMillis is how long the broker may hold the request while
+// none is ready.
+type QueuePollRequest struct {
+	SubscriptionID string `json:"subscriptionID"`
+	Topic          string `json:"topic"`
+	ProviderID     string `json:"providerID"`
+	Group          string `json:"group,omitempty"`
+	WaitMillis     int64  `json:"waitMillis"`
+}
+
+// QueueDelivery is a message handed to a remote subscription; the broker
+// waits for a QueueAck with its DeliveryID, and fails the delivery when
+// neither the ack nor a QueueHeartbeat came within AckTimeoutMillis.
+type QueueDelivery struct {
+	DeliveryID       string       `json:"deliveryID"`
+	Message          QueueMessage `json:"message"`
+	AckTimeoutMillis int64        `json:"ackTimeoutMillis"`
+}
+
+// QueueHeartbeat reports that the handler of a delivery is still running.
+type QueueHeartbeat struct {
+	DeliveryID string `json:"deliveryID"`
+}
+
+// QueueAck reports the outcome of a delivery's handler: an empty Error for
+// success, or else the error and whether a retry may succeed.
+type QueueAck struct {
+	DeliveryID string `json:"deliveryID"`
+	Error      string `json:"error,omitempty"`
+	Retryable  bool   `json:"retryable,omitempty"`
+}
+
+// QueueBrokerLock keeps the queue broker to one instance of the cloud when
+// the queue is shared by several. Held takes the lock when it is free and
+// reports whether this instance holds it.
+type QueueBrokerLock interface {
+	Held(ctx context.Context) (bool, error)
+}
+
+// QueueBroker serves a queue to processes that cannot share it. A remote
+// subscription polls for its messages; on its first poll the broker
+// subscribes to the queue on its behalf with a handler that hands each
+// message to a poll and returns the error its ack reports. Retries, ordering
+// and dead letters thus stay with the queue. A subscription that stops
+// polling for twice maxWait is unsubscribed again, and the message its
+// handler was offering is retried.
+//
+// The deliveries awaiting an ack live in the broker's memory, so only the
+// instance holding lock serves polls; the others answer
+// ErrQueueBrokerElsewhere. A nil lock suits a queue of this process alone.
+// A delivery is failed once ackTimeout passes from its offer or its last
+// heartbeat, which must be shorter than the lease of a shared queue; each
+// heartbeat renews that lease.
+type QueueBroker struct {
+	queue      Queue
+	lock       QueueBrokerLock
+	maxWait    time.Duration
+	ackTimeout time.Duration
+
+	mu            sync.Mutex
+	subscriptions map[string]*brokerSubscription
+	deliveries    map[string]*brokerDelivery
+}
+
+type brokerSubscription struct {
+	req        QueuePollRequest
+	deliveries chan *brokerDelivery
+	gone       chan struct{}
+	idle       *time.Timer
+}
+
+type brokerDelivery struct {
+	id     string
+	msg    Message
+	result chan error
+	beats  chan struct{}
+}
+
+func NewQueueBroker(queue Queue, lock QueueBrokerLock, maxWait, ackTimeout time.Duration) *QueueBroker {
+	return &QueueBroker{
+		queue:         queue,
+		lock:          lock,
+		maxWait:       maxWait,
+		ackTimeout:    ackTimeout,
+		subscriptions: make(map[string]*brokerSubscription),
+		deliveries:    make(map[string]*brokerDelivery),
+	}
+}
+
+func (b *QueueBroker) Publish(ctx context.Context, msg QueueMessage) error {
+	return b.queue.Publish(ctx, msg.Message())
+}
+
+// Poll returns the next message of the subscription, or nil when none came
+// within the requested wait, capped at maxWait.
+func (b *QueueBroker) Poll(ctx context.Context, req QueuePollRequest) (*QueueDelivery, error) {
+	if err := b.hold(ctx); err != nil {
+		return nil, err
+	}
+	sub, err := b.subscribe(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var d *brokerDelivery
+	select {
+	case d = <-sub.deliveries:
+	default:
+		timer := time.NewTimer(min(time.Duration(req.WaitMillis)*time.Millisecond, b.maxWait))
+		defer timer.Stop()
+		select {
+		case d = <-sub.deliveries:
+		case <-timer.C:
+			return nil, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return &QueueDelivery{DeliveryID: d.id, Message: NewQueueMessage(d.msg), AckTimeoutMillis: b.ackTimeout.Milliseconds()}, nil
+}
+
+// Heartbeat restarts the ack timeout of a delivery whose remote handler is
+// still running.
+func (b *QueueBroker) Heartbeat(ctx context.Context, beat QueueHeartbeat) error {
+	b.mu.Lock()
+	d, ok := b.deliveries[beat.DeliveryID]
+	b.mu.Unlock()
+	if !ok {
+		return ErrDeliveryNotFound
+	}
+
+	select {
+	case d.beats <- struct{}{}:
+	default:
+		// a beat is already waiting for the handler
+	}
+	return nil
+}
+
+// Ack settles a delivery with the outcome of its remote handler.
+func (b *QueueBroker) Ack(ctx context.Context, ack QueueAck) error {
+	b.mu.Lock()
+	d, ok := b.deliveries[ack.DeliveryID]
+	delete(b.deliveries, ack.DeliveryID)
+	b.mu.Unlock()
+	if !ok {
+		return ErrDeliveryNotFound
+	}
+
+	var err error
+	if ack.Error != "" {
+		err = errors.New(ack.Error)
+		if !ack.Retryable {
+			err = NonRetryable(err)
+		}
+	}
+	d.result <- err
+	return nil
+}
+
+// hold returns ErrQueueBrokerElsewhere unless this instance holds the lock,
+// dropping the subscriptions it took while it held it before.
+func (b *QueueBroker) hold(ctx context.Context) error {
+	if b.lock == nil {
+		return nil
+	}
+	held, err := b.lock.Held(ctx)
+	if err != nil {
+		return fmt.Errorf("checking the queue broker lock: %w", err)
+	}
+	if held {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, sub := range b.subscriptions {
+		b.dropLocked(sub)
+	}
+	return ErrQueueBrokerElsewhere
+}
+
+// subscribe returns the subscription of req, subscribing to the queue when
+// it is new or changed, and keeps it from idling out.
+func (b *QueueBroker) subscribe(ctx context.Context, req QueuePollRequest) (*brokerSubscription, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub, ok := b.subscriptions[req.SubscriptionID]
+	if ok && sub.req.Topic == req.Topic && sub.req.ProviderID == req.ProviderID && sub.req.Group == req.Group {
+		sub.idle.Reset(2 * b.maxWait)
+		return sub, nil
+	}
+	if ok {
+		b.dropLocked(sub)
+	}
+
+	sub = &brokerSubscription{
+		req:        req,
+		deliveries: make(chan *brokerDelivery),
+		gone:       make(chan struct{}),
+	}
+	var opts []SubscribeOption
+	if req.Group != "" {
+		opts = append(opts, InGroup(req.Group))
+	}
+	if err := b.queue.Subscribe(ctx, req.SubscriptionID, req.Topic, req.ProviderID, b.handler(sub), opts...); err != nil {
+		return nil, err
+	}
+	sub.idle = time.AfterFunc(2*b.maxWait, func() { b.drop(sub) })
+	b.subscriptions[req.SubscriptionID] = sub
+	return sub, nil
+}
+
+func (b *QueueBroker) drop(sub *brokerSubscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subscriptions[sub.req.SubscriptionID] == sub {
+		b.dropLocked(sub)
+	}
+}
+
+func (b *QueueBroker) dropLocked(sub *brokerSubscription) {
+	sub.idle.Stop()
+	delete(b.subscriptions, sub.req.SubscriptionID)
+	b.queue.Unsubscribe(sub.req.SubscriptionID)
+	close(sub.gone)
+}
+
+// handler offers each message to a poll of sub and waits for its ack, both
+// within ackTimeout; a heartbeat renews the lease of the message and starts
+// the timeout again.
+func (b *QueueBroker) handler(sub *brokerSubscription) MessageHandler {
+	return func(ctx context.Context, msg Message) error {
+		timer := time.NewTimer(b.ackTimeout)
+		defer timer.Stop()
+
+		d := &brokerDelivery{id: NewID(), msg: msg, result: make(chan error, 1), beats: make(chan struct{}, 1)}
+		b.mu.Lock()
+		b.deliveries[d.id] = d
+		b.mu.Unlock()
+		defer func() {
+			b.mu.Lock()
+			delete(b.deliveries, d.id)
+			b.mu.Unlock()
+		}()
+
+		select {
+		case sub.deliveries <- d:
+		case <-sub.gone:
+			return errSubscriberGone
+		case <-timer.C:
+			return errAckTimeout
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		for {
+			select {
+			case err := <-d.result:
+				return err
+			case <-d.beats:
+				if err := RenewLease(ctx); err != nil {
+					return err
+				}
+				timer.Reset(b.ackTimeout)
+			case <-timer.C:
+				return errAckTimeout
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
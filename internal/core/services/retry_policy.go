@@ -0,0 +1,137 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Metadata the queues set on every delivery, so handlers can tell a retry
+// from a first attempt.
+const (
+	// MetadataAttempt is the number of the delivery attempt, starting at 1.
+	MetadataAttempt = "attempt"
+	// MetadataLastError is the error the previous attempt failed with.
+	MetadataLastError = "lastError"
+)
+
+// RetryPolicy decides when a queue retries a message whose handler failed.
+// The n-th retry waits BaseDelay * Multiplier^(n-1), at most MaxDelay,
+// shortened by up to Jitter of itself so retries of messages that failed
+// together spread out.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	Multiplier  float64
+	// Jitter is the fraction of a delay that is random, from 0 to 1
+	Jitter float64
+	// MaxDelay caps a delay; zero means DefaultMaxRetryDelay
+	MaxDelay time.Duration
+}
+
+// DefaultMaxRetryDelay caps the delays of policies without a MaxDelay.
+const DefaultMaxRetryDelay = time.Hour
+
+// ErrNonRetryable marks a failure another attempt cannot fix.
+var ErrNonRetryable = errors.New("non-retryable")
+
+type nonRetryableError struct {
+	err error
+}
+
+func (e *nonRetryableError) Error() string { return e.err.Error() }
+
+func (e *nonRetryableError) Unwrap() []error { return []error{e.err, ErrNonRetryable} }
+
+// NonRetryable marks err as a failure another attempt cannot fix, so a
+// queue dead-letters the message at once.
+func NonRetryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &nonRetryableError{err: err}
+}
+
+// IsRetryable reports whether another attempt may succeed where err failed.
+// An album that belongs to another user or a video its manifest does not
+// list stays that way until someone changes the MediaVault.
+func IsRetryable(err error) bool {
+	return !errors.Is(err, ErrNonRetryable) &&
+		!errors.Is(err, ErrUserIDMismatch) &&
+		!errors.Is(err, ErrVideoNotInManifest)
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   time.Second,
+	Multiplier:  2,
+	Jitter:      0.2,
+	MaxDelay:    DefaultMaxRetryDelay,
+}
+
+// Exhausted reports whether a message that failed attempts times has no
+// attempts left.
+func (p RetryPolicy) Exhausted(attempts int) bool {
+	return attempts >= p.MaxAttempts
+}
+
+// Delay returns how long a message that failed attempts times waits before
+// its next attempt.
+func (p RetryPolicy) Delay(attempts int) time.Duration {
+	maxDelay := p.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = DefaultMaxRetryDelay
+	}
+	multiplier := max(p.Multiplier, 1)
+	// capped as a float, since the uncapped delay may not fit a Duration
+	delay := min(float64(p.BaseDelay)*math.Pow(multiplier, float64(attempts-1)), float64(maxDelay))
+	if p.Jitter > 0 {
+		delay -= delay * min(p.Jitter, 1) * rand.Float64()
+	}
+	return time.Duration(delay)
+}
+
+// ParseRetryPolicy parses "maxAttempts/baseDelay/multiplier/jitter" with an
+// optional "/maxDelay", for example "5/2s/2/0.2" or "5/2s/2/0.2/10m".
+func ParseRetryPolicy(s string) (RetryPolicy, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 4 && len(parts) != 5 {
+		return RetryPolicy{}, fmt.Errorf("retry policy %q: want maxAttempts/baseDelay/multiplier/jitter[/maxDelay]", s)
+	}
+
+	maxAttempts, err := strconv.Atoi(parts[0])
+	if err != nil || maxAttempts < 1 {
+		return RetryPolicy{}, fmt.Errorf("retry policy %q: invalid max attempts", s)
+	}
+	baseDelay, err := time.ParseDuration(parts[1])
+	if err != nil || baseDelay < 0 {
+		return RetryPolicy{}, fmt.Errorf("retry policy %q: invalid base delay", s)
+	}
+	multiplier, err := strconv.ParseFloat(parts[2], 64)
+	if err != nil || multiplier < 1 {
+		return RetryPolicy{}, fmt.Errorf("retry policy %q: multiplier must be at least 1", s)
+	}
+	jitter, err := strconv.ParseFloat(parts[3], 64)
+	if err != nil || jitter < 0 || jitter > 1 {
+		return RetryPolicy{}, fmt.Errorf("retry policy %q: jitter must be between 0 and 1", s)
+	}
+	maxDelay := DefaultMaxRetryDelay
+	if len(parts) == 5 {
+		maxDelay, err = time.ParseDuration(parts[4])
+		if err != nil || maxDelay < baseDelay {
+			return RetryPolicy{}, fmt.Errorf("retry policy %q: max delay must be at least the base delay", s)
+		}
+	}
+
+	return RetryPolicy{
+		MaxAttempts: maxAttempts,
+		BaseDelay:   baseDelay,
+		Multiplier:  multiplier,
+		Jitter:      jitter,
+		MaxDelay:    maxDelay,
+	}, nil
+}
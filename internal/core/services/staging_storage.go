@@ -1,9 +1,12 @@
 package services
 
-import "context"
+import (
+	"context"
+	"io"
+)
 
 type StagingStorage interface {
-	Store(ctx context.Context, key string, data []byte) error
-	Load(ctx context.Context, key string) ([]byte, error)
+	Store(ctx context.Context, key string, r io.Reader) (int64, error)
+	Load(ctx context.Context, key string) (io.ReadCloser, error)
 	Delete(ctx context.Context, key string) error
 }
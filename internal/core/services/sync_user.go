@@ -4,7 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"time"
 )
 
 type SyncUserPayload struct {
@@ -16,18 +15,13 @@ type SyncUserConsumer struct {
 	providerID         string
 	mediaVaultRegistry MediaVaultRegistry
 	cloudClient        CloudClient
-	maxRetries         int
 }
 
-func NewSyncUserConsumer(providerID string, mediaVaultRegistry MediaVaultRegistry, cloudClient CloudClient, maxRetries int) *SyncUserConsumer {
-	if maxRetries <= 0 {
-		maxRetries = 3
-	}
+func NewSyncUserConsumer(providerID string, mediaVaultRegistry MediaVaultRegistry, cloudClient CloudClient) *SyncUserConsumer {
 	return &SyncUserConsumer{
 		providerID:         providerID,
 		mediaVaultRegistry: mediaVaultRegistry,
 		cloudClient:        cloudClient,
-		maxRetries:         maxRetries,
 	}
 }
 
@@ -52,20 +46,14 @@ func (c *SyncUserConsumer) Handle(ctx context.Context, msg Message) error {
 		return nil
 	}
 
-	for attempt := 0; attempt < c.maxRetries; attempt++ {
-		err = c.cloudClient.PostUserAlbums(ctx, UserAlbumsRequest{
-			ProviderID: c.providerID,
-			DatabaseID: payload.DatabaseID,
-			UserID:     payload.UserID,
-			AlbumUIDs:  albumUIDs,
-		})
-		if err == nil {
-			break
-		}
-		if attempt == c.maxRetries-1 {
-			return fmt.Errorf("posting user albums after %d attempts: %w", c.maxRetries, err)
-		}
-		time.Sleep(time.Duration(8<<attempt) * time.Second)
+	err = c.cloudClient.PostUserAlbums(ctx, UserAlbumsRequest{
+		ProviderID: c.providerID,
+		DatabaseID: payload.DatabaseID,
+		UserID:     payload.UserID,
+		AlbumUIDs:  albumUIDs,
+	})
+	if err != nil {
+		return fmt.Errorf("posting user albums: %w", err)
 	}
 
 	return nil
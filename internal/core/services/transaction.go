@@ -0,0 +1,10 @@
+package services
+
+import "context"
+
+// Transactor runs fn as one unit of work. Repositories that support
+// transactions join it through the ctx handed to fn; an error from fn rolls
+// back every write made through that ctx.
+type Transactor interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
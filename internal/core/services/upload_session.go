@@ -0,0 +1,274 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/media-vault-sync/internal/core/domain"
+)
+
+var (
+	ErrUploadSessionNotFound = errors.New("upload session not found")
+	ErrUploadOffsetMismatch  = errors.New("upload offset mismatch")
+	ErrUploadSizeExceeded    = errors.New("upload exceeds declared size")
+	ErrUploadIncomplete      = errors.New("upload incomplete")
+)
+
+type CreateUploadSessionRequest struct {
+	ProviderID string `json:"providerID"`
+	DatabaseID string `json:"databaseID"`
+	UserID     string `json:"userID"`
+	AlbumUID   string `json:"albumUID"`
+	VideoUID   string `json:"videoUID"`
+	SizeBytes  int64  `json:"sizeBytes"`
+}
+
+// UploadSessionService implements resumable uploads: chunks are staged in the
+// blob store under uploads/{sessionID}/ and handed to VideoUploadService as
+// one stream on finalize.
+type UploadSessionService struct {
+	sessionRepo        UploadSessionRepository
+	blobStore          BlobStore
+	videoUploadService *VideoUploadService
+	clock              Clock
+	ttl                time.Duration
+}
+
+func NewUploadSessionService(
+	sessionRepo UploadSessionRepository,
+	blobStore BlobStore,
+	videoUploadService *VideoUploadService,
+	clock Clock,
+	ttl time.Duration,
+) *UploadSessionService {
+	return &UploadSessionService{
+		sessionRepo:        sessionRepo,
+		blobStore:          blobStore,
+		videoUploadService: videoUploadService,
+		clock:              clock,
+		ttl:                ttl,
+	}
+}
+
+func (s *UploadSessionService) Create(ctx context.Context, req CreateUploadSessionRequest) (*domain.UploadSession, error) {
+	if req.SizeBytes < 0 {
+		return nil, fmt.Errorf("invalid size %d", req.SizeBytes)
+	}
+
+	now := s.clock.Now()
+	session := &domain.UploadSession{
+		ID:         NewID(),
+		ProviderID: req.ProviderID,
+		DatabaseID: req.DatabaseID,
+		UserID:     req.UserID,
+		AlbumUID:   req.AlbumUID,
+		VideoUID:   req.VideoUID,
+		SizeBytes:  req.SizeBytes,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if err := s.sessionRepo.Create(ctx, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (s *UploadSessionService) Status(ctx context.Context, id string) (*domain.UploadSession, error) {
+	session, err := s.sessionRepo.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
+		return nil, ErrUploadSessionNotFound
+	}
+	return session, nil
+}
+
+// PutChunk appends a chunk at offset, which must equal the acknowledged
+// offset. On ErrUploadOffsetMismatch the returned session carries the offset
+// the client should resume from.
+func (s *UploadSessionService) PutChunk(ctx context.Context, id string, offset int64, r io.Reader) (*domain.UploadSession, error) {
+	session, err := s.Status(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if offset != session.Offset {
+		return session, ErrUploadOffsetMismatch
+	}
+
+	// read at most one byte past the declared size to detect an oversized chunk
+	remaining := session.SizeBytes - offset
+	key := chunkKey(id, offset)
+	n, err := s.blobStore.Put(ctx, key, io.LimitReader(r, remaining+1))
+	if err != nil {
+		return nil, fmt.Errorf("staging chunk: %w", err)
+	}
+	if n > remaining {
+		s.blobStore.Delete(ctx, key)
+		return session, ErrUploadSizeExceeded
+	}
+
+	updated, err := s.sessionRepo.UpdateOffset(ctx, id, offset, offset+n, s.clock.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !updated {
+		// another request for the same offset won the race
+		return s.Status(ctx, id)
+	}
+
+	session.Offset = offset + n
+	session.UpdatedAt = s.clock.Now()
+	return session, nil
+}
+
+// Finalize streams the staged chunks into VideoUploadService, which verifies
+// the checksum before recording the object. The session is removed unless the
+// upload is incomplete, so a checksum mismatch requires a new session.
+func (s *UploadSessionService) Finalize(ctx context.Context, id string, checksum string) error {
+	session, err := s.Status(ctx, id)
+	if err != nil {
+		return err
+	}
+	if session.Offset != session.SizeBytes {
+		return fmt.Errorf("%w: %d of %d bytes received", ErrUploadIncomplete, session.Offset, session.SizeBytes)
+	}
+
+	keys, err := s.chunkKeys(ctx, session)
+	if err != nil {
+		return err
+	}
+
+	body := &chunkReader{ctx: ctx, blobStore: s.blobStore, keys: keys}
+	err = s.videoUploadService.ProcessVideoUpload(ctx, VideoUploadRequest{
+		ProviderID:       session.ProviderID,
+		DatabaseID:       session.DatabaseID,
+		UserID:           session.UserID,
+		AlbumUID:         session.AlbumUID,
+		VideoUID:         session.VideoUID,
+		Body:             body,
+		ExpectedChecksum: checksum,
+	})
+	body.Close()
+	if err != nil && !errors.Is(err, ErrChecksumMismatch) && !errors.Is(err, ErrVideoNotInManifest) {
+		return err
+	}
+
+	if cleanupErr := s.remove(ctx, session); cleanupErr != nil {
+		return cleanupErr
+	}
+	return err
+}
+
+// ExpireStale removes sessions that saw no activity for longer than the TTL.
+func (s *UploadSessionService) ExpireStale(ctx context.Context) (int, error) {
+	sessions, err := s.sessionRepo.FindStale(ctx, s.clock.Now().Add(-s.ttl))
+	if err != nil {
+		return 0, err
+	}
+
+	for i, session := range sessions {
+		if err := s.remove(ctx, session); err != nil {
+			return i, err
+		}
+	}
+	return len(sessions), nil
+}
+
+func (s *UploadSessionService) remove(ctx context.Context, session *domain.UploadSession) error {
+	chunks, err := s.blobStore.List(ctx, chunkPrefix(session.ID))
+	if err != nil {
+		return err
+	}
+	for _, chunk := range chunks {
+		if err := s.blobStore.Delete(ctx, chunk.Key); err != nil {
+			return err
+		}
+	}
+	return s.sessionRepo.Delete(ctx, session.ID)
+}
+
+// chunkKeys returns the acknowledged chunks in order and checks that they
+// cover [0, Offset) without gaps.
+func (s *UploadSessionService) chunkKeys(ctx context.Context, session *domain.UploadSession) ([]string, error) {
+	chunks, err := s.blobStore.List(ctx, chunkPrefix(session.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	var next int64
+	for _, chunk := range chunks {
+		offset, err := strconv.ParseInt(strings.TrimPrefix(chunk.Key, chunkPrefix(session.ID)), 10, 64)
+		if err != nil || offset >= session.Offset {
+			// leftovers of a chunk that was never acknowledged
+			continue
+		}
+		if offset != next {
+			return nil, fmt.Errorf("%w: missing chunk at offset %d", ErrUploadIncomplete, next)
+		}
+		keys = append(keys, chunk.Key)
+		next += chunk.SizeBytes
+	}
+	if next != session.Offset {
+		return nil, fmt.Errorf("%w: missing chunk at offset %d", ErrUploadIncomplete, next)
+	}
+	return keys, nil
+}
+
+func chunkPrefix(sessionID string) string {
+	return "uploads/" + sessionID + "/"
+}
+
+// offsets are zero-padded so listing returns chunks in upload order
+func chunkKey(sessionID string, offset int64) string {
+	return fmt.Sprintf("%s%020d", chunkPrefix(sessionID), offset)
+}
+
+// chunkReader opens one chunk at a time so finalize never holds more than a
+// single chunk open.
+type chunkReader struct {
+	ctx       context.Context
+	blobStore BlobStore
+	keys      []string
+	current   io.ReadCloser
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.keys) == 0 {
+				return 0, io.EOF
+			}
+			body, err := r.blobStore.Get(r.ctx, r.keys[0])
+			if err != nil {
+				return 0, fmt.Errorf("reading chunk %s: %w", r.keys[0], err)
+			}
+			r.current = body
+			r.keys = r.keys[1:]
+		}
+
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			r.current.Close()
+			r.current = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (r *chunkReader) Close() error {
+	if r.current != nil {
+		return r.current.Close()
+	}
+	return nil
+}
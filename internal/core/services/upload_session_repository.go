@@ -0,0 +1,18 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/media-vault-sync/internal/core/domain"
+)
+
+type UploadSessionRepository interface {
+	Create(ctx context.Context, session *domain.UploadSession) error
+	FindByID(ctx context.Context, id string) (*domain.UploadSession, error)
+	// UpdateOffset moves the offset only if it still equals expectedOffset and
+	// reports whether it did.
+	UpdateOffset(ctx context.Context, id string, expectedOffset, newOffset int64, updatedAt time.Time) (bool, error)
+	Delete(ctx context.Context, id string) error
+	FindStale(ctx context.Context, updatedBefore time.Time) ([]*domain.UploadSession, error)
+}
@@ -12,9 +12,11 @@ type UserAlbumsRequest struct {
 	AlbumUIDs  []string `json:"albumUIDs"`
 }
 
+// Source is passed on to the manifest upload and recorded on its revision.
 type AlbumManifestUploadPayload struct {
 	DatabaseID string `json:"databaseID"`
 	AlbumUID   string `json:"albumUID"`
+	Source     string `json:"source,omitempty"`
 }
 
 type UserAlbumsService struct {
@@ -44,6 +46,7 @@ func (s *UserAlbumsService) ProcessUserAlbums(ctx context.Context, req UserAlbum
 		payload, err := json.Marshal(AlbumManifestUploadPayload{
 			DatabaseID: req.DatabaseID,
 			AlbumUID:   albumUID,
+			Source:     ManifestSourceUserSync,
 		})
 		if err != nil {
 			return err
@@ -53,7 +56,8 @@ func (s *UserAlbumsService) ProcessUserAlbums(ctx context.Context, req UserAlbum
 			Topic:   "albummanifestupload",
 			Payload: payload,
 			Metadata: map[string]string{
-				"providerID": req.ProviderID,
+				"providerID":        req.ProviderID,
+				MetadataOrderingKey: AlbumOrderingKey(req.ProviderID, req.DatabaseID, albumUID),
 			},
 		})
 		if err != nil {
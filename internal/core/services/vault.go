@@ -7,6 +7,8 @@ type MediaVault interface {
 	ListVideoUIDs(ctx context.Context, albumUID string) ([]string, error)
 	GetUserIDForAlbum(ctx context.Context, albumUID string) (string, error)
 	CMove(ctx context.Context, albumUID string) error
+	// CMoveVideos sends only the listed videos of the album.
+	CMoveVideos(ctx context.Context, albumUID string, videoUIDs []string) error
 }
 
 type MediaVaultRegistry interface {
@@ -2,11 +2,27 @@ package services
 
 import (
 	"context"
+	"time"
 
 	"github.com/media-vault-sync/internal/core/domain"
 )
 
+// VideoFilter selects videos of one provider database, ordered by VideoUID.
+// Zero values leave a criterion out; UpdatedSince is inclusive and
+// UpdatedBefore exclusive.
+type VideoFilter struct {
+	ProviderID    string
+	DatabaseID    string
+	UserID        string
+	UpdatedSince  time.Time
+	UpdatedBefore time.Time
+	// keyset cursor: only videos sorting after this one
+	AfterVideoUID string
+	Limit         int
+}
+
 type VideoRepository interface {
 	Upsert(ctx context.Context, video *domain.Video) error
 	FindByVideoUID(ctx context.Context, providerID, databaseID, videoUID string) (*domain.Video, error)
+	List(ctx context.Context, filter VideoFilter) ([]*domain.Video, error)
 }
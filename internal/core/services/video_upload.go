@@ -6,19 +6,27 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
+	"strings"
+	"time"
 
 	"github.com/media-vault-sync/internal/core/domain"
 )
 
-var ErrVideoNotInManifest = errors.New("video not in manifest")
+var (
+	ErrVideoNotInManifest = errors.New("video not in manifest")
+	ErrChecksumMismatch   = errors.New("checksum mismatch")
+)
 
 type VideoUploadRequest struct {
-	ProviderID string `json:"providerID"`
-	DatabaseID string `json:"databaseID"`
-	UserID     string `json:"userID"`
-	AlbumUID   string `json:"albumUID"`
-	VideoUID   string `json:"videoUID"`
-	Data       []byte `json:"-"`
+	ProviderID string    `json:"providerID"`
+	DatabaseID string    `json:"databaseID"`
+	UserID     string    `json:"userID"`
+	AlbumUID   string    `json:"albumUID"`
+	VideoUID   string    `json:"videoUID"`
+	Body       io.Reader `json:"-"`
+	// ExpectedChecksum, when set, is the hex SHA-256 the body must hash to
+	ExpectedChecksum string `json:"-"`
 }
 
 type VideoUploadService struct {
@@ -26,6 +34,7 @@ type VideoUploadService struct {
 	albumVideoRepo AlbumVideoRepository
 	videoRepo      VideoRepository
 	objectRepo     ObjectRepository
+	blobStore      BlobStore
 	clock          Clock
 }
 
@@ -34,6 +43,7 @@ func NewVideoUploadService(
 	albumVideoRepo AlbumVideoRepository,
 	videoRepo VideoRepository,
 	objectRepo ObjectRepository,
+	blobStore BlobStore,
 	clock Clock,
 ) *VideoUploadService {
 	return &VideoUploadService{
@@ -41,21 +51,133 @@ func NewVideoUploadService(
 		albumVideoRepo: albumVideoRepo,
 		videoRepo:      videoRepo,
 		objectRepo:     objectRepo,
+		blobStore:      blobStore,
 		clock:          clock,
 	}
 }
 
+// ContentStorageKey is where a blob with the given hex SHA-256 lives. Content
+// is stored once per checksum; each object version pointing at it counts as
+// a reference.
+func ContentStorageKey(checksum string) string {
+	return "blobs/sha256/" + checksum
+}
+
+// VideoReferenceRequest asks the cloud to record a video whose content it
+// may already hold, so that the bytes do not have to be sent again.
+type VideoReferenceRequest struct {
+	ProviderID string `json:"providerID"`
+	DatabaseID string `json:"databaseID"`
+	UserID     string `json:"userID"`
+	AlbumUID   string `json:"albumUID"`
+	VideoUID   string `json:"videoUID"`
+	Checksum   string `json:"checksum"`
+}
+
 func (s *VideoUploadService) ProcessVideoUpload(ctx context.Context, req VideoUploadRequest) error {
-	inManifest, err := s.albumVideoRepo.Exists(ctx, req.ProviderID, req.DatabaseID, req.AlbumUID, req.VideoUID)
+	if err := s.checkManifest(ctx, req.ProviderID, req.DatabaseID, req.AlbumUID, req.VideoUID); err != nil {
+		return err
+	}
+
+	now := s.clock.Now()
+	if err := s.upsertVideo(ctx, req.ProviderID, req.DatabaseID, req.UserID, req.VideoUID, now); err != nil {
+		return err
+	}
+
+	// the checksum is only known once the body has been read, so the content
+	// lands under a temporary key first and is moved to its address afterwards.
+	// It is hashed while it streams into the blob store, so only one buffer is
+	// in memory at a time.
+	incomingKey := "uploads/incoming/" + NewID()
+	body := req.Body
+	if body == nil {
+		body = strings.NewReader("")
+	}
+	hasher := sha256.New()
+	size, err := s.blobStore.Put(ctx, incomingKey, io.TeeReader(body, hasher))
+	if err != nil {
+		return fmt.Errorf("storing video content: %w", err)
+	}
+	checksum := hex.EncodeToString(hasher.Sum(nil))
+
+	if req.ExpectedChecksum != "" && req.ExpectedChecksum != checksum {
+		if err := s.blobStore.Delete(ctx, incomingKey); err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: expected %s, got %s", ErrChecksumMismatch, req.ExpectedChecksum, checksum)
+	}
+
+	// the version is recorded before the blob is checked: from then on the
+	// garbage collector keeps the blob, and one it deleted before is put back
+	contentKey := ContentStorageKey(checksum)
+	if err := s.addVersion(ctx, req.ProviderID, req.DatabaseID, req.VideoUID, contentKey, size, checksum, now); err != nil {
+		s.blobStore.Delete(ctx, incomingKey)
+		return err
+	}
+
+	_, err = s.blobStore.Head(ctx, contentKey)
+	switch {
+	case err == nil:
+		// another version already holds these bytes
+		return s.blobStore.Delete(ctx, incomingKey)
+	case errors.Is(err, ErrBlobNotFound):
+		if err := s.blobStore.Move(ctx, incomingKey, contentKey); err != nil {
+			return fmt.Errorf("storing video content: %w", err)
+		}
+		return nil
+	default:
+		s.blobStore.Delete(ctx, incomingKey)
+		return err
+	}
+}
+
+// ProcessVideoReference records a new version of a video from content the
+// cloud already stores. It returns ErrBlobNotFound when no blob has the
+// checksum, in which case the caller has to upload the bytes.
+func (s *VideoUploadService) ProcessVideoReference(ctx context.Context, req VideoReferenceRequest) error {
+	if err := s.checkManifest(ctx, req.ProviderID, req.DatabaseID, req.AlbumUID, req.VideoUID); err != nil {
+		return err
+	}
+
+	contentKey := ContentStorageKey(req.Checksum)
+	info, err := s.blobStore.Head(ctx, contentKey)
 	if err != nil {
 		return err
 	}
 
-	if !inManifest {
-		album, err := s.albumRepo.FindByAlbumUID(ctx, req.ProviderID, req.DatabaseID, req.AlbumUID)
+	now := s.clock.Now()
+	if err := s.upsertVideo(ctx, req.ProviderID, req.DatabaseID, req.UserID, req.VideoUID, now); err != nil {
+		return err
+	}
+
+	if err := s.addVersion(ctx, req.ProviderID, req.DatabaseID, req.VideoUID, contentKey, info.SizeBytes, req.Checksum, now); err != nil {
+		return err
+	}
+
+	// the garbage collector may have deleted the blob before the version
+	// referenced it; uploading the bytes puts it back
+	_, err = s.blobStore.Head(ctx, contentKey)
+	return err
+}
+
+// checkManifest returns ErrVideoNotInManifest for a video the album does not
+// list, and flags the album as out of sync when that happens. The check is
+// repeated if a concurrent manifest upload changes the album meanwhile.
+func (s *VideoUploadService) checkManifest(ctx context.Context, providerID, databaseID, albumUID, videoUID string) error {
+	return retryOnAlbumConflict(func() error {
+		album, err := s.albumRepo.FindByAlbumUID(ctx, providerID, databaseID, albumUID)
+		if err != nil {
+			return err
+		}
+
+		inManifest, err := s.albumVideoRepo.Exists(ctx, providerID, databaseID, albumUID, videoUID)
 		if err != nil {
 			return err
 		}
+		if inManifest {
+			return nil
+		}
+
 		if album != nil {
 			album.Synced = false
 			album.UpdatedAt = s.clock.Now()
@@ -64,42 +186,56 @@ func (s *VideoUploadService) ProcessVideoUpload(ctx context.Context, req VideoUp
 			}
 		}
 		return ErrVideoNotInManifest
-	}
-
-	now := s.clock.Now()
+	})
+}
 
+func (s *VideoUploadService) upsertVideo(ctx context.Context, providerID, databaseID, userID, videoUID string, now time.Time) error {
 	// this entity includes more metadata, like the userID
 	video := &domain.Video{
-		UID:        fmt.Sprintf("%s-%s-%s", req.ProviderID, req.DatabaseID, req.VideoUID),
-		ProviderID: req.ProviderID,
-		DatabaseID: req.DatabaseID,
-		UserID:     req.UserID,
-		VideoUID:   req.VideoUID,
+		UID:        fmt.Sprintf("%s-%s-%s", providerID, databaseID, videoUID),
+		ProviderID: providerID,
+		DatabaseID: databaseID,
+		UserID:     userID,
+		VideoUID:   videoUID,
 		CreatedAt:  now,
 		UpdatedAt:  now,
 	}
-	if err := s.videoRepo.Upsert(ctx, video); err != nil {
-		return err
-	}
+	return s.videoRepo.Upsert(ctx, video)
+}
 
-	// hashing can be expensive if we have too many big files
-	hash := sha256.Sum256(req.Data)
-	checksum := hex.EncodeToString(hash[:])
-	storageKey := fmt.Sprintf("objects/%s/%s/%s", req.ProviderID, req.DatabaseID, req.VideoUID)
-	// TODO: upload the data to a Blob Storage and bind it to the storageKey
-	// If the key changed, we should also delete the previous key before uploading the new one
-	// Enhancement: make the object versioned for auditability
-
-	// this entity includes storage details like the storageKey
-	object := &domain.Object{
-		UID:        fmt.Sprintf("%s-%s-%s-obj", req.ProviderID, req.DatabaseID, req.VideoUID),
-		ProviderID: req.ProviderID,
-		DatabaseID: req.DatabaseID,
-		VideoUID:   req.VideoUID,
-		StorageKey: storageKey,
-		SizeBytes:  int64(len(req.Data)),
-		Checksum:   checksum,
-		CreatedAt:  now,
+// objectVersionConflictAttempts bounds how often a version is added again
+// after a concurrent upload of the same video got in the way.
+const objectVersionConflictAttempts = 5
+
+// addVersion stores the content as the new current version of the video,
+// unless the current version already holds it (e.g. a retry).
+func (s *VideoUploadService) addVersion(ctx context.Context, providerID, databaseID, videoUID, storageKey string, size int64, checksum string, now time.Time) error {
+	var err error
+	for attempt := 0; attempt < objectVersionConflictAttempts; attempt++ {
+		var current *domain.Object
+		current, err = s.objectRepo.FindByVideoUID(ctx, providerID, databaseID, videoUID)
+		if err != nil {
+			return err
+		}
+		if current != nil && current.PurgedAt == nil && current.Checksum == checksum {
+			return nil
+		}
+
+		// this entity includes storage details like the storageKey; the
+		// repository numbers the version
+		err = s.objectRepo.AddVersion(ctx, &domain.Object{
+			UID:        NewID(),
+			ProviderID: providerID,
+			DatabaseID: databaseID,
+			VideoUID:   videoUID,
+			StorageKey: storageKey,
+			SizeBytes:  size,
+			Checksum:   checksum,
+			CreatedAt:  now,
+		})
+		if !errors.Is(err, ErrObjectVersionConflict) {
+			return err
+		}
 	}
-	return s.objectRepo.Upsert(ctx, object)
+	return err
 }
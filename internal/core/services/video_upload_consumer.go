@@ -25,5 +25,8 @@ func (c *VideoUploadConsumer) Handle(ctx context.Context, msg Message) error {
 		return fmt.Errorf("getting MediaVault for database %s: %w", payload.DatabaseID, err)
 	}
 
+	if len(payload.VideoUIDs) > 0 {
+		return mediaVault.CMoveVideos(ctx, payload.AlbumUID, payload.VideoUIDs)
+	}
 	return mediaVault.CMove(ctx, payload.AlbumUID)
 }
@@ -0,0 +1,18 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS queue_messages (
+    id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    message_id VARCHAR(255) NOT NULL DEFAULT '',
+    topic VARCHAR(255) NOT NULL,
+    provider_id VARCHAR(255) NOT NULL DEFAULT '',
+    payload LONGBLOB NOT NULL,
+    metadata TEXT NOT NULL,
+    deliver_at DATETIME(6) NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    lease_owner VARCHAR(255) NULL,
+    lease_expires_at DATETIME(6) NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_ready (topic, provider_id, deliver_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- +migrate Down
+DROP TABLE IF EXISTS queue_messages;
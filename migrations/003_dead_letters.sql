@@ -0,0 +1,16 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS dead_letters (
+    id VARCHAR(64) NOT NULL PRIMARY KEY,
+    message_id VARCHAR(255) NOT NULL DEFAULT '',
+    topic VARCHAR(255) NOT NULL,
+    provider_id VARCHAR(255) NOT NULL DEFAULT '',
+    payload LONGBLOB NOT NULL,
+    metadata TEXT NOT NULL,
+    attempts INT NOT NULL,
+    last_error TEXT NOT NULL,
+    created_at DATETIME(6) NOT NULL,
+    INDEX idx_dead_letter_lookup (topic, provider_id, created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- +migrate Down
+DROP TABLE IF EXISTS dead_letters;
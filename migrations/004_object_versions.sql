@@ -0,0 +1,17 @@
+-- +migrate Up
+ALTER TABLE objects
+    ADD COLUMN version INT NOT NULL DEFAULT 1 AFTER video_uid,
+    ADD COLUMN superseded_at DATETIME(6) NULL,
+    ADD COLUMN purged_at DATETIME(6) NULL,
+    DROP INDEX uk_object,
+    ADD UNIQUE KEY uk_object_version (provider_id, database_id, video_uid, version),
+    ADD INDEX idx_superseded (superseded_at, purged_at);
+
+-- +migrate Down
+ALTER TABLE objects
+    DROP INDEX idx_superseded,
+    DROP INDEX uk_object_version,
+    DROP COLUMN purged_at,
+    DROP COLUMN superseded_at,
+    DROP COLUMN version,
+    ADD UNIQUE KEY uk_object (provider_id, database_id, video_uid);
@@ -0,0 +1,17 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS upload_sessions (
+    id VARCHAR(64) NOT NULL PRIMARY KEY,
+    provider_id VARCHAR(255) NOT NULL,
+    database_id VARCHAR(255) NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    album_uid VARCHAR(255) NOT NULL,
+    video_uid VARCHAR(255) NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    offset_bytes BIGINT NOT NULL DEFAULT 0,
+    created_at DATETIME(6) NOT NULL,
+    updated_at DATETIME(6) NOT NULL,
+    INDEX idx_updated (updated_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- +migrate Down
+DROP TABLE IF EXISTS upload_sessions;
@@ -0,0 +1,5 @@
+-- +migrate Up
+CREATE INDEX idx_storage_key ON objects (storage_key(255));
+
+-- +migrate Down
+DROP INDEX idx_storage_key ON objects;
@@ -0,0 +1,7 @@
+-- +migrate Up
+CREATE INDEX idx_album_user ON albums (user_id, provider_id, database_id);
+CREATE INDEX idx_video_user ON videos (user_id, provider_id, database_id);
+
+-- +migrate Down
+DROP INDEX idx_video_user ON videos;
+DROP INDEX idx_album_user ON albums;
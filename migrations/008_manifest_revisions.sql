@@ -0,0 +1,14 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS manifest_revisions (
+    uid VARCHAR(64) NOT NULL PRIMARY KEY,
+    provider_id VARCHAR(255) NOT NULL,
+    database_id VARCHAR(255) NOT NULL,
+    album_uid VARCHAR(255) NOT NULL,
+    added TEXT NOT NULL,
+    removed TEXT NOT NULL,
+    created_at DATETIME(6) NOT NULL,
+    INDEX idx_manifest_revision_album (provider_id, database_id, album_uid)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- +migrate Down
+DROP TABLE IF EXISTS manifest_revisions;
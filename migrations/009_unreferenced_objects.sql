@@ -0,0 +1,13 @@
+-- +migrate Up
+ALTER TABLE objects
+    ADD COLUMN unreferenced_at DATETIME(6) NULL,
+    ADD INDEX idx_unreferenced (unreferenced_at, purged_at);
+
+CREATE INDEX idx_album_video_video ON album_videos (provider_id, database_id, video_uid);
+
+-- +migrate Down
+DROP INDEX idx_album_video_video ON album_videos;
+
+ALTER TABLE objects
+    DROP INDEX idx_unreferenced,
+    DROP COLUMN unreferenced_at;
@@ -0,0 +1,22 @@
+-- +migrate Up
+ALTER TABLE manifest_revisions
+    ADD COLUMN revision INT NOT NULL DEFAULT 0 AFTER album_uid,
+    ADD COLUMN source VARCHAR(64) NOT NULL DEFAULT '' AFTER revision;
+
+UPDATE manifest_revisions mr
+JOIN (
+    SELECT uid, ROW_NUMBER() OVER (PARTITION BY provider_id, database_id, album_uid ORDER BY created_at, uid) AS revision
+    FROM manifest_revisions
+) numbered ON numbered.uid = mr.uid
+SET mr.revision = numbered.revision;
+
+ALTER TABLE manifest_revisions
+    DROP INDEX idx_manifest_revision_album,
+    ADD UNIQUE KEY uk_manifest_revision (provider_id, database_id, album_uid, revision);
+
+-- +migrate Down
+ALTER TABLE manifest_revisions
+    DROP INDEX uk_manifest_revision,
+    ADD INDEX idx_manifest_revision_album (provider_id, database_id, album_uid),
+    DROP COLUMN source,
+    DROP COLUMN revision;
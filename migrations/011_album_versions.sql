@@ -0,0 +1,7 @@
+-- +migrate Up
+ALTER TABLE albums
+    ADD COLUMN version INT NOT NULL DEFAULT 1 AFTER synced;
+
+-- +migrate Down
+ALTER TABLE albums
+    DROP COLUMN version;
@@ -0,0 +1,15 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS outbox_messages (
+    seq BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    id VARCHAR(64) NOT NULL,
+    message_id VARCHAR(255) NOT NULL DEFAULT '',
+    topic VARCHAR(255) NOT NULL,
+    payload LONGBLOB NOT NULL,
+    metadata TEXT NOT NULL,
+    deliver_at DATETIME(6) NULL,
+    created_at DATETIME(6) NOT NULL,
+    UNIQUE KEY uk_outbox_id (id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- +migrate Down
+DROP TABLE IF EXISTS outbox_messages;
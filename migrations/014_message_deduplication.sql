@@ -0,0 +1,18 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS queue_message_ids (
+    message_id VARCHAR(255) NOT NULL PRIMARY KEY,
+    published_at DATETIME(6) NOT NULL,
+    INDEX idx_published (published_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS processed_messages (
+    consumer VARCHAR(255) NOT NULL,
+    message_id VARCHAR(255) NOT NULL,
+    processed_at DATETIME(6) NOT NULL,
+    PRIMARY KEY (consumer, message_id),
+    INDEX idx_processed (processed_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- +migrate Down
+DROP TABLE IF EXISTS processed_messages;
+DROP TABLE IF EXISTS queue_message_ids;
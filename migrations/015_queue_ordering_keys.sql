@@ -0,0 +1,9 @@
+-- +migrate Up
+ALTER TABLE queue_messages
+    ADD COLUMN ordering_key VARCHAR(255) NULL AFTER provider_id,
+    ADD INDEX idx_ordering (topic, ordering_key, id);
+
+-- +migrate Down
+ALTER TABLE queue_messages
+    DROP INDEX idx_ordering,
+    DROP COLUMN ordering_key;
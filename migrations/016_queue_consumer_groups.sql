@@ -0,0 +1,21 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS queue_consumer_groups (
+    topic VARCHAR(255) NOT NULL,
+    provider_id VARCHAR(255) NOT NULL DEFAULT '',
+    consumer_group VARCHAR(255) NOT NULL,
+    created_at DATETIME(6) NOT NULL,
+    PRIMARY KEY (topic, provider_id, consumer_group)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+ALTER TABLE queue_messages
+    ADD COLUMN consumer_group VARCHAR(255) NOT NULL DEFAULT '' AFTER provider_id,
+    DROP INDEX idx_ordering,
+    ADD INDEX idx_ordering (topic, consumer_group, ordering_key, id);
+
+-- +migrate Down
+ALTER TABLE queue_messages
+    DROP INDEX idx_ordering,
+    ADD INDEX idx_ordering (topic, ordering_key, id),
+    DROP COLUMN consumer_group;
+
+DROP TABLE IF EXISTS queue_consumer_groups;
@@ -0,0 +1,11 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS album_redrives (
+    provider_id VARCHAR(255) NOT NULL,
+    database_id VARCHAR(255) NOT NULL,
+    album_uid VARCHAR(255) NOT NULL,
+    redriven_at DATETIME(6) NOT NULL,
+    PRIMARY KEY (provider_id, database_id, album_uid)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- +migrate Down
+DROP TABLE IF EXISTS album_redrives;
@@ -0,0 +1,8 @@
+package migrations
+
+import "embed"
+
+// Files holds the SQL migrations so binaries can apply the schema at startup.
+//
+//go:embed *.sql
+var Files embed.FS
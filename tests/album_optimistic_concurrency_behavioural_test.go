@@ -0,0 +1,311 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/media-vault-sync/internal/adapters/queue/memory"
+	memoryrepo "github.com/media-vault-sync/internal/adapters/repo/memory"
+	memorystorage "github.com/media-vault-sync/internal/adapters/storage/memory"
+	"github.com/media-vault-sync/internal/core/domain"
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+// interleavingAlbumRepo runs beforeUpdate once, just before the first Update
+// reaches the repository, to simulate a writer racing the caller.
+type interleavingAlbumRepo struct {
+	services.AlbumRepository
+	beforeUpdate func()
+}
+
+func (r *interleavingAlbumRepo) Update(ctx context.Context, album *domain.Album) error {
+	if r.beforeUpdate != nil {
+		race := r.beforeUpdate
+		r.beforeUpdate = nil
+		race()
+	}
+	return r.AlbumRepository.Update(ctx, album)
+}
+
+// raceAlbumUpdates checks the compare-and-swap contract of an AlbumRepository
+// under concurrent writers.
+func raceAlbumUpdates(t *testing.T, ctx context.Context, repo services.AlbumRepository, albumUID string) {
+	t.Helper()
+	const writers = 8
+
+	now := time.Now().UTC().Truncate(time.Second)
+	album := &domain.Album{
+		UID:        "race-" + albumUID,
+		ProviderID: "p1",
+		DatabaseID: "db1",
+		UserID:     "user1",
+		AlbumUID:   albumUID,
+		Synced:     true,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if err := repo.Create(ctx, album); err != nil || album.Version != 1 {
+		t.Fatalf("expected the album created at version 1, got %d (%v)", album.Version, err)
+	}
+	stale := *album
+	if err := repo.Create(ctx, &stale); !errors.Is(err, services.ErrAlbumConflict) {
+		t.Fatalf("creating an existing album should conflict, got %v", err)
+	}
+
+	// every writer holds the same version; exactly one may win
+	var wg sync.WaitGroup
+	errs := make([]error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			copy := *album
+			copy.Synced = i%2 == 0
+			errs[i] = repo.Update(ctx, &copy)
+		}(i)
+	}
+	wg.Wait()
+
+	won := 0
+	for _, err := range errs {
+		var conflict *services.AlbumConflictError
+		switch {
+		case err == nil:
+			won++
+		case errors.As(err, &conflict):
+			if conflict.AlbumUID != albumUID || conflict.Version != 1 {
+				t.Errorf("unexpected conflict details: %+v", conflict)
+			}
+		default:
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if won != 1 {
+		t.Fatalf("expected exactly one write from version 1 to win, got %d", won)
+	}
+
+	// writers that re-read on conflict all get through, one after the other
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				current, err := repo.FindByAlbumUID(ctx, "p1", "db1", albumUID)
+				if err != nil {
+					t.Errorf("read failed: %v", err)
+					return
+				}
+				current.UpdatedAt = current.UpdatedAt.Add(time.Second)
+				err = repo.Update(ctx, current)
+				if err == nil {
+					return
+				}
+				if !errors.Is(err, services.ErrAlbumConflict) {
+					t.Errorf("update failed: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	final, _ := repo.FindByAlbumUID(ctx, "p1", "db1", albumUID)
+	if final.Version != 2+writers {
+		t.Errorf("expected version %d after every write, got %d", 2+writers, final.Version)
+	}
+	if !final.UpdatedAt.Equal(now.Add(writers * time.Second)) {
+		t.Errorf("an update was lost: updatedAt %v", final.UpdatedAt)
+	}
+}
+
+func TestAlbumOptimisticConcurrency_MemoryRepositoryComparesVersions(t *testing.T) {
+	raceAlbumUpdates(t, context.Background(), memoryrepo.NewAlbumRepository(), "album1")
+}
+
+type albumRaceHarness struct {
+	albumRepo      *interleavingAlbumRepo
+	albumVideoRepo *memoryrepo.AlbumVideoRepository
+	revisionRepo   *memoryrepo.ManifestRevisionRepository
+	queue          *memory.InMemoryQueue
+	manifests      *services.AlbumManifestUploadService
+	videos         *services.VideoUploadService
+}
+
+func newAlbumRaceHarness(t *testing.T, synced bool, videoUIDs ...string) *albumRaceHarness {
+	t.Helper()
+	clock := services.NewFakeClock(time.Now())
+	h := &albumRaceHarness{
+		albumRepo:      &interleavingAlbumRepo{AlbumRepository: memoryrepo.NewAlbumRepository()},
+		albumVideoRepo: memoryrepo.NewAlbumVideoRepository(),
+		revisionRepo:   memoryrepo.NewManifestRevisionRepository(),
+		queue:          memory.NewInMemoryQueue(clock),
+	}
+	objectRepo := memoryrepo.NewObjectRepository()
+	h.manifests = services.NewAlbumManifestUploadService(h.albumRepo, h.albumVideoRepo, h.revisionRepo, objectRepo, memoryrepo.NewTransactor(), h.queue, clock)
+	h.videos = services.NewVideoUploadService(h.albumRepo, h.albumVideoRepo, memoryrepo.NewVideoRepository(), objectRepo, memorystorage.NewBlobStore(), clock)
+
+	h.upload(t, videoUIDs...)
+	if !synced {
+		h.setSynced(t, false)
+	}
+	return h
+}
+
+func (h *albumRaceHarness) upload(t *testing.T, videoUIDs ...string) {
+	t.Helper()
+	if err := h.manifests.ProcessAlbumManifestUpload(context.Background(), services.AlbumManifestUploadRequest{
+		ProviderID: "p1",
+		DatabaseID: "db1",
+		UserID:     "user1",
+		AlbumUID:   "album1",
+		VideoUIDs:  videoUIDs,
+	}); err != nil {
+		t.Fatalf("manifest upload failed: %v", err)
+	}
+}
+
+func (h *albumRaceHarness) album(t *testing.T) *domain.Album {
+	t.Helper()
+	album, err := h.albumRepo.FindByAlbumUID(context.Background(), "p1", "db1", "album1")
+	if err != nil || album == nil {
+		t.Fatalf("album1 not found: %v", err)
+	}
+	return album
+}
+
+// setSynced writes past the interleaving hook, like a concurrent writer would.
+func (h *albumRaceHarness) setSynced(t *testing.T, synced bool) {
+	t.Helper()
+	album := h.album(t)
+	album.Synced = synced
+	if err := h.albumRepo.AlbumRepository.Update(context.Background(), album); err != nil {
+		t.Fatalf("racing write failed: %v", err)
+	}
+}
+
+func (h *albumRaceHarness) manifest(t *testing.T) string {
+	t.Helper()
+	videos, err := h.albumVideoRepo.FindByAlbumUID(context.Background(), "p1", "db1", "album1")
+	if err != nil {
+		t.Fatalf("failed to read manifest: %v", err)
+	}
+	videoUIDs := make([]string, len(videos))
+	for i, video := range videos {
+		videoUIDs[i] = video.VideoUID
+	}
+	return strings.Join(videoUIDs, ",")
+}
+
+func TestAlbumOptimisticConcurrency_ServicesRetryLostRaces(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("a manifest upload keeps an album flagged while it was in flight", func(t *testing.T) {
+		h := newAlbumRaceHarness(t, true, "v1", "v2")
+		var published []string
+		h.queue.Subscribe(ctx, "onprem:p1:videoupload", "videoupload", "p1", func(ctx context.Context, msg services.Message) error {
+			published = append(published, string(msg.Payload))
+			return nil
+		})
+		h.queue.Process(ctx)
+		published = nil
+
+		// a video upload flags the album between the manifest upload's read and write
+		h.albumRepo.beforeUpdate = func() { h.setSynced(t, false) }
+		h.upload(t, "v1", "v2", "v3")
+		h.queue.Process(ctx)
+
+		album := h.album(t)
+		if album.Synced {
+			t.Error("the flag set by the racing video upload was lost")
+		}
+		if album.Version != 3 {
+			t.Errorf("expected version 3 after create, flag and manifest update, got %d", album.Version)
+		}
+		if got := h.manifest(t); got != "v1,v2,v3" {
+			t.Errorf("expected the new manifest stored, got %s", got)
+		}
+		revisions, _ := h.revisionRepo.List(ctx, services.ManifestRevisionFilter{ProviderID: "p1", DatabaseID: "db1", AlbumUID: "album1"})
+		if len(revisions) != 2 || strings.Join(revisions[1].Added, ",") != "v3" {
+			t.Errorf("expected the retry to record v3 once, got %+v", revisions)
+		}
+		if len(published) != 1 || !strings.Contains(published[0], "v3") {
+			t.Errorf("expected one videoupload for v3, got %v", published)
+		}
+	})
+
+	t.Run("a repair upload marks the album synced despite an unrelated write", func(t *testing.T) {
+		h := newAlbumRaceHarness(t, false, "v1")
+
+		h.albumRepo.beforeUpdate = func() {
+			album := h.album(t)
+			album.UpdatedAt = album.UpdatedAt.Add(time.Minute)
+			if err := h.albumRepo.AlbumRepository.Update(ctx, album); err != nil {
+				t.Fatalf("racing write failed: %v", err)
+			}
+		}
+		h.upload(t, "v1", "v2")
+
+		if !h.album(t).Synced {
+			t.Error("the repair upload should mark the album synced")
+		}
+	})
+
+	t.Run("a video upload rechecks a manifest that changed under it", func(t *testing.T) {
+		h := newAlbumRaceHarness(t, true, "v1")
+
+		// the manifest gains v2 between the video upload's check and its flag
+		h.albumRepo.beforeUpdate = func() { h.upload(t, "v1", "v2") }
+		err := h.videos.ProcessVideoUpload(ctx, services.VideoUploadRequest{
+			ProviderID: "p1",
+			DatabaseID: "db1",
+			UserID:     "user1",
+			AlbumUID:   "album1",
+			VideoUID:   "v2",
+			Body:       strings.NewReader("content of v2"),
+		})
+		if err != nil {
+			t.Fatalf("v2 is in the manifest by now and should be accepted: %v", err)
+		}
+		if !h.album(t).Synced {
+			t.Error("album should stay synced")
+		}
+	})
+
+	t.Run("concurrent manifest uploads all apply", func(t *testing.T) {
+		h := newAlbumRaceHarness(t, true, "v0")
+
+		const uploads = 4
+		var wg sync.WaitGroup
+		for i := 1; i <= uploads; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				if err := h.manifests.ProcessAlbumManifestUpload(ctx, services.AlbumManifestUploadRequest{
+					ProviderID: "p1",
+					DatabaseID: "db1",
+					UserID:     "user1",
+					AlbumUID:   "album1",
+					VideoUIDs:  []string{fmt.Sprintf("v%d", i)},
+				}); err != nil {
+					t.Errorf("upload %d failed: %v", i, err)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		if album := h.album(t); album.Version != 1+uploads {
+			t.Errorf("expected every upload to update the album once, got version %d", album.Version)
+		}
+		revisions, _ := h.revisionRepo.List(ctx, services.ManifestRevisionFilter{ProviderID: "p1", DatabaseID: "db1", AlbumUID: "album1"})
+		for i, revision := range revisions {
+			if revision.Revision != i+1 {
+				t.Errorf("revisions should be numbered without gaps, got %d at %d", revision.Revision, i)
+			}
+		}
+	})
+}
@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/media-vault-sync/internal/adapters/http/onprem"
+	cloudapp "github.com/media-vault-sync/internal/app/cloud"
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+type albumStatusBody struct {
+	ProviderID       string   `json:"providerID"`
+	AlbumUID         string   `json:"albumUID"`
+	UserID           string   `json:"userID"`
+	Synced           bool     `json:"synced"`
+	ManifestSize     int      `json:"manifestSize"`
+	UploadedCount    int      `json:"uploadedCount"`
+	MissingVideoUIDs []string `json:"missingVideoUIDs"`
+	Videos           []struct {
+		VideoUID string `json:"videoUID"`
+		Object   *struct {
+			Version   int    `json:"version"`
+			SizeBytes int64  `json:"sizeBytes"`
+			Checksum  string `json:"checksum"`
+		} `json:"object"`
+	} `json:"videos"`
+}
+
+func TestAlbumStatus_ReportsProgressAndMissingVideos(t *testing.T) {
+	ctx := context.Background()
+
+	cloud := cloudapp.Wire(cloudapp.Config{}, &cloudapp.WireOptions{Clock: services.NewFakeClock(time.Now())})
+	server := httptest.NewServer(cloud.Handler)
+	defer server.Close()
+
+	client := onprem.NewHTTPCloudClient(server.URL, nil)
+	if err := client.PostAlbumManifestUpload(ctx, services.AlbumManifestUploadRequest{
+		ProviderID: "p1",
+		DatabaseID: "db1",
+		UserID:     "user1",
+		AlbumUID:   "album1",
+		VideoUIDs:  []string{"v1", "v2", "v3"},
+	}); err != nil {
+		t.Fatalf("failed to upload manifest: %v", err)
+	}
+	for _, videoUID := range []string{"v1", "v3"} {
+		if err := client.PostVideoUpload(ctx, services.VideoUploadRequest{
+			ProviderID: "p1",
+			DatabaseID: "db1",
+			UserID:     "user1",
+			AlbumUID:   "album1",
+			VideoUID:   videoUID,
+			Body:       strings.NewReader("content of " + videoUID),
+		}); err != nil {
+			t.Fatalf("failed to upload %s: %v", videoUID, err)
+		}
+	}
+
+	resp, err := http.Get(server.URL + "/v1/providers/p1/databases/db1/albums/album1")
+	if err != nil {
+		t.Fatalf("status request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	var status albumStatusBody
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Fatalf("failed to decode status: %v", err)
+	}
+
+	album, _ := cloud.AlbumRepo.FindByAlbumUID(ctx, "p1", "db1", "album1")
+	if status.Synced != album.Synced || status.UserID != "user1" || status.AlbumUID != "album1" {
+		t.Errorf("album fields do not match the stored album: %+v", status)
+	}
+	if status.ManifestSize != 3 || status.UploadedCount != 2 {
+		t.Errorf("expected 2 of 3 uploaded, got %d of %d", status.UploadedCount, status.ManifestSize)
+	}
+	if len(status.MissingVideoUIDs) != 1 || status.MissingVideoUIDs[0] != "v2" {
+		t.Errorf("expected v2 missing, got %v", status.MissingVideoUIDs)
+	}
+
+	if len(status.Videos) != 3 {
+		t.Fatalf("expected a status per manifest video, got %d", len(status.Videos))
+	}
+	for _, video := range status.Videos {
+		switch video.VideoUID {
+		case "v2":
+			if video.Object != nil {
+				t.Errorf("v2 was never uploaded but has object %+v", video.Object)
+			}
+		default:
+			if video.Object == nil {
+				t.Errorf("%s should carry its object metadata", video.VideoUID)
+				continue
+			}
+			if video.Object.Version != 1 || video.Object.SizeBytes != int64(len("content of "+video.VideoUID)) || video.Object.Checksum == "" {
+				t.Errorf("unexpected object metadata for %s: %+v", video.VideoUID, video.Object)
+			}
+		}
+	}
+}
+
+func TestAlbumStatus_UnknownAlbumIsNotFound(t *testing.T) {
+	cloud := cloudapp.Wire(cloudapp.Config{}, &cloudapp.WireOptions{Clock: services.NewFakeClock(time.Now())})
+	server := httptest.NewServer(cloud.Handler)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/v1/providers/p1/databases/db1/albums/missing")
+	if err != nil {
+		t.Fatalf("status request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown album, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Post(server.URL+"/v1/providers/p1/databases/db1/albums/missing", "application/json", nil)
+	if err != nil {
+		t.Fatalf("status request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 for a write to the status endpoint, got %d", resp.StatusCode)
+	}
+}
@@ -55,7 +55,7 @@ func TestAlbumManifestUpload_Idempotency(t *testing.T) {
 	albumRepo := memoryrepo.NewAlbumRepository()
 	albumVideoRepo := memoryrepo.NewAlbumVideoRepository()
 
-	albumManifestUploadService := services.NewAlbumManifestUploadService(albumRepo, albumVideoRepo, queue, clock)
+	albumManifestUploadService := services.NewAlbumManifestUploadService(albumRepo, albumVideoRepo, memoryrepo.NewManifestRevisionRepository(), memoryrepo.NewObjectRepository(), memoryrepo.NewTransactor(), queue, clock)
 	albumManifestUploadHandler := cloud.NewAlbumManifestUploadHandler(albumManifestUploadService)
 
 	mux := http.NewServeMux()
@@ -65,7 +65,7 @@ func TestAlbumManifestUpload_Idempotency(t *testing.T) {
 
 	cloudClient := onprem.NewHTTPCloudClient(cloudServer.URL, nil)
 	mediaVaultRegistry := mediavault.NewFileSystemMediaVaultRegistry(configPath, nil)
-	albumManifestUploadConsumer := services.NewAlbumManifestUploadConsumer("p1", mediaVaultRegistry, cloudClient, 1)
+	albumManifestUploadConsumer := services.NewAlbumManifestUploadConsumer("p1", mediaVaultRegistry, cloudClient)
 
 	queue.Subscribe(ctx, "onprem:p1", "albummanifestupload", "p1", albumManifestUploadConsumer.Handle)
 
@@ -22,7 +22,7 @@ func TestAlbumManifestUpload_UserImmutability(t *testing.T) {
 	albumRepo := memoryrepo.NewAlbumRepository()
 	albumVideoRepo := memoryrepo.NewAlbumVideoRepository()
 
-	albumManifestUploadService := services.NewAlbumManifestUploadService(albumRepo, albumVideoRepo, queue, clock)
+	albumManifestUploadService := services.NewAlbumManifestUploadService(albumRepo, albumVideoRepo, memoryrepo.NewManifestRevisionRepository(), memoryrepo.NewObjectRepository(), memoryrepo.NewTransactor(), queue, clock)
 	albumManifestUploadHandler := cloud.NewAlbumManifestUploadHandler(albumManifestUploadService)
 
 	mux := http.NewServeMux()
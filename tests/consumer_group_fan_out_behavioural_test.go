@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/media-vault-sync/internal/adapters/http/onprem"
+	"github.com/media-vault-sync/internal/adapters/mediavault"
+	"github.com/media-vault-sync/internal/adapters/queue/memory"
+	cloudapp "github.com/media-vault-sync/internal/app/cloud"
+	onpremapp "github.com/media-vault-sync/internal/app/onprem"
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+func TestConsumerGroups_AuditSubscriberDoesNotStealManifests(t *testing.T) {
+	ctx := context.Background()
+	clock := services.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	queue := memory.NewInMemoryQueue(clock)
+
+	cloud := cloudapp.Wire(cloudapp.Config{}, &cloudapp.WireOptions{Clock: clock, Queue: queue})
+	cloudServer := httptest.NewServer(cloud.Handler)
+	defer cloudServer.Close()
+
+	configPath := filepath.Join(t.TempDir(), "mediavault_config.json")
+	data, _ := json.Marshal(mediavault.Config{
+		Providers: []mediavault.ProviderConfig{{
+			ProviderID: "p1",
+			Databases: []mediavault.DatabaseConfig{{
+				DatabaseID: "db1",
+				Users: []mediavault.UserConfig{{
+					UserID: "user1",
+					Albums: []mediavault.AlbumConfig{
+						{AlbumUID: "album1", Videos: []string{"v1"}},
+						{AlbumUID: "album2", Videos: []string{"v2"}},
+					},
+				}},
+			}},
+		}},
+	})
+	os.WriteFile(configPath, data, 0644)
+
+	// the receiver is the on-prem app itself
+	var app *onpremapp.App
+	receiverServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.Handler.ServeHTTP(w, r)
+	}))
+	defer receiverServer.Close()
+
+	app = onpremapp.Wire(onpremapp.Config{ProviderID: "p1", MediaVaultConfigPath: configPath, StagingDir: t.TempDir()}, &onpremapp.WireOptions{
+		Clock:       clock,
+		Queue:       queue,
+		CloudClient: onprem.NewHTTPCloudClient(cloudServer.URL, nil),
+		ReceiverURL: receiverServer.URL,
+	})
+	if err := app.SubscribeAll(ctx); err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+
+	var mu sync.Mutex
+	var audited []string
+	queue.Subscribe(ctx, "audit", "albummanifestupload", "", func(ctx context.Context, msg services.Message) error {
+		var payload services.AlbumManifestUploadPayload
+		json.Unmarshal(msg.Payload, &payload)
+		mu.Lock()
+		defer mu.Unlock()
+		audited = append(audited, payload.AlbumUID)
+		return nil
+	})
+
+	syncPayload, _ := json.Marshal(services.SyncUserPayload{DatabaseID: "db1", UserID: "user1"})
+	queue.Publish(ctx, services.Message{Topic: "usersync", Payload: syncPayload, Metadata: map[string]string{"providerID": "p1"}})
+	queue.Process(ctx)
+
+	if len(audited) != 2 {
+		t.Errorf("expected the audit subscriber to see both manifests, got %v", audited)
+	}
+	for _, albumUID := range []string{"album1", "album2"} {
+		album, _ := cloud.AlbumRepo.FindByAlbumUID(ctx, "p1", "db1", albumUID)
+		if album == nil || !album.Synced {
+			t.Errorf("expected on-prem to still sync %s, got %+v", albumUID, album)
+		}
+	}
+}
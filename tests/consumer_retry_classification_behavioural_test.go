@@ -0,0 +1,205 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/media-vault-sync/internal/adapters/http/onprem"
+	"github.com/media-vault-sync/internal/adapters/mediavault"
+	memoryrepo "github.com/media-vault-sync/internal/adapters/repo/memory"
+	cloudapp "github.com/media-vault-sync/internal/app/cloud"
+	onpremapp "github.com/media-vault-sync/internal/app/onprem"
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+// flakyCloudClient fails the next failures user albums posts, like a cloud
+// outage, and counts the posts.
+type flakyCloudClient struct {
+	services.CloudClient
+	failures   int
+	userAlbums int
+}
+
+func (c *flakyCloudClient) PostUserAlbums(ctx context.Context, req services.UserAlbumsRequest) error {
+	c.userAlbums++
+	if c.failures > 0 {
+		c.failures--
+		return errors.New("cloud unavailable")
+	}
+	return c.CloudClient.PostUserAlbums(ctx, req)
+}
+
+func TestConsumerRetries_QueueReschedulesAndRejectionsFailAtOnce(t *testing.T) {
+	ctx := context.Background()
+	clock := services.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	cloud := cloudapp.Wire(cloudapp.Config{}, &cloudapp.WireOptions{Clock: clock})
+	cloudServer := httptest.NewServer(cloud.Handler)
+	defer cloudServer.Close()
+	httpClient := onprem.NewHTTPCloudClient(cloudServer.URL, nil)
+	cloudClient := &flakyCloudClient{CloudClient: httpClient}
+
+	configPath := filepath.Join(t.TempDir(), "mediavault_config.json")
+	data, _ := json.Marshal(mediavault.Config{
+		Providers: []mediavault.ProviderConfig{{
+			ProviderID: "p1",
+			Databases: []mediavault.DatabaseConfig{{
+				DatabaseID: "db1",
+				Users: []mediavault.UserConfig{{
+					UserID: "user1",
+					Albums: []mediavault.AlbumConfig{
+						{AlbumUID: "album1", Videos: []string{"v1"}},
+						{AlbumUID: "album2", Videos: []string{"v2"}},
+					},
+				}},
+			}},
+		}},
+	})
+	os.WriteFile(configPath, data, 0644)
+
+	// the receiver is the on-prem app itself
+	var app *onpremapp.App
+	receiverServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.Handler.ServeHTTP(w, r)
+	}))
+	defer receiverServer.Close()
+
+	deadLetterRepo := memoryrepo.NewDeadLetterRepository()
+	app = onpremapp.Wire(onpremapp.Config{ProviderID: "p1", MediaVaultConfigPath: configPath, StagingDir: t.TempDir()}, &onpremapp.WireOptions{
+		Clock:          clock,
+		CloudClient:    cloudClient,
+		DeadLetterRepo: deadLetterRepo,
+		ReceiverURL:    receiverServer.URL,
+	})
+	if err := app.SubscribeAll(ctx); err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+
+	publish := func(topic string, payload any) {
+		t.Helper()
+		raw, _ := json.Marshal(payload)
+		if err := app.Queue.Publish(ctx, services.Message{Topic: topic, Payload: raw, Metadata: map[string]string{"providerID": "p1"}}); err != nil {
+			t.Fatalf("publish failed: %v", err)
+		}
+	}
+	deadLetter := func(topic string) *services.DeadLetter {
+		t.Helper()
+		deadLetters, _ := deadLetterRepo.List(ctx, services.DeadLetterFilter{Topic: topic})
+		if len(deadLetters) != 1 {
+			t.Fatalf("expected one %s dead letter, got %d", topic, len(deadLetters))
+		}
+		return deadLetters[0]
+	}
+
+	t.Run("a failed cloud call is retried by the queue", func(t *testing.T) {
+		cloudClient.failures = 1
+		publish("usersync", services.SyncUserPayload{DatabaseID: "db1", UserID: "user1"})
+
+		start := time.Now()
+		app.Queue.Process(ctx)
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("the failed call must not hold up the queue, took %v", elapsed)
+		}
+		if cloudClient.userAlbums != 1 || app.Queue.PendingCount() != 1 {
+			t.Fatalf("expected the message waiting for its retry, got %d posts and %d pending", cloudClient.userAlbums, app.Queue.PendingCount())
+		}
+
+		clock.Advance(time.Second)
+		app.Queue.Process(ctx)
+		if cloudClient.userAlbums != 2 || app.Queue.PendingCount() != 0 {
+			t.Errorf("expected the retry to succeed, got %d posts and %d pending", cloudClient.userAlbums, app.Queue.PendingCount())
+		}
+	})
+
+	t.Run("an album of another user is dead-lettered at once", func(t *testing.T) {
+		if err := httpClient.PostAlbumManifestUpload(ctx, services.AlbumManifestUploadRequest{
+			ProviderID: "p1",
+			DatabaseID: "db1",
+			UserID:     "user2",
+			AlbumUID:   "album1",
+			VideoUIDs:  []string{"v1"},
+		}); err != nil {
+			t.Fatalf("failed to upload manifest: %v", err)
+		}
+
+		publish("albummanifestupload", services.AlbumManifestUploadPayload{DatabaseID: "db1", AlbumUID: "album1"})
+		app.Queue.Process(ctx)
+
+		dl := deadLetter("albummanifestupload")
+		if dl.Attempts != 1 || !strings.Contains(dl.LastError, services.ErrUserIDMismatch.Error()) {
+			t.Errorf("expected one attempt failing with the user mismatch, got %d: %s", dl.Attempts, dl.LastError)
+		}
+	})
+
+	t.Run("a video missing from the manifest is dead-lettered at once", func(t *testing.T) {
+		if err := httpClient.PostAlbumManifestUpload(ctx, services.AlbumManifestUploadRequest{
+			ProviderID: "p1",
+			DatabaseID: "db1",
+			UserID:     "user1",
+			AlbumUID:   "album2",
+		}); err != nil {
+			t.Fatalf("failed to upload manifest: %v", err)
+		}
+
+		publish("videoupload", services.VideoUploadPayload{DatabaseID: "db1", AlbumUID: "album2"})
+		app.Queue.Process(ctx)
+
+		dl := deadLetter("videoupload")
+		if dl.Attempts != 1 || !strings.Contains(dl.LastError, services.ErrVideoNotInManifest.Error()) {
+			t.Errorf("expected one attempt failing with the missing video, got %d: %s", dl.Attempts, dl.LastError)
+		}
+	})
+}
+
+// rejectingCloudClient refuses every video upload with err.
+type rejectingCloudClient struct {
+	services.CloudClient
+	err error
+}
+
+func (c *rejectingCloudClient) PostVideoUpload(ctx context.Context, req services.VideoUploadRequest) error {
+	return c.err
+}
+
+func TestConsumerRetries_SenderGetsBackTheErrorTheCloudNamed(t *testing.T) {
+	ctx := context.Background()
+
+	configPath := filepath.Join(t.TempDir(), "mediavault_config.json")
+	data, _ := json.Marshal(mediavault.Config{
+		Providers: []mediavault.ProviderConfig{{
+			ProviderID: "p1",
+			Databases: []mediavault.DatabaseConfig{{
+				DatabaseID: "db1",
+				Users: []mediavault.UserConfig{{
+					UserID: "user1",
+					Albums: []mediavault.AlbumConfig{{AlbumUID: "album1", Videos: []string{"v1"}}},
+				}},
+			}},
+		}},
+	})
+	os.WriteFile(configPath, data, 0644)
+
+	for _, want := range []error{services.ErrUserIDMismatch, services.ErrVideoNotInManifest} {
+		cloudClient := &rejectingCloudClient{err: want}
+		app := onpremapp.Wire(onpremapp.Config{ProviderID: "p1", MediaVaultConfigPath: configPath, StagingDir: t.TempDir()}, &onpremapp.WireOptions{
+			CloudClient: cloudClient,
+		})
+		receiverServer := httptest.NewServer(app.Handler)
+
+		sender := onprem.NewHTTPVideoSender(receiverServer.URL, "p1", nil)
+		err := sender.SendVideo(ctx, "db1", "album1", "v1", strings.NewReader("content of v1"))
+		receiverServer.Close()
+
+		if !errors.Is(err, want) || services.IsRetryable(err) {
+			t.Errorf("expected the permanent %v, got %v", want, err)
+		}
+	}
+}
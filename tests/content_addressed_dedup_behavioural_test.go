@@ -0,0 +1,187 @@
+package tests
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/media-vault-sync/internal/adapters/http/onprem"
+	cloudapp "github.com/media-vault-sync/internal/app/cloud"
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+// uploadCountingTransport counts the requests that carry video bytes and the
+// reference checks that try to avoid them.
+type uploadCountingTransport struct {
+	mu         sync.Mutex
+	uploads    int
+	references int
+}
+
+func (t *uploadCountingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	switch {
+	case strings.HasSuffix(req.URL.Path, "/videoupload/reference"):
+		t.references++
+	case strings.HasSuffix(req.URL.Path, "/videoupload"):
+		t.uploads++
+	}
+	t.mu.Unlock()
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestContentAddressedDedup_SameClipInTwoAlbumsIsStoredAndSentOnce(t *testing.T) {
+	ctx := context.Background()
+	clock := services.NewFakeClock(time.Now())
+
+	cloud := cloudapp.Wire(cloudapp.Config{ObjectRetention: time.Hour}, &cloudapp.WireOptions{Clock: clock})
+	server := httptest.NewServer(cloud.Handler)
+	defer server.Close()
+
+	transport := &uploadCountingTransport{}
+	client := onprem.NewHTTPCloudClient(server.URL, &http.Client{Transport: transport})
+
+	for _, manifest := range []services.AlbumManifestUploadRequest{
+		{ProviderID: "p1", DatabaseID: "db1", UserID: "user1", AlbumUID: "album1", VideoUIDs: []string{"v1"}},
+		{ProviderID: "p1", DatabaseID: "db2", UserID: "user2", AlbumUID: "album2", VideoUIDs: []string{"v9"}},
+	} {
+		if err := client.PostAlbumManifestUpload(ctx, manifest); err != nil {
+			t.Fatalf("failed to upload manifest: %v", err)
+		}
+	}
+
+	clip := "the same clip in two albums"
+	sum := sha256.Sum256([]byte(clip))
+	checksum := hex.EncodeToString(sum[:])
+
+	upload := func(databaseID, albumUID, videoUID, content string) {
+		t.Helper()
+		sum := sha256.Sum256([]byte(content))
+		err := client.PostVideoUpload(ctx, services.VideoUploadRequest{
+			ProviderID:       "p1",
+			DatabaseID:       databaseID,
+			UserID:           "user1",
+			AlbumUID:         albumUID,
+			VideoUID:         videoUID,
+			Body:             strings.NewReader(content),
+			ExpectedChecksum: hex.EncodeToString(sum[:]),
+		})
+		if err != nil {
+			t.Fatalf("upload of %s failed: %v", videoUID, err)
+		}
+	}
+
+	upload("db1", "album1", "v1", clip)
+	upload("db2", "album2", "v9", clip)
+
+	if transport.references != 2 {
+		t.Errorf("expected a reference check before each upload, got %d", transport.references)
+	}
+	if transport.uploads != 1 {
+		t.Errorf("expected the bytes to be sent once, got %d uploads", transport.uploads)
+	}
+
+	first, _ := cloud.ObjectRepo.FindByVideoUID(ctx, "p1", "db1", "v1")
+	second, _ := cloud.ObjectRepo.FindByVideoUID(ctx, "p1", "db2", "v9")
+	if first == nil || second == nil {
+		t.Fatal("both videos should have an object")
+	}
+	if first.StorageKey != services.ContentStorageKey(checksum) || second.StorageKey != first.StorageKey {
+		t.Errorf("expected both objects to reference %s, got %s and %s", services.ContentStorageKey(checksum), first.StorageKey, second.StorageKey)
+	}
+	if second.SizeBytes != int64(len(clip)) {
+		t.Errorf("expected the referenced object to carry the blob size %d, got %d", len(clip), second.SizeBytes)
+	}
+
+	blobs, _ := cloud.BlobStore.List(ctx, "")
+	if len(blobs) != 1 {
+		t.Fatalf("expected a single stored blob, got %d", len(blobs))
+	}
+
+	// replacing one video leaves the shared blob alone: the other one still references it
+	upload("db1", "album1", "v1", "a new cut of the clip")
+	clock.Advance(2 * time.Hour)
+	if _, err := cloud.ObjectGarbageCollector.Collect(ctx); err != nil {
+		t.Fatalf("gc failed: %v", err)
+	}
+	if _, err := cloud.BlobStore.Head(ctx, services.ContentStorageKey(checksum)); err != nil {
+		t.Fatalf("shared blob should survive while referenced: %v", err)
+	}
+
+	// once the last reference is superseded and past retention, the blob goes
+	upload("db2", "album2", "v9", "another cut of the clip")
+	clock.Advance(2 * time.Hour)
+	if _, err := cloud.ObjectGarbageCollector.Collect(ctx); err != nil {
+		t.Fatalf("gc failed: %v", err)
+	}
+	if _, err := cloud.BlobStore.Head(ctx, services.ContentStorageKey(checksum)); !errors.Is(err, services.ErrBlobNotFound) {
+		t.Errorf("unreferenced blob should be deleted, got %v", err)
+	}
+}
+
+func TestContentAddressedDedup_ReferenceToUnknownContentFallsBackToUpload(t *testing.T) {
+	ctx := context.Background()
+
+	cloud := cloudapp.Wire(cloudapp.Config{}, &cloudapp.WireOptions{Clock: services.NewFakeClock(time.Now())})
+	server := httptest.NewServer(cloud.Handler)
+	defer server.Close()
+
+	transport := &uploadCountingTransport{}
+	client := onprem.NewHTTPCloudClient(server.URL, &http.Client{Transport: transport})
+	if err := client.PostAlbumManifestUpload(ctx, services.AlbumManifestUploadRequest{
+		ProviderID: "p1",
+		DatabaseID: "db1",
+		UserID:     "user1",
+		AlbumUID:   "album1",
+		VideoUIDs:  []string{"v1"},
+	}); err != nil {
+		t.Fatalf("failed to upload manifest: %v", err)
+	}
+
+	// a reference for a video outside the manifest is rejected like an upload
+	err := client.PostVideoUpload(ctx, services.VideoUploadRequest{
+		ProviderID:       "p1",
+		DatabaseID:       "db1",
+		UserID:           "user1",
+		AlbumUID:         "album1",
+		VideoUID:         "v2",
+		Body:             strings.NewReader("content"),
+		ExpectedChecksum: strings.Repeat("0", 64),
+	})
+	if err == nil {
+		t.Fatal("expected a video outside the manifest to be rejected")
+	}
+	if transport.uploads != 0 {
+		t.Errorf("expected no bytes to be sent for a rejected reference, got %d uploads", transport.uploads)
+	}
+
+	content := "content the cloud has never seen"
+	sum := sha256.Sum256([]byte(content))
+	err = client.PostVideoUpload(ctx, services.VideoUploadRequest{
+		ProviderID:       "p1",
+		DatabaseID:       "db1",
+		UserID:           "user1",
+		AlbumUID:         "album1",
+		VideoUID:         "v1",
+		Body:             strings.NewReader(content),
+		ExpectedChecksum: hex.EncodeToString(sum[:]),
+	})
+	if err != nil {
+		t.Fatalf("upload failed: %v", err)
+	}
+	if transport.uploads != 1 {
+		t.Errorf("expected the unknown content to be uploaded, got %d uploads", transport.uploads)
+	}
+
+	object, _ := cloud.ObjectRepo.FindByVideoUID(ctx, "p1", "db1", "v1")
+	if object == nil || object.Checksum != hex.EncodeToString(sum[:]) {
+		t.Errorf("expected the uploaded object to be recorded, got %+v", object)
+	}
+}
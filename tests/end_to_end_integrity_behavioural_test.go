@@ -0,0 +1,206 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/media-vault-sync/internal/adapters/http/onprem"
+	"github.com/media-vault-sync/internal/adapters/mediavault"
+	"github.com/media-vault-sync/internal/adapters/storage/fs"
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+// corruptingTransport flips the first byte of the next `remaining` request
+// bodies sent to paths ending in suffix, and counts every such request.
+type corruptingTransport struct {
+	suffix    string
+	mu        sync.Mutex
+	remaining int
+	requests  int
+}
+
+func (t *corruptingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if strings.HasSuffix(req.URL.Path, t.suffix) {
+		t.mu.Lock()
+		t.requests++
+		if t.remaining > 0 {
+			t.remaining--
+			// the body is swapped in place so trailers set while it is read still go out
+			req.Body = &flipFirstByte{ReadCloser: req.Body}
+		}
+		t.mu.Unlock()
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+type flipFirstByte struct {
+	io.ReadCloser
+	flipped bool
+}
+
+func (f *flipFirstByte) Read(p []byte) (int, error) {
+	n, err := f.ReadCloser.Read(p)
+	if n > 0 && !f.flipped {
+		p[0] ^= 0xff
+		f.flipped = true
+	}
+	return n, err
+}
+
+// corruptingStaging damages every file it loads back, as a failing disk would.
+type corruptingStaging struct {
+	services.StagingStorage
+}
+
+func (s *corruptingStaging) Load(ctx context.Context, key string) (io.ReadCloser, error) {
+	body, err := s.StagingStorage.Load(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return &flipFirstByte{ReadCloser: body}, nil
+}
+
+func newIntegrityReceiver(t *testing.T, cloudURL string, cloudTransport http.RoundTripper, staging services.StagingStorage) *httptest.Server {
+	t.Helper()
+
+	configPath := filepath.Join(t.TempDir(), "mediavault_config.json")
+	data, _ := json.Marshal(mediavault.Config{
+		Providers: []mediavault.ProviderConfig{{
+			ProviderID: "p1",
+			Databases: []mediavault.DatabaseConfig{{
+				DatabaseID: "db1",
+				Users: []mediavault.UserConfig{{
+					UserID: "user1",
+					Albums: []mediavault.AlbumConfig{{AlbumUID: "album1", Videos: []string{"v1"}}},
+				}},
+			}},
+		}},
+	})
+	if err := os.WriteFile(configPath, data, 0644); err != nil {
+		t.Fatalf("failed to write mediavault config: %v", err)
+	}
+
+	cloudClient := onprem.NewHTTPCloudClient(cloudURL, &http.Client{Transport: cloudTransport})
+	registry := mediavault.NewFileSystemMediaVaultRegistry(configPath, nil)
+	server := httptest.NewServer(onprem.NewVideoReceiver(staging, cloudClient, registry))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestIntegrity_DamagedUploadIsRejectedAndRetried(t *testing.T) {
+	ctx := context.Background()
+	cloud, server := newChunkedUploadTest(t)
+
+	data := bytes.Repeat([]byte("integrity"), 1000)
+	sum := sha256.Sum256(data)
+	req := videoRequest(data)
+	req.ExpectedChecksum = hex.EncodeToString(sum[:])
+
+	transport := &corruptingTransport{suffix: "/videoupload", remaining: 1}
+	client := onprem.NewHTTPCloudClient(server.URL, &http.Client{Transport: transport})
+	if err := client.PostVideoUpload(ctx, req); err != nil {
+		t.Fatalf("upload should succeed after a retry: %v", err)
+	}
+	if transport.requests != 2 {
+		t.Errorf("expected the damaged upload to be sent again, got %d uploads", transport.requests)
+	}
+
+	object, _ := cloud.ObjectRepo.FindByVideoUID(ctx, "p1", "db1", "v1")
+	if object == nil || object.Checksum != req.ExpectedChecksum {
+		t.Fatalf("expected the intact content to be recorded, got %+v", object)
+	}
+	versions, _ := cloud.ObjectRepo.ListVersions(ctx, "p1", "db1", "v1")
+	if len(versions) != 1 {
+		t.Errorf("the damaged upload must not leave a version, got %d", len(versions))
+	}
+	blobs, _ := cloud.BlobStore.List(ctx, "")
+	if len(blobs) != 1 {
+		t.Errorf("the damaged upload must not leave a blob, got %d", len(blobs))
+	}
+
+	// damage that persists exhausts the retries and surfaces the dedicated error
+	other := videoRequest([]byte("always damaged"))
+	otherSum := sha256.Sum256([]byte("always damaged"))
+	other.ExpectedChecksum = hex.EncodeToString(otherSum[:])
+	transport = &corruptingTransport{suffix: "/videoupload", remaining: 100}
+	client = onprem.NewHTTPCloudClient(server.URL, &http.Client{Transport: transport})
+	if err := client.PostVideoUpload(ctx, other); !errors.Is(err, services.ErrChecksumMismatch) {
+		t.Errorf("expected ErrChecksumMismatch, got %v", err)
+	}
+}
+
+func TestIntegrity_ReceiverRejectsBytesDamagedBeforeStaging(t *testing.T) {
+	ctx := context.Background()
+	cloud, server := newChunkedUploadTest(t)
+
+	stagingPath := t.TempDir()
+	cloudTransport := &corruptingTransport{suffix: "/videoupload"}
+	receiver := newIntegrityReceiver(t, server.URL, cloudTransport, fs.NewStagingStorage(stagingPath))
+
+	senderTransport := &corruptingTransport{suffix: "/receive-video", remaining: 1}
+	sender := onprem.NewHTTPVideoSender(receiver.URL, "p1", &http.Client{Transport: senderTransport})
+
+	err := sender.SendVideo(ctx, "db1", "album1", "v1", strings.NewReader("video read from the vault"))
+	if !errors.Is(err, services.ErrChecksumMismatch) {
+		t.Fatalf("expected ErrChecksumMismatch from the receiver, got %v", err)
+	}
+	if cloudTransport.requests != 0 {
+		t.Errorf("damaged bytes must not reach the cloud, got %d uploads", cloudTransport.requests)
+	}
+	if object, _ := cloud.ObjectRepo.FindByVideoUID(ctx, "p1", "db1", "v1"); object != nil {
+		t.Errorf("no object should be recorded, got %+v", object)
+	}
+	entries, _ := os.ReadDir(filepath.Join(stagingPath, "p1", "db1", "album1"))
+	if len(entries) != 0 {
+		t.Errorf("the rejected file should be removed from staging, found %d files", len(entries))
+	}
+
+	// sending again without damage goes through, carrying the sender's digest to the cloud
+	content := "video read from the vault"
+	if err := sender.SendVideo(ctx, "db1", "album1", "v1", strings.NewReader(content)); err != nil {
+		t.Fatalf("undamaged send failed: %v", err)
+	}
+	sum := sha256.Sum256([]byte(content))
+	object, _ := cloud.ObjectRepo.FindByVideoUID(ctx, "p1", "db1", "v1")
+	if object == nil || object.Checksum != hex.EncodeToString(sum[:]) {
+		t.Errorf("expected the source digest to be recorded, got %+v", object)
+	}
+}
+
+func TestIntegrity_StagedFileIsVerifiedWhenLoaded(t *testing.T) {
+	ctx := context.Background()
+	cloud, server := newChunkedUploadTest(t)
+
+	stagingPath := t.TempDir()
+	cloudTransport := &corruptingTransport{suffix: "/videoupload"}
+	staging := &corruptingStaging{StagingStorage: fs.NewStagingStorage(stagingPath)}
+	receiver := newIntegrityReceiver(t, server.URL, cloudTransport, staging)
+
+	sender := onprem.NewHTTPVideoSender(receiver.URL, "p1", nil)
+	if err := sender.SendVideo(ctx, "db1", "album1", "v1", strings.NewReader("staged then damaged")); err == nil {
+		t.Fatal("expected the send to fail when the staged file is damaged")
+	}
+
+	if cloudTransport.requests != 0 {
+		t.Errorf("a damaged staged file must not be uploaded, got %d uploads", cloudTransport.requests)
+	}
+	if object, _ := cloud.ObjectRepo.FindByVideoUID(ctx, "p1", "db1", "v1"); object != nil {
+		t.Errorf("no object should be recorded, got %+v", object)
+	}
+	entries, _ := os.ReadDir(filepath.Join(stagingPath, "p1", "db1", "album1"))
+	if len(entries) != 0 {
+		t.Errorf("the damaged file should be removed from staging, found %d files", len(entries))
+	}
+}
@@ -0,0 +1,269 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/media-vault-sync/internal/adapters/http/cloud"
+	"github.com/media-vault-sync/internal/adapters/http/onprem"
+	"github.com/media-vault-sync/internal/adapters/queue/memory"
+	memoryrepo "github.com/media-vault-sync/internal/adapters/repo/memory"
+	cloudapp "github.com/media-vault-sync/internal/app/cloud"
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+// responseLosingTransport delivers every request but drops the response of
+// the next losses ones, the way a client timeout does. It records the
+// Idempotency-Key of each request.
+type responseLosingTransport struct {
+	losses int
+	keys   []string
+}
+
+func (t *responseLosingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.keys = append(t.keys, req.Header.Get(cloud.IdempotencyKeyHeader))
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil || t.losses == 0 {
+		return resp, err
+	}
+	t.losses--
+	resp.Body.Close()
+	return nil, errors.New("timeout awaiting response headers")
+}
+
+func TestIdempotencyKeys_RetriesAfterLostResponsesRunOnce(t *testing.T) {
+	ctx := context.Background()
+	clock := services.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	queue := memory.NewInMemoryQueue(clock)
+
+	app := cloudapp.Wire(cloudapp.Config{IdempotencyTTL: time.Hour}, &cloudapp.WireOptions{Clock: clock, Queue: queue})
+	server := httptest.NewServer(app.Handler)
+	defer server.Close()
+
+	transport := &responseLosingTransport{}
+	client := onprem.NewHTTPCloudClient(server.URL, &http.Client{Transport: transport})
+
+	var manifestRequests []services.Message
+	queue.Subscribe(ctx, "onprem:p1:albummanifestupload", "albummanifestupload", "p1", func(ctx context.Context, msg services.Message) error {
+		manifestRequests = append(manifestRequests, msg)
+		return nil
+	})
+
+	userAlbums := services.UserAlbumsRequest{ProviderID: "p1", DatabaseID: "db1", UserID: "user1", AlbumUIDs: []string{"album1", "album2"}}
+
+	t.Run("user albums are not re-emitted by a retry", func(t *testing.T) {
+		transport.losses = 2
+		for attempt := 0; attempt < 2; attempt++ {
+			if err := client.PostUserAlbums(ctx, userAlbums); err == nil {
+				t.Fatal("expected the lost response to fail the attempt")
+			}
+		}
+		if err := client.PostUserAlbums(ctx, userAlbums); err != nil {
+			t.Fatalf("retry failed: %v", err)
+		}
+		queue.Process(ctx)
+
+		if len(manifestRequests) != 2 {
+			t.Errorf("expected one albummanifestupload per album, got %d", len(manifestRequests))
+		}
+		if len(transport.keys) != 3 || transport.keys[0] == "" || transport.keys[1] != transport.keys[0] || transport.keys[2] != transport.keys[0] {
+			t.Errorf("expected every attempt to carry the same key, got %v", transport.keys)
+		}
+	})
+
+	t.Run("a succeeded operation run again is a new one", func(t *testing.T) {
+		first := transport.keys[0]
+		manifestRequests = nil
+		transport.keys = nil
+
+		if err := client.PostUserAlbums(ctx, userAlbums); err != nil {
+			t.Fatalf("user albums failed: %v", err)
+		}
+		queue.Process(ctx)
+
+		if transport.keys[0] == first {
+			t.Error("a new operation must not reuse the key of the last one")
+		}
+		if len(manifestRequests) != 2 {
+			t.Errorf("the albums are still missing and should be requested again, got %d", len(manifestRequests))
+		}
+	})
+
+	t.Run("video uploads keep their key across lost responses", func(t *testing.T) {
+		if err := client.PostAlbumManifestUpload(ctx, services.AlbumManifestUploadRequest{
+			ProviderID: "p1",
+			DatabaseID: "db1",
+			UserID:     "user1",
+			AlbumUID:   "album1",
+			VideoUIDs:  []string{"v1"},
+		}); err != nil {
+			t.Fatalf("failed to upload manifest: %v", err)
+		}
+
+		upload := func(content string) error {
+			return client.PostVideoUpload(ctx, services.VideoUploadRequest{
+				ProviderID: "p1",
+				DatabaseID: "db1",
+				UserID:     "user1",
+				AlbumUID:   "album1",
+				VideoUID:   "v1",
+				Body:       strings.NewReader(content),
+			})
+		}
+
+		transport.keys = nil
+		transport.losses = 1
+		if err := upload("content of v1"); err == nil {
+			t.Fatal("expected the lost response to fail the attempt")
+		}
+		if err := upload("content of v1"); err != nil {
+			t.Fatalf("retry failed: %v", err)
+		}
+		if err := upload("new content of v1"); err != nil {
+			t.Fatalf("upload failed: %v", err)
+		}
+
+		if len(transport.keys) != 3 || transport.keys[1] != transport.keys[0] {
+			t.Fatalf("expected the retry to carry the key of the lost attempt, got %v", transport.keys)
+		}
+		if transport.keys[2] == transport.keys[0] {
+			t.Error("a later upload is a new operation and needs a new key")
+		}
+		if versions, _ := app.ObjectRepo.ListVersions(ctx, "p1", "db1", "v1"); len(versions) != 2 {
+			t.Errorf("expected the new content stored as version 2, got %d versions", len(versions))
+		}
+	})
+
+	t.Run("an operation that failed for good is a new one when run again", func(t *testing.T) {
+		upload := func() error {
+			return client.PostVideoUpload(ctx, services.VideoUploadRequest{
+				ProviderID: "p1",
+				DatabaseID: "db1",
+				UserID:     "user1",
+				AlbumUID:   "album1",
+				VideoUID:   "v2",
+				Body:       strings.NewReader("content of v2"),
+			})
+		}
+
+		transport.keys = nil
+		if err := upload(); !errors.Is(err, services.ErrVideoNotInManifest) {
+			t.Fatalf("expected the video outside the manifest rejected, got %v", err)
+		}
+		if err := client.PostAlbumManifestUpload(ctx, services.AlbumManifestUploadRequest{
+			ProviderID: "p1",
+			DatabaseID: "db1",
+			UserID:     "user1",
+			AlbumUID:   "album1",
+			VideoUIDs:  []string{"v1", "v2"},
+		}); err != nil {
+			t.Fatalf("failed to upload manifest: %v", err)
+		}
+		if err := upload(); err != nil {
+			t.Fatalf("upload failed: %v", err)
+		}
+
+		if len(transport.keys) != 3 || transport.keys[2] == transport.keys[0] {
+			t.Errorf("expected the upload after the rejected one to carry a new key, got %v", transport.keys)
+		}
+	})
+}
+
+func TestIdempotencyKeys_ServerStoresSuccessesForTheTTL(t *testing.T) {
+	ctx := context.Background()
+	clock := services.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	queue := memory.NewInMemoryQueue(clock)
+
+	app := cloudapp.Wire(cloudapp.Config{IdempotencyTTL: time.Hour}, &cloudapp.WireOptions{Clock: clock, Queue: queue})
+	server := httptest.NewServer(app.Handler)
+	defer server.Close()
+
+	post := func(path, key, body string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, server.URL+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set(cloud.IdempotencyKeyHeader, key)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	manifest := func(userID string) string {
+		return `{"providerID":"p1","databaseID":"db1","userID":"` + userID + `","albumUID":"album1","videoUIDs":["v1"]}`
+	}
+
+	if resp := post("/v1/albummanifestupload", "key-1", manifest("user1")); resp.StatusCode != http.StatusOK || resp.Header.Get(cloud.IdempotentReplayedHeader) != "" {
+		t.Fatalf("expected the first request to run, got %d", resp.StatusCode)
+	}
+	queue.Process(ctx)
+	published := queue.PendingCount()
+
+	t.Run("a repeated key replays the stored status", func(t *testing.T) {
+		album, _ := app.AlbumRepo.FindByAlbumUID(ctx, "p1", "db1", "album1")
+
+		resp := post("/v1/albummanifestupload", "key-1", manifest("user1"))
+		if resp.StatusCode != http.StatusOK || resp.Header.Get(cloud.IdempotentReplayedHeader) != "true" {
+			t.Errorf("expected a replayed 200, got %d", resp.StatusCode)
+		}
+		if after, _ := app.AlbumRepo.FindByAlbumUID(ctx, "p1", "db1", "album1"); after.Version != album.Version {
+			t.Error("a replay must not run the service again")
+		}
+		if queue.PendingCount() != published {
+			t.Error("a replay must not publish again")
+		}
+	})
+
+	t.Run("keys are scoped to their endpoint", func(t *testing.T) {
+		resp := post("/v1/useralbums", "key-1", `{"providerID":"p1","databaseID":"db1","userID":"user1","albumUIDs":["album1"]}`)
+		if resp.StatusCode != http.StatusOK || resp.Header.Get(cloud.IdempotentReplayedHeader) != "" {
+			t.Errorf("expected the other endpoint to run, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("failures are not stored", func(t *testing.T) {
+		if resp := post("/v1/albummanifestupload", "key-2", manifest("user2")); resp.StatusCode != http.StatusConflict {
+			t.Fatalf("expected the user mismatch to be rejected, got %d", resp.StatusCode)
+		}
+		if resp := post("/v1/albummanifestupload", "key-2", manifest("user1")); resp.StatusCode != http.StatusOK || resp.Header.Get(cloud.IdempotentReplayedHeader) != "" {
+			t.Errorf("a key whose request failed should run again, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("requests without a key always run", func(t *testing.T) {
+		album, _ := app.AlbumRepo.FindByAlbumUID(ctx, "p1", "db1", "album1")
+		post("/v1/albummanifestupload", "", manifest("user1"))
+		post("/v1/albummanifestupload", "", manifest("user1"))
+		if after, _ := app.AlbumRepo.FindByAlbumUID(ctx, "p1", "db1", "album1"); after.Version != album.Version+2 {
+			t.Errorf("expected both requests to run, version went from %d to %d", album.Version, after.Version)
+		}
+	})
+
+	t.Run("a key in progress is rejected", func(t *testing.T) {
+		service := services.NewIdempotencyService(memoryrepo.NewIdempotencyRepository(), clock, time.Hour)
+		if status, err := service.Begin(ctx, "POST /v1/useralbums", "key-3"); status != 0 || err != nil {
+			t.Fatalf("expected the first request to run, got %d (%v)", status, err)
+		}
+		if _, err := service.Begin(ctx, "POST /v1/useralbums", "key-3"); !errors.Is(err, services.ErrIdempotencyKeyInUse) {
+			t.Errorf("expected ErrIdempotencyKeyInUse, got %v", err)
+		}
+	})
+
+	t.Run("stored statuses expire after the TTL", func(t *testing.T) {
+		clock.Advance(2 * time.Hour)
+		if expired, err := app.IdempotencyService.ExpireStale(ctx); err != nil || expired != 3 {
+			t.Fatalf("expected every stored key expired, got %d (%v)", expired, err)
+		}
+		if resp := post("/v1/albummanifestupload", "key-1", manifest("user1")); resp.Header.Get(cloud.IdempotentReplayedHeader) != "" {
+			t.Error("an expired key should run again")
+		}
+	})
+}
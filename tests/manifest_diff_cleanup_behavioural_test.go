@@ -0,0 +1,138 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/media-vault-sync/internal/adapters/http/onprem"
+	cloudapp "github.com/media-vault-sync/internal/app/cloud"
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+func TestManifestDiff_RecordsRevisionsAndPurgesUnreferencedVideos(t *testing.T) {
+	ctx := context.Background()
+	clock := services.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	cloud := cloudapp.Wire(cloudapp.Config{ObjectRetention: 24 * time.Hour, UnreferencedRetention: time.Hour}, &cloudapp.WireOptions{Clock: clock})
+	server := httptest.NewServer(cloud.Handler)
+	defer server.Close()
+	client := onprem.NewHTTPCloudClient(server.URL, nil)
+
+	manifest := func(albumUID string, videoUIDs ...string) {
+		t.Helper()
+		if err := client.PostAlbumManifestUpload(ctx, services.AlbumManifestUploadRequest{
+			ProviderID: "p1",
+			DatabaseID: "db1",
+			UserID:     "user1",
+			AlbumUID:   albumUID,
+			VideoUIDs:  videoUIDs,
+		}); err != nil {
+			t.Fatalf("failed to upload manifest: %v", err)
+		}
+	}
+	upload := func(albumUID, videoUID string) {
+		t.Helper()
+		if err := client.PostVideoUpload(ctx, services.VideoUploadRequest{
+			ProviderID: "p1",
+			DatabaseID: "db1",
+			UserID:     "user1",
+			AlbumUID:   albumUID,
+			VideoUID:   videoUID,
+			Body:       strings.NewReader("content of " + videoUID),
+		}); err != nil {
+			t.Fatalf("failed to upload %s: %v", videoUID, err)
+		}
+	}
+	blobExists := func(videoUID string) bool {
+		t.Helper()
+		versions, _ := cloud.ObjectRepo.ListVersions(ctx, "p1", "db1", videoUID)
+		if len(versions) == 0 {
+			t.Fatalf("%s has no object", videoUID)
+		}
+		_, err := cloud.BlobStore.Head(ctx, versions[0].StorageKey)
+		if err != nil && !errors.Is(err, services.ErrBlobNotFound) {
+			t.Fatalf("head failed: %v", err)
+		}
+		return err == nil
+	}
+
+	// v3 is shared with album2
+	manifest("album1", "v1", "v2", "v3")
+	manifest("album2", "v3")
+	for _, videoUID := range []string{"v1", "v2", "v3"} {
+		upload("album1", videoUID)
+	}
+
+	manifest("album1", "v1", "v4")
+
+	revisions, err := cloud.ManifestRevisionRepo.List(ctx, services.ManifestRevisionFilter{ProviderID: "p1", DatabaseID: "db1", AlbumUID: "album1"})
+	if err != nil {
+		t.Fatalf("failed to list revisions: %v", err)
+	}
+	if len(revisions) != 2 {
+		t.Fatalf("expected a revision per manifest change, got %d", len(revisions))
+	}
+	if got := strings.Join(revisions[0].Added, ","); got != "v1,v2,v3" || len(revisions[0].Removed) != 0 {
+		t.Errorf("first revision should add every video, got %+v", revisions[0])
+	}
+	if strings.Join(revisions[1].Added, ",") != "v4" || strings.Join(revisions[1].Removed, ",") != "v2,v3" {
+		t.Errorf("expected v4 added and v2, v3 removed, got %+v", revisions[1])
+	}
+
+	manifest("album1", "v1", "v4")
+	if revisions, _ := cloud.ManifestRevisionRepo.List(ctx, services.ManifestRevisionFilter{ProviderID: "p1", DatabaseID: "db1", AlbumUID: "album1"}); len(revisions) != 2 {
+		t.Errorf("an unchanged manifest records no revision, got %d", len(revisions))
+	}
+
+	v2, _ := cloud.ObjectRepo.FindByVideoUID(ctx, "p1", "db1", "v2")
+	v3, _ := cloud.ObjectRepo.FindByVideoUID(ctx, "p1", "db1", "v3")
+	if v2.UnreferencedAt == nil {
+		t.Error("v2 is in no album anymore and should be scheduled for purging")
+	}
+	if v3.UnreferencedAt != nil {
+		t.Error("v3 is still in album2 and must not be scheduled")
+	}
+
+	if purged, _ := cloud.ObjectGarbageCollector.Collect(ctx); purged != 0 {
+		t.Errorf("expected nothing purged within the retention, got %d", purged)
+	}
+
+	clock.Advance(2 * time.Hour)
+	if purged, err := cloud.ObjectGarbageCollector.Collect(ctx); err != nil || purged != 1 {
+		t.Fatalf("expected v2 purged, got %d (%v)", purged, err)
+	}
+	if blobExists("v2") {
+		t.Error("v2 blob should be deleted")
+	}
+	if !blobExists("v1") || !blobExists("v3") {
+		t.Error("referenced blobs must survive")
+	}
+
+	t.Run("re-adding a video cancels its purge", func(t *testing.T) {
+		manifest("album2")
+		manifest("album1", "v1", "v3", "v4")
+
+		clock.Advance(2 * time.Hour)
+		cloud.ObjectGarbageCollector.Collect(ctx)
+		if !blobExists("v3") {
+			t.Error("v3 was re-added before the retention ran out and must survive")
+		}
+	})
+
+	t.Run("a purged video is stored again when re-uploaded", func(t *testing.T) {
+		manifest("album1", "v1", "v2", "v3", "v4")
+		upload("album1", "v2")
+
+		current, _ := cloud.ObjectRepo.FindByVideoUID(ctx, "p1", "db1", "v2")
+		if current == nil || current.Version != 2 || current.PurgedAt != nil {
+			t.Fatalf("expected a fresh version 2 of v2, got %+v", current)
+		}
+		if _, err := cloud.BlobStore.Head(ctx, current.StorageKey); err != nil {
+			t.Errorf("re-uploaded content should be stored again: %v", err)
+		}
+	})
+}
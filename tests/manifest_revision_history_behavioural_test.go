@@ -0,0 +1,180 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/media-vault-sync/internal/adapters/http/onprem"
+	"github.com/media-vault-sync/internal/adapters/mediavault"
+	cloudapp "github.com/media-vault-sync/internal/app/cloud"
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+type manifestRevisionBody struct {
+	Revision  int      `json:"revision"`
+	Source    string   `json:"source"`
+	Added     []string `json:"added"`
+	Removed   []string `json:"removed"`
+	VideoUIDs []string `json:"videoUIDs"`
+}
+
+type manifestRevisionPageBody struct {
+	Revisions  []manifestRevisionBody `json:"revisions"`
+	NextCursor string                 `json:"nextCursor"`
+}
+
+func getManifestHistory(t *testing.T, rawURL string, out any) int {
+	t.Helper()
+	resp, err := http.Get(rawURL)
+	if err != nil {
+		t.Fatalf("history request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("failed to decode history: %v", err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestManifestRevisionHistory_NumbersSourcesAndSnapshots(t *testing.T) {
+	ctx := context.Background()
+	clock := services.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	cloud := cloudapp.Wire(cloudapp.Config{}, &cloudapp.WireOptions{Clock: clock})
+	server := httptest.NewServer(cloud.Handler)
+	defer server.Close()
+	client := onprem.NewHTTPCloudClient(server.URL, nil)
+
+	configPath := filepath.Join(t.TempDir(), "mediavault_config.json")
+	writeAlbum := func(videoUIDs ...string) {
+		data, _ := json.Marshal(mediavault.Config{
+			Providers: []mediavault.ProviderConfig{{
+				ProviderID: "p1",
+				Databases: []mediavault.DatabaseConfig{{
+					DatabaseID: "db1",
+					Users: []mediavault.UserConfig{{
+						UserID: "user1",
+						Albums: []mediavault.AlbumConfig{{AlbumUID: "album1", Videos: videoUIDs}},
+					}},
+				}},
+			}},
+		})
+		os.WriteFile(configPath, data, 0644)
+	}
+	consumer := services.NewAlbumManifestUploadConsumer("p1", mediavault.NewFileSystemMediaVaultRegistry(configPath, &recordingVideoSender{}), client)
+	consume := func(source string) {
+		t.Helper()
+		raw, _ := json.Marshal(services.AlbumManifestUploadPayload{DatabaseID: "db1", AlbumUID: "album1", Source: source})
+		if err := consumer.Handle(ctx, services.Message{Topic: "albummanifestupload", Payload: raw}); err != nil {
+			t.Fatalf("albummanifestupload failed: %v", err)
+		}
+	}
+
+	if err := client.PostAlbumManifestUpload(ctx, services.AlbumManifestUploadRequest{
+		ProviderID: "p1",
+		DatabaseID: "db1",
+		UserID:     "user1",
+		AlbumUID:   "album1",
+		VideoUIDs:  []string{"v1", "v2"},
+	}); err != nil {
+		t.Fatalf("failed to upload manifest: %v", err)
+	}
+	clock.Advance(time.Hour)
+	writeAlbum("v1", "v2", "v3")
+	consume(services.ManifestSourceUserSync)
+	clock.Advance(time.Hour)
+	consume(services.ManifestSourceRepair)
+	clock.Advance(time.Hour)
+	writeAlbum("v3", "v4")
+	consume(services.ManifestSourceRepair)
+
+	base := server.URL + "/v1/providers/p1/databases/db1/albums/album1/revisions"
+
+	var page manifestRevisionPageBody
+	if status := getManifestHistory(t, base, &page); status != http.StatusOK {
+		t.Fatalf("expected 200, got %d", status)
+	}
+	if len(page.Revisions) != 3 {
+		t.Fatalf("an unchanged manifest records no revision, expected 3, got %+v", page.Revisions)
+	}
+	for i, want := range []struct {
+		source, added, removed string
+	}{
+		{services.ManifestSourceUpload, "v1,v2", ""},
+		{services.ManifestSourceUserSync, "v3", ""},
+		{services.ManifestSourceRepair, "v4", "v1,v2"},
+	} {
+		got := page.Revisions[i]
+		if got.Revision != i+1 || got.Source != want.source || strings.Join(got.Added, ",") != want.added || strings.Join(got.Removed, ",") != want.removed {
+			t.Errorf("revision %d: expected %+v, got %+v", i+1, want, got)
+		}
+	}
+
+	t.Run("history pages through in order", func(t *testing.T) {
+		var seen []int
+		cursor := ""
+		for pages := 0; ; pages++ {
+			if pages > 3 {
+				t.Fatal("pagination does not terminate")
+			}
+			var page manifestRevisionPageBody
+			getManifestHistory(t, base+"?limit=2&cursor="+url.QueryEscape(cursor), &page)
+			for _, revision := range page.Revisions {
+				seen = append(seen, revision.Revision)
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			cursor = page.NextCursor
+		}
+		if len(seen) != 3 || seen[0] != 1 || seen[2] != 3 {
+			t.Errorf("unexpected revisions across pages: %v", seen)
+		}
+	})
+
+	t.Run("history filters by time", func(t *testing.T) {
+		since := time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC).Format(time.RFC3339)
+		before := time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC).Format(time.RFC3339)
+		var page manifestRevisionPageBody
+		getManifestHistory(t, base+"?createdSince="+since+"&createdBefore="+before, &page)
+		if len(page.Revisions) != 1 || page.Revisions[0].Revision != 2 {
+			t.Errorf("expected only revision 2 in the window, got %+v", page.Revisions)
+		}
+	})
+
+	t.Run("a revision shows the manifest as of it", func(t *testing.T) {
+		for revision, want := range map[string]string{"1": "v1,v2", "2": "v1,v2,v3", "3": "v3,v4"} {
+			var snapshot manifestRevisionBody
+			if status := getManifestHistory(t, base+"/"+revision, &snapshot); status != http.StatusOK {
+				t.Fatalf("revision %s: expected 200, got %d", revision, status)
+			}
+			if got := strings.Join(snapshot.VideoUIDs, ","); got != want {
+				t.Errorf("revision %s: expected %s, got %s", revision, want, got)
+			}
+		}
+	})
+
+	t.Run("unknown albums, revisions and bad parameters", func(t *testing.T) {
+		for path, want := range map[string]int{
+			"/v1/providers/p1/databases/db1/albums/nope/revisions":               http.StatusNotFound,
+			"/v1/providers/p1/databases/db1/albums/album1/revisions/4":           http.StatusNotFound,
+			"/v1/providers/p1/databases/db1/albums/album1/revisions/x":           http.StatusBadRequest,
+			"/v1/providers/p1/databases/db1/albums/album1/revisions?cursor=bad!": http.StatusBadRequest,
+		} {
+			var ignored manifestRevisionPageBody
+			if status := getManifestHistory(t, server.URL+path, &ignored); status != want {
+				t.Errorf("%s: expected %d, got %d", path, want, status)
+			}
+		}
+	})
+}
@@ -0,0 +1,223 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/media-vault-sync/internal/adapters/mediavault"
+	"github.com/media-vault-sync/internal/adapters/queue/memory"
+	memoryrepo "github.com/media-vault-sync/internal/adapters/repo/memory"
+	onpremapp "github.com/media-vault-sync/internal/app/onprem"
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+// countingCloudClient records the user albums posts of the on-prem consumers.
+type countingCloudClient struct {
+	userAlbums []services.UserAlbumsRequest
+}
+
+func (c *countingCloudClient) PostUserAlbums(ctx context.Context, req services.UserAlbumsRequest) error {
+	c.userAlbums = append(c.userAlbums, req)
+	return nil
+}
+
+func (c *countingCloudClient) PostAlbumManifestUpload(ctx context.Context, req services.AlbumManifestUploadRequest) error {
+	return nil
+}
+
+func (c *countingCloudClient) PostVideoUpload(ctx context.Context, req services.VideoUploadRequest) error {
+	return nil
+}
+
+// lossyDeleteOutbox fails the next failures deletes, like a relay crashing
+// right after publishing.
+type lossyDeleteOutbox struct {
+	*memoryrepo.OutboxRepository
+	failures int
+}
+
+func (r *lossyDeleteOutbox) Delete(ctx context.Context, id string) error {
+	if r.failures > 0 {
+		r.failures--
+		return errors.New("connection lost")
+	}
+	return r.OutboxRepository.Delete(ctx, id)
+}
+
+func TestMessageDeduplication_DuplicatesAreHandledOnce(t *testing.T) {
+	ctx := context.Background()
+	clock := services.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	t.Run("a message the relay publishes twice is delivered once", func(t *testing.T) {
+		queue := memory.NewInMemoryQueue(clock)
+		outbox := &lossyDeleteOutbox{OutboxRepository: memoryrepo.NewOutboxRepository()}
+		publisher := services.NewOutboxPublisher(outbox, queue, clock)
+		relay := services.NewOutboxRelay(outbox, queue, memoryrepo.NewTransactor())
+
+		var delivered []services.Message
+		queue.Subscribe(ctx, "sub", "videoupload", "p1", func(ctx context.Context, msg services.Message) error {
+			delivered = append(delivered, msg)
+			return nil
+		})
+
+		publisher.Publish(ctx, services.Message{Topic: "videoupload", Payload: []byte(`{}`), Metadata: map[string]string{"providerID": "p1"}})
+
+		outbox.failures = 1
+		if _, err := relay.Relay(ctx); err == nil {
+			t.Fatal("expected the lost delete to fail the relay")
+		}
+		if relayed, err := relay.Relay(ctx); err != nil || relayed != 1 {
+			t.Fatalf("expected the message relayed again, got %d (%v)", relayed, err)
+		}
+		queue.Process(ctx)
+
+		if len(delivered) != 1 || delivered[0].MessageID == "" {
+			t.Errorf("expected one delivery with an assigned ID, got %+v", delivered)
+		}
+	})
+
+	t.Run("consumers skip messages they already processed", func(t *testing.T) {
+		deduplicator := services.NewMessageDeduplicator(memoryrepo.NewProcessedMessageRepository(), memoryrepo.NewTransactor(), clock, time.Hour)
+
+		failures := 1
+		runs := 0
+		handler := deduplicator.Handler("consumer-a", func(ctx context.Context, msg services.Message) error {
+			runs++
+			if failures > 0 {
+				failures--
+				return errors.New("cloud unavailable")
+			}
+			return nil
+		})
+		msg := services.Message{MessageID: "m1", Topic: "usersync"}
+
+		if err := handler(ctx, msg); err == nil {
+			t.Fatal("expected the failure to reach the queue")
+		}
+		for i := 0; i < 2; i++ {
+			if err := handler(ctx, msg); err != nil {
+				t.Fatalf("delivery failed: %v", err)
+			}
+		}
+		if runs != 2 {
+			t.Errorf("expected the failed delivery retried and the redelivery skipped, got %d runs", runs)
+		}
+
+		other := deduplicator.Handler("consumer-b", func(ctx context.Context, msg services.Message) error {
+			runs++
+			return nil
+		})
+		other(ctx, msg)
+		if runs != 3 {
+			t.Error("every consumer processes a message once")
+		}
+
+		clock.Advance(2 * time.Hour)
+		if expired, err := deduplicator.ExpireStale(ctx); err != nil || expired != 2 {
+			t.Errorf("expected both records expired, got %d (%v)", expired, err)
+		}
+	})
+
+	t.Run("a delivery cut short leaves the message for its redelivery", func(t *testing.T) {
+		repo := memoryrepo.NewProcessedMessageRepository()
+		deduplicator := services.NewMessageDeduplicator(repo, memoryrepo.NewTransactor(), clock, time.Hour)
+
+		runs := 0
+		handler := deduplicator.Handler("consumer-a", func(ctx context.Context, msg services.Message) error {
+			runs++
+			if processed, _ := repo.IsProcessed(ctx, "consumer-a", msg.MessageID); processed {
+				t.Error("expected the message unmarked while its handler runs")
+			}
+			if runs == 1 {
+				// the process dies or loses its lease before the handler returns
+				return context.Canceled
+			}
+			return nil
+		})
+		msg := services.Message{MessageID: "m3", Topic: "usersync"}
+
+		handler(ctx, msg)
+		if err := handler(ctx, msg); err != nil {
+			t.Fatalf("redelivery failed: %v", err)
+		}
+		handler(ctx, msg)
+		if runs != 2 {
+			t.Errorf("expected the redelivery run and the one after it skipped, got %d runs", runs)
+		}
+	})
+
+	t.Run("only the transactional form runs the handler in a unit of work", func(t *testing.T) {
+		transactor := &recordingTransactor{}
+		deduplicator := services.NewMessageDeduplicator(memoryrepo.NewProcessedMessageRepository(), transactor, clock, time.Hour)
+
+		var inTx []bool
+		record := func(ctx context.Context, msg services.Message) error {
+			inTx = append(inTx, transactor.active > 0)
+			return nil
+		}
+		deduplicator.Handler("upload", record)(ctx, services.Message{MessageID: "m2"})
+		deduplicator.HandlerInTx("check", record)(ctx, services.Message{MessageID: "m2"})
+
+		if len(inTx) != 2 || inTx[0] || !inTx[1] {
+			t.Errorf("expected only HandlerInTx to hold a unit of work around the handler, got %v", inTx)
+		}
+	})
+
+	t.Run("on-prem consumers handle a redelivered usersync once", func(t *testing.T) {
+		configPath := filepath.Join(t.TempDir(), "mediavault_config.json")
+		data, _ := json.Marshal(mediavault.Config{
+			Providers: []mediavault.ProviderConfig{{
+				ProviderID: "p1",
+				Databases: []mediavault.DatabaseConfig{{
+					DatabaseID: "db1",
+					Users: []mediavault.UserConfig{{
+						UserID: "user1",
+						Albums: []mediavault.AlbumConfig{{AlbumUID: "album1", Videos: []string{"v1"}}},
+					}},
+				}},
+			}},
+		})
+		os.WriteFile(configPath, data, 0644)
+
+		// no dedup window, so the queue delivers the duplicate
+		cloudClient := &countingCloudClient{}
+		app := onpremapp.Wire(onpremapp.Config{ProviderID: "p1", MediaVaultConfigPath: configPath}, &onpremapp.WireOptions{
+			Clock:       clock,
+			CloudClient: cloudClient,
+		})
+		if err := app.SubscribeAll(ctx); err != nil {
+			t.Fatalf("subscribe failed: %v", err)
+		}
+
+		payload, _ := json.Marshal(services.SyncUserPayload{DatabaseID: "db1", UserID: "user1"})
+		for i := 0; i < 2; i++ {
+			app.Queue.Publish(ctx, services.Message{
+				MessageID: "sync-1",
+				Topic:     "usersync",
+				Payload:   payload,
+				Metadata:  map[string]string{"providerID": "p1"},
+			})
+		}
+		app.Queue.Process(ctx)
+
+		if len(cloudClient.userAlbums) != 1 {
+			t.Errorf("expected one user albums post, got %d", len(cloudClient.userAlbums))
+		}
+	})
+}
+
+// recordingTransactor counts the units of work in progress.
+type recordingTransactor struct {
+	active int
+}
+
+func (t *recordingTransactor) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	t.active++
+	defer func() { t.active-- }()
+	return fn(ctx)
+}
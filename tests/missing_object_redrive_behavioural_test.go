@@ -0,0 +1,141 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/media-vault-sync/internal/adapters/http/onprem"
+	"github.com/media-vault-sync/internal/adapters/queue/memory"
+	cloudapp "github.com/media-vault-sync/internal/app/cloud"
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+func TestMissingObjectRedrive_TargetsIncompleteAlbumsAfterGracePeriod(t *testing.T) {
+	ctx := context.Background()
+	clock := services.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	queue := memory.NewInMemoryQueue(clock)
+
+	cloud := cloudapp.Wire(cloudapp.Config{MissingObjectGrace: time.Hour}, &cloudapp.WireOptions{
+		Clock: clock,
+		Queue: queue,
+	})
+	server := httptest.NewServer(cloud.Handler)
+	defer server.Close()
+	client := onprem.NewHTTPCloudClient(server.URL, nil)
+
+	var videoUploads, manifestRequests, checks []services.Message
+	queue.Subscribe(ctx, "onprem:p1:videoupload", "videoupload", "p1", func(ctx context.Context, msg services.Message) error {
+		videoUploads = append(videoUploads, msg)
+		return nil
+	})
+	queue.Subscribe(ctx, "onprem:p1:albummanifestupload", "albummanifestupload", "p1", func(ctx context.Context, msg services.Message) error {
+		manifestRequests = append(manifestRequests, msg)
+		return nil
+	})
+	queue.Subscribe(ctx, "cloud:syncconsistencycheck", "syncconsistencycheck", "", func(ctx context.Context, msg services.Message) error {
+		checks = append(checks, msg)
+		return nil
+	})
+
+	// album1 misses v2, album2 is complete
+	manifests := map[string][]string{"album1": {"v1", "v2", "v3"}, "album2": {"v4"}}
+	for albumUID, videoUIDs := range manifests {
+		if err := client.PostAlbumManifestUpload(ctx, services.AlbumManifestUploadRequest{
+			ProviderID: "p1",
+			DatabaseID: "db1",
+			UserID:     "user1",
+			AlbumUID:   albumUID,
+			VideoUIDs:  videoUIDs,
+		}); err != nil {
+			t.Fatalf("failed to upload manifest: %v", err)
+		}
+	}
+	for albumUID, videoUIDs := range map[string][]string{"album1": {"v1", "v3"}, "album2": {"v4"}} {
+		for _, videoUID := range videoUIDs {
+			if err := client.PostVideoUpload(ctx, services.VideoUploadRequest{
+				ProviderID: "p1",
+				DatabaseID: "db1",
+				UserID:     "user1",
+				AlbumUID:   albumUID,
+				VideoUID:   videoUID,
+				Body:       strings.NewReader("content of " + videoUID),
+			}); err != nil {
+				t.Fatalf("failed to upload %s: %v", videoUID, err)
+			}
+		}
+	}
+	queue.Process(ctx)
+	videoUploads = nil
+	before, _ := cloud.AlbumRepo.FindByAlbumUID(ctx, "p1", "db1", "album1")
+
+	if err := cloud.EventualConsistencyWorker.Scan(ctx); err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+	queue.Process(ctx)
+	if len(videoUploads) != 0 {
+		t.Fatalf("uploads may still be in flight within the grace period, got %d re-drives", len(videoUploads))
+	}
+
+	clock.Advance(2 * time.Hour)
+	if err := cloud.EventualConsistencyWorker.Scan(ctx); err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+	queue.Process(ctx)
+
+	if len(videoUploads) != 1 {
+		t.Fatalf("expected one videoupload re-drive, got %d", len(videoUploads))
+	}
+	var payload services.VideoUploadPayload
+	json.Unmarshal(videoUploads[0].Payload, &payload)
+	if payload.DatabaseID != "db1" || payload.AlbumUID != "album1" || len(payload.VideoUIDs) != 1 || payload.VideoUIDs[0] != "v2" {
+		t.Errorf("expected re-drive of v2 in db1/album1, got %+v", payload)
+	}
+	if len(manifestRequests) != 0 || len(checks) != 0 {
+		t.Errorf("a synced album needs no manifest refresh, got %d manifest requests and %d checks", len(manifestRequests), len(checks))
+	}
+	after, _ := cloud.AlbumRepo.FindByAlbumUID(ctx, "p1", "db1", "album1")
+	if after.Version != before.Version || !after.UpdatedAt.Equal(before.UpdatedAt) {
+		t.Errorf("expected the re-drive to leave the album as it was, got version %d updated %s, was %d %s", after.Version, after.UpdatedAt, before.Version, before.UpdatedAt)
+	}
+
+	t.Run("re-drives wait another grace period", func(t *testing.T) {
+		videoUploads = nil
+		cloud.EventualConsistencyWorker.Scan(ctx)
+		queue.Process(ctx)
+		if len(videoUploads) != 0 {
+			t.Fatalf("album was just re-driven, got %d more re-drives", len(videoUploads))
+		}
+
+		clock.Advance(2 * time.Hour)
+		cloud.EventualConsistencyWorker.Scan(ctx)
+		queue.Process(ctx)
+		if len(videoUploads) != 1 {
+			t.Errorf("expected another re-drive after the grace period, got %d", len(videoUploads))
+		}
+	})
+
+	t.Run("complete albums are left alone", func(t *testing.T) {
+		if err := client.PostVideoUpload(ctx, services.VideoUploadRequest{
+			ProviderID: "p1",
+			DatabaseID: "db1",
+			UserID:     "user1",
+			AlbumUID:   "album1",
+			VideoUID:   "v2",
+			Body:       strings.NewReader("content of v2"),
+		}); err != nil {
+			t.Fatalf("failed to upload v2: %v", err)
+		}
+
+		videoUploads = nil
+		clock.Advance(2 * time.Hour)
+		cloud.EventualConsistencyWorker.Scan(ctx)
+		queue.Process(ctx)
+		if len(videoUploads) != 0 {
+			t.Errorf("album1 is complete, got %d re-drives", len(videoUploads))
+		}
+	})
+}
@@ -3,13 +3,19 @@ package tests
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"os"
+	"sync"
 	"testing"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
+	memoryqueue "github.com/media-vault-sync/internal/adapters/queue/memory"
 	"github.com/media-vault-sync/internal/adapters/repo/mysql"
 	"github.com/media-vault-sync/internal/core/domain"
+	"github.com/media-vault-sync/internal/core/services"
+	"github.com/media-vault-sync/migrations"
 )
 
 func TestMySQL_SchemaAndUpsert(t *testing.T) {
@@ -96,6 +102,34 @@ func TestMySQL_SchemaAndUpsert(t *testing.T) {
 
 	cleanupTables(t, db)
 
+	t.Run("album updates compare versions", func(t *testing.T) {
+		raceAlbumUpdates(t, ctx, mysql.NewAlbumRepository(db), "race-album")
+	})
+
+	cleanupTables(t, db)
+
+	t.Run("albums whose IDs join to the same string do not collide", func(t *testing.T) {
+		service := services.NewAlbumManifestUploadService(
+			mysql.NewAlbumRepository(db),
+			mysql.NewAlbumVideoRepository(db),
+			mysql.NewManifestRevisionRepository(db),
+			mysql.NewObjectRepository(db),
+			mysql.NewTransactor(db),
+			memoryqueue.NewInMemoryQueue(services.NewFakeClock(time.Now())),
+			services.NewFakeClock(time.Now()),
+		)
+		for _, req := range []services.AlbumManifestUploadRequest{
+			{ProviderID: "a-b", DatabaseID: "c", UserID: "user1", AlbumUID: "d"},
+			{ProviderID: "a", DatabaseID: "b-c", UserID: "user1", AlbumUID: "d"},
+		} {
+			if err := service.ProcessAlbumManifestUpload(ctx, req); err != nil {
+				t.Fatalf("manifest upload of %s/%s failed: %v", req.ProviderID, req.DatabaseID, err)
+			}
+		}
+	})
+
+	cleanupTables(t, db)
+
 	t.Run("manifest membership updates correctly", func(t *testing.T) {
 		albumVideoRepo := mysql.NewAlbumVideoRepository(db)
 
@@ -248,70 +282,634 @@ func TestMySQL_SchemaAndUpsert(t *testing.T) {
 			t.Errorf("expected size 2048 after upsert, got %d", found.SizeBytes)
 		}
 	})
-}
 
-func runMigrations(t *testing.T, db *sql.DB) {
-	t.Helper()
+	cleanupTables(t, db)
 
-	migrations := []string{
-		`CREATE TABLE IF NOT EXISTS albums (
-			uid VARCHAR(255) NOT NULL PRIMARY KEY,
-			provider_id VARCHAR(255) NOT NULL,
-			database_id VARCHAR(255) NOT NULL,
-			user_id VARCHAR(255) NOT NULL,
-			album_uid VARCHAR(255) NOT NULL,
-			synced BOOLEAN NOT NULL DEFAULT FALSE,
-			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-			updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
-			UNIQUE KEY uk_album (provider_id, database_id, album_uid)
-		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
-
-		`CREATE TABLE IF NOT EXISTS album_videos (
-			id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
-			provider_id VARCHAR(255) NOT NULL,
-			database_id VARCHAR(255) NOT NULL,
-			album_uid VARCHAR(255) NOT NULL,
-			video_uid VARCHAR(255) NOT NULL,
-			UNIQUE KEY uk_album_video (provider_id, database_id, album_uid, video_uid),
-			INDEX idx_album_lookup (provider_id, database_id, album_uid)
-		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
-
-		`CREATE TABLE IF NOT EXISTS videos (
-			uid VARCHAR(255) NOT NULL PRIMARY KEY,
-			provider_id VARCHAR(255) NOT NULL,
-			database_id VARCHAR(255) NOT NULL,
-			user_id VARCHAR(255) NOT NULL,
-			video_uid VARCHAR(255) NOT NULL,
-			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-			updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
-			UNIQUE KEY uk_video (provider_id, database_id, video_uid)
-		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
-
-		`CREATE TABLE IF NOT EXISTS objects (
-			uid VARCHAR(255) NOT NULL PRIMARY KEY,
-			provider_id VARCHAR(255) NOT NULL,
-			database_id VARCHAR(255) NOT NULL,
-			video_uid VARCHAR(255) NOT NULL,
-			storage_key VARCHAR(1024) NOT NULL,
-			size_bytes BIGINT NOT NULL,
-			checksum VARCHAR(255) NOT NULL,
-			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-			UNIQUE KEY uk_object (provider_id, database_id, video_uid)
-		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
-	}
+	t.Run("object versions keep history", func(t *testing.T) {
+		objectRepo := mysql.NewObjectRepository(db)
+		now := time.Now().UTC().Truncate(time.Second)
+
+		for version := 1; version <= 2; version++ {
+			err := objectRepo.AddVersion(ctx, &domain.Object{
+				UID:        fmt.Sprintf("obj-uid-v%d", version),
+				ProviderID: "p1",
+				DatabaseID: "db1",
+				VideoUID:   "v1",
+				Version:    version,
+				StorageKey: fmt.Sprintf("key-v%d", version),
+				SizeBytes:  1024,
+				Checksum:   fmt.Sprintf("sum-v%d", version),
+				CreatedAt:  now.Add(time.Duration(version) * time.Minute),
+			})
+			if err != nil {
+				t.Fatalf("failed to add version %d: %v", version, err)
+			}
+		}
+
+		current, err := objectRepo.FindByVideoUID(ctx, "p1", "db1", "v1")
+		if err != nil {
+			t.Fatalf("failed to find current version: %v", err)
+		}
+		if current == nil || current.Version != 2 {
+			t.Fatalf("expected current version 2, got %+v", current)
+		}
+
+		versions, err := objectRepo.ListVersions(ctx, "p1", "db1", "v1")
+		if err != nil {
+			t.Fatalf("failed to list versions: %v", err)
+		}
+		if len(versions) != 2 || versions[0].SupersededAt == nil {
+			t.Fatalf("expected v1 superseded in history, got %+v", versions)
+		}
+
+		superseded, err := objectRepo.FindSuperseded(ctx, now.Add(time.Hour), 10)
+		if err != nil {
+			t.Fatalf("failed to find superseded: %v", err)
+		}
+		if len(superseded) != 1 || superseded[0].UID != "obj-uid-v1" {
+			t.Fatalf("expected only v1 superseded, got %+v", superseded)
+		}
+
+		if err := objectRepo.MarkPurged(ctx, "obj-uid-v1", now.Add(time.Hour)); err != nil {
+			t.Fatalf("failed to mark purged: %v", err)
+		}
+		superseded, _ = objectRepo.FindSuperseded(ctx, now.Add(time.Hour), 10)
+		if len(superseded) != 0 {
+			t.Errorf("purged versions should not be returned, got %d", len(superseded))
+		}
+	})
+
+	cleanupTables(t, db)
+
+	t.Run("concurrent versions are numbered in turn", func(t *testing.T) {
+		objectRepo := mysql.NewObjectRepository(db)
+		now := time.Now().UTC().Truncate(time.Second)
+
+		const writers = 8
+		var wg sync.WaitGroup
+		for i := range writers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					err := objectRepo.AddVersion(ctx, &domain.Object{
+						UID:        fmt.Sprintf("concurrent-obj-%d", i),
+						ProviderID: "p1",
+						DatabaseID: "db1",
+						VideoUID:   "v1",
+						StorageKey: fmt.Sprintf("key-%d", i),
+						Checksum:   fmt.Sprintf("sum-%d", i),
+						CreatedAt:  now,
+					})
+					if !errors.Is(err, services.ErrObjectVersionConflict) {
+						if err != nil {
+							t.Errorf("failed to add version %d: %v", i, err)
+						}
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		versions, err := objectRepo.ListVersions(ctx, "p1", "db1", "v1")
+		if err != nil {
+			t.Fatalf("failed to list versions: %v", err)
+		}
+		if len(versions) != writers {
+			t.Fatalf("expected %d versions, got %d", writers, len(versions))
+		}
+		current := 0
+		for i, version := range versions {
+			if version.Version != i+1 {
+				t.Errorf("expected version %d, got %d", i+1, version.Version)
+			}
+			if version.SupersededAt == nil {
+				current++
+			}
+		}
+		if current != 1 {
+			t.Errorf("expected one current version, got %d", current)
+		}
+	})
+
+	cleanupTables(t, db)
+
+	t.Run("shared storage keys are reference counted", func(t *testing.T) {
+		objectRepo := mysql.NewObjectRepository(db)
+		now := time.Now().UTC().Truncate(time.Second)
+
+		for _, videoUID := range []string{"v1", "v2"} {
+			err := objectRepo.AddVersion(ctx, &domain.Object{
+				UID:        "obj-" + videoUID,
+				ProviderID: "p1",
+				DatabaseID: "db1",
+				VideoUID:   videoUID,
+				Version:    1,
+				StorageKey: "blobs/sha256/shared",
+				SizeBytes:  1024,
+				Checksum:   "shared",
+				CreatedAt:  now,
+			})
+			if err != nil {
+				t.Fatalf("failed to add object for %s: %v", videoUID, err)
+			}
+		}
+
+		count, err := objectRepo.CountByStorageKey(ctx, "blobs/sha256/shared")
+		if err != nil {
+			t.Fatalf("failed to count references: %v", err)
+		}
+		if count != 2 {
+			t.Errorf("expected 2 references, got %d", count)
+		}
+
+		if err := objectRepo.MarkPurged(ctx, "obj-v1", now); err != nil {
+			t.Fatalf("failed to mark purged: %v", err)
+		}
+		count, _ = objectRepo.CountByStorageKey(ctx, "blobs/sha256/shared")
+		if count != 1 {
+			t.Errorf("purged versions should not count as references, got %d", count)
+		}
+
+		err = objectRepo.Purge(ctx, "obj-v2", now, func(references int) error {
+			return errors.New("blob store unavailable")
+		})
+		if err == nil {
+			t.Fatal("expected the failed release to be returned")
+		}
+		if count, _ := objectRepo.CountByStorageKey(ctx, "blobs/sha256/shared"); count != 1 {
+			t.Errorf("a failed release should leave the version unpurged, got %d references", count)
+		}
+
+		released := -1
+		err = objectRepo.Purge(ctx, "obj-v2", now, func(references int) error {
+			released = references
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("failed to purge: %v", err)
+		}
+		if released != 0 {
+			t.Errorf("expected the last reference released, got %d", released)
+		}
+	})
+
+	cleanupTables(t, db)
+
+	t.Run("list methods page by keyset and filter", func(t *testing.T) {
+		albumRepo := mysql.NewAlbumRepository(db)
+		videoRepo := mysql.NewVideoRepository(db)
+		objectRepo := mysql.NewObjectRepository(db)
+		now := time.Now().UTC().Truncate(time.Second)
+
+		for i := 1; i <= 3; i++ {
+			userID := "user1"
+			if i == 2 {
+				userID = "user2"
+			}
+			err := albumRepo.Create(ctx, &domain.Album{
+				UID:        fmt.Sprintf("list-album-%d", i),
+				ProviderID: "p1",
+				DatabaseID: "db1",
+				UserID:     userID,
+				AlbumUID:   fmt.Sprintf("album%d", i),
+				Synced:     i != 3,
+				CreatedAt:  now,
+				UpdatedAt:  now.Add(time.Duration(i) * time.Hour),
+			})
+			if err != nil {
+				t.Fatalf("failed to create album: %v", err)
+			}
+			err = videoRepo.Upsert(ctx, &domain.Video{
+				UID:        fmt.Sprintf("list-video-%d", i),
+				ProviderID: "p1",
+				DatabaseID: "db1",
+				UserID:     userID,
+				VideoUID:   fmt.Sprintf("v%d", i),
+				CreatedAt:  now,
+				UpdatedAt:  now,
+			})
+			if err != nil {
+				t.Fatalf("failed to upsert video: %v", err)
+			}
+			for version := 1; version <= 2; version++ {
+				err = objectRepo.AddVersion(ctx, &domain.Object{
+					UID:        fmt.Sprintf("list-obj-%d-v%d", i, version),
+					ProviderID: "p1",
+					DatabaseID: "db1",
+					VideoUID:   fmt.Sprintf("v%d", i),
+					Version:    version,
+					StorageKey: fmt.Sprintf("key-%d-v%d", i, version),
+					Checksum:   fmt.Sprintf("sum-%d-v%d", i, version),
+					CreatedAt:  now.Add(time.Duration(version) * time.Minute),
+				})
+				if err != nil {
+					t.Fatalf("failed to add object: %v", err)
+				}
+			}
+		}
+
+		albums, err := albumRepo.List(ctx, services.AlbumFilter{ProviderID: "p1", DatabaseID: "db1", AfterAlbumUID: "album1", Limit: 1})
+		if err != nil {
+			t.Fatalf("failed to list albums: %v", err)
+		}
+		if len(albums) != 1 || albums[0].AlbumUID != "album2" {
+			t.Errorf("expected album2 after album1, got %+v", albums)
+		}
+
+		unsynced := false
+		albums, _ = albumRepo.List(ctx, services.AlbumFilter{ProviderID: "p1", DatabaseID: "db1", UserID: "user1", Synced: &unsynced})
+		if len(albums) != 1 || albums[0].AlbumUID != "album3" {
+			t.Errorf("expected album3 for user1 out of sync, got %+v", albums)
+		}
+
+		albums, _ = albumRepo.List(ctx, services.AlbumFilter{ProviderID: "p1", DatabaseID: "db1", UpdatedSince: now.Add(2 * time.Hour), UpdatedBefore: now.Add(3 * time.Hour)})
+		if len(albums) != 1 || albums[0].AlbumUID != "album2" {
+			t.Errorf("expected album2 in the time window, got %+v", albums)
+		}
+
+		videos, err := videoRepo.List(ctx, services.VideoFilter{ProviderID: "p1", DatabaseID: "db1", UserID: "user1"})
+		if err != nil {
+			t.Fatalf("failed to list videos: %v", err)
+		}
+		if len(videos) != 2 || videos[0].VideoUID != "v1" || videos[1].VideoUID != "v3" {
+			t.Errorf("expected v1 and v3 for user1, got %+v", videos)
+		}
+
+		objects, err := objectRepo.List(ctx, services.ObjectFilter{ProviderID: "p1", DatabaseID: "db1"})
+		if err != nil {
+			t.Fatalf("failed to list objects: %v", err)
+		}
+		if len(objects) != 3 {
+			t.Errorf("expected only current versions, got %d objects", len(objects))
+		}
+
+		objects, _ = objectRepo.List(ctx, services.ObjectFilter{ProviderID: "p1", DatabaseID: "db1", IncludeSuperseded: true, AfterVideoUID: "v1", AfterVersion: 1, Limit: 2})
+		if len(objects) != 2 || objects[0].UID != "list-obj-1-v2" || objects[1].UID != "list-obj-2-v1" {
+			t.Errorf("expected the page after (v1, 1), got %+v", objects)
+		}
+	})
+
+	cleanupTables(t, db)
+
+	t.Run("re-drive candidates are found after the cutoff", func(t *testing.T) {
+		albumRepo := mysql.NewAlbumRepository(db)
+		now := time.Now().UTC().Truncate(time.Second)
+
+		for _, albumUID := range []string{"redriven", "waiting", "unsynced"} {
+			err := albumRepo.Create(ctx, &domain.Album{
+				UID:        "redrive-" + albumUID,
+				ProviderID: "p1",
+				DatabaseID: "db1",
+				UserID:     "user1",
+				AlbumUID:   albumUID,
+				Synced:     albumUID != "unsynced",
+				CreatedAt:  now,
+				UpdatedAt:  now,
+			})
+			if err != nil {
+				t.Fatalf("failed to create album: %v", err)
+			}
+		}
+
+		albums, err := albumRepo.FindRedriveCandidates(ctx, now)
+		if err != nil {
+			t.Fatalf("failed to find re-drive candidates: %v", err)
+		}
+		if len(albums) != 0 {
+			t.Errorf("albums updated at the cutoff are still in their grace period, got %+v", albums)
+		}
+
+		cutoff := now.Add(time.Hour)
+		if err := albumRepo.MarkRedriven(ctx, "p1", "db1", "redriven", cutoff); err != nil {
+			t.Fatalf("failed to mark the re-drive: %v", err)
+		}
+		albums, _ = albumRepo.FindRedriveCandidates(ctx, cutoff)
+		if len(albums) != 1 || albums[0].AlbumUID != "waiting" {
+			t.Errorf("expected only the synced album not re-driven since the cutoff, got %+v", albums)
+		}
+
+		album, _ := albumRepo.FindByAlbumUID(ctx, "p1", "db1", "redriven")
+		if album.Version != 1 || !album.UpdatedAt.Equal(now) {
+			t.Errorf("expected the re-drive to leave version and updated_at alone, got %+v", album)
+		}
+	})
+
+	cleanupTables(t, db)
 
-	for _, m := range migrations {
-		_, err := db.Exec(m)
+	t.Run("manifest revisions and unreferenced objects", func(t *testing.T) {
+		albumVideoRepo := mysql.NewAlbumVideoRepository(db)
+		objectRepo := mysql.NewObjectRepository(db)
+		revisionRepo := mysql.NewManifestRevisionRepository(db)
+		now := time.Now().UTC().Truncate(time.Second)
+
+		for i, revision := range []*domain.ManifestRevision{
+			{UID: "rev-1", ProviderID: "p1", DatabaseID: "db1", AlbumUID: "album1", Added: []string{"v1", "v2"}, CreatedAt: now},
+			{UID: "rev-2", ProviderID: "p1", DatabaseID: "db1", AlbumUID: "album1", Source: "usersync", Removed: []string{"v2"}, CreatedAt: now.Add(time.Minute)},
+			{UID: "rev-3", ProviderID: "p1", DatabaseID: "db1", AlbumUID: "album2", Added: []string{"v3"}, CreatedAt: now},
+		} {
+			if err := revisionRepo.Add(ctx, revision); err != nil {
+				t.Fatalf("failed to add revision %d: %v", i, err)
+			}
+		}
+		filter := services.ManifestRevisionFilter{ProviderID: "p1", DatabaseID: "db1", AlbumUID: "album1"}
+		revisions, err := revisionRepo.List(ctx, filter)
 		if err != nil {
-			t.Fatalf("failed to run migration: %v", err)
+			t.Fatalf("failed to list revisions: %v", err)
+		}
+		if len(revisions) != 2 || len(revisions[0].Added) != 2 || len(revisions[0].Removed) != 0 || revisions[1].Removed[0] != "v2" {
+			t.Errorf("unexpected revisions: %+v", revisions)
+		}
+		if revisions[0].Revision != 1 || revisions[1].Revision != 2 || revisions[1].Source != "usersync" {
+			t.Errorf("expected revisions numbered per album with their source, got %+v", revisions)
+		}
+		if others, _ := revisionRepo.List(ctx, services.ManifestRevisionFilter{ProviderID: "p1", DatabaseID: "db1", AlbumUID: "album2"}); len(others) != 1 || others[0].Revision != 1 {
+			t.Errorf("album2 numbers its own revisions, got %+v", others)
+		}
+
+		filter.AfterRevision = 1
+		if page, _ := revisionRepo.List(ctx, filter); len(page) != 1 || page[0].UID != "rev-2" {
+			t.Errorf("expected only rev-2 after revision 1, got %+v", page)
+		}
+		filter = services.ManifestRevisionFilter{ProviderID: "p1", DatabaseID: "db1", AlbumUID: "album1", CreatedSince: now.Add(30 * time.Second), Limit: 1}
+		if page, _ := revisionRepo.List(ctx, filter); len(page) != 1 || page[0].UID != "rev-2" {
+			t.Errorf("expected rev-2 created in the window, got %+v", page)
+		}
+
+		err = albumVideoRepo.ReplaceForAlbum(ctx, "p1", "db1", "album1", []domain.AlbumVideo{
+			{ProviderID: "p1", DatabaseID: "db1", AlbumUID: "album1", VideoUID: "v1"},
+		})
+		if err != nil {
+			t.Fatalf("failed to store manifest: %v", err)
+		}
+		if count, _ := albumVideoRepo.CountByVideoUID(ctx, "p1", "db1", "v1"); count != 1 {
+			t.Errorf("expected v1 in one album, got %d", count)
+		}
+		if count, _ := albumVideoRepo.CountByVideoUID(ctx, "p1", "db1", "v2"); count != 0 {
+			t.Errorf("expected v2 in no album, got %d", count)
 		}
+
+		err = objectRepo.AddVersion(ctx, &domain.Object{
+			UID:        "unref-v2",
+			ProviderID: "p1",
+			DatabaseID: "db1",
+			VideoUID:   "v2",
+			Version:    1,
+			StorageKey: "key-v2",
+			Checksum:   "sum-v2",
+			CreatedAt:  now,
+		})
+		if err != nil {
+			t.Fatalf("failed to add object: %v", err)
+		}
+
+		if err := objectRepo.MarkUnreferenced(ctx, "p1", "db1", []string{"v2"}, now); err != nil {
+			t.Fatalf("failed to mark unreferenced: %v", err)
+		}
+		objects, err := objectRepo.FindUnreferenced(ctx, now.Add(time.Hour), 10)
+		if err != nil {
+			t.Fatalf("failed to find unreferenced: %v", err)
+		}
+		if len(objects) != 1 || objects[0].UID != "unref-v2" || objects[0].UnreferencedAt == nil {
+			t.Errorf("expected v2 unreferenced, got %+v", objects)
+		}
+		if objects, _ := objectRepo.FindUnreferenced(ctx, now, 10); len(objects) != 0 {
+			t.Errorf("cutoff is exclusive, got %+v", objects)
+		}
+
+		if err := objectRepo.ClearUnreferenced(ctx, "p1", "db1", []string{"v2"}); err != nil {
+			t.Fatalf("failed to clear unreferenced: %v", err)
+		}
+		if objects, _ := objectRepo.FindUnreferenced(ctx, now.Add(time.Hour), 10); len(objects) != 0 {
+			t.Errorf("cleared objects are not scheduled anymore, got %+v", objects)
+		}
+	})
+
+	cleanupTables(t, db)
+
+	t.Run("units of work commit album, manifest and outbox together", func(t *testing.T) {
+		transactor := mysql.NewTransactor(db)
+		albumRepo := mysql.NewAlbumRepository(db)
+		albumVideoRepo := mysql.NewAlbumVideoRepository(db)
+		outboxRepo := mysql.NewOutboxRepository(db)
+		now := time.Now().UTC().Truncate(time.Second)
+
+		write := func(ctx context.Context, albumUID string) error {
+			err := albumRepo.Create(ctx, &domain.Album{
+				UID:        "tx-" + albumUID,
+				ProviderID: "p1",
+				DatabaseID: "db1",
+				UserID:     "user1",
+				AlbumUID:   albumUID,
+				Synced:     true,
+				CreatedAt:  now,
+				UpdatedAt:  now,
+			})
+			if err != nil {
+				return err
+			}
+			err = albumVideoRepo.ReplaceForAlbum(ctx, "p1", "db1", albumUID, []domain.AlbumVideo{
+				{ProviderID: "p1", DatabaseID: "db1", AlbumUID: albumUID, VideoUID: "v1"},
+			})
+			if err != nil {
+				return err
+			}
+			return outboxRepo.Add(ctx, &services.OutboxMessage{
+				ID:        "outbox-" + albumUID,
+				Message:   services.Message{Topic: "videoupload", Payload: []byte(albumUID), Metadata: map[string]string{"providerID": "p1"}},
+				CreatedAt: now,
+			})
+		}
+
+		crash := errors.New("crash before commit")
+		err := transactor.WithinTx(ctx, func(ctx context.Context) error {
+			if err := write(ctx, "rolled-back"); err != nil {
+				return err
+			}
+			return crash
+		})
+		if !errors.Is(err, crash) {
+			t.Fatalf("expected the unit of work's error, got %v", err)
+		}
+		if album, _ := albumRepo.FindByAlbumUID(ctx, "p1", "db1", "rolled-back"); album != nil {
+			t.Error("album should be rolled back")
+		}
+		if videos, _ := albumVideoRepo.FindByAlbumUID(ctx, "p1", "db1", "rolled-back"); len(videos) != 0 {
+			t.Error("manifest should be rolled back")
+		}
+		if pending, _ := outboxRepo.ListPending(ctx, 10); len(pending) != 0 {
+			t.Errorf("outbox should be rolled back, got %d", len(pending))
+		}
+
+		for _, albumUID := range []string{"committed-1", "committed-2"} {
+			if err := transactor.WithinTx(ctx, func(ctx context.Context) error { return write(ctx, albumUID) }); err != nil {
+				t.Fatalf("unit of work failed: %v", err)
+			}
+		}
+		if videos, _ := albumVideoRepo.FindByAlbumUID(ctx, "p1", "db1", "committed-1"); len(videos) != 1 {
+			t.Error("manifest should be committed")
+		}
+
+		queue := memoryqueue.NewInMemoryQueue(services.NewFakeClock(now))
+		var delivered []string
+		queue.Subscribe(ctx, "sub", "videoupload", "p1", func(ctx context.Context, msg services.Message) error {
+			delivered = append(delivered, string(msg.Payload))
+			return nil
+		})
+		relayed, err := services.NewOutboxRelay(outboxRepo, queue, transactor).Relay(ctx)
+		if err != nil || relayed != 2 {
+			t.Fatalf("expected 2 relayed, got %d (%v)", relayed, err)
+		}
+		queue.Process(ctx)
+		if len(delivered) != 2 || delivered[0] != "committed-1" || delivered[1] != "committed-2" {
+			t.Errorf("expected messages in commit order, got %v", delivered)
+		}
+		if pending, _ := outboxRepo.ListPending(ctx, 10); len(pending) != 0 {
+			t.Errorf("relayed messages should be deleted, got %d", len(pending))
+		}
+	})
+
+	cleanupTables(t, db)
+
+	t.Run("idempotency keys are claimed once until they expire", func(t *testing.T) {
+		repo := mysql.NewIdempotencyRepository(db)
+		now := time.Now().UTC().Truncate(time.Millisecond)
+		reserve := func(at time.Time) *domain.IdempotencyRecord {
+			t.Helper()
+			existing, err := repo.Reserve(ctx, &domain.IdempotencyRecord{Key: "key-1", CreatedAt: at, ExpiresAt: at.Add(time.Minute)})
+			if err != nil {
+				t.Fatalf("reserve failed: %v", err)
+			}
+			return existing
+		}
+
+		if existing := reserve(now); existing != nil {
+			t.Fatalf("a new key should be claimed, got %+v", existing)
+		}
+		if existing := reserve(now); existing == nil || existing.Completed() {
+			t.Fatalf("expected the claim in progress, got %+v", existing)
+		}
+
+		if err := repo.Complete(ctx, "key-1", 201, now.Add(time.Hour)); err != nil {
+			t.Fatalf("complete failed: %v", err)
+		}
+		if existing := reserve(now.Add(30 * time.Minute)); existing == nil || existing.StatusCode != 201 {
+			t.Fatalf("expected the stored status, got %+v", existing)
+		}
+
+		if existing := reserve(now.Add(2 * time.Hour)); existing != nil {
+			t.Errorf("an expired record should be taken over, got %+v", existing)
+		}
+		if deleted, err := repo.DeleteExpired(ctx, now.Add(3*time.Hour)); err != nil || deleted != 1 {
+			t.Errorf("expected the record expired, got %d (%v)", deleted, err)
+		}
+	})
+
+	cleanupTables(t, db)
+
+	t.Run("processed messages commit with the handler's unit of work", func(t *testing.T) {
+		repo := mysql.NewProcessedMessageRepository(db)
+		now := time.Now().UTC()
+		deduplicator := services.NewMessageDeduplicator(repo, mysql.NewTransactor(db), services.NewFakeClock(now), time.Hour)
+
+		runs := 0
+		failing := true
+		handler := deduplicator.HandlerInTx("consumer-a", func(ctx context.Context, msg services.Message) error {
+			runs++
+			if failing {
+				return errors.New("handler failed")
+			}
+			return nil
+		})
+		msg := services.Message{MessageID: "m1"}
+
+		if err := handler(ctx, msg); err == nil {
+			t.Fatal("expected the handler's error")
+		}
+		failing = false
+		handler(ctx, msg)
+		handler(ctx, msg)
+		if runs != 2 {
+			t.Errorf("expected the rolled back mark to allow one retry, got %d runs", runs)
+		}
+
+		if first, err := repo.MarkProcessed(ctx, "consumer-b", "m1", now); err != nil || !first {
+			t.Errorf("marks are per consumer, got %v (%v)", first, err)
+		}
+		if deleted, err := repo.DeleteProcessedBefore(ctx, now.Add(time.Minute)); err != nil || deleted != 2 {
+			t.Errorf("expected both marks deleted, got %d (%v)", deleted, err)
+		}
+	})
+
+	cleanupTables(t, db)
+
+	t.Run("processed messages are marked once a long handler succeeded", func(t *testing.T) {
+		repo := mysql.NewProcessedMessageRepository(db)
+		deduplicator := services.NewMessageDeduplicator(repo, mysql.NewTransactor(db), services.NewFakeClock(time.Now().UTC()), time.Hour)
+
+		failing := true
+		handler := deduplicator.Handler("consumer-a", func(ctx context.Context, msg services.Message) error {
+			// a process dying here leaves nothing that skips the redelivery
+			if processed, err := repo.IsProcessed(ctx, "consumer-a", msg.MessageID); err != nil || processed {
+				t.Errorf("expected no mark while the handler runs, got %v (%v)", processed, err)
+			}
+			if failing {
+				return errors.New("handler failed")
+			}
+			return nil
+		})
+		msg := services.Message{MessageID: "m1"}
+
+		if err := handler(ctx, msg); err == nil {
+			t.Fatal("expected the handler's error")
+		}
+		failing = false
+		if err := handler(ctx, msg); err != nil {
+			t.Fatalf("retry failed: %v", err)
+		}
+		if first, err := repo.MarkProcessed(ctx, "consumer-a", "m1", time.Now()); err != nil || first {
+			t.Errorf("expected the retried message marked, got %v (%v)", first, err)
+		}
+	})
+
+	t.Run("named locks are held by one connection at a time", func(t *testing.T) {
+		first := mysql.NewNamedLock(db, "media_vault_sync.test_lock")
+		second := mysql.NewNamedLock(db, "media_vault_sync.test_lock")
+		defer first.Release()
+		defer second.Release()
+
+		if held, err := first.Held(ctx); err != nil || !held {
+			t.Fatalf("expected the first lock taken, got %v (%v)", held, err)
+		}
+		if held, err := first.Held(ctx); err != nil || !held {
+			t.Errorf("expected the first lock still held, got %v (%v)", held, err)
+		}
+		if held, err := second.Held(ctx); err != nil || held {
+			t.Errorf("expected the second lock refused while the first holds it, got %v (%v)", held, err)
+		}
+
+		if err := first.Release(); err != nil {
+			t.Fatalf("release failed: %v", err)
+		}
+		if held, err := second.Held(ctx); err != nil || !held {
+			t.Errorf("expected the second lock taken once released, got %v (%v)", held, err)
+		}
+	})
+}
+
+func runMigrations(t *testing.T, db *sql.DB) {
+	t.Helper()
+
+	if err := mysql.Migrate(context.Background(), db, migrations.Files); err != nil {
+		t.Fatalf("failed to run migrations: %v", err)
 	}
 }
 
 func cleanupTables(t *testing.T, db *sql.DB) {
 	t.Helper()
 
-	tables := []string{"objects", "videos", "album_videos", "albums"}
+	tables := []string{"processed_messages", "idempotency_keys", "outbox_messages", "manifest_revisions", "objects", "videos", "album_videos", "album_redrives", "albums"}
 	for _, table := range tables {
 		_, err := db.Exec("DELETE FROM " + table)
 		if err != nil {
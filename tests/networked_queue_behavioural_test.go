@@ -0,0 +1,330 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/media-vault-sync/internal/adapters/http/cloud"
+	"github.com/media-vault-sync/internal/adapters/mediavault"
+	"github.com/media-vault-sync/internal/adapters/queue/memory"
+	"github.com/media-vault-sync/internal/adapters/queue/remote"
+	cloudapp "github.com/media-vault-sync/internal/app/cloud"
+	onpremapp "github.com/media-vault-sync/internal/app/onprem"
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+// runQueue runs q in the background until the returned stop is called.
+func runQueue(q interface {
+	Run(ctx context.Context, interval time.Duration)
+}) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		q.Run(ctx, 10*time.Millisecond)
+		close(done)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func TestNetworkedQueue_OnPremSyncsThroughTheCloudBroker(t *testing.T) {
+	ctx := context.Background()
+	clock := services.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	// the cloud keeps its own queue, as in a process of its own
+	cloud := cloudapp.Wire(cloudapp.Config{QueueBrokerPollWait: 200 * time.Millisecond}, &cloudapp.WireOptions{Clock: clock})
+	cloudServer := httptest.NewServer(cloud.Handler)
+	defer cloudServer.Close()
+
+	configPath := filepath.Join(t.TempDir(), "mediavault_config.json")
+	data, _ := json.Marshal(mediavault.Config{
+		Providers: []mediavault.ProviderConfig{{
+			ProviderID: "p1",
+			Databases: []mediavault.DatabaseConfig{{
+				DatabaseID: "db1",
+				Users: []mediavault.UserConfig{{
+					UserID: "user1",
+					Albums: []mediavault.AlbumConfig{
+						{AlbumUID: "album1", Videos: []string{"v1", "v2"}},
+						{AlbumUID: "album2", Videos: []string{"v3"}},
+					},
+				}},
+			}},
+		}},
+	})
+	os.WriteFile(configPath, data, 0644)
+
+	var app *onpremapp.App
+	receiverServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.Handler.ServeHTTP(w, r)
+	}))
+	defer receiverServer.Close()
+
+	cfg := onpremapp.Config{
+		ProviderID:           "p1",
+		MediaVaultConfigPath: configPath,
+		StagingDir:           t.TempDir(),
+		CloudBaseURL:         cloudServer.URL,
+		QueueBackend:         "remote",
+		QueuePollWait:        100 * time.Millisecond,
+	}
+	// as cmd/onprem starts it: the remote queue needs no database
+	db, err := onpremapp.OpenDatabase(ctx, cfg)
+	if err != nil || db != nil {
+		t.Fatalf("expected no database for the remote queue, got %v (%v)", db, err)
+	}
+	app = onpremapp.Wire(cfg, &onpremapp.WireOptions{DB: db, Clock: clock, ReceiverURL: receiverServer.URL})
+	if err := app.SubscribeAll(ctx); err != nil {
+		t.Fatalf("subscribe failed: %v", err)
+	}
+
+	stopCloud := runQueue(cloud.Queue)
+	stopOnPrem := runQueue(app.Queue)
+
+	syncPayload, _ := json.Marshal(services.SyncUserPayload{DatabaseID: "db1", UserID: "user1"})
+	if err := app.Queue.Publish(ctx, services.Message{Topic: "usersync", Payload: syncPayload, Metadata: map[string]string{"providerID": "p1"}}); err != nil {
+		t.Fatalf("publish failed: %v", err)
+	}
+
+	uploaded := func() bool {
+		for _, videoUID := range []string{"v1", "v2", "v3"} {
+			if object, _ := cloud.ObjectRepo.FindByVideoUID(ctx, "p1", "db1", videoUID); object == nil {
+				return false
+			}
+		}
+		return true
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for !uploaded() && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	stopOnPrem()
+	stopCloud()
+
+	if !uploaded() {
+		t.Fatal("expected the videouploads of the cloud to reach on-prem and upload every video")
+	}
+	for _, albumUID := range []string{"album1", "album2"} {
+		if album, _ := cloud.AlbumRepo.FindByAlbumUID(ctx, "p1", "db1", albumUID); album == nil || !album.Synced {
+			t.Errorf("expected %s synced, got %+v", albumUID, album)
+		}
+	}
+}
+
+func TestNetworkedQueue_AcksCarryTheHandlerOutcome(t *testing.T) {
+	ctx := context.Background()
+
+	cloud := cloudapp.Wire(cloudapp.Config{
+		QueueBrokerPollWait: 200 * time.Millisecond,
+		QueueRetryPolicy:    services.RetryPolicy{MaxAttempts: 3, BaseDelay: 10 * time.Millisecond, Multiplier: 1},
+	}, nil)
+	cloudServer := httptest.NewServer(cloud.Handler)
+	defer cloudServer.Close()
+
+	queue := remote.NewQueue(cloudServer.URL, nil, remote.WithPollWait(100*time.Millisecond))
+
+	var mu sync.Mutex
+	attempts := map[string]int{}
+	queue.Subscribe(ctx, "onprem:p1:videoupload", "videoupload", "p1", func(ctx context.Context, msg services.Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts[string(msg.Payload)]++
+		switch {
+		case string(msg.Payload) == "flaky" && attempts["flaky"] == 1:
+			return errors.New("staging disk busy")
+		case string(msg.Payload) == "broken":
+			return services.NonRetryable(errors.New("video missing from the vault"))
+		}
+		return nil
+	})
+
+	stopCloud := runQueue(cloud.Queue)
+	stopOnPrem := runQueue(queue)
+
+	p1 := map[string]string{"providerID": "p1"}
+	cloud.Queue.Publish(ctx, services.Message{Topic: "videoupload", Payload: []byte("flaky"), Metadata: p1})
+	cloud.Queue.Publish(ctx, services.Message{Topic: "videoupload", Payload: []byte("broken"), Metadata: p1})
+	cloud.Queue.Publish(ctx, services.Message{Topic: "videoupload", Payload: []byte("other provider"), Metadata: map[string]string{"providerID": "p2"}})
+
+	deadLetters := func() []*services.DeadLetter {
+		dls, _ := cloud.DeadLetterRepo.List(ctx, services.DeadLetterFilter{})
+		return dls
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		mu.Lock()
+		done := attempts["flaky"] == 2 && len(deadLetters()) == 1
+		mu.Unlock()
+		if done {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	stopOnPrem()
+	stopCloud()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if attempts["flaky"] != 2 {
+		t.Errorf("expected the failed message retried once, got %d attempts", attempts["flaky"])
+	}
+	if attempts["broken"] != 1 {
+		t.Errorf("expected the non-retryable failure not retried, got %d attempts", attempts["broken"])
+	}
+	if attempts["other provider"] != 0 {
+		t.Error("expected the message of another provider not delivered to p1")
+	}
+	dls := deadLetters()
+	if len(dls) != 1 || string(dls[0].Message.Payload) != "broken" || dls[0].LastError != "video missing from the vault" {
+		t.Errorf("expected the non-retryable failure dead-lettered by the cloud, got %+v", dls)
+	}
+}
+
+type fixedBrokerLock struct {
+	mu   sync.Mutex
+	held bool
+}
+
+func (l *fixedBrokerLock) Held(ctx context.Context) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.held, nil
+}
+
+func (l *fixedBrokerLock) set(held bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.held = held
+}
+
+func TestNetworkedQueue_OnlyTheInstanceHoldingTheBrokerLockServesPolls(t *testing.T) {
+	ctx := context.Background()
+	queue := memory.NewInMemoryQueue(services.RealClock{})
+	lock := &fixedBrokerLock{}
+	broker := services.NewQueueBroker(queue, lock, 100*time.Millisecond, time.Second)
+	server := httptest.NewServer(cloud.NewQueueBrokerHandler(broker))
+	defer server.Close()
+
+	poll := func() *http.Response {
+		body, _ := json.Marshal(services.QueuePollRequest{SubscriptionID: "onprem:p1:videoupload", Topic: "videoupload", ProviderID: "p1", WaitMillis: 50})
+		resp, err := http.Post(server.URL+"/v1/queue/poll", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("poll failed: %v", err)
+		}
+		return resp
+	}
+
+	resp := poll()
+	var apiErr services.APIError
+	json.NewDecoder(resp.Body).Decode(&apiErr)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || apiErr.Code != "queue_broker_elsewhere" || !apiErr.Retryable {
+		t.Fatalf("expected 503 queue_broker_elsewhere while another instance holds the lock, got %d %+v", resp.StatusCode, apiErr)
+	}
+
+	lock.set(true)
+	resp = poll()
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected the lock holder to serve the poll, got %d", resp.StatusCode)
+	}
+
+	// losing the lock drops the subscription, so the queue keeps the message
+	lock.set(false)
+	resp = poll()
+	resp.Body.Close()
+	queue.Publish(ctx, services.Message{Topic: "videoupload", Metadata: map[string]string{"providerID": "p1"}})
+	if delivered, requeued := queue.Tick(ctx); delivered != 0 || requeued != 0 || queue.PendingCount() != 1 {
+		t.Errorf("expected the message left pending once the lock was lost, got %d delivered, %d requeued, %d pending", delivered, requeued, queue.PendingCount())
+	}
+}
+
+func TestNetworkedQueue_AckTimeoutCountsFromTheOffer(t *testing.T) {
+	ctx := context.Background()
+	queue := memory.NewInMemoryQueue(services.RealClock{})
+	broker := services.NewQueueBroker(queue, nil, 10*time.Second, 100*time.Millisecond)
+
+	// subscribes, then stops polling while staying within the idle timeout
+	if delivery, err := broker.Poll(ctx, services.QueuePollRequest{SubscriptionID: "onprem:p1:videoupload", Topic: "videoupload", ProviderID: "p1"}); delivery != nil || err != nil {
+		t.Fatalf("expected an empty poll, got %+v, %v", delivery, err)
+	}
+	queue.Publish(ctx, services.Message{Topic: "videoupload", Metadata: map[string]string{"providerID": "p1"}})
+
+	start := time.Now()
+	delivered, requeued := queue.Tick(ctx)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the unpolled delivery failed within the ack timeout, took %s", elapsed)
+	}
+	if delivered != 0 || requeued != 1 {
+		t.Errorf("expected the unpolled delivery retried, got %d delivered, %d requeued", delivered, requeued)
+	}
+}
+
+func TestNetworkedQueue_HeartbeatsKeepSlowHandlersFromRedelivery(t *testing.T) {
+	ctx := context.Background()
+
+	cloud := cloudapp.Wire(cloudapp.Config{
+		QueueBrokerPollWait:   200 * time.Millisecond,
+		QueueBrokerAckTimeout: 150 * time.Millisecond,
+		QueueRetryPolicy:      services.RetryPolicy{MaxAttempts: 3, BaseDelay: 10 * time.Millisecond, Multiplier: 1},
+	}, nil)
+	cloudServer := httptest.NewServer(cloud.Handler)
+	defer cloudServer.Close()
+
+	queue := remote.NewQueue(cloudServer.URL, nil, remote.WithPollWait(100*time.Millisecond), remote.WithConcurrency(2))
+
+	var mu sync.Mutex
+	attempts := 0
+	finished := make(chan struct{})
+	queue.Subscribe(ctx, "onprem:p1:videoupload", "videoupload", "p1", func(ctx context.Context, msg services.Message) error {
+		mu.Lock()
+		attempts++
+		first := attempts == 1
+		mu.Unlock()
+
+		// a CMove of many videos, well past the ack timeout
+		time.Sleep(600 * time.Millisecond)
+		if first {
+			close(finished)
+		}
+		return nil
+	})
+
+	stopCloud := runQueue(cloud.Queue)
+	stopOnPrem := runQueue(queue)
+
+	cloud.Queue.Publish(ctx, services.Message{Topic: "videoupload", Metadata: map[string]string{"providerID": "p1"}})
+
+	select {
+	case <-finished:
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected the slow handler to finish")
+	}
+	// long enough for a redelivery to show, had the delivery timed out
+	time.Sleep(300 * time.Millisecond)
+
+	stopOnPrem()
+	stopCloud()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if attempts != 1 {
+		t.Errorf("expected the slow handler's message delivered once, got %d attempts", attempts)
+	}
+	if dls, _ := cloud.DeadLetterRepo.List(ctx, services.DeadLetterFilter{}); len(dls) != 0 {
+		t.Errorf("expected no dead letters, got %+v", dls)
+	}
+}
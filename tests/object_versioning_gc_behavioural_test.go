@@ -0,0 +1,299 @@
+package tests
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/media-vault-sync/internal/adapters/queue/memory"
+	memoryrepo "github.com/media-vault-sync/internal/adapters/repo/memory"
+	memorystorage "github.com/media-vault-sync/internal/adapters/storage/memory"
+	"github.com/media-vault-sync/internal/core/domain"
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+func TestObjectVersioning_ReuploadCreatesVersionAndGCPurgesSuperseded(t *testing.T) {
+	ctx := context.Background()
+	clock := services.NewFakeClock(time.Now())
+
+	queue := memory.NewInMemoryQueue(clock)
+	albumRepo := memoryrepo.NewAlbumRepository()
+	albumVideoRepo := memoryrepo.NewAlbumVideoRepository()
+	videoRepo := memoryrepo.NewVideoRepository()
+	objectRepo := memoryrepo.NewObjectRepository()
+	blobStore := memorystorage.NewBlobStore()
+
+	albumManifestUploadService := services.NewAlbumManifestUploadService(albumRepo, albumVideoRepo, memoryrepo.NewManifestRevisionRepository(), objectRepo, memoryrepo.NewTransactor(), queue, clock)
+	if err := albumManifestUploadService.ProcessAlbumManifestUpload(ctx, services.AlbumManifestUploadRequest{
+		ProviderID: "p1",
+		DatabaseID: "db1",
+		UserID:     "user1",
+		AlbumUID:   "album1",
+		VideoUIDs:  []string{"v1"},
+	}); err != nil {
+		t.Fatalf("failed to upload manifest: %v", err)
+	}
+
+	videoUploadService := services.NewVideoUploadService(albumRepo, albumVideoRepo, videoRepo, objectRepo, blobStore, clock)
+	upload := func(content string) {
+		t.Helper()
+		err := videoUploadService.ProcessVideoUpload(ctx, services.VideoUploadRequest{
+			ProviderID: "p1",
+			DatabaseID: "db1",
+			UserID:     "user1",
+			AlbumUID:   "album1",
+			VideoUID:   "v1",
+			Body:       strings.NewReader(content),
+		})
+		if err != nil {
+			t.Fatalf("upload failed: %v", err)
+		}
+	}
+
+	upload("first content")
+	clock.Advance(time.Minute)
+	upload("first content")
+
+	versions, _ := objectRepo.ListVersions(ctx, "p1", "db1", "v1")
+	if len(versions) != 1 {
+		t.Fatalf("re-uploading the same content should not create a version, got %d versions", len(versions))
+	}
+
+	clock.Advance(time.Minute)
+	upload("second content")
+
+	versions, _ = objectRepo.ListVersions(ctx, "p1", "db1", "v1")
+	if len(versions) != 2 {
+		t.Fatalf("expected 2 versions, got %d", len(versions))
+	}
+	v1, v2 := versions[0], versions[1]
+	if v1.SupersededAt == nil {
+		t.Error("v1 should be superseded")
+	}
+	if v1.StorageKey == v2.StorageKey {
+		t.Errorf("versions should have distinct storage keys, both are %s", v1.StorageKey)
+	}
+
+	current, _ := objectRepo.FindByVideoUID(ctx, "p1", "db1", "v1")
+	if current == nil || current.Version != 2 {
+		t.Fatalf("expected current version 2, got %+v", current)
+	}
+
+	gc := services.NewObjectGarbageCollector(objectRepo, blobStore, clock, time.Hour, time.Hour)
+
+	purged, err := gc.Collect(ctx)
+	if err != nil {
+		t.Fatalf("gc failed: %v", err)
+	}
+	if purged != 0 {
+		t.Errorf("expected nothing purged within retention, got %d", purged)
+	}
+	if _, err := blobStore.Head(ctx, v1.StorageKey); err != nil {
+		t.Errorf("v1 blob should survive within retention: %v", err)
+	}
+
+	clock.Advance(2 * time.Hour)
+	purged, err = gc.Collect(ctx)
+	if err != nil {
+		t.Fatalf("gc failed: %v", err)
+	}
+	if purged != 1 {
+		t.Errorf("expected 1 purged blob, got %d", purged)
+	}
+
+	if _, err := blobStore.Head(ctx, v1.StorageKey); !errors.Is(err, services.ErrBlobNotFound) {
+		t.Errorf("v1 blob should be purged, got %v", err)
+	}
+	if _, err := blobStore.Head(ctx, v2.StorageKey); err != nil {
+		t.Errorf("current blob must not be purged: %v", err)
+	}
+
+	versions, _ = objectRepo.ListVersions(ctx, "p1", "db1", "v1")
+	if len(versions) != 2 || versions[0].PurgedAt == nil {
+		t.Error("v1 should remain in history marked as purged")
+	}
+}
+
+// failingAddVersionRepo records no version, as when the database is down.
+type failingAddVersionRepo struct {
+	services.ObjectRepository
+}
+
+func (r failingAddVersionRepo) AddVersion(ctx context.Context, object *domain.Object) error {
+	return errors.New("database unavailable")
+}
+
+func TestObjectVersioning_ConcurrentUploadsGetDistinctVersions(t *testing.T) {
+	ctx := context.Background()
+	clock := services.NewFakeClock(time.Now())
+
+	albumRepo := memoryrepo.NewAlbumRepository()
+	albumVideoRepo := memoryrepo.NewAlbumVideoRepository()
+	objectRepo := memoryrepo.NewObjectRepository()
+	blobStore := memorystorage.NewBlobStore()
+
+	albumManifestUploadService := services.NewAlbumManifestUploadService(albumRepo, albumVideoRepo, memoryrepo.NewManifestRevisionRepository(), objectRepo, memoryrepo.NewTransactor(), memory.NewInMemoryQueue(clock), clock)
+	if err := albumManifestUploadService.ProcessAlbumManifestUpload(ctx, services.AlbumManifestUploadRequest{
+		ProviderID: "p1",
+		DatabaseID: "db1",
+		UserID:     "user1",
+		AlbumUID:   "album1",
+		VideoUIDs:  []string{"v1"},
+	}); err != nil {
+		t.Fatalf("failed to upload manifest: %v", err)
+	}
+
+	upload := func(objectRepo services.ObjectRepository, content string) error {
+		videoUploadService := services.NewVideoUploadService(albumRepo, albumVideoRepo, memoryrepo.NewVideoRepository(), objectRepo, blobStore, clock)
+		return videoUploadService.ProcessVideoUpload(ctx, services.VideoUploadRequest{
+			ProviderID: "p1",
+			DatabaseID: "db1",
+			UserID:     "user1",
+			AlbumUID:   "album1",
+			VideoUID:   "v1",
+			Body:       strings.NewReader(content),
+		})
+	}
+
+	const uploads = 10
+	var wg sync.WaitGroup
+	for i := range uploads {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := upload(objectRepo, fmt.Sprintf("content %d", i)); err != nil {
+				t.Errorf("upload %d failed: %v", i, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	versions, _ := objectRepo.ListVersions(ctx, "p1", "db1", "v1")
+	if len(versions) != uploads {
+		t.Fatalf("expected %d versions, got %d", uploads, len(versions))
+	}
+	current := 0
+	for i, version := range versions {
+		if version.Version != i+1 {
+			t.Errorf("expected versions numbered in turn, got version %d at %d", version.Version, i)
+		}
+		if version.SupersededAt == nil {
+			current++
+		}
+	}
+	if current != 1 {
+		t.Errorf("expected one current version, got %d", current)
+	}
+
+	if err := upload(failingAddVersionRepo{objectRepo}, "content never recorded"); err == nil {
+		t.Fatal("expected the upload to fail when its version cannot be recorded")
+	}
+	sum := sha256.Sum256([]byte("content never recorded"))
+	if _, err := blobStore.Head(ctx, services.ContentStorageKey(hex.EncodeToString(sum[:]))); !errors.Is(err, services.ErrBlobNotFound) {
+		t.Errorf("expected no blob left behind by the failed upload, got %v", err)
+	}
+}
+
+// headHookBlobStore runs onHead once, right after the next Head of key.
+type headHookBlobStore struct {
+	services.BlobStore
+	key    string
+	onHead func()
+}
+
+func (s *headHookBlobStore) Head(ctx context.Context, key string) (*services.BlobInfo, error) {
+	info, err := s.BlobStore.Head(ctx, key)
+	if onHead := s.onHead; key == s.key && onHead != nil {
+		s.onHead = nil
+		onHead()
+	}
+	return info, err
+}
+
+func TestObjectVersioning_GCRacingAReferenceKeepsTheContent(t *testing.T) {
+	ctx := context.Background()
+	clock := services.NewFakeClock(time.Now())
+
+	albumRepo := memoryrepo.NewAlbumRepository()
+	albumVideoRepo := memoryrepo.NewAlbumVideoRepository()
+	objectRepo := memoryrepo.NewObjectRepository()
+	memoryBlobStore := memorystorage.NewBlobStore()
+
+	albumManifestUploadService := services.NewAlbumManifestUploadService(albumRepo, albumVideoRepo, memoryrepo.NewManifestRevisionRepository(), objectRepo, memoryrepo.NewTransactor(), memory.NewInMemoryQueue(clock), clock)
+	if err := albumManifestUploadService.ProcessAlbumManifestUpload(ctx, services.AlbumManifestUploadRequest{
+		ProviderID: "p1",
+		DatabaseID: "db1",
+		UserID:     "user1",
+		AlbumUID:   "album1",
+		VideoUIDs:  []string{"v1", "v2"},
+	}); err != nil {
+		t.Fatalf("failed to upload manifest: %v", err)
+	}
+
+	clip := "a clip v1 no longer holds"
+	sum := sha256.Sum256([]byte(clip))
+	checksum := hex.EncodeToString(sum[:])
+	contentKey := services.ContentStorageKey(checksum)
+
+	// the garbage collector gets to the superseded version of v1 right after
+	// the reference of v2 found its blob
+	gc := services.NewObjectGarbageCollector(objectRepo, memoryBlobStore, clock, time.Hour, time.Hour)
+	blobStore := &headHookBlobStore{BlobStore: memoryBlobStore, key: contentKey}
+	videoUploadService := services.NewVideoUploadService(albumRepo, albumVideoRepo, memoryrepo.NewVideoRepository(), objectRepo, blobStore, clock)
+
+	upload := func(videoUID, content string) {
+		t.Helper()
+		err := videoUploadService.ProcessVideoUpload(ctx, services.VideoUploadRequest{
+			ProviderID: "p1",
+			DatabaseID: "db1",
+			UserID:     "user1",
+			AlbumUID:   "album1",
+			VideoUID:   videoUID,
+			Body:       strings.NewReader(content),
+		})
+		if err != nil {
+			t.Fatalf("upload of %s failed: %v", videoUID, err)
+		}
+	}
+	upload("v1", clip)
+	upload("v1", "what v1 holds now")
+	clock.Advance(2 * time.Hour)
+
+	blobStore.onHead = func() {
+		if _, err := gc.Collect(ctx); err != nil {
+			t.Errorf("gc failed: %v", err)
+		}
+	}
+	err := videoUploadService.ProcessVideoReference(ctx, services.VideoReferenceRequest{
+		ProviderID: "p1",
+		DatabaseID: "db1",
+		UserID:     "user1",
+		AlbumUID:   "album1",
+		VideoUID:   "v2",
+		Checksum:   checksum,
+	})
+	if !errors.Is(err, services.ErrBlobNotFound) {
+		t.Fatalf("expected the reference to ask for the bytes once the blob was collected, got %v", err)
+	}
+
+	upload("v2", clip)
+	if _, err := memoryBlobStore.Head(ctx, contentKey); err != nil {
+		t.Fatalf("expected the upload to put the blob back: %v", err)
+	}
+	if _, err := gc.Collect(ctx); err != nil {
+		t.Fatalf("gc failed: %v", err)
+	}
+	if _, err := memoryBlobStore.Head(ctx, contentKey); err != nil {
+		t.Errorf("expected the blob kept while v2 references it: %v", err)
+	}
+	current, _ := objectRepo.FindByVideoUID(ctx, "p1", "db1", "v2")
+	if current == nil || current.Checksum != checksum {
+		t.Errorf("expected v2 to hold the clip, got %+v", current)
+	}
+}
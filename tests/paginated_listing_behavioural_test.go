@@ -0,0 +1,205 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/media-vault-sync/internal/adapters/http/onprem"
+	cloudapp "github.com/media-vault-sync/internal/app/cloud"
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+type listingPage struct {
+	Albums []struct {
+		AlbumUID string `json:"albumUID"`
+		UserID   string `json:"userID"`
+		Synced   bool   `json:"synced"`
+	} `json:"albums"`
+	Videos []struct {
+		VideoUID string `json:"videoUID"`
+		UserID   string `json:"userID"`
+	} `json:"videos"`
+	Objects []struct {
+		VideoUID string `json:"videoUID"`
+		Version  int    `json:"version"`
+	} `json:"objects"`
+	NextCursor string `json:"nextCursor"`
+}
+
+func getListingPage(t *testing.T, rawURL string) (listingPage, int) {
+	t.Helper()
+	resp, err := http.Get(rawURL)
+	if err != nil {
+		t.Fatalf("list request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var page listingPage
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+			t.Fatalf("failed to decode page: %v", err)
+		}
+	}
+	return page, resp.StatusCode
+}
+
+func TestPaginatedListing_AlbumsVideosAndObjects(t *testing.T) {
+	ctx := context.Background()
+	clock := services.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	cloud := cloudapp.Wire(cloudapp.Config{}, &cloudapp.WireOptions{Clock: clock})
+	server := httptest.NewServer(cloud.Handler)
+	defer server.Close()
+	client := onprem.NewHTTPCloudClient(server.URL, nil)
+
+	// album1..album5, odd ones for user1, one hour apart
+	for i := 1; i <= 5; i++ {
+		userID := "user1"
+		if i%2 == 0 {
+			userID = "user2"
+		}
+		albumUID := fmt.Sprintf("album%d", i)
+		videoUID := fmt.Sprintf("v%d", i)
+		if err := client.PostAlbumManifestUpload(ctx, services.AlbumManifestUploadRequest{
+			ProviderID: "p1",
+			DatabaseID: "db1",
+			UserID:     userID,
+			AlbumUID:   albumUID,
+			VideoUIDs:  []string{videoUID},
+		}); err != nil {
+			t.Fatalf("failed to upload manifest: %v", err)
+		}
+		if err := client.PostVideoUpload(ctx, services.VideoUploadRequest{
+			ProviderID: "p1",
+			DatabaseID: "db1",
+			UserID:     userID,
+			AlbumUID:   albumUID,
+			VideoUID:   videoUID,
+			Body:       strings.NewReader("content of " + videoUID),
+		}); err != nil {
+			t.Fatalf("failed to upload video: %v", err)
+		}
+		clock.Advance(time.Hour)
+	}
+
+	// another database must never show up
+	if err := client.PostAlbumManifestUpload(ctx, services.AlbumManifestUploadRequest{
+		ProviderID: "p1",
+		DatabaseID: "db2",
+		UserID:     "user1",
+		AlbumUID:   "album0",
+		VideoUIDs:  []string{"v0"},
+	}); err != nil {
+		t.Fatalf("failed to upload manifest: %v", err)
+	}
+
+	album3, _ := cloud.AlbumRepo.FindByAlbumUID(ctx, "p1", "db1", "album3")
+	album3.Synced = false
+	cloud.AlbumRepo.Update(ctx, album3)
+
+	base := server.URL + "/v1/providers/p1/databases/db1"
+
+	t.Run("albums page through in order", func(t *testing.T) {
+		var seen []string
+		cursor := ""
+		for pages := 0; ; pages++ {
+			if pages > 5 {
+				t.Fatal("pagination does not terminate")
+			}
+			page, status := getListingPage(t, base+"/albums?limit=2&cursor="+url.QueryEscape(cursor))
+			if status != http.StatusOK {
+				t.Fatalf("expected 200, got %d", status)
+			}
+			if len(page.Albums) > 2 {
+				t.Fatalf("page exceeds limit: %d albums", len(page.Albums))
+			}
+			for _, album := range page.Albums {
+				seen = append(seen, album.AlbumUID)
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			cursor = page.NextCursor
+		}
+		if got := strings.Join(seen, ","); got != "album1,album2,album3,album4,album5" {
+			t.Errorf("unexpected albums across pages: %s", got)
+		}
+	})
+
+	t.Run("albums filter by user, synced and time", func(t *testing.T) {
+		page, _ := getListingPage(t, base+"/albums?userID=user1")
+		if len(page.Albums) != 3 {
+			t.Errorf("expected 3 albums for user1, got %d", len(page.Albums))
+		}
+
+		page, _ = getListingPage(t, base+"/albums?synced=false")
+		if len(page.Albums) != 1 || page.Albums[0].AlbumUID != "album3" {
+			t.Errorf("expected only album3 out of sync, got %+v", page.Albums)
+		}
+
+		since := time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC).Format(time.RFC3339)
+		before := time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC).Format(time.RFC3339)
+		page, _ = getListingPage(t, base+"/albums?synced=true&updatedSince="+since+"&updatedBefore="+before)
+		if len(page.Albums) != 1 || page.Albums[0].AlbumUID != "album2" {
+			t.Errorf("expected album2 in the window, got %+v", page.Albums)
+		}
+	})
+
+	t.Run("videos filter by user", func(t *testing.T) {
+		page, _ := getListingPage(t, base+"/videos?userID=user2&limit=1")
+		if len(page.Videos) != 1 || page.Videos[0].VideoUID != "v2" || page.NextCursor == "" {
+			t.Fatalf("expected v2 and a cursor, got %+v", page)
+		}
+		page, _ = getListingPage(t, base+"/videos?userID=user2&limit=1&cursor="+url.QueryEscape(page.NextCursor))
+		if len(page.Videos) != 1 || page.Videos[0].VideoUID != "v4" || page.NextCursor != "" {
+			t.Errorf("expected v4 on the last page, got %+v", page)
+		}
+	})
+
+	t.Run("objects list current versions unless asked for history", func(t *testing.T) {
+		if err := client.PostVideoUpload(ctx, services.VideoUploadRequest{
+			ProviderID: "p1",
+			DatabaseID: "db1",
+			UserID:     "user1",
+			AlbumUID:   "album1",
+			VideoUID:   "v1",
+			Body:       strings.NewReader("new content of v1"),
+		}); err != nil {
+			t.Fatalf("failed to re-upload video: %v", err)
+		}
+
+		page, _ := getListingPage(t, base+"/objects")
+		if len(page.Objects) != 5 {
+			t.Errorf("expected 5 current objects, got %d", len(page.Objects))
+		}
+
+		page, _ = getListingPage(t, base+"/objects?videoUID=v1&includeSuperseded=true&limit=1")
+		if len(page.Objects) != 1 || page.Objects[0].Version != 1 || page.NextCursor == "" {
+			t.Fatalf("expected v1 version 1 and a cursor, got %+v", page)
+		}
+		page, _ = getListingPage(t, base+"/objects?videoUID=v1&includeSuperseded=true&limit=1&cursor="+url.QueryEscape(page.NextCursor))
+		if len(page.Objects) != 1 || page.Objects[0].Version != 2 {
+			t.Errorf("expected v1 version 2 on the next page, got %+v", page)
+		}
+	})
+
+	t.Run("bad parameters are rejected", func(t *testing.T) {
+		for _, query := range []string{
+			"/albums?cursor=not-a-cursor!",
+			"/albums?synced=maybe",
+			"/videos?updatedSince=yesterday",
+			"/objects?limit=-1",
+		} {
+			if _, status := getListingPage(t, base+query); status != http.StatusBadRequest {
+				t.Errorf("%s: expected 400, got %d", query, status)
+			}
+		}
+	})
+}
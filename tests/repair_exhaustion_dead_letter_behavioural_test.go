@@ -0,0 +1,173 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/media-vault-sync/internal/adapters/queue/memory"
+	cloudapp "github.com/media-vault-sync/internal/app/cloud"
+	"github.com/media-vault-sync/internal/core/domain"
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+func TestRepairExhaustion_DeadLettersAlbumAndReplays(t *testing.T) {
+	ctx := context.Background()
+	clock := services.NewFakeClock(time.Now())
+	queue := memory.NewInMemoryQueue(clock)
+
+	cloud := cloudapp.Wire(cloudapp.Config{}, &cloudapp.WireOptions{
+		Clock: clock,
+		Queue: queue,
+	})
+	cloudServer := httptest.NewServer(cloud.Handler)
+	defer cloudServer.Close()
+
+	if err := cloud.SubscribeEventualConsistencyCheck(ctx); err != nil {
+		t.Fatalf("failed to subscribe cloud: %v", err)
+	}
+
+	var manifestRequests []services.Message
+	queue.Subscribe(ctx, "collector", "albummanifestupload", "", func(ctx context.Context, msg services.Message) error {
+		manifestRequests = append(manifestRequests, msg)
+		return nil
+	})
+
+	cloud.AlbumRepo.Create(ctx, &domain.Album{
+		UID:        "p1-db1-album1",
+		ProviderID: "p1",
+		DatabaseID: "db1",
+		UserID:     "user1",
+		AlbumUID:   "album1",
+		Synced:     false,
+		CreatedAt:  clock.Now(),
+		UpdatedAt:  clock.Now(),
+	})
+
+	exhausted, _ := json.Marshal(services.EventualConsistencyCheckPayload{
+		ProviderID: "p1",
+		DatabaseID: "db1",
+		AlbumUID:   "album1",
+		Attempt:    services.MaxRepairAttempts,
+	})
+	queue.Publish(ctx, services.Message{
+		MessageID: "check-final",
+		Topic:     "syncconsistencycheck",
+		Payload:   exhausted,
+		Metadata:  map[string]string{},
+	})
+	queue.Process(ctx)
+
+	if len(manifestRequests) != 0 {
+		t.Fatalf("exhausted album should not be repaired again, got %d manifest requests", len(manifestRequests))
+	}
+
+	resp, err := http.Get(cloudServer.URL + "/v1/deadletters?topic=syncconsistencycheck&providerID=p1")
+	if err != nil {
+		t.Fatalf("list dead letters failed: %v", err)
+	}
+	var deadLetters []struct {
+		ID        string `json:"id"`
+		Topic     string `json:"topic"`
+		Attempts  int    `json:"attempts"`
+		LastError string `json:"lastError"`
+	}
+	json.NewDecoder(resp.Body).Decode(&deadLetters)
+	resp.Body.Close()
+
+	if len(deadLetters) != 1 {
+		t.Fatalf("expected 1 dead letter, got %d", len(deadLetters))
+	}
+	if deadLetters[0].Attempts != services.MaxRepairAttempts {
+		t.Errorf("expected %d attempts, got %d", services.MaxRepairAttempts, deadLetters[0].Attempts)
+	}
+	if deadLetters[0].LastError == "" {
+		t.Error("dead letter should explain why the album gave up")
+	}
+
+	resp, err = http.Post(cloudServer.URL+"/v1/deadletters/"+deadLetters[0].ID+"/replay", "application/json", nil)
+	if err != nil {
+		t.Fatalf("replay failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 from replay, got %d", resp.StatusCode)
+	}
+
+	queue.Process(ctx)
+
+	if len(manifestRequests) != 1 {
+		t.Errorf("replay should restart the repair loop, got %d manifest requests", len(manifestRequests))
+	}
+
+	resp, err = http.Get(cloudServer.URL + "/v1/deadletters/" + deadLetters[0].ID)
+	if err != nil {
+		t.Fatalf("get dead letter failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("replayed dead letter should be gone, got status %d", resp.StatusCode)
+	}
+}
+
+func TestRepairExhaustion_RepeatedScansDeadLetterAnAlbumOnce(t *testing.T) {
+	ctx := context.Background()
+	clock := services.NewFakeClock(time.Now())
+	queue := memory.NewInMemoryQueue(clock)
+
+	cloud := cloudapp.Wire(cloudapp.Config{}, &cloudapp.WireOptions{
+		Clock: clock,
+		Queue: queue,
+	})
+	if err := cloud.SubscribeEventualConsistencyCheck(ctx); err != nil {
+		t.Fatalf("failed to subscribe cloud: %v", err)
+	}
+
+	// on-prem never manages to sync the album
+	manifestRequests := 0
+	queue.Subscribe(ctx, "collector", "albummanifestupload", "", func(ctx context.Context, msg services.Message) error {
+		manifestRequests++
+		return nil
+	})
+
+	cloud.AlbumRepo.Create(ctx, &domain.Album{
+		UID:        "p1-db1-album1",
+		ProviderID: "p1",
+		DatabaseID: "db1",
+		UserID:     "user1",
+		AlbumUID:   "album1",
+		Synced:     false,
+		CreatedAt:  clock.Now(),
+		UpdatedAt:  clock.Now(),
+	})
+
+	for range 4 {
+		if err := cloud.EventualConsistencyWorker.Scan(ctx); err != nil {
+			t.Fatalf("scan failed: %v", err)
+		}
+		// lets the repair loop run through its backoffs
+		for range 2 * services.MaxRepairAttempts {
+			queue.Process(ctx)
+			clock.Advance(time.Minute)
+		}
+	}
+
+	deadLetters, _ := cloud.DeadLetterRepo.List(ctx, services.DeadLetterFilter{Topic: "syncconsistencycheck"})
+	if len(deadLetters) != 1 {
+		t.Fatalf("expected one dead letter for the given-up album, got %d", len(deadLetters))
+	}
+	if manifestRequests != services.MaxRepairAttempts-1 {
+		t.Errorf("expected scans after giving up not to repair the album again, got %d manifest requests", manifestRequests)
+	}
+
+	if err := cloud.DeadLetterService.Replay(ctx, deadLetters[0].ID); err != nil {
+		t.Fatalf("replay failed: %v", err)
+	}
+	queue.Process(ctx)
+	if manifestRequests != services.MaxRepairAttempts {
+		t.Errorf("expected the replay to restart the repairs, got %d manifest requests", manifestRequests)
+	}
+}
@@ -0,0 +1,188 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/media-vault-sync/internal/adapters/http/onprem"
+	cloudapp "github.com/media-vault-sync/internal/app/cloud"
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+// flakyChunkTransport fails the chunk PUTs whose offsets are listed in
+// failAt, once each, after the chunk reached the server, so the cloud has
+// acknowledged it but the client never saw the response.
+type flakyChunkTransport struct {
+	mu      sync.Mutex
+	failAt  map[string]bool
+	offsets []string
+	creates int
+}
+
+func (t *flakyChunkTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method == http.MethodPost && strings.HasSuffix(req.URL.Path, "/videoupload/sessions") {
+		t.mu.Lock()
+		t.creates++
+		t.mu.Unlock()
+	}
+
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil || req.Method != http.MethodPut {
+		return resp, err
+	}
+
+	offset := req.Header.Get("X-Upload-Offset")
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.offsets = append(t.offsets, offset)
+	if t.failAt[offset] {
+		delete(t.failAt, offset)
+		resp.Body.Close()
+		return nil, errors.New("connection reset")
+	}
+	return resp, nil
+}
+
+func newChunkedUploadTest(t *testing.T) (*cloudapp.App, *httptest.Server) {
+	t.Helper()
+	ctx := context.Background()
+
+	cloud := cloudapp.Wire(cloudapp.Config{}, &cloudapp.WireOptions{Clock: services.NewFakeClock(time.Now())})
+	server := httptest.NewServer(cloud.Handler)
+	t.Cleanup(server.Close)
+
+	err := onprem.NewHTTPCloudClient(server.URL, nil).PostAlbumManifestUpload(ctx, services.AlbumManifestUploadRequest{
+		ProviderID: "p1",
+		DatabaseID: "db1",
+		UserID:     "user1",
+		AlbumUID:   "album1",
+		VideoUIDs:  []string{"v1"},
+	})
+	if err != nil {
+		t.Fatalf("failed to upload manifest: %v", err)
+	}
+	return cloud, server
+}
+
+func videoRequest(data []byte) services.VideoUploadRequest {
+	return services.VideoUploadRequest{
+		ProviderID: "p1",
+		DatabaseID: "db1",
+		UserID:     "user1",
+		AlbumUID:   "album1",
+		VideoUID:   "v1",
+		Body:       bytes.NewReader(data),
+	}
+}
+
+func TestChunkedUpload_ResumesFromAcknowledgedOffset(t *testing.T) {
+	ctx := context.Background()
+	cloud, server := newChunkedUploadTest(t)
+
+	data := make([]byte, 1000)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	transport := &flakyChunkTransport{failAt: map[string]bool{"300": true}}
+	client := onprem.NewHTTPCloudClient(server.URL, &http.Client{Transport: transport}, onprem.WithChunkedUpload(300, 3))
+
+	if err := client.PostVideoUpload(ctx, videoRequest(data)); err != nil {
+		t.Fatalf("chunked upload failed: %v", err)
+	}
+
+	// the chunk at 300 was acknowledged before the failure, so the client
+	// continues at 600 instead of resending it
+	if got := strings.Join(transport.offsets, ","); got != "0,300,600,900" {
+		t.Errorf("unexpected chunk offsets: %s", got)
+	}
+
+	sum := sha256.Sum256(data)
+	obj, _ := cloud.ObjectRepo.FindByVideoUID(ctx, "p1", "db1", "v1")
+	if obj == nil {
+		t.Fatal("object for v1 should exist")
+	}
+	if obj.Checksum != hex.EncodeToString(sum[:]) || obj.SizeBytes != int64(len(data)) {
+		t.Errorf("object does not match uploaded data: %+v", obj)
+	}
+}
+
+func TestChunkedUpload_RetriedUploadResumesSession(t *testing.T) {
+	ctx := context.Background()
+	cloud, server := newChunkedUploadTest(t)
+
+	data := make([]byte, 1000)
+	rand.New(rand.NewSource(2)).Read(data)
+
+	transport := &flakyChunkTransport{failAt: map[string]bool{"300": true}}
+	client := onprem.NewHTTPCloudClient(server.URL, &http.Client{Transport: transport}, onprem.WithChunkedUpload(300, 0))
+
+	if err := client.PostVideoUpload(ctx, videoRequest(data)); err == nil {
+		t.Fatal("first attempt should fail without chunk retries")
+	}
+	if obj, _ := cloud.ObjectRepo.FindByVideoUID(ctx, "p1", "db1", "v1"); obj != nil {
+		t.Fatal("object should not exist before the upload is finalized")
+	}
+
+	if err := client.PostVideoUpload(ctx, videoRequest(data)); err != nil {
+		t.Fatalf("retried upload failed: %v", err)
+	}
+
+	if transport.creates != 1 {
+		t.Errorf("retry should resume the existing session, %d sessions created", transport.creates)
+	}
+	if got := strings.Join(transport.offsets, ","); got != "0,300,600,900" {
+		t.Errorf("unexpected chunk offsets: %s", got)
+	}
+
+	obj, _ := cloud.ObjectRepo.FindByVideoUID(ctx, "p1", "db1", "v1")
+	if obj == nil {
+		t.Fatal("object for v1 should exist after the retry")
+	}
+}
+
+func TestChunkedUpload_FinalizeRejectsChecksumMismatch(t *testing.T) {
+	ctx := context.Background()
+	cloud, _ := newChunkedUploadTest(t)
+
+	session, err := cloud.UploadSessionService.Create(ctx, services.CreateUploadSessionRequest{
+		ProviderID: "p1",
+		DatabaseID: "db1",
+		UserID:     "user1",
+		AlbumUID:   "album1",
+		VideoUID:   "v1",
+		SizeBytes:  5,
+	})
+	if err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+
+	if _, err := cloud.UploadSessionService.PutChunk(ctx, session.ID, 1, strings.NewReader("x")); !errors.Is(err, services.ErrUploadOffsetMismatch) {
+		t.Errorf("expected offset mismatch for a gap, got %v", err)
+	}
+	if _, err := cloud.UploadSessionService.PutChunk(ctx, session.ID, 0, strings.NewReader("hello")); err != nil {
+		t.Fatalf("failed to put chunk: %v", err)
+	}
+
+	other := sha256.Sum256([]byte("other"))
+	err = cloud.UploadSessionService.Finalize(ctx, session.ID, hex.EncodeToString(other[:]))
+	if !errors.Is(err, services.ErrChecksumMismatch) {
+		t.Fatalf("expected checksum mismatch, got %v", err)
+	}
+
+	if obj, _ := cloud.ObjectRepo.FindByVideoUID(ctx, "p1", "db1", "v1"); obj != nil {
+		t.Error("no object should be recorded for mismatching content")
+	}
+	blobs, _ := cloud.BlobStore.List(ctx, "")
+	if len(blobs) != 0 {
+		t.Errorf("staged chunks and content should be cleaned up, found %d blobs", len(blobs))
+	}
+}
@@ -0,0 +1,118 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/media-vault-sync/internal/adapters/mediavault"
+	"github.com/media-vault-sync/internal/adapters/queue/memory"
+	cloudapp "github.com/media-vault-sync/internal/app/cloud"
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+type recordingVideoSender struct {
+	sent []string
+}
+
+func (s *recordingVideoSender) SendVideo(ctx context.Context, databaseID, albumUID, videoUID string, body io.Reader) error {
+	s.sent = append(s.sent, videoUID)
+	return nil
+}
+
+func TestSelectiveCMove_ManifestChangeMovesOnlyAddedVideos(t *testing.T) {
+	ctx := context.Background()
+	clock := services.NewFakeClock(time.Now())
+	queue := memory.NewInMemoryQueue(clock)
+
+	cloud := cloudapp.Wire(cloudapp.Config{}, &cloudapp.WireOptions{Clock: clock, Queue: queue})
+
+	var payloads []services.VideoUploadPayload
+	queue.Subscribe(ctx, "onprem:p1:videoupload", "videoupload", "p1", func(ctx context.Context, msg services.Message) error {
+		var payload services.VideoUploadPayload
+		json.Unmarshal(msg.Payload, &payload)
+		payloads = append(payloads, payload)
+		return nil
+	})
+
+	upload := func(videoUIDs ...string) []services.VideoUploadPayload {
+		t.Helper()
+		payloads = nil
+		service := services.NewAlbumManifestUploadService(cloud.AlbumRepo, cloud.AlbumVideoRepo, cloud.ManifestRevisionRepo, cloud.ObjectRepo, cloud.Transactor, queue, clock)
+		if err := service.ProcessAlbumManifestUpload(ctx, services.AlbumManifestUploadRequest{
+			ProviderID: "p1",
+			DatabaseID: "db1",
+			UserID:     "user1",
+			AlbumUID:   "album1",
+			VideoUIDs:  videoUIDs,
+		}); err != nil {
+			t.Fatalf("manifest upload failed: %v", err)
+		}
+		queue.Process(ctx)
+		return payloads
+	}
+
+	if got := upload("v1", "v2"); len(got) != 1 || len(got[0].VideoUIDs) != 0 {
+		t.Errorf("a new album should move the whole album, got %+v", got)
+	}
+
+	got := upload("v1", "v2", "v3", "v4")
+	if len(got) != 1 || strings.Join(got[0].VideoUIDs, ",") != "v3,v4" {
+		t.Errorf("expected only v3 and v4 to be moved, got %+v", got)
+	}
+
+	if got := upload("v1", "v3", "v4"); len(got) != 0 {
+		t.Errorf("removing a video moves nothing, got %+v", got)
+	}
+
+	got = upload("v2", "v3", "v4", "v5")
+	if len(got) != 1 || strings.Join(got[0].VideoUIDs, ",") != "v2,v5" {
+		t.Errorf("expected v2 and v5 to be moved, got %+v", got)
+	}
+}
+
+func TestSelectiveCMove_ConsumerSendsOnlyListedVideos(t *testing.T) {
+	ctx := context.Background()
+
+	configPath := filepath.Join(t.TempDir(), "mediavault_config.json")
+	data, _ := json.Marshal(mediavault.Config{
+		Providers: []mediavault.ProviderConfig{{
+			ProviderID: "p1",
+			Databases: []mediavault.DatabaseConfig{{
+				DatabaseID: "db1",
+				Users: []mediavault.UserConfig{{
+					UserID: "user1",
+					Albums: []mediavault.AlbumConfig{{AlbumUID: "album1", Videos: []string{"v1", "v2", "v3"}}},
+				}},
+			}},
+		}},
+	})
+	os.WriteFile(configPath, data, 0644)
+
+	sender := &recordingVideoSender{}
+	consumer := services.NewVideoUploadConsumer(mediavault.NewFileSystemMediaVaultRegistry(configPath, sender))
+
+	handle := func(payload services.VideoUploadPayload) []string {
+		t.Helper()
+		sender.sent = nil
+		raw, _ := json.Marshal(payload)
+		if err := consumer.Handle(ctx, services.Message{Topic: "videoupload", Payload: raw}); err != nil {
+			t.Fatalf("videoupload failed: %v", err)
+		}
+		return sender.sent
+	}
+
+	if sent := handle(services.VideoUploadPayload{DatabaseID: "db1", AlbumUID: "album1"}); strings.Join(sent, ",") != "v1,v2,v3" {
+		t.Errorf("a payload without videos moves the whole album, sent %v", sent)
+	}
+
+	sent := handle(services.VideoUploadPayload{DatabaseID: "db1", AlbumUID: "album1", VideoUIDs: []string{"v3", "gone"}})
+	if strings.Join(sent, ",") != "v3" {
+		t.Errorf("expected only v3, videos no longer in the album are skipped; sent %v", sent)
+	}
+}
@@ -0,0 +1,131 @@
+package tests
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/media-vault-sync/internal/adapters/http/cloud"
+	"github.com/media-vault-sync/internal/adapters/http/onprem"
+	"github.com/media-vault-sync/internal/adapters/mediavault"
+	"github.com/media-vault-sync/internal/adapters/queue/memory"
+	memoryrepo "github.com/media-vault-sync/internal/adapters/repo/memory"
+	"github.com/media-vault-sync/internal/adapters/storage/fs"
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+func TestStreamedVideoUpload_StoredContentMatchesSource(t *testing.T) {
+	ctx := context.Background()
+	clock := services.NewFakeClock(time.Now())
+
+	tmpDir := t.TempDir()
+	stagingPath := filepath.Join(tmpDir, "staging")
+
+	queue := memory.NewInMemoryQueue(clock)
+	albumRepo := memoryrepo.NewAlbumRepository()
+	albumVideoRepo := memoryrepo.NewAlbumVideoRepository()
+	videoRepo := memoryrepo.NewVideoRepository()
+	objectRepo := memoryrepo.NewObjectRepository()
+	blobStore := fs.NewBlobStore(filepath.Join(tmpDir, "blobs"))
+
+	albumManifestUploadService := services.NewAlbumManifestUploadService(albumRepo, albumVideoRepo, memoryrepo.NewManifestRevisionRepository(), objectRepo, memoryrepo.NewTransactor(), queue, clock)
+	if err := albumManifestUploadService.ProcessAlbumManifestUpload(ctx, services.AlbumManifestUploadRequest{
+		ProviderID: "p1",
+		DatabaseID: "db1",
+		UserID:     "user1",
+		AlbumUID:   "album1",
+		VideoUIDs:  []string{"v1"},
+	}); err != nil {
+		t.Fatalf("failed to upload manifest: %v", err)
+	}
+
+	videoUploadService := services.NewVideoUploadService(albumRepo, albumVideoRepo, videoRepo, objectRepo, blobStore, clock)
+	cloudMux := http.NewServeMux()
+	cloudMux.Handle("/v1/album/", cloud.NewVideoUploadHandler(videoUploadService))
+	cloudServer := httptest.NewServer(cloudMux)
+	defer cloudServer.Close()
+
+	cloudClient := onprem.NewHTTPCloudClient(cloudServer.URL, nil)
+	stagingStorage := fs.NewStagingStorage(stagingPath)
+	configPath := filepath.Join(tmpDir, "mediavault_config.json")
+	mediaVaultConfig := mediavault.Config{
+		Providers: []mediavault.ProviderConfig{
+			{
+				ProviderID: "p1",
+				Databases: []mediavault.DatabaseConfig{
+					{
+						DatabaseID: "db1",
+						Users: []mediavault.UserConfig{
+							{
+								UserID: "user1",
+								Albums: []mediavault.AlbumConfig{
+									{AlbumUID: "album1", Videos: []string{"v1"}},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	data, _ := json.Marshal(mediaVaultConfig)
+	os.WriteFile(configPath, data, 0644)
+	mediaVaultRegistry := mediavault.NewFileSystemMediaVaultRegistry(configPath, nil)
+
+	receiverServer := httptest.NewServer(onprem.NewVideoReceiver(stagingStorage, cloudClient, mediaVaultRegistry))
+	defer receiverServer.Close()
+
+	// 8MB of deterministic data, hashed on the side as it is sent
+	const size = 8 * 1024 * 1024
+	hasher := sha256.New()
+	body := io.TeeReader(io.LimitReader(rand.New(rand.NewSource(1)), size), hasher)
+
+	sender := onprem.NewHTTPVideoSender(receiverServer.URL, "p1", nil)
+	if err := sender.SendVideo(ctx, "db1", "album1", "v1", body); err != nil {
+		t.Fatalf("failed to send video: %v", err)
+	}
+
+	obj, err := objectRepo.FindByVideoUID(ctx, "p1", "db1", "v1")
+	if err != nil {
+		t.Fatalf("failed to find object: %v", err)
+	}
+	if obj == nil {
+		t.Fatal("object for v1 should exist")
+	}
+	if obj.SizeBytes != size {
+		t.Errorf("expected size %d, got %d", size, obj.SizeBytes)
+	}
+	if want := hex.EncodeToString(hasher.Sum(nil)); obj.Checksum != want {
+		t.Errorf("expected checksum %s, got %s", want, obj.Checksum)
+	}
+
+	stored, err := blobStore.Get(ctx, obj.StorageKey)
+	if err != nil {
+		t.Fatalf("video content should be stored under %s: %v", obj.StorageKey, err)
+	}
+	storedHasher := sha256.New()
+	io.Copy(storedHasher, stored)
+	stored.Close()
+	if got := hex.EncodeToString(storedHasher.Sum(nil)); got != obj.Checksum {
+		t.Errorf("stored content checksum %s does not match object checksum %s", got, obj.Checksum)
+	}
+
+	blobs, _ := blobStore.List(ctx, "")
+	if len(blobs) != 1 {
+		t.Errorf("expected exactly one blob without leftover temp files, got %d", len(blobs))
+	}
+
+	entries, _ := os.ReadDir(filepath.Join(stagingPath, "p1", "db1", "album1"))
+	if len(entries) != 0 {
+		t.Errorf("expected staging to be cleaned up, found %d files", len(entries))
+	}
+}
@@ -0,0 +1,161 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/media-vault-sync/internal/adapters/http/onprem"
+	"github.com/media-vault-sync/internal/adapters/queue/memory"
+	memoryrepo "github.com/media-vault-sync/internal/adapters/repo/memory"
+	cloudapp "github.com/media-vault-sync/internal/app/cloud"
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+type unitOfWorkKey struct{}
+
+// markingTransactor tags the ctx of each unit of work so repositories can
+// tell whether a write joined one.
+type markingTransactor struct {
+	units int
+}
+
+func (t *markingTransactor) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	t.units++
+	return fn(context.WithValue(ctx, unitOfWorkKey{}, t.units))
+}
+
+type unitCheckingOutbox struct {
+	*memoryrepo.OutboxRepository
+	outsideUnit int
+}
+
+func (r *unitCheckingOutbox) Add(ctx context.Context, msg *services.OutboxMessage) error {
+	if ctx.Value(unitOfWorkKey{}) == nil {
+		r.outsideUnit++
+	}
+	return r.OutboxRepository.Add(ctx, msg)
+}
+
+// flakyPublishQueue fails the next failures publishes.
+type flakyPublishQueue struct {
+	*memory.InMemoryQueue
+	failures int
+}
+
+func (q *flakyPublishQueue) Publish(ctx context.Context, msg services.Message) error {
+	if q.failures > 0 {
+		q.failures--
+		return errors.New("queue unavailable")
+	}
+	return q.InMemoryQueue.Publish(ctx, msg)
+}
+
+func TestTransactionalOutbox_ManifestChangesPublishThroughTheRelay(t *testing.T) {
+	ctx := context.Background()
+	clock := services.NewFakeClock(time.Now())
+	queue := memory.NewInMemoryQueue(clock)
+	transactor := &markingTransactor{}
+	outbox := &unitCheckingOutbox{OutboxRepository: memoryrepo.NewOutboxRepository()}
+
+	cloud := cloudapp.Wire(cloudapp.Config{}, &cloudapp.WireOptions{
+		Clock:      clock,
+		Queue:      queue,
+		Transactor: transactor,
+		OutboxRepo: outbox,
+	})
+	server := httptest.NewServer(cloud.Handler)
+	defer server.Close()
+	client := onprem.NewHTTPCloudClient(server.URL, nil)
+
+	var videoUploads []services.Message
+	queue.Subscribe(ctx, "onprem:p1:videoupload", "videoupload", "p1", func(ctx context.Context, msg services.Message) error {
+		videoUploads = append(videoUploads, msg)
+		return nil
+	})
+
+	for _, videoUIDs := range [][]string{{"v1"}, {"v1", "v2"}} {
+		if err := client.PostAlbumManifestUpload(ctx, services.AlbumManifestUploadRequest{
+			ProviderID: "p1",
+			DatabaseID: "db1",
+			UserID:     "user1",
+			AlbumUID:   "album1",
+			VideoUIDs:  videoUIDs,
+		}); err != nil {
+			t.Fatalf("failed to upload manifest: %v", err)
+		}
+	}
+
+	if transactor.units != 2 {
+		t.Errorf("expected each manifest upload to run as one unit of work, got %d", transactor.units)
+	}
+	if outbox.outsideUnit != 0 {
+		t.Errorf("%d outbox writes did not join the unit of work", outbox.outsideUnit)
+	}
+
+	queue.Process(ctx)
+	if len(videoUploads) != 0 {
+		t.Fatalf("messages must wait in the outbox for the relay, got %d delivered", len(videoUploads))
+	}
+
+	relayed, err := cloud.OutboxRelay.Relay(ctx)
+	if err != nil || relayed != 2 {
+		t.Fatalf("expected 2 messages relayed, got %d (%v)", relayed, err)
+	}
+	queue.Process(ctx)
+	if len(videoUploads) != 2 {
+		t.Fatalf("expected both videouploads delivered, got %d", len(videoUploads))
+	}
+	if pending, _ := outbox.ListPending(ctx, 0); len(pending) != 0 {
+		t.Errorf("relayed messages should leave the outbox, %d left", len(pending))
+	}
+	if relayed, _ := cloud.OutboxRelay.Relay(ctx); relayed != 0 {
+		t.Errorf("nothing is left to relay, got %d", relayed)
+	}
+}
+
+func TestTransactionalOutbox_RelayKeepsMessagesItCouldNotPublish(t *testing.T) {
+	ctx := context.Background()
+	clock := services.NewFakeClock(time.Now())
+	queue := &flakyPublishQueue{InMemoryQueue: memory.NewInMemoryQueue(clock)}
+	outbox := memoryrepo.NewOutboxRepository()
+	publisher := services.NewOutboxPublisher(outbox, queue, clock)
+	relay := services.NewOutboxRelay(outbox, queue, memoryrepo.NewTransactor())
+
+	var delivered []string
+	publisher.Subscribe(ctx, "sub", "topic", "", func(ctx context.Context, msg services.Message) error {
+		delivered = append(delivered, msg.MessageID)
+		return nil
+	})
+	for _, id := range []string{"m1", "m2", "m3"} {
+		publisher.Publish(ctx, services.Message{MessageID: id, Topic: "topic"})
+	}
+
+	relay.Relay(ctx)
+	queue.Process(ctx)
+	if len(delivered) != 3 {
+		t.Fatalf("expected all three delivered, got %v", delivered)
+	}
+
+	delivered = nil
+	publisher.Publish(ctx, services.Message{MessageID: "m4", Topic: "topic"})
+	publisher.Publish(ctx, services.Message{MessageID: "m5", Topic: "topic"})
+	queue.failures = 1
+	relayed, err := relay.Relay(ctx)
+	if err == nil || relayed != 0 {
+		t.Fatalf("expected the failed publish reported and nothing relayed, got %d (%v)", relayed, err)
+	}
+	if pending, _ := outbox.ListPending(ctx, 0); len(pending) != 2 {
+		t.Fatalf("unpublished messages must stay in the outbox, got %d", len(pending))
+	}
+
+	if relayed, err := relay.Relay(ctx); err != nil || relayed != 2 {
+		t.Fatalf("expected both relayed on the next run, got %d (%v)", relayed, err)
+	}
+	queue.Process(ctx)
+	if len(delivered) != 2 || delivered[0] != "m4" || delivered[1] != "m5" {
+		t.Errorf("expected m4 then m5, got %v", delivered)
+	}
+}
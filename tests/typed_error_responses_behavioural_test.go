@@ -0,0 +1,164 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/media-vault-sync/internal/adapters/http/cloud"
+	"github.com/media-vault-sync/internal/adapters/http/onprem"
+	cloudapp "github.com/media-vault-sync/internal/app/cloud"
+	"github.com/media-vault-sync/internal/core/services"
+)
+
+func TestTypedErrorResponses_ClientMapsBodiesToSentinels(t *testing.T) {
+	ctx := context.Background()
+	clock := services.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	app := cloudapp.Wire(cloudapp.Config{IdempotencyTTL: time.Hour}, &cloudapp.WireOptions{Clock: clock})
+	server := httptest.NewServer(app.Handler)
+	defer server.Close()
+	client := onprem.NewHTTPCloudClient(server.URL, nil)
+
+	post := func(path, key, body string) (*http.Response, services.APIError) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, server.URL+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set(cloud.IdempotencyKeyHeader, key)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var apiErr services.APIError
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		return resp, apiErr
+	}
+	manifest := func(userID string, videoUIDs ...string) error {
+		return client.PostAlbumManifestUpload(ctx, services.AlbumManifestUploadRequest{
+			ProviderID: "p1",
+			DatabaseID: "db1",
+			UserID:     userID,
+			AlbumUID:   "album1",
+			VideoUIDs:  videoUIDs,
+		})
+	}
+
+	t.Run("errors are answered with a code, message and retryable flag", func(t *testing.T) {
+		resp, apiErr := post("/v1/albummanifestupload", "", "{")
+		if resp.StatusCode != http.StatusBadRequest || resp.Header.Get("Content-Type") != "application/json" {
+			t.Fatalf("expected a JSON 400, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+		if apiErr.Code != services.ErrorCodeInvalidRequest || apiErr.Message != "invalid request body" || apiErr.Retryable {
+			t.Errorf("expected a non-retryable invalid_request, got %+v", apiErr)
+		}
+
+		if _, err := app.IdempotencyService.Begin(ctx, "POST /v1/useralbums", "key-1"); err != nil {
+			t.Fatalf("begin failed: %v", err)
+		}
+		resp, apiErr = post("/v1/useralbums", "key-1", `{"providerID":"p1","databaseID":"db1","userID":"user1","albumUIDs":["album1"]}`)
+		if resp.StatusCode != http.StatusConflict || apiErr.Code != "idempotency_key_in_use" || !apiErr.Retryable {
+			t.Errorf("a key still in progress is worth retrying, got %d %+v", resp.StatusCode, apiErr)
+		}
+	})
+
+	t.Run("an album of another user is a permanent user mismatch", func(t *testing.T) {
+		if err := manifest("user1", "v1"); err != nil {
+			t.Fatalf("failed to upload manifest: %v", err)
+		}
+		err := manifest("user2", "v1")
+		if !errors.Is(err, services.ErrUserIDMismatch) || services.IsRetryable(err) {
+			t.Errorf("expected a non-retryable ErrUserIDMismatch, got %v", err)
+		}
+	})
+
+	t.Run("a video missing from the manifest is a permanent rejection", func(t *testing.T) {
+		err := client.PostVideoUpload(ctx, services.VideoUploadRequest{
+			ProviderID: "p1",
+			DatabaseID: "db1",
+			UserID:     "user1",
+			AlbumUID:   "album1",
+			VideoUID:   "v2",
+			Body:       strings.NewReader("content of v2"),
+		})
+		if !errors.Is(err, services.ErrVideoNotInManifest) || services.IsRetryable(err) {
+			t.Errorf("expected a non-retryable ErrVideoNotInManifest, got %v", err)
+		}
+	})
+
+	t.Run("server errors keep their details out of the response", func(t *testing.T) {
+		broken := cloudapp.Wire(cloudapp.Config{}, &cloudapp.WireOptions{Clock: clock, BlobStore: failingBlobStore{}})
+		brokenServer := httptest.NewServer(broken.Handler)
+		defer brokenServer.Close()
+		brokenClient := onprem.NewHTTPCloudClient(brokenServer.URL, nil)
+
+		if err := brokenClient.PostAlbumManifestUpload(ctx, services.AlbumManifestUploadRequest{
+			ProviderID: "p1",
+			DatabaseID: "db1",
+			UserID:     "user1",
+			AlbumUID:   "album1",
+			VideoUIDs:  []string{"v1"},
+		}); err != nil {
+			t.Fatalf("failed to upload manifest: %v", err)
+		}
+		err := brokenClient.PostVideoUpload(ctx, services.VideoUploadRequest{
+			ProviderID: "p1",
+			DatabaseID: "db1",
+			UserID:     "user1",
+			AlbumUID:   "album1",
+			VideoUID:   "v1",
+			Body:       strings.NewReader("content of v1"),
+		})
+
+		var apiErr *services.APIError
+		if !errors.As(err, &apiErr) || apiErr.Code != services.ErrorCodeInternal || !apiErr.Retryable {
+			t.Fatalf("expected a retryable internal error, got %v", err)
+		}
+		if strings.Contains(apiErr.Message, "/var/lib/blobs") {
+			t.Errorf("expected the storage details kept out of the message, got %q", apiErr.Message)
+		}
+	})
+
+	t.Run("the retryable flag decides for codes the client does not know", func(t *testing.T) {
+		status, body := http.StatusServiceUnavailable, `{"code":"maintenance","message":"back soon","retryable":true}`
+		stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			w.Write([]byte(body))
+		}))
+		defer stub.Close()
+		stubClient := onprem.NewHTTPCloudClient(stub.URL, nil)
+		userAlbums := services.UserAlbumsRequest{ProviderID: "p1", DatabaseID: "db1", UserID: "user1", AlbumUIDs: []string{"album1"}}
+
+		err := stubClient.PostUserAlbums(ctx, userAlbums)
+		if err == nil || err.Error() != "back soon" || !services.IsRetryable(err) {
+			t.Errorf("expected a retryable error with the message, got %v", err)
+		}
+
+		status, body = http.StatusForbidden, `{"code":"provider_disabled","message":"provider disabled","retryable":false}`
+		if err := stubClient.PostUserAlbums(ctx, userAlbums); services.IsRetryable(err) {
+			t.Errorf("expected a permanent failure, got %v", err)
+		}
+
+		status, body = http.StatusBadGateway, "bad gateway"
+		if err := stubClient.PostUserAlbums(ctx, userAlbums); err == nil || !services.IsRetryable(err) || !strings.Contains(err.Error(), "502") {
+			t.Errorf("a body that is no API error leaves the status, got %v", err)
+		}
+	})
+}
+
+// failingBlobStore fails every write with an error naming its disk.
+type failingBlobStore struct {
+	services.BlobStore
+}
+
+func (failingBlobStore) Put(ctx context.Context, key string, r io.Reader) (int64, error) {
+	return 0, errors.New("writing /var/lib/blobs/" + key + ": no space left on device")
+}
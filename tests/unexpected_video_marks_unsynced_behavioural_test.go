@@ -17,6 +17,7 @@ import (
 	"github.com/media-vault-sync/internal/adapters/queue/memory"
 	memoryrepo "github.com/media-vault-sync/internal/adapters/repo/memory"
 	"github.com/media-vault-sync/internal/adapters/storage/fs"
+	memorystorage "github.com/media-vault-sync/internal/adapters/storage/memory"
 	"github.com/media-vault-sync/internal/core/services"
 )
 
@@ -60,14 +61,15 @@ func TestUnexpectedVideo_MarksUnsynced(t *testing.T) {
 	albumVideoRepo := memoryrepo.NewAlbumVideoRepository()
 	videoRepo := memoryrepo.NewVideoRepository()
 	objectRepo := memoryrepo.NewObjectRepository()
+	blobStore := memorystorage.NewBlobStore()
 
 	userAlbumsService := services.NewUserAlbumsService(albumRepo, queue)
 	userAlbumsHandler := cloud.NewUserAlbumsHandler(userAlbumsService)
 
-	albumManifestUploadService := services.NewAlbumManifestUploadService(albumRepo, albumVideoRepo, queue, clock)
+	albumManifestUploadService := services.NewAlbumManifestUploadService(albumRepo, albumVideoRepo, memoryrepo.NewManifestRevisionRepository(), objectRepo, memoryrepo.NewTransactor(), queue, clock)
 	albumManifestUploadHandler := cloud.NewAlbumManifestUploadHandler(albumManifestUploadService)
 
-	videoUploadService := services.NewVideoUploadService(albumRepo, albumVideoRepo, videoRepo, objectRepo, clock)
+	videoUploadService := services.NewVideoUploadService(albumRepo, albumVideoRepo, videoRepo, objectRepo, blobStore, clock)
 	videoUploadHandler := cloud.NewVideoUploadHandler(videoUploadService)
 
 	cloudMux := http.NewServeMux()
@@ -87,7 +89,7 @@ func TestUnexpectedVideo_MarksUnsynced(t *testing.T) {
 	mediaVaultRegistryProxy := &mediaVaultRegistryProxyForReceiver{
 		getRegistry: func() services.MediaVaultRegistry { return mediaVaultRegistry },
 	}
-	onpremReceiver := onprem.NewVideoReceiver(stagingStorage, cloudClient, mediaVaultRegistryProxy, 1)
+	onpremReceiver := onprem.NewVideoReceiver(stagingStorage, cloudClient, mediaVaultRegistryProxy)
 	onpremMux.Handle("/receive-video", onpremReceiver)
 	onpremReceiverServer = httptest.NewServer(onpremMux)
 	defer onpremReceiverServer.Close()
@@ -95,8 +97,8 @@ func TestUnexpectedVideo_MarksUnsynced(t *testing.T) {
 	videoSender := onprem.NewHTTPVideoSender(onpremReceiverServer.URL, "p1", nil)
 	mediaVaultRegistry = mediavault.NewFileSystemMediaVaultRegistry(configPath, videoSender)
 
-	syncUserConsumer := services.NewSyncUserConsumer("p1", mediaVaultRegistry, cloudClient, 1)
-	albumManifestUploadConsumer := services.NewAlbumManifestUploadConsumer("p1", mediaVaultRegistry, cloudClient, 1)
+	syncUserConsumer := services.NewSyncUserConsumer("p1", mediaVaultRegistry, cloudClient)
+	albumManifestUploadConsumer := services.NewAlbumManifestUploadConsumer("p1", mediaVaultRegistry, cloudClient)
 
 	var albumManifestUploadProcessed int32
 	wrappedAlbumManifestUploadConsumer := func(ctx context.Context, msg services.Message) error {
@@ -65,7 +65,7 @@ func TestUserSync_NewAlbumsOnly(t *testing.T) {
 
 	cloudClient := onprem.NewHTTPCloudClient(cloudServer.URL, nil)
 	mediaVaultRegistry := mediavault.NewFileSystemMediaVaultRegistry(configPath, nil)
-	syncUserConsumer := services.NewSyncUserConsumer("p1", mediaVaultRegistry, cloudClient, 1)
+	syncUserConsumer := services.NewSyncUserConsumer("p1", mediaVaultRegistry, cloudClient)
 
 	queue.Subscribe(ctx, "onprem:p1", "usersync", "p1", syncUserConsumer.Handle)
 
@@ -184,7 +184,7 @@ func TestUserSync_OnlyMatchingProviderReceives(t *testing.T) {
 
 	cloudClient := onprem.NewHTTPCloudClient(cloudServer.URL, nil)
 	mediaVaultRegistry := mediavault.NewFileSystemMediaVaultRegistry(configPath, nil)
-	syncUserConsumer := services.NewSyncUserConsumer("p1", mediaVaultRegistry, cloudClient, 1)
+	syncUserConsumer := services.NewSyncUserConsumer("p1", mediaVaultRegistry, cloudClient)
 
 	var p1Received int
 	queue.Subscribe(ctx, "onprem:p1", "usersync", "p1", func(ctx context.Context, msg services.Message) error {